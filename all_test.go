@@ -1,11 +1,14 @@
 package ngorm
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"testing"
 
 	_ "github.com/lib/pq"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/scope"
 	_ "github.com/ngorm/postgres"
 	_ "github.com/ngorm/ql"
 )
@@ -67,9 +70,15 @@ func (q *pgWrap) Close() error {
 }
 
 func (q *pgWrap) Clear(tables ...interface{}) error {
-	_, err := q.DB.DropTable(tables...)
-	if err != nil {
-		return err
+	// The tables are dropped with the constraints referencing them, in any
+	// order.
+	for _, table := range tables {
+		e := q.DB.NewEngine()
+		_, err := q.DB.exec(fmt.Sprintf("DROP TABLE IF EXISTS %s CASCADE", scope.QuotedTableName(e, table)))
+		engine.Put(e)
+		if err != nil {
+			return err
+		}
 	}
 	return q.Close()
 }
@@ -0,0 +1,153 @@
+package ngorm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ngorm/ngorm/builder"
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+	"github.com/ngorm/ngorm/util"
+)
+
+//ArchiveTable returns the name of the table Archive moves the rows of table to.
+func ArchiveTable(table string) string {
+	return table + "_archive"
+}
+
+//Archive moves the rows of the table of value matching where into the archive
+//table, named after the table with the _archive suffix, and returns the number
+//of moved rows. The archive table is created when it doesn't exist, and
+//columns added to the model are added to it.
+//
+//    n, err := db.Archive(&Order{}, "created_at < ?", time.Now().AddDate(-1, 0, 0))
+//
+// Rows are copied and deleted in a single transaction, or in the transaction
+// of db when there is one. Like Delete, Archive refuses to run without
+// conditions. Soft deleted rows are archived too.
+func (db *DB) Archive(value interface{}, where ...interface{}) (int64, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	e.Scope.ContextValue(value)
+	search.Inline(e, where...)
+	e.Search.Unscoped = true
+	if !scope.HasConditions(e, value) {
+		return 0, errors.New("ngorm: missing WHERE clause while archiving")
+	}
+	table := scope.TableName(e, value)
+	archive := ArchiveTable(table)
+	if err := db.migrateArchive(value, archive); err != nil {
+		return 0, err
+	}
+	m, err := scope.GetModelStruct(e, value)
+	if err != nil {
+		return 0, err
+	}
+	var columns []string
+	for _, f := range m.StructFields {
+		if f.IsNormal {
+			columns = append(columns, scope.Quote(e, f.DBName))
+		}
+	}
+	cond, err := builder.CombinedCondition(e, value)
+	if err != nil {
+		return 0, err
+	}
+	cols := strings.Join(columns, ", ")
+	copySQL := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s%s",
+		scope.Quote(e, archive), cols, cols, scope.QuotedTableName(e, value),
+		util.AddExtraSpaceIfExist(cond))
+	deleteSQL := fmt.Sprintf("DELETE FROM %s%s",
+		scope.QuotedTableName(e, value), util.AddExtraSpaceIfExist(cond))
+
+	tx := db
+	if db.tx == nil {
+		tx, err = db.BeginTx()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := tx.moveRows(copySQL, deleteSQL, e.Scope.SQLVars)
+	if tx == db {
+		return n, err
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// moveRows executes the statements copying and deleting the archived rows,
+// the number of copied rows must match the number of deleted ones.
+func (db *DB) moveRows(copySQL, deleteSQL string, args []interface{}) (int64, error) {
+	r, err := db.ExecTx(copySQL, args...)
+	if err != nil {
+		return 0, err
+	}
+	copied, err := r.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	r, err = db.ExecTx(deleteSQL, args...)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := r.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if copied != deleted {
+		return 0, fmt.Errorf("ngorm: archived %d rows but deleted %d, the rows changed while archiving", copied, deleted)
+	}
+	return deleted, nil
+}
+
+// migrateArchive creates the archive table of value, or adds the columns
+// missing from it. Indexes and join tables of the model are not created.
+func (db *DB) migrateArchive(value interface{}, archive string) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	search.Table(e, archive)
+	var stmts []string
+	if !e.Dialect.HasTable(archive) {
+		err := scope.CreateTable(e, value)
+		if err != nil {
+			return err
+		}
+		stmts = append(stmts, e.Scope.SQL)
+	} else {
+		m, err := scope.GetModelStruct(e, value)
+		if err != nil {
+			return err
+		}
+		for _, f := range m.StructFields {
+			if !f.IsNormal || e.Dialect.HasColumn(archive, f.DBName) {
+				continue
+			}
+			typ, err := dialects.DataTypeOf(e.Dialect, f)
+			if err != nil {
+				return err
+			}
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD %s %s",
+				scope.Quote(e, archive), scope.Quote(e, f.DBName), typ))
+		}
+	}
+	return db.execDDL(stmts...)
+}
+
+// execDDL executes the schema statements stmts one at a time.
+func (db *DB) execDDL(stmts ...string) error {
+	for _, q := range stmts {
+		if isQL(db) && db.tx == nil {
+			q = util.WrapTX(q)
+		}
+		if _, err := db.ExecTx(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package ngorm
+
+import "testing"
+
+type ArchiveItem struct {
+	ID   int64
+	Name string
+	Age  int
+}
+
+func TestDB_Archive(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBArchive, &ArchiveItem{})
+	}
+}
+
+func testDBArchive(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&ArchiveItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []ArchiveItem{{Name: "a", Age: 10}, {Name: "b", Age: 20}, {Name: "c", Age: 30}} {
+		err = db.Create(&v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Archive(&ArchiveItem{})
+	if err == nil {
+		t.Error("expected an error")
+	}
+	n, err := db.Archive(&ArchiveItem{}, "age < ?", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 got %d", n)
+	}
+	n, err = db.Archive(&ArchiveItem{}, "name = ?", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 got %d", n)
+	}
+	var count int64
+	err = db.Model(&ArchiveItem{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected 0 got %d", count)
+	}
+	var names []string
+	err = db.Table(ArchiveTable("archive_items")).Order("name").Pluck("name", &names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 || names[0] != "a" || names[2] != "c" {
+		t.Errorf("expected [a b c] got %v", names)
+	}
+}
@@ -3,10 +3,13 @@ package ngorm
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/hooks"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/scope"
-	"github.com/ngorm/ngorm/util"
+	"github.com/ngorm/ngorm/search"
 )
 
 // Association provides utility functions for dealing with association queries
@@ -33,6 +36,10 @@ func (a *Association) Append(values ...interface{}) error {
 // Save save passed values as associations. This expects to have a single value
 // for a has_one, belongs_to relationships. You can pass one or more values for
 // many_to_many relationship.
+//
+// The values of has_many and many_to_many associations are created and linked
+// to the model, which is left unchanged in the database, and appended to its
+// field.
 func (a *Association) Save(values ...interface{}) error {
 	if len(values) > 0 {
 		e := a.db.e
@@ -69,81 +76,340 @@ func (a *Association) Save(values ...interface{}) error {
 			}
 			return a.db.Begin().Save(vp.Interface())
 		}
-		v = reflect.MakeSlice(field.Struct.Type, 0, 0)
-		if v.Kind() == reflect.Ptr {
-			v = v.Elem()
+		if rel.Kind == "belongs_to" {
+			if len(values) > 1 {
+				return fmt.Errorf("relation %s expect one struct value got %d", rel.Kind, len(values))
+			}
+			ov := reflect.ValueOf(values[0])
+			if field.Field.Kind() != reflect.Ptr && ov.Kind() == reflect.Ptr {
+				ov = ov.Elem()
+			}
+			field.Field.Set(ov)
+			return a.db.Begin().Save(e.Scope.Value)
 		}
+		current := reflect.ValueOf(field.Field.Interface())
+		v = reflect.MakeSlice(field.Struct.Type, 0, 0)
 		for _, value := range values {
 			fv := reflect.ValueOf(value)
-			if fv.Kind() == reflect.Ptr {
+			if fv.Kind() == reflect.Ptr && v.Type().Elem().Kind() != reflect.Ptr {
 				fv = fv.Elem()
 			}
 			v = reflect.Append(v, fv)
 		}
+
+		// Only the new values are saved and linked, the model itself isn't
+		// updated.
+		ne := e.Clone()
+		defer engine.Put(ne)
+		ne.Scope.ContextValue(e.Scope.Value)
+		search.Select(ne, a.column)
 		field.Field.Set(v)
-		return a.db.Begin().Save(e.Scope.Value)
+		if err := hooks.AfterAssociation(ne); err != nil {
+			return err
+		}
+		// The values given as pointers get their primary keys.
+		for i, value := range values {
+			fv := reflect.ValueOf(value)
+			if fv.Kind() == reflect.Ptr && v.Index(i).Kind() != reflect.Ptr {
+				fv.Elem().Set(v.Index(i))
+			}
+		}
+		field.Field.Set(reflect.AppendSlice(current, v))
+		return nil
 	}
 	return nil
 }
 
-func isZero(v reflect.Value) bool {
-	return v.Interface() == reflect.Zero(v.Type()).Interface()
+//Replace replaces the current associations with values, which are saved like
+//with Append. The records which are no longer associated aren't deleted, see
+//Delete.
+//
+// Saving values and unlinking the old associations happen in a single
+// transaction, or in the transaction of the model's *DB when there is one, so
+// a failure leaves the associations as they were. The field of the model is
+// restored too.
+func (a *Association) Replace(values ...interface{}) error {
+	return a.inTx(func(ta *Association) error {
+		err := ta.Save(values...)
+		if err != nil {
+			return err
+		}
+		if ta.field.Relationship.Kind == "belongs_to" {
+			// Saving the new value already replaced the foreign key.
+			return nil
+		}
+		return ta.unlink(values, true)
+	})
 }
 
-// Count return the count of current associations
-func (a *Association) Count() (int, error) {
+// inTx calls fn with a copy of a operating in a transaction, or with a when a
+// is already in one. The field of the association is restored when fn fails.
+func (a *Association) inTx(fn func(*Association) error) error {
+	old := reflect.ValueOf(a.field.Field.Interface())
+	restore := func(err error) error {
+		a.field.Field.Set(old)
+		return err
+	}
+	if a.db.tx != nil {
+		if err := fn(a); err != nil {
+			return restore(err)
+		}
+		return nil
+	}
+	tx, err := a.db.BeginTx()
+	if err != nil {
+		return err
+	}
+	source := a.db.e.Scope.Value
+	tx.e.Scope.ContextValue(source)
+	tx.e.Scope.Set(model.AssociationSource, source)
+	err = fn(&Association{db: tx, column: a.column, field: a.field})
+	if err != nil {
+		_ = tx.Rollback()
+		return restore(err)
+	}
+	if err = tx.Commit(); err != nil {
+		return restore(err)
+	}
+	return nil
+}
+
+//Delete removes values from the associations of the model. Only the links are
+//removed, the records themselves aren't deleted: the foreign keys of has_one
+//and has_many associations are set to NULL, the rows of the join table of
+//many_to_many associations are deleted and the foreign key of the model is
+//set to NULL for belongs_to associations.
+//
+//    a, err := db.Model(&user).Association("Languages")
+//    if err != nil {
+//        return err
+//    }
+//    err = a.Delete(&english)
+func (a *Association) Delete(values ...interface{}) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return a.unlink(values, false)
+}
+
+//Clear removes all the associations of the model, without deleting the
+//associated records, see Delete.
+func (a *Association) Clear() error {
+	return a.unlink(nil, true)
+}
+
+// unlink removes the links between the model and values, or when except is
+// true between the model and all the associated records but values. The field
+// of the model is updated to match.
+func (a *Association) unlink(values []interface{}, except bool) error {
+	e := a.db.e
+	source := e.Scope.Value
+	rel := a.field.Relationship
+	ne := a.db.NewEngine()
+	defer engine.Put(ne)
+	tableOf := func(t reflect.Type) string {
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return scope.TableNameOf(ne, reflect.New(t).Interface())
+	}
 	var (
-		count      = 0
-		rel        = a.field.Relationship
-		fieldValue = a.field.Field.Interface()
-		query      = a.db.Model(fieldValue)
+		table      string
+		nulls      []string
+		conds      []string
+		args       []interface{}
+		keyColumns []string
+		keyFields  []string
 	)
-	if rel.Kind == "many_to_many" {
-		if isQL(a.db) {
-			err := scope.JoinWithQL(
-				rel.JoinTableHandler,
-				query.e, a.db.e.Scope.ValueOf())
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return e.Dialect.BindVar(len(args))
+	}
+	sourceField := func(name string) (interface{}, error) {
+		f, err := scope.FieldByName(e, source, name)
+		if err != nil {
+			return nil, err
+		}
+		return f.Field.Interface(), nil
+	}
+	switch rel.Kind {
+	case "many_to_many":
+		h := rel.JoinTableHandler
+		table = h.TableName
+		for _, fk := range h.Source.ForeignKeys {
+			v, err := sourceField(fk.AssociationDBName)
 			if err != nil {
-				return 0, err
+				return err
 			}
-		} else {
-			err := scope.JoinWith(
-				rel.JoinTableHandler,
-				query.e, a.db.e.Scope.ValueOf())
+			conds = append(conds, fmt.Sprintf("%s = %s", scope.Quote(e, fk.DBName), bind(v)))
+		}
+		keyColumns, keyFields = h.Destination.DBNames(), h.Destination.AssociationDBNames()
+	case "has_one", "has_many":
+		table = tableOf(a.field.Struct.Type)
+		t := a.field.Struct.Type
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if err := scope.Writable(ne, reflect.New(t).Interface()); err != nil {
+			return err
+		}
+		for i, fk := range rel.ForeignDBNames {
+			v, err := sourceField(rel.AssociationForeignFieldNames[i])
 			if err != nil {
-				return 0, err
-			}
-		}
-
-		query.e.Scope.ContextValue(fieldValue)
-	} else if rel.Kind == "has_many" || rel.Kind == "has_one" {
-		primaryKeys := util.ColumnAsArray(rel.AssociationForeignFieldNames, a.db.e.Scope.ValueOf())
-		query = query.Where(
-			fmt.Sprintf("%v IN (%v)",
-				scope.ToQueryCondition(a.db.e, rel.ForeignDBNames),
-				util.ToQueryMarks(primaryKeys)),
-			util.ToQueryValues(primaryKeys)...,
-		)
-	} else if rel.Kind == "belongs_to" {
-		primaryKeys := util.ColumnAsArray(rel.ForeignFieldNames, a.db.e.Scope.ValueOf())
-		query = query.Where(
-			fmt.Sprintf("%v IN (%v)",
-				scope.ToQueryCondition(a.db.e, rel.AssociationForeignDBNames),
-				util.ToQueryMarks(primaryKeys)),
-			util.ToQueryValues(primaryKeys)...,
-		)
-	}
-
-	if rel.PolymorphicType != "" {
-		query = query.Where(
-			fmt.Sprintf("%v%v = ?",
-				a.db.e.Dialect.QueryFieldName(
-					scope.QuotedTableName(a.db.e, fieldValue)),
-				scope.Quote(a.db.e, rel.PolymorphicDBName)),
-			rel.PolymorphicValue,
-		)
-	}
-	err := query.Count(&count)
+				return err
+			}
+			nulls = append(nulls, fk)
+			conds = append(conds, fmt.Sprintf("%s = %s", scope.Quote(e, fk), bind(v)))
+		}
+		if rel.PolymorphicType != "" {
+			conds = append(conds, fmt.Sprintf("%s = %s",
+				scope.Quote(e, rel.PolymorphicDBName), bind(rel.PolymorphicValue)))
+		}
+		p, err := scope.PrimaryField(ne, reflect.New(t).Interface())
+		if err != nil {
+			return err
+		}
+		keyColumns, keyFields = []string{p.DBName}, []string{p.Name}
+	case "belongs_to":
+		if err := scope.Writable(e, source); err != nil {
+			return err
+		}
+		table = tableOf(reflect.TypeOf(source))
+		p, err := scope.PrimaryField(e, source)
+		if err != nil {
+			return err
+		}
+		conds = append(conds, fmt.Sprintf("%s = %s",
+			scope.Quote(e, p.DBName), bind(p.Field.Interface())))
+		nulls = rel.ForeignDBNames
+		keyColumns, keyFields = rel.ForeignDBNames, rel.AssociationForeignFieldNames
+	default:
+		return fmt.Errorf("ngorm: unknown relationship %s of %s", rel.Kind, a.column)
+	}
+
+	var keys [][]interface{}
+	for _, value := range values {
+		k, err := a.keyOf(value, keyFields)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		// ql has no NOT, the records kept are matched with != instead.
+		op, and, or := "=", " AND ", " OR "
+		if except {
+			op, and, or = "!=", " OR ", " AND "
+		}
+		var match []string
+		for _, k := range keys {
+			var eq []string
+			for i, column := range keyColumns {
+				eq = append(eq, fmt.Sprintf("%s %s %s", scope.Quote(e, column), op, bind(k[i])))
+			}
+			match = append(match, "("+strings.Join(eq, and)+")")
+		}
+		conds = append(conds, "("+strings.Join(match, or)+")")
+	}
+
+	var sql string
+	if nulls == nil {
+		sql = fmt.Sprintf("DELETE FROM %s WHERE %s",
+			scope.Quote(e, table), strings.Join(conds, " AND "))
+	} else {
+		set := make([]string, len(nulls))
+		for i, column := range nulls {
+			set[i] = scope.Quote(e, column) + " = NULL"
+		}
+		sql = fmt.Sprintf("UPDATE %s SET %s WHERE %s", scope.Quote(e, table),
+			strings.Join(set, ", "), strings.Join(conds, " AND "))
+	}
+	if _, err := a.db.ExecTx(sql, args...); err != nil {
+		return err
+	}
+	return a.unlinkField(keys, keyFields, except)
+}
+
+// unlinkField removes from the field of the association the records whose
+// keys are in keys, or all those which aren't when except is true.
+func (a *Association) unlinkField(keys [][]interface{}, fields []string, except bool) error {
+	removed := func(v reflect.Value) (bool, error) {
+		if v.Kind() != reflect.Ptr {
+			v = v.Addr()
+		}
+		k, err := a.keyOf(v.Interface(), fields)
+		if err != nil {
+			return false, err
+		}
+		for _, key := range keys {
+			if reflect.DeepEqual(k, key) {
+				return !except, nil
+			}
+		}
+		return except, nil
+	}
+	f := a.field.Field
+	if f.Kind() == reflect.Slice {
+		kept := reflect.MakeSlice(f.Type(), 0, f.Len())
+		for i := 0; i < f.Len(); i++ {
+			ok, err := removed(f.Index(i))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				kept = reflect.Append(kept, f.Index(i))
+			}
+		}
+		f.Set(kept)
+		return nil
+	}
+	if f.Kind() == reflect.Ptr && f.IsNil() {
+		return nil
+	}
+	ok, err := removed(f)
+	if err != nil || !ok {
+		return err
+	}
+	f.Set(reflect.Zero(f.Type()))
+	if rel := a.field.Relationship; rel.Kind == "belongs_to" {
+		e := a.db.e
+		for _, name := range rel.ForeignFieldNames {
+			fk, err := scope.FieldByName(e, e.Scope.Value, name)
+			if err != nil {
+				return err
+			}
+			fk.Field.Set(reflect.Zero(fk.Field.Type()))
+		}
+	}
+	return nil
+}
+
+// keyOf returns the values of the fields of value identifying it in the
+// association.
+func (a *Association) keyOf(value interface{}, fields []string) ([]interface{}, error) {
+	var k []interface{}
+	for _, name := range fields {
+		f, err := scope.FieldByName(a.db.e, value, name)
+		if err != nil {
+			return nil, err
+		}
+		k = append(k, f.Field.Interface())
+	}
+	return k, nil
+}
+
+func isZero(v reflect.Value) bool {
+	return v.Interface() == reflect.Zero(v.Type()).Interface()
+}
+
+// Count returns the number of records associated to the model in the
+// database, with a COUNT query which doesn't load them, see
+// hooks.CountRelated.
+func (a *Association) Count() (int, error) {
+	e := a.db.NewEngine()
+	defer engine.Put(e)
+	var count int
+	err := hooks.CountRelated(e, a.db.e.Scope.Value, a.column, &count)
 	if err != nil {
 		return 0, err
 	}
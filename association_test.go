@@ -1,6 +1,7 @@
 package ngorm
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -432,6 +433,27 @@ func testAssociationBelongsTo(t *testing.T, db *DB) {
 	if count != 1 {
 		t.Errorf("expected %d got %d", 1, count)
 	}
+
+	// Delete
+	a, err = db.Model(&post).Association("Category")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete(&post.Category)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.CategoryID.Valid || post.Category.ID != 0 {
+		t.Errorf("expected the category to be removed got %v", post.Category)
+	}
+	var deleted fixture.Post
+	err = db.First(&deleted, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.CategoryID.Valid {
+		t.Errorf("expected a NULL category_id got %v", deleted.CategoryID)
+	}
 }
 
 func TestAssociationBelongsToOverideFK(t *testing.T) {
@@ -734,6 +756,43 @@ func testAssociationHasMany(t *testing.T, db *DB) {
 	if !compareComments(comments11, []string{"Comment 1", "Comment 2"}) {
 		t.Errorf("Query has many relations with Related")
 	}
+
+	// Delete
+	a, err = db.Model(&post).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete(post.Comments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post.Comments) != 1 || post.Comments[0].Content != "Comment 2" {
+		t.Errorf("expected the comments to be [Comment 2] got %v", post.Comments)
+	}
+	count, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected %d got %d", 1, count)
+	}
+
+	// Clear
+	a, err = db.Model(&post).Association("Comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected %d got %d", 0, count)
+	}
 }
 
 func TestAssociationHasManyOverideFK(t *testing.T) {
@@ -849,4 +908,336 @@ func testAssociationManyToMany(t *testing.T, db *DB) {
 	if len(newLanguages1) != len(languages) {
 		t.Errorf("expected %d got %d", len(languages), len(newLanguages1))
 	}
+	var found []string
+	for _, l := range newLanguages1 {
+		found = append(found, l.Name)
+	}
+	sort.Strings(found)
+	if !reflect.DeepEqual(found, []string{"EN", "ZH"}) {
+		t.Errorf("expected [EN ZH] got %v", found)
+	}
+
+	countLanguages := func(expect int) {
+		t.Helper()
+		a, err := db.Model(&user).Association("Languages")
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := a.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expect {
+			t.Errorf("expected %d got %d", expect, count)
+		}
+	}
+
+	// Delete
+	err = a.Delete(&user.Languages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Languages) != 1 || user.Languages[0].Name != "EN" {
+		t.Errorf("expected the languages to be [EN] got %v", user.Languages)
+	}
+	countLanguages(1)
+
+	// Replace
+	a, err = db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Replace(&fixture.Language{Name: "DE"}, &fixture.Language{Name: "FR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	countLanguages(2)
+	var names []string
+	for _, l := range user.Languages {
+		if l.ID == 0 {
+			t.Errorf("expected %s to be saved", l.Name)
+		}
+		names = append(names, l.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"DE", "FR"}) {
+		t.Errorf("expected [DE FR] got %v", names)
+	}
+
+	// Clear
+	a, err = db.Model(&user).Association("Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Languages) != 0 {
+		t.Errorf("expected no languages got %d", len(user.Languages))
+	}
+	countLanguages(0)
+
+	// The languages themselves are kept.
+	var all int
+	err = db.Model(&fixture.Language{}).Count(&all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all != 4 {
+		t.Errorf("expected %d got %d", 4, all)
+	}
+}
+
+type Member struct {
+	ID        int64
+	Name      string
+	Friends   []*Member `gorm:"many2many:friendships;"`
+	Followers []*Member `gorm:"many2many:follows;jointable_foreignkey:followed_id;association_jointable_foreignkey:follower_id"`
+}
+
+func TestAssociationSelfReferential(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationSelfReferential, &Member{})
+	}
+}
+
+func testAssociationSelfReferential(t *testing.T, db *DB) {
+	e := db.NewEngine()
+	for _, v := range []struct {
+		field, table, source, destination string
+	}{
+		{"Friends", "friendships", "member_id", "friend_id"},
+		{"Followers", "follows", "followed_id", "follower_id"},
+	} {
+		f, err := scope.FieldByName(e, &Member{}, v.field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := f.Relationship.JoinTableHandler
+		if h.TableName != v.table {
+			t.Errorf("expected %s got %s", v.table, h.TableName)
+		}
+		if s := h.Source.DBNames(); !reflect.DeepEqual(s, []string{v.source}) {
+			t.Errorf("expected [%s] got %v", v.source, s)
+		}
+		if d := h.Destination.DBNames(); !reflect.DeepEqual(d, []string{v.destination}) {
+			t.Errorf("expected [%s] got %v", v.destination, d)
+		}
+	}
+
+	_, err := db.Automigrate(&Member{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := Member{
+		Name:      "alice",
+		Friends:   []*Member{{Name: "bob"}, {Name: "carol"}},
+		Followers: []*Member{{Name: "dave"}},
+	}
+	err = db.Begin().Save(&alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found Member
+	err = db.Preload("Friends").Preload("Followers").First(&found, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var friends []string
+	for _, f := range found.Friends {
+		friends = append(friends, f.Name)
+	}
+	sort.Strings(friends)
+	if !reflect.DeepEqual(friends, []string{"bob", "carol"}) {
+		t.Errorf("expected [bob carol] got %v", friends)
+	}
+	if len(found.Followers) != 1 || found.Followers[0].Name != "dave" {
+		t.Errorf("expected the follower dave got %v", found.Followers)
+	}
+
+	// The friends of bob are not those of alice.
+	var bob Member
+	err = db.Preload("Friends").Where("name = ?", "bob").First(&bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bob.Friends) != 0 {
+		t.Errorf("expected bob to have no friends got %d", len(bob.Friends))
+	}
+
+	a, err := db.Model(&alice).Association("Friends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected %d got %d", 2, count)
+	}
+}
+
+type Course struct {
+	ID       int64
+	Title    string
+	Students []Student `gorm:"many2many:enrollments;JOINTABLE_FOREIGNKEY:course_ref;ASSOCIATION_JOINTABLE_FOREIGNKEY:student_ref"`
+}
+
+type Student struct {
+	ID   int64
+	Name string
+}
+
+func TestAssociationJoinTableForeignKeys(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationJoinTableForeignKeys, &Course{}, &Student{}, "enrollments")
+	}
+}
+
+func testAssociationJoinTableForeignKeys(t *testing.T, db *DB) {
+	e := db.NewEngine()
+	f, err := scope.FieldByName(e, &Course{}, "Students")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := f.Relationship.JoinTableHandler
+	if s := h.Source.DBNames(); !reflect.DeepEqual(s, []string{"course_ref"}) {
+		t.Errorf("expected [course_ref] got %v", s)
+	}
+	if d := h.Destination.DBNames(); !reflect.DeepEqual(d, []string{"student_ref"}) {
+		t.Errorf("expected [student_ref] got %v", d)
+	}
+
+	_, err = db.Automigrate(&Course{}, &Student{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	course := Course{Title: "go", Students: []Student{{Name: "a"}, {Name: "b"}}}
+	err = db.Create(&course)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = db.SQLCommon().QueryRow(fmt.Sprintf("SELECT count(*) FROM enrollments WHERE course_ref = %s",
+		db.Dialect().BindVar(1)), course.ID).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 enrollments got %d", n)
+	}
+
+	var found Course
+	err = db.Preload("Students").First(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found.Students) != 2 {
+		t.Errorf("expected 2 students got %d", len(found.Students))
+	}
+	a, err := db.Model(&found).Association("Students")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Delete(found.Students[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 student got %d", n)
+	}
+}
+
+type Playlist struct {
+	ID    int64
+	Name  string
+	Songs []Song `gorm:"many2many:playlist_songs"`
+}
+
+type Song struct {
+	ID    int64
+	Title string `gorm:"unique_index"`
+}
+
+func TestAssociationReplaceTx(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAssociationReplaceTx, &Playlist{}, &Song{}, "playlist_songs")
+	}
+}
+
+func testAssociationReplaceTx(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Playlist{}, &Song{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := Playlist{Name: "p", Songs: []Song{{Title: "a"}, {Title: "b"}}}
+	err = db.Create(&playlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(expect int) {
+		t.Helper()
+		a, err := db.Model(&playlist).Association("Songs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := a.Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expect {
+			t.Errorf("expected %d songs got %d", expect, n)
+		}
+	}
+
+	// Saving the second song fails on the unique title, the first one is
+	// rolled back with it.
+	a, err := db.Model(&playlist).Association("Songs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Replace(&Song{Title: "c"}, &Song{Title: "a"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	count(2)
+	if len(playlist.Songs) != 2 || playlist.Songs[0].Title != "a" {
+		t.Errorf("expected the songs to be restored got %+v", playlist.Songs)
+	}
+	var songs int
+	err = db.Model(&Song{}).Count(&songs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if songs != 2 {
+		t.Errorf("expected 2 songs got %d", songs)
+	}
+
+	// The transaction of the model is used when there is one.
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = tx.Model(&playlist).Association("Songs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Replace(&Song{Title: "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count(1)
+	if len(playlist.Songs) != 1 || playlist.Songs[0].Title != "d" {
+		t.Errorf("expected the songs to be replaced got %+v", playlist.Songs)
+	}
 }
@@ -0,0 +1,83 @@
+package builder
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ngorm/ngorm/engine"
+)
+
+//Position is the place in a statement where a custom clause is rendered.
+type Position int
+
+// Supported positions of custom clauses.
+const (
+	// Hint renders the clause right after the SELECT keyword, this is where
+	// optimizer hints like /*+ INDEX(users idx_name) */ go.
+	Hint Position = iota
+
+	// BeforeWhere renders the clause after the FROM and JOIN clauses, for
+	// instance AS OF SYSTEM TIME '-10s'.
+	BeforeWhere
+
+	// AfterLimit renders the clause at the end of the statement, for instance
+	// FOR UPDATE.
+	AfterLimit
+)
+
+//ClauseBuilder renders a custom clause with value, which is the value given
+//when the clause was added to the search. Bind variables are added with
+//scope.AddToVars. An empty string renders nothing.
+type ClauseBuilder func(e *engine.Engine, value interface{}) (string, error)
+
+type customClause struct {
+	pos   Position
+	build ClauseBuilder
+}
+
+var clauses = struct {
+	sync.RWMutex
+	m map[string]customClause
+}{m: make(map[string]customClause)}
+
+//RegisterClause registers fn to render clauses added to searches with name at
+//position pos. This allows vendor specific syntax to be supported without
+//changes to the builder
+//
+//  builder.RegisterClause("as_of", builder.BeforeWhere,
+//  	func(e *engine.Engine, v interface{}) (string, error) {
+//  		return "AS OF SYSTEM TIME " + scope.AddToVars(e, v), nil
+//  	})
+//  search.Clause(e, "as_of", "-10s")
+//
+// Registering a name again replaces the previous builder.
+func RegisterClause(name string, pos Position, fn ClauseBuilder) {
+	clauses.Lock()
+	clauses.m[name] = customClause{pos: pos, build: fn}
+	clauses.Unlock()
+}
+
+//ClausesSQL renders the custom clauses of the search on e which are registered
+//at position pos. An error is returned for clauses that were not registered.
+func ClausesSQL(e *engine.Engine, pos Position) (string, error) {
+	var o string
+	for _, c := range e.Search.Clauses {
+		clauses.RLock()
+		cc, ok := clauses.m[c.Name]
+		clauses.RUnlock()
+		if !ok {
+			return "", fmt.Errorf("ngorm: unknown clause %q", c.Name)
+		}
+		if cc.pos != pos {
+			continue
+		}
+		s, err := cc.build(e, c.Value)
+		if err != nil {
+			return "", err
+		}
+		if s != "" {
+			o += " " + s
+		}
+	}
+	return o, nil
+}
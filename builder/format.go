@@ -0,0 +1,214 @@
+package builder
+
+import (
+	"strings"
+	"unicode"
+)
+
+// clauseKeywords are the keywords starting a new line in formatted
+// statements, longer keywords come first so that LEFT JOIN isn't matched as
+// LEFT followed by JOIN.
+var clauseKeywords = [][]string{
+	{"LEFT", "OUTER", "JOIN"},
+	{"RIGHT", "OUTER", "JOIN"},
+	{"FULL", "OUTER", "JOIN"},
+	{"ON", "CONFLICT"},
+	{"UNION", "ALL"},
+	{"GROUP", "BY"},
+	{"ORDER", "BY"},
+	{"LEFT", "JOIN"},
+	{"RIGHT", "JOIN"},
+	{"INNER", "JOIN"},
+	{"CROSS", "JOIN"},
+	{"FULL", "JOIN"},
+	{"SELECT"},
+	{"FROM"},
+	{"JOIN"},
+	{"WHERE"},
+	{"HAVING"},
+	{"LIMIT"},
+	{"OFFSET"},
+	{"SET"},
+	{"VALUES"},
+	{"RETURNING"},
+	{"UNION"},
+}
+
+//Format pretty prints the statement q for logs and reviews. Each clause
+//starts a new line and the conditions joined with AND or OR at the top level
+//of WHERE, HAVING and ON clauses are put on their own indented line
+//
+//    SELECT u1.*
+//    FROM users AS u1
+//    JOIN users AS u2 ON u1.name = u2.name
+//      AND u1.id != u2.id
+//    WHERE (u1.age > $1)
+//      OR (u1.role = $2)
+//    LIMIT 10
+//
+// Runs of white space are collapsed, string literals, quoted identifiers and
+// parenthesized expressions like sub queries are left on a single line.
+// Statements separated by semicolons, like the transactions used with ql,
+// start on a new line. The result is meant for humans only, it isn't
+// guaranteed to be equivalent to q.
+func Format(q string) string {
+	tokens := tokenize(q)
+	var buf strings.Builder
+	depth := 0
+	lineStart, space := true, false
+	conditions, between := false, false
+	var prev string
+	write := func(s string) {
+		if space && !lineStart {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(s)
+		lineStart, space = false, false
+		prev = s
+	}
+	newLine := func(indent string) {
+		if buf.Len() > 0 {
+			buf.WriteString("\n" + indent)
+		}
+		lineStart, space = true, false
+	}
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case isSpace(tok):
+			space = true
+			continue
+		case tok == "(":
+			depth++
+		case tok == ")":
+			if depth > 0 {
+				depth--
+			}
+		case tok == ";" && depth == 0:
+			write(tok)
+			newLine("")
+			conditions = false
+			continue
+		case depth == 0 && isWord(tok):
+			// DELETE FROM is kept together.
+			n := matchKeyword(tokens, i)
+			if n > 0 && !(strings.EqualFold(tok, "FROM") && strings.EqualFold(prev, "DELETE")) {
+				var words []string
+				for j := i; j < i+n; j++ {
+					if !isSpace(tokens[j]) {
+						words = append(words, tokens[j])
+					}
+				}
+				last := strings.ToUpper(words[len(words)-1])
+				conditions = last == "WHERE" || last == "HAVING" || last == "JOIN"
+				between = false
+				newLine("")
+				write(strings.Join(words, " "))
+				i += n - 1
+				continue
+			}
+			switch strings.ToUpper(tok) {
+			case "BETWEEN":
+				between = true
+			case "AND":
+				if between {
+					between = false
+				} else if conditions {
+					newLine("  ")
+				}
+			case "OR":
+				if conditions {
+					newLine("  ")
+				}
+			}
+		case depth == 0 && (tok == "&&" || tok == "||") && conditions:
+			newLine("  ")
+		}
+		write(tok)
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+// matchKeyword returns the number of tokens of the clause keyword starting at
+// tokens[i], or zero when there is none.
+func matchKeyword(tokens []string, i int) int {
+	for _, kw := range clauseKeywords {
+		j := i
+		ok := true
+		for k, word := range kw {
+			if k > 0 {
+				if j >= len(tokens) || !isSpace(tokens[j]) {
+					ok = false
+					break
+				}
+				j++
+			}
+			if j >= len(tokens) || !strings.EqualFold(tokens[j], word) {
+				ok = false
+				break
+			}
+			j++
+		}
+		if ok {
+			return j - i
+		}
+	}
+	return 0
+}
+
+// tokenize splits q into words, quoted strings and identifiers, runs of white
+// space and punctuation.
+func tokenize(q string) []string {
+	var tokens []string
+	r := []rune(q)
+	for i := 0; i < len(r); {
+		start := i
+		switch c := r[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i++
+			for i < len(r) {
+				if r[i] == c {
+					// A doubled quote is an escaped quote.
+					if i+1 < len(r) && r[i+1] == c {
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				i++
+			}
+		case unicode.IsSpace(c):
+			for i < len(r) && unicode.IsSpace(r[i]) {
+				i++
+			}
+		case isWordRune(c):
+			for i < len(r) && isWordRune(r[i]) {
+				i++
+			}
+		case (c == '&' || c == '|') && i+1 < len(r) && r[i+1] == c:
+			i += 2
+		default:
+			i++
+		}
+		tokens = append(tokens, string(r[start:i]))
+	}
+	return tokens
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || c == '$' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func isWord(tok string) bool {
+	for _, c := range tok {
+		if !isWordRune(c) {
+			return false
+		}
+	}
+	return tok != ""
+}
+
+func isSpace(tok string) bool {
+	return tok != "" && strings.TrimSpace(tok) == ""
+}
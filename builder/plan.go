@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/regexes"
+	"github.com/ngorm/ngorm/scope"
+)
+
+// planKey returns the key identifying the SQL built on e for modelValue in
+// the plan cache. ok is false when the search can't be cached, that is when it
+// has conditions other than strings with plain arguments, because the
+// arguments of those can't be collected without building the statement.
+// Searches with the conditions of the callbacks, like the tenant ones, aren't
+// cached either since the conditions depend on the context of the operation.
+func planKey(e *engine.Engine, modelValue interface{}) (key string, ok bool) {
+	s := e.Search
+	if len(e.Scope.SQLVars) > 0 || len(s.NotConditions) > 0 || len(s.Clauses) > 0 {
+		return "", false
+	}
+	if e.Callbacks != nil && len(e.Callbacks.Conditions()) > 0 {
+		return "", false
+	}
+	f, err := scope.PrimaryField(e, modelValue)
+	if err != nil || (f != nil && !f.IsBlank) {
+		return "", false
+	}
+	var buf bytes.Buffer
+	typ := reflect.TypeOf(modelValue)
+	if v, isValue := modelValue.(reflect.Value); isValue {
+		typ = v.Type()
+	}
+	fmt.Fprintf(&buf, "%v\x00%s\x00%v\x00%s\x00%s\x00%s\x00%v%v%v",
+		reflect.TypeOf(e.Dialect), e.Dialect.GetName(), typ,
+		scope.TableName(e, modelValue), s.TableName, s.Alias,
+		s.Raw, s.Unscoped, s.IgnoreOrderQuery)
+	for _, conds := range [][]map[string]interface{}{
+		s.JoinConditions, s.WhereConditions, s.OrConditions, s.HavingConditions,
+	} {
+		buf.WriteString("\x01")
+		for _, c := range conds {
+			if !conditionKey(&buf, c) {
+				return "", false
+			}
+		}
+	}
+	if len(s.Selects) > 0 {
+		args, _ := s.Selects["args"].([]interface{})
+		if len(args) > 0 {
+			return "", false
+		}
+		fmt.Fprintf(&buf, "\x01%v", s.Selects["query"])
+	}
+	buf.WriteString("\x01")
+	for _, o := range s.Orders {
+		str, isString := o.(string)
+		if !isString {
+			return "", false
+		}
+		buf.WriteString(str + "\x00")
+	}
+	buf.WriteString("\x01")
+	if len(s.GroupExprs) > 0 {
+		return "", false
+	}
+	buf.WriteString(s.Group)
+	fmt.Fprintf(&buf, "\x01%v\x00%v\x01%v", s.Limit, s.Offset, s.TableNames)
+	return buf.String(), true
+}
+
+// conditionKey writes the shape of condition c to buf. This returns false for
+// conditions that can't be cached.
+func conditionKey(buf *bytes.Buffer, c map[string]interface{}) bool {
+	query, isString := c["query"].(string)
+	if !isString || regexes.IsNumber.MatchString(query) {
+		return false
+	}
+	buf.WriteString(query + "\x00")
+	args, _ := c["args"].([]interface{})
+	for _, arg := range args {
+		if _, isExpr := arg.(*model.Expr); isExpr {
+			return false
+		}
+		if _, isBytes := arg.([]byte); isBytes {
+			buf.WriteString("v")
+			continue
+		}
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Slice {
+			fmt.Fprintf(buf, "s%d", v.Len())
+			continue
+		}
+		buf.WriteString("v")
+	}
+	buf.WriteString("\x00")
+	return true
+}
+
+// planArgs returns the bind arguments of a cacheable search in the order they
+// are added when building the statement, converted like scope.AddToVars does.
+func planArgs(e *engine.Engine) []interface{} {
+	var o []interface{}
+	s := e.Search
+	for _, conds := range [][]map[string]interface{}{
+		s.JoinConditions, s.WhereConditions, s.OrConditions, s.HavingConditions,
+	} {
+		for _, c := range conds {
+			args, _ := c["args"].([]interface{})
+			for _, arg := range args {
+				if v := reflect.ValueOf(arg); v.Kind() == reflect.Slice {
+					if _, isBytes := arg.([]byte); isBytes {
+						o = append(o, scope.BindValue(e, arg))
+						continue
+					}
+					for i := 0; i < v.Len(); i++ {
+						o = append(o, scope.BindValue(e, v.Index(i).Interface()))
+					}
+					continue
+				}
+				if valuer, isValuer := arg.(driver.Valuer); isValuer {
+					arg, _ = valuer.Value()
+				}
+				o = append(o, scope.BindValue(e, arg))
+			}
+		}
+	}
+	return o
+}
@@ -0,0 +1,104 @@
+package builder
+
+import (
+	"strings"
+
+	"github.com/ngorm/ngorm/dialects"
+)
+
+//SplitStatements splits script into the statements separated by semicolons,
+//as written in schema files and fixtures. Semicolons inside string literals,
+//quoted identifiers, comments and postgres dollar quoted strings don't end a
+//statement. With mysql backslashes escape quotes inside string literals.
+//
+// The statements are returned without the semicolon and the surrounding white
+// space, the statements made only of comments are left out.
+func SplitStatements(d dialects.Dialect, script string) []string {
+	backslash := d != nil && d.GetName() == "mysql"
+	var stmts []string
+	r := []rune(script)
+	start, content := 0, false
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i++
+			for i < len(r) {
+				if backslash && r[i] == '\\' && c != '`' {
+					i += 2
+					continue
+				}
+				if r[i] == c {
+					// A doubled quote is an escaped quote.
+					if i+1 < len(r) && r[i+1] == c {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			content = true
+		case c == '-' && i+1 < len(r) && r[i+1] == '-':
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			i = skipPast(r, i+2, "*/")
+		case c == '$':
+			tag := dollarTag(r[i:])
+			if tag == "" {
+				i++
+				content = true
+				continue
+			}
+			i = skipPast(r, i+len(tag), tag)
+			content = true
+		case c == ';':
+			if content {
+				stmts = append(stmts, strings.TrimSpace(string(r[start:i])))
+			}
+			i++
+			start, content = i, false
+		default:
+			if !isSpace(string(c)) {
+				content = true
+			}
+			i++
+		}
+	}
+	if content {
+		stmts = append(stmts, strings.TrimSpace(string(r[start:])))
+	}
+	return stmts
+}
+
+// dollarTag returns the opening tag of the dollar quoted string starting r,
+// like $$ or $body$, or "" when r doesn't start one. Bind variables like $1
+// aren't tags.
+func dollarTag(r []rune) string {
+	for i := 1; i < len(r); i++ {
+		switch c := r[i]; {
+		case c == '$':
+			return string(r[:i+1])
+		case c == '_' || c > 127 || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 1:
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// skipPast returns the index following the first occurrence of end in r from
+// i, or len(r) when there is none.
+func skipPast(r []rune, i int, end string) int {
+	e := []rune(end)
+	for ; i+len(e) <= len(r); i++ {
+		if string(r[i:i+len(e)]) == end {
+			return i + len(e)
+		}
+	}
+	return len(r)
+}
@@ -9,12 +9,16 @@ package builder
 import (
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
 
+	"github.com/ngorm/ngorm/clause"
+	"github.com/ngorm/ngorm/dialects"
 	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/regexes"
 	"github.com/ngorm/ngorm/scope"
@@ -35,6 +39,7 @@ import (
 //  []uint16,[]uint32,[]uint64, []string, []interface{}
 //  map[string]interface{}:
 //  struct
+//  clause.Expression
 //
 // Note that if you supply a query as a struct then it should be a model.
 // Example of a clause is,
@@ -58,8 +63,8 @@ import (
 // specific. For example ql uses $1,$2,$3 etc but also supports ?. You don't
 // have to worry about this, it is automatically handled by the supported
 // database dialects.
-func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface{}) (str string, err error) {
-	switch value := clause["query"].(type) {
+func Where(e *engine.Engine, modelValue interface{}, cond map[string]interface{}) (str string, err error) {
+	switch value := cond["query"].(type) {
 	case string:
 		if regexes.IsNumber.MatchString(value) {
 			return PrimaryCondition(e, modelValue, scope.AddToVars(e, value))
@@ -95,23 +100,25 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 			return "", err
 		}
 		str = fmt.Sprintf("(%v%v IN (?))",
-			e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+			e.Dialect.QueryFieldName(scope.QuotedTableAlias(e, modelValue)),
 			scope.Quote(e, pk))
-		clause["args"] = []interface{}{value}
+		cond["args"] = []interface{}{value}
 	case map[string]interface{}:
 		var sqls []string
 		for key, value := range value {
 			if value != nil {
 				sqls = append(sqls, fmt.Sprintf("(%v%v = %v)",
-					e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+					e.Dialect.QueryFieldName(scope.QuotedTableAlias(e, modelValue)),
 					scope.Quote(e, key), scope.AddToVars(e, value)))
 			} else {
 				sqls = append(sqls, fmt.Sprintf("(%v%v IS NULL)",
-					e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+					e.Dialect.QueryFieldName(scope.QuotedTableAlias(e, modelValue)),
 					scope.Quote(e, key)))
 			}
 		}
 		return strings.Join(sqls, " AND "), nil
+	case clause.Expression:
+		return Expression(e, value)
 	default:
 		v := reflect.ValueOf(value)
 		if v.Kind() == reflect.Ptr {
@@ -123,19 +130,22 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 			if err != nil {
 				return "", err
 			}
+			include, _ := cond["include"].([]string)
 			for _, field := range fds {
-				if !field.IsIgnored && !field.IsBlank {
-					sqls = append(sqls, fmt.Sprintf("(%v%v = %v)",
-						e.Dialect.QueryFieldName(scope.QuotedTableName(e, value)),
-						scope.Quote(e, field.DBName),
-						scope.AddToVars(e, field.Field.Interface())))
+				if !field.IsIgnored && (!field.IsBlank || included(field, include)) {
+					c, err := fieldCondition(e, e.Dialect.QueryFieldName(scope.QuotedTableAlias(e, value))+
+						scope.Quote(e, field.DBName), field, "=")
+					if err != nil {
+						return "", err
+					}
+					sqls = append(sqls, c)
 				}
 			}
 			return strings.Join(sqls, " AND "), nil
 		}
 	}
 
-	args := clause["args"].([]interface{})
+	args := cond["args"].([]interface{})
 	for _, arg := range args {
 		switch reflect.ValueOf(arg).Kind() {
 		case reflect.Slice: // For where("id in (?)", []int64{1,2})
@@ -162,6 +172,17 @@ func Where(e *engine.Engine, modelValue interface{}, clause map[string]interface
 	return
 }
 
+// included returns true if field is named in include either by its name or its
+// database name.
+func included(field *model.Field, include []string) bool {
+	for _, name := range include {
+		if name == field.Name || name == field.DBName {
+			return true
+		}
+	}
+	return false
+}
+
 //PrimaryCondition generates WHERE clause with the value set for primary key.
 //This will return an error if the modelValue doesn't have primary key, the
 //reason for modelValue not to have a primary key might be due to the modelValue
@@ -176,29 +197,75 @@ func PrimaryCondition(e *engine.Engine, modelValue, value interface{}) (string,
 		return "", err
 	}
 	return fmt.Sprintf("(%v%v = %v)",
-		e.Dialect.QueryFieldName(scope.QuotedTableName(e, modelValue)),
+		e.Dialect.QueryFieldName(scope.QuotedTableAlias(e, modelValue)),
 		scope.Quote(e, pk), value), nil
 }
 
+// hasModel returns false when modelValue is nil or the zero reflect.Value.
+func hasModel(modelValue interface{}) bool {
+	if v, ok := modelValue.(reflect.Value); ok {
+		return v.IsValid()
+	}
+	return modelValue != nil
+}
+
+//CallbackConditions returns the conditions added by the callbacks of e to the
+//statements on modelValue, see engine.Condition. Their arguments are added to
+//the bind variables of e.
+func CallbackConditions(e *engine.Engine, modelValue interface{}) ([]string, error) {
+	if e.Callbacks == nil {
+		return nil, nil
+	}
+	value := modelValue
+	if v, ok := value.(reflect.Value); ok {
+		value = nil
+		if v.IsValid() {
+			value = v.Interface()
+		}
+	}
+	var conds []string
+	for _, cond := range e.Callbacks.Conditions() {
+		expr, err := cond(e, value)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			conds = append(conds, scope.AddToVars(e, expr))
+		}
+	}
+	return conds, nil
+}
+
 //WhereSQL builds WHERE SQL clause of modelValue using the given engine e as
 //context.
 func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error) {
 	var (
-		quotedTableName                                = scope.QuotedTableName(e, modelValue)
+		quotedTableName                                = scope.QuotedTableAlias(e, modelValue)
 		primaryConditions, andConditions, orConditions []string
 	)
 
-	if !e.Search.Unscoped && scope.HasColumn(e, modelValue, "deleted_at") {
-		primaryConditions = append(primaryConditions,
-			fmt.Sprintf("%v deleted_at IS NULL",
-				e.Dialect.QueryFieldName(quotedTableName)),
-		)
+	if !e.Search.Unscoped {
+		if sd := scope.SoftDeleteOf(e, modelValue); sd != nil {
+			column := e.Dialect.QueryFieldName(quotedTableName) + scope.Quote(e, sd.Column())
+			primaryConditions = append(primaryConditions,
+				scope.AddToVars(e, sd.NotDeleted(column)))
+		}
 	}
-
-	f, err := scope.PrimaryField(e, modelValue)
+	conds, err := CallbackConditions(e, modelValue)
 	if err != nil {
 		return "", err
 	}
+	primaryConditions = append(primaryConditions, conds...)
+
+	// Without a model, as when querying a table into maps, there are no
+	// primary keys to match.
+	var f *model.Field
+	if hasModel(modelValue) {
+		f, err = scope.PrimaryField(e, modelValue)
+		if err != nil {
+			return "", err
+		}
+	}
 	if !(f == nil || f.IsBlank) {
 		pfs, err := scope.PrimaryFields(e, modelValue)
 		if err != nil {
@@ -218,7 +285,9 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 		if err != nil {
 			return "", err
 		}
-		andConditions = append(andConditions, sql)
+		if sql != "" {
+			andConditions = append(andConditions, sql)
+		}
 	}
 
 	for _, clause := range e.Search.OrConditions {
@@ -226,7 +295,9 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 		if err != nil {
 			return "", err
 		}
-		orConditions = append(orConditions, sql)
+		if sql != "" {
+			orConditions = append(orConditions, sql)
+		}
 	}
 
 	for _, clause := range e.Search.NotConditions {
@@ -234,7 +305,9 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 		if err != nil {
 			return "", err
 		}
-		andConditions = append(andConditions, sql)
+		if sql != "" {
+			andConditions = append(andConditions, sql)
+		}
 	}
 
 	orSQL := strings.Join(orConditions, " OR ")
@@ -279,13 +352,14 @@ func WhereSQL(e *engine.Engine, modelValue interface{}) (sql string, err error)
 //  []uint16,[]uint32,[]uint64, []string, []interface{}
 //  map[string]interface{}:
 //  struct
-func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}) (str string, err error) {
+//  clause.Expression
+func Not(e *engine.Engine, modelValue interface{}, cond map[string]interface{}) (str string, err error) {
 	var notEqualSQL string
 	primaryKey, err := scope.PrimaryKey(e, modelValue)
 	if err != nil {
 		return "", err
 	}
-	switch value := clause["query"].(type) {
+	switch value := cond["query"].(type) {
 	case string:
 		if regexes.IsNumber.MatchString(value) {
 			id, _ := strconv.Atoi(value)
@@ -294,15 +368,15 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 			str = fmt.Sprintf(" NOT (%v) ", value)
 			notEqualSQL = fmt.Sprintf("NOT (%v)", value)
 		} else {
-			str = fmt.Sprintf("(%v.%v NOT IN (?))", scope.QuotedTableName(e, modelValue), scope.Quote(e, value))
-			notEqualSQL = fmt.Sprintf("(%v.%v <> ?)", scope.QuotedTableName(e, modelValue), scope.Quote(e, value))
+			str = fmt.Sprintf("(%v.%v NOT IN (?))", scope.QuotedTableAlias(e, modelValue), scope.Quote(e, value))
+			notEqualSQL = fmt.Sprintf("(%v.%v <> ?)", scope.QuotedTableAlias(e, modelValue), scope.Quote(e, value))
 		}
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, sql.NullInt64:
-		return fmt.Sprintf("(%v.%v <> %v)", scope.QuotedTableName(e, modelValue), scope.Quote(e, primaryKey), value), nil
+		return fmt.Sprintf("(%v.%v <> %v)", scope.QuotedTableAlias(e, modelValue), scope.Quote(e, primaryKey), value), nil
 	case []int, []int8, []int16, []int32, []int64, []uint, []uint8, []uint16, []uint32, []uint64, []string:
 		if reflect.ValueOf(value).Len() > 0 {
-			str = fmt.Sprintf("(%v.%v NOT IN (?))", scope.QuotedTableName(e, modelValue), scope.Quote(e, primaryKey))
-			clause["args"] = []interface{}{value}
+			str = fmt.Sprintf("(%v.%v NOT IN (?))", scope.QuotedTableAlias(e, modelValue), scope.Quote(e, primaryKey))
+			cond["args"] = []interface{}{value}
 		} else {
 			return "", nil
 		}
@@ -311,13 +385,19 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 		for key, value := range value {
 			if value != nil {
 				sqls = append(sqls, fmt.Sprintf("(%v.%v <> %v)",
-					scope.QuotedTableName(e, modelValue),
+					scope.QuotedTableAlias(e, modelValue),
 					scope.Quote(e, key), scope.AddToVars(e, value)))
 			} else {
-				sqls = append(sqls, fmt.Sprintf("(%v.%v IS NOT NULL)", scope.QuotedTableName(e, modelValue), scope.Quote(e, key)))
+				sqls = append(sqls, fmt.Sprintf("(%v.%v IS NOT NULL)", scope.QuotedTableAlias(e, modelValue), scope.Quote(e, key)))
 			}
 		}
 		return strings.Join(sqls, " AND "), nil
+	case clause.Expression:
+		c, err := Expression(e, value)
+		if err != nil || c == "" {
+			return "", err
+		}
+		return fmt.Sprintf("(NOT %s)", c), nil
 	case interface{}:
 		v := reflect.ValueOf(value)
 		if v.Kind() == reflect.Ptr {
@@ -329,12 +409,15 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 			if err != nil {
 				return "", err
 			}
+			include, _ := cond["include"].([]string)
 			for _, field := range fds {
-				if !field.IsBlank {
-					sqls = append(sqls, fmt.Sprintf("(%v.%v <> %v)",
-						scope.QuotedTableName(e, modelValue),
-						scope.Quote(e, field.DBName),
-						scope.AddToVars(e, field.Field.Interface())))
+				if !field.IsBlank || included(field, include) {
+					c, err := fieldCondition(e, scope.QuotedTableAlias(e, modelValue)+"."+
+						scope.Quote(e, field.DBName), field, "<>")
+					if err != nil {
+						return "", err
+					}
+					sqls = append(sqls, c)
 				}
 			}
 			return strings.Join(sqls, " AND "), nil
@@ -342,7 +425,7 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 
 	}
 
-	args := clause["args"].([]interface{})
+	args := cond["args"].([]interface{})
 	for _, arg := range args {
 		switch reflect.ValueOf(arg).Kind() {
 		case reflect.Slice: // For where("id in (?)", []int64{1,2})
@@ -367,11 +450,66 @@ func Not(e *engine.Engine, modelValue interface{}, clause map[string]interface{}
 	return
 }
 
+//Expression renders the typed condition c. The result is wrapped in
+//parentheses unless c imposes no condition at all, in which case an empty
+//string is returned.
+func Expression(e *engine.Engine, c clause.Expression) (string, error) {
+	s, err := c.Build(exprBuilder{e: e})
+	if err != nil || s == "" {
+		return "", err
+	}
+	return "(" + s + ")", nil
+}
+
+// exprBuilder implements clause.Builder on top of an engine.
+type exprBuilder struct {
+	e *engine.Engine
+}
+
+func (b exprBuilder) Quote(column string) string {
+	return scope.Quote(b.e, column)
+}
+
+func (b exprBuilder) AddToVars(value interface{}) string {
+	return scope.AddToVars(b.e, value)
+}
+
+func (b exprBuilder) RowValues() bool {
+	return dialects.SupportsRowValues(b.e.Dialect)
+}
+
+func (b exprBuilder) SubQuery(q *model.SubQuery) (string, error) {
+	if q == nil || q.Search == nil {
+		return "", errors.New("builder: invalid subquery")
+	}
+	ne := b.e.Clone()
+	defer engine.Put(ne)
+	ne.Search = q.Search
+	ne.Scope.ContextValue(q.Value)
+	ne.Scope.SQLVars = b.e.Scope.SQLVars
+	s, err := PrepareQuerySQL(ne, q.Value)
+	if err != nil {
+		return "", err
+	}
+	b.e.Scope.SQLVars = ne.Scope.SQLVars
+	return strings.TrimSpace(s), nil
+}
+
 //SelectSQL builds SELECT clause for modelValue using engine e as context.
 func SelectSQL(e *engine.Engine, modelValue interface{}) string {
 	if len(e.Search.Selects) == 0 {
+		if columns := scope.ProjectionColumns(e, modelValue); len(columns) > 0 {
+			var prefix string
+			if len(e.Search.JoinConditions) > 0 {
+				prefix = scope.QuotedTableAlias(e, modelValue) + "."
+			}
+			for i, c := range columns {
+				columns[i] = prefix + scope.Quote(e, c)
+			}
+			return strings.Join(columns, ", ")
+		}
 		if len(e.Search.JoinConditions) > 0 {
-			return fmt.Sprintf("%v.*", scope.QuotedTableName(e, modelValue))
+			return fmt.Sprintf("%v.*", scope.QuotedTableAlias(e, modelValue))
 		}
 		return "*"
 	}
@@ -420,10 +558,17 @@ func JoinSQL(e *engine.Engine, modelValue interface{}) (string, error) {
 	return strings.Join(j, " ") + " ", nil
 }
 
-//OrderSQL builds ORDER BY SQL clause
+//OrderSQL builds ORDER BY SQL clause. Orders which are clause.Expression
+//values failing to build are left out, the statements built with
+//PrepareQuerySQL fail instead.
 func OrderSQL(e *engine.Engine, modelValue interface{}) string {
+	s, _ := orderSQL(e)
+	return s
+}
+
+func orderSQL(e *engine.Engine) (string, error) {
 	if len(e.Search.Orders) == 0 || e.Search.IgnoreOrderQuery {
-		return ""
+		return "", nil
 	}
 	buf := util.B.Get()
 	defer func() {
@@ -431,22 +576,34 @@ func OrderSQL(e *engine.Engine, modelValue interface{}) string {
 	}()
 	var orders []string
 	for _, order := range e.Search.Orders {
-		if str, ok := order.(string); ok {
-			if regexes.Column.MatchString(str) {
-				str = scope.Quote(e, str)
+		switch value := order.(type) {
+		case string:
+			if regexes.Column.MatchString(value) {
+				value = scope.Quote(e, value)
 			}
-			orders = append(orders, str)
-		} else if expr, ok := order.(*model.Expr); ok {
-			exp := expr.Q
-			for _, arg := range expr.Args {
+			orders = append(orders, value)
+		case *model.Expr:
+			exp := value.Q
+			for _, arg := range value.Args {
 				exp = strings.Replace(exp, "?", scope.AddToVars(e, arg), 1)
 			}
 			orders = append(orders, exp)
+		case clause.Expression:
+			exp, err := value.Build(exprBuilder{e: e})
+			if err != nil {
+				return "", err
+			}
+			if exp != "" {
+				orders = append(orders, exp)
+			}
 		}
 	}
+	if len(orders) == 0 {
+		return "", nil
+	}
 	buf.WriteString(" ORDER BY ")
 	buf.WriteString(strings.Join(orders, ","))
-	return buf.String()
+	return buf.String(), nil
 }
 
 //LimitAndOffsetSQL generates SQL for LIMIT and OFFSET. This relies on the
@@ -455,13 +612,62 @@ func LimitAndOffsetSQL(e *engine.Engine) string {
 	return e.Dialect.LimitAndOffsetSQL(e.Search.Limit, e.Search.Offset)
 }
 
+// fieldCondition returns the comparison of column with the value of field for
+// struct conditions, op is = or <>. Fields with the ENCRYPTED tag are compared
+// with all the values their column may have, see scope.EncryptedSearch.
+func fieldCondition(e *engine.Engine, column string, field *model.Field, op string) (string, error) {
+	if _, ok := field.TagSettings["ENCRYPTED"]; !ok {
+		return fmt.Sprintf("(%v %s %v)", column, op, scope.AddToVars(e, scope.FieldValue(e, field))), nil
+	}
+	values, err := scope.EncryptedSearch(e, field)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 1 {
+		return fmt.Sprintf("(%v %s %v)", column, op, scope.AddToVars(e, values[0])), nil
+	}
+	vars := make([]string, len(values))
+	for k, v := range values {
+		vars[k] = scope.AddToVars(e, v)
+	}
+	in := "IN"
+	if op == "<>" {
+		in = "NOT IN"
+	}
+	return fmt.Sprintf("(%v %s (%s))", column, in, strings.Join(vars, ",")), nil
+}
+
 //GroupSQL generates GROUP BY SQL. This returns an empty string when
-//engine.Engine.Search.Group is empty.
-func GroupSQL(e *engine.Engine) string {
-	if len(e.Search.Group) == 0 {
-		return ""
+//engine.Engine.Search.Group and engine.Engine.Search.GroupExprs are empty.
+//
+// Column names are quoted, an error is returned for names which are not valid
+// identifiers. Arguments of *model.Expr values are added to the bind variables.
+func GroupSQL(e *engine.Engine) (string, error) {
+	if e.Search.Group == "" && len(e.Search.GroupExprs) == 0 {
+		return "", nil
 	}
-	return " GROUP BY " + e.Search.Group
+	var groups []string
+	if e.Search.Group != "" {
+		for _, name := range strings.Split(e.Search.Group, ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case regexes.IsNumber.MatchString(name):
+				groups = append(groups, name)
+			case regexes.Identifier.MatchString(name):
+				groups = append(groups, scope.Quote(e, name))
+			default:
+				return "", fmt.Errorf("ngorm: invalid GROUP BY column %q", name)
+			}
+		}
+	}
+	for _, expr := range e.Search.GroupExprs {
+		exp := expr.Q
+		for _, arg := range expr.Args {
+			exp = strings.Replace(exp, "?", scope.AddToVars(e, arg), 1)
+		}
+		groups = append(groups, exp)
+	}
+	return " GROUP BY " + strings.Join(groups, ","), nil
 }
 
 //HavingSQL builds HAVING SQL clause
@@ -476,7 +682,12 @@ func HavingSQL(e *engine.Engine, modelValue interface{}) (string, error) {
 		if err != nil {
 			return "", err
 		}
-		andConditions = append(andConditions, sql)
+		if sql != "" {
+			andConditions = append(andConditions, sql)
+		}
+	}
+	if len(andConditions) == 0 {
+		return "", nil
 	}
 	combinedSQL := strings.Join(andConditions, " AND ")
 	return " HAVING " + combinedSQL, nil
@@ -495,7 +706,34 @@ func PrepareQuery(e *engine.Engine, modelValue interface{}) error {
 
 //PrepareQuerySQL returns SQL that has been built on the engine e for the
 //modelValue.
+//
+// When e.Plans is set the SQL is looked up in the plan cache first, in which
+// case only the bind variables are collected from the search.
 func PrepareQuerySQL(e *engine.Engine, modelValue interface{}) (string, error) {
+	if e.Plans == nil {
+		return prepareQuerySQL(e, modelValue)
+	}
+	key, ok := planKey(e, modelValue)
+	if !ok {
+		return prepareQuerySQL(e, modelValue)
+	}
+	if q, ok := e.Plans.Get(key); ok {
+		e.Scope.SQLVars = append(e.Scope.SQLVars, planArgs(e)...)
+		return q, nil
+	}
+	q, err := prepareQuerySQL(e, modelValue)
+	if err != nil {
+		return "", err
+	}
+	// Only cache when the arguments collected from the search are exactly the
+	// ones bound while building, otherwise cache hits would bind wrong values.
+	if reflect.DeepEqual(planArgs(e), e.Scope.SQLVars) {
+		e.Plans.Set(key, q)
+	}
+	return q, nil
+}
+
+func prepareQuerySQL(e *engine.Engine, modelValue interface{}) (string, error) {
 	if e.Search.Raw {
 		c, err := CombinedCondition(e, modelValue)
 		if err != nil {
@@ -514,20 +752,147 @@ func PrepareQuerySQL(e *engine.Engine, modelValue interface{}) (string, error) {
 			from[i+1] = e.Search.TableNames[i]
 		}
 	}
+	hint, err := ClausesSQL(e, Hint)
+	if err != nil {
+		return "", err
+	}
 	return strings.Replace(
-		fmt.Sprintf("SELECT %v FROM %v %v",
+		fmt.Sprintf("SELECT%v %v FROM %v %v",
+			hint,
 			SelectSQL(e, modelValue),
 			strings.Join(from, ","),
 			c),
 		"$$", "?", -1), nil
 }
 
+//ToSQL returns the SELECT statement built on e for modelValue together with
+//its bind arguments. Nothing is executed, this is useful for logging, testing
+//or handing the statement over to a different executor.
+func ToSQL(e *engine.Engine, modelValue interface{}) (string, []interface{}, error) {
+	err := PrepareQuery(e, modelValue)
+	if err != nil {
+		return "", nil, err
+	}
+	if str, ok := e.Scope.Get(model.QueryOption); ok {
+		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	return e.Scope.SQL, e.Scope.SQLVars, nil
+}
+
+//CountSQL returns the statement counting the rows matched by the search built
+//on e for modelValue together with its bind arguments. ORDER BY, LIMIT and
+//OFFSET are ignored.
+//
+// When the search selects distinct columns, for instance
+// search.Select(e, "DISTINCT name"), the distinct values are counted. Grouped
+// searches count the number of groups. Both are counted with a subquery when
+// the dialect can't count them directly.
+func CountSQL(e *engine.Engine, modelValue interface{}) (string, []interface{}, error) {
+	s := e.Search
+	selects := s.Selects
+	defer withoutPaging(e)()
+
+	query, _ := selects["query"].(string)
+	args, _ := selects["args"].([]interface{})
+	var columns string
+	if m := regexes.DistinctColumns.FindStringSubmatch(query); m != nil {
+		columns = m[1]
+	}
+	wrap := s.Group != "" || len(s.GroupExprs) > 0 ||
+		(columns != "" && (strings.Contains(columns, ",") || dialects.IsQL(e.Dialect)))
+	if !wrap {
+		switch {
+		case columns != "":
+			s.Selects = map[string]interface{}{"query": "count(DISTINCT " + columns + ")", "args": args}
+		case !regexes.CountingQuery.MatchString(strings.TrimSpace(query)):
+			s.Selects = map[string]interface{}{"query": "count(*)", "args": []interface{}{}}
+		}
+		q, err := PrepareQuerySQL(e, modelValue)
+		if err != nil {
+			return "", nil, err
+		}
+		return q, e.Scope.SQLVars, nil
+	}
+	if query == "" {
+		s.Selects = map[string]interface{}{"query": "1", "args": []interface{}{}}
+	}
+	q, err := PrepareQuerySQL(e, modelValue)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("SELECT count(*) FROM (%s) AS ngorm_count", q), e.Scope.SQLVars, nil
+}
+
+//AggregateSQL returns the statement applying the aggregate function fn, for
+//instance sum, to column over the rows matched by the search built on e for
+//modelValue. ORDER BY, LIMIT and OFFSET are ignored.
+//
+// Grouped searches return a row per group, with the columns of GROUP BY
+// followed by the aggregate named after column. ORDER BY, LIMIT and OFFSET
+// then apply to the groups. An error is returned when the search is grouped by
+// expressions or column positions, which the rows can't be matched with.
+func AggregateSQL(e *engine.Engine, modelValue interface{}, fn, column string) (string, []interface{}, error) {
+	if !regexes.Identifier.MatchString(fn) || !regexes.Identifier.MatchString(column) {
+		return "", nil, errmsg.ErrInvalidSQL
+	}
+	s := e.Search
+	if s.Group == "" && len(s.GroupExprs) == 0 {
+		defer withoutPaging(e)()
+		s.Selects = map[string]interface{}{
+			"query": fmt.Sprintf("%s(%s)", fn, scope.Quote(e, column)),
+			"args":  []interface{}{},
+		}
+	} else {
+		if len(s.GroupExprs) > 0 {
+			return "", nil, errors.New("ngorm: can't aggregate groups of expressions")
+		}
+		var keys []string
+		for _, name := range strings.Split(s.Group, ",") {
+			name = strings.TrimSpace(name)
+			if !regexes.Identifier.MatchString(name) {
+				return "", nil, fmt.Errorf("ngorm: can't aggregate groups of %q", name)
+			}
+			keys = append(keys, scope.Quote(e, name))
+		}
+		selects := s.Selects
+		defer func() { s.Selects = selects }()
+		s.Selects = map[string]interface{}{
+			"query": fmt.Sprintf("%s, %s(%s) AS %s", strings.Join(keys, ", "), fn,
+				scope.Quote(e, column), scope.Quote(e, column)),
+			"args": []interface{}{},
+		}
+	}
+	q, err := PrepareQuerySQL(e, modelValue)
+	if err != nil {
+		return "", nil, err
+	}
+	return q, e.Scope.SQLVars, nil
+}
+
+// withoutPaging clears ordering, limit and offset of the search on e and
+// returns a function restoring them, together with the selected columns.
+func withoutPaging(e *engine.Engine) func() {
+	s := e.Search
+	selects, ignore, limit, offset := s.Selects, s.IgnoreOrderQuery, s.Limit, s.Offset
+	s.IgnoreOrderQuery, s.Limit, s.Offset = true, nil, nil
+	return func() {
+		s.Selects, s.IgnoreOrderQuery, s.Limit, s.Offset = selects, ignore, limit, offset
+	}
+}
+
 //CombinedCondition combines all conditions to build a single SQL query.
 func CombinedCondition(e *engine.Engine, modelValue interface{}) (string, error) {
 	joinSQL, err := JoinSQL(e, modelValue)
 	if err != nil {
 		return "", err
 	}
+	before, err := ClausesSQL(e, BeforeWhere)
+	if err != nil {
+		return "", err
+	}
+	if before != "" {
+		joinSQL = strings.TrimSpace(joinSQL+before) + " "
+	}
 	whereSQL, err := WhereSQL(e, modelValue)
 	if err != nil {
 		return "", err
@@ -535,12 +900,24 @@ func CombinedCondition(e *engine.Engine, modelValue interface{}) (string, error)
 	if e.Search.Raw {
 		whereSQL = strings.TrimSuffix(strings.TrimPrefix(whereSQL, "WHERE ("), ")")
 	}
+	group, err := GroupSQL(e)
+	if err != nil {
+		return "", err
+	}
 	having, err := HavingSQL(e, modelValue)
 	if err != nil {
 		return "", err
 	}
-	return joinSQL + whereSQL + GroupSQL(e) + having +
-		OrderSQL(e, modelValue) + LimitAndOffsetSQL(e), nil
+	after, err := ClausesSQL(e, AfterLimit)
+	if err != nil {
+		return "", err
+	}
+	order, err := orderSQL(e)
+	if err != nil {
+		return "", err
+	}
+	return joinSQL + whereSQL + group + having +
+		order + LimitAndOffsetSQL(e) + after, nil
 }
 
 // AddIndex builds SQL to add index for columns with given name
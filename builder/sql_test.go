@@ -1,32 +1,74 @@
 package builder
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/ngorm/ngorm/clause"
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
 	"github.com/ngorm/ngorm/fixture"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
 	"github.com/ngorm/ngorm/search"
 	"github.com/ngorm/ql"
 )
 
 func TestGroup(t *testing.T) {
 	e := fixture.TestEngine()
-	s := GroupSQL(e)
+	e.Dialect = ql.Memory()
+	s, err := GroupSQL(e)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if s != "" {
 		t.Errorf("expected an empty string got %s", s)
 	}
 	by := "location"
-	err := search.Group(e, by)
+	err = search.Group(e, by)
 	if err != nil {
 		t.Error(err)
 	}
-	s = GroupSQL(e)
+	s, err = GroupSQL(e)
+	if err != nil {
+		t.Fatal(err)
+	}
 	expect := " GROUP BY " + by
 	if s != expect {
 		t.Errorf("expected %s got %s", expect, s)
 	}
 
+	_ = search.Group(e, &model.Expr{Q: "substr(name, ?)", Args: []interface{}{1}})
+	_ = search.Group(e, "users.age, created_at")
+	_ = search.Group(e, 2)
+	s, err = GroupSQL(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = " GROUP BY location,users.age,created_at,2,substr(name, $1)"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(e.Scope.SQLVars) != 1 {
+		t.Errorf("expected 1 var got %v", e.Scope.SQLVars)
+	}
+
+	err = search.Group(e, 1.5)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	for _, group := range []string{"name; DROP TABLE users", "DATE(created_at)"} {
+		e = fixture.TestEngine()
+		e.Dialect = ql.Memory()
+		_ = search.Group(e, group)
+		_, err = GroupSQL(e)
+		if err == nil {
+			t.Errorf("expected an error for %s", group)
+		}
+	}
 }
 
 func TestLimitAndOffsetSQL(t *testing.T) {
@@ -44,6 +86,33 @@ func TestLimitAndOffsetSQL(t *testing.T) {
 
 }
 
+type failingExpr struct{}
+
+func (failingExpr) Build(clause.Builder) (string, error) {
+	return "", errors.New("failing")
+}
+
+func TestOrderExpression(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	search.Order(e, "name")
+	search.Order(e, clause.Raw("length(name) > ?", 3))
+	var user fixture.User
+	s, err := PrepareQuerySQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT * FROM users   ORDER BY name,length(name) > $1"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	search.Order(e, failingExpr{})
+	_, err = PrepareQuerySQL(e, &user)
+	if err == nil {
+		t.Error("expected the error of the order expression")
+	}
+}
+
 func TestPrepareQuerySQL(t *testing.T) {
 	e := fixture.TestEngine()
 	e.Dialect = ql.Memory()
@@ -174,6 +243,22 @@ func TestWhere(t *testing.T) {
 	if s != expect {
 		t.Errorf("expected %s got %s", expect, s)
 	}
+
+	// Struct with zero values included
+	e.Search.WhereConditions = nil
+	e.Scope.SQLVars = nil
+	search.WhereStruct(e, &fixture.User{Name: "gernest"}, "Age", "email")
+	s, err = Where(e, &user, e.Search.WhereConditions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = `(age = $1) AND (name = $2) AND (email = $3)`
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if e.Scope.SQLVars[0] != int64(0) || e.Scope.SQLVars[2] != "" {
+		t.Errorf("expected zero values got %v", e.Scope.SQLVars)
+	}
 }
 
 func TestNot(t *testing.T) {
@@ -273,3 +358,435 @@ func TestNot(t *testing.T) {
 	}
 
 }
+
+func TestWhereClause(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+
+	search.In(e, "name", []string{"gernest", "kilimahewa"})
+	search.NotIn(e, "age", []int{1, 2})
+	search.Between(e, "age", 18, 30)
+	search.IsNull(e, "email")
+	search.IsNotNull(e, "name")
+	search.Gt(e, "age", 10)
+	search.Lte(e, "age", 40)
+	search.In(e, "id", []int{})
+	search.NotIn(e, "id", []int{})
+	expect := []string{
+		"(name IN ($1,$2))",
+		"(age NOT IN ($3,$4))",
+		"(age BETWEEN $5 AND $6)",
+		"(email IS NULL)",
+		"(name IS NOT NULL)",
+		"(age > $7)",
+		"(age <= $8)",
+		"(1 <> 1)",
+		"",
+	}
+	for i, c := range e.Search.WhereConditions {
+		s, err := Where(e, &user, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != expect[i] {
+			t.Errorf("expected %s got %s", expect[i], s)
+		}
+	}
+	if len(e.Scope.SQLVars) != 8 {
+		t.Errorf("expected 8 vars got %d", len(e.Scope.SQLVars))
+	}
+
+	e.Search.WhereConditions = nil
+	e.Scope.SQLVars = nil
+	search.Where(e, "name = ?", "gernest")
+	search.NotIn(e, "id", []int{})
+	s, err := WhereSQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "WHERE (name = $1)"
+	if s != exp {
+		t.Errorf("expected %s got %s", exp, s)
+	}
+
+	e.Search.WhereConditions = nil
+	e.Scope.SQLVars = nil
+	search.Not(e, clause.In("name", []string{"gernest"}))
+	s, err = Not(e, &user, e.Search.NotConditions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = "(NOT (name IN ($1)))"
+	if s != exp {
+		t.Errorf("expected %s got %s", exp, s)
+	}
+}
+
+type tupleDialect struct {
+	*ql.QL
+}
+
+func (tupleDialect) RowValues() bool { return true }
+
+func TestTupleIn(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	pairs := [][]interface{}{{1, "a"}, {2, "b"}}
+	search.TupleIn(e, []string{"id", "name"}, pairs)
+	s, err := Where(e, &user, e.Search.WhereConditions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "((id = $1 AND name = $2) OR (id = $3 AND name = $4))"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+
+	e = fixture.TestEngine()
+	e.Dialect = tupleDialect{&ql.QL{}}
+	users := []fixture.User{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}
+	search.TupleIn(e, []string{"id", "name"}, users)
+	s, err = Where(e, &user, e.Search.WhereConditions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "((id,name) IN (($1,$2),($3,$4)))"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(e.Scope.SQLVars) != 4 || e.Scope.SQLVars[3] != "b" {
+		t.Errorf("unexpected vars %v", e.Scope.SQLVars)
+	}
+
+	e.Scope.SQLVars = nil
+	s, err = Where(e, &user, map[string]interface{}{
+		"query": clause.TupleIn([]string{"id", "name"}, [][]int{{1}}),
+		"args":  []interface{}{},
+	})
+	if err == nil {
+		t.Errorf("expected an error got %s", s)
+	}
+}
+
+func TestExists(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	sub := fixture.TestEngine()
+	search.Where(sub, "emails.user_id = users.id")
+	search.Where(sub, "emails.email = ?", "gernest@example.com")
+
+	search.Where(e, "name = ?", "gernest")
+	search.Exists(e, sub, &fixture.Email{})
+	search.NotExists(e, sub, &fixture.Email{})
+	s, err := WhereSQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "WHERE (name = $1) AND " +
+		"(EXISTS (SELECT * FROM emails  WHERE (emails.user_id = users.id) AND (emails.email = $2))) AND " +
+		"(NOT EXISTS (SELECT * FROM emails  WHERE (emails.user_id = users.id) AND (emails.email = $3)))"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(e.Scope.SQLVars) != 3 {
+		t.Errorf("expected 3 vars got %v", e.Scope.SQLVars)
+	}
+}
+
+func TestTableAlias(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	search.Table(e, "users AS u")
+	search.Not(e, map[string]interface{}{"name": "gernest"})
+	search.Select(e, "u.name")
+	s, err := PrepareQuerySQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT u.name FROM users AS u  WHERE (u.name <> $1)"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	search.Alias(e, "u1")
+	search.Join(e, "JOIN users AS u2 ON u1.name = u2.name AND u1.id != u2.id")
+	search.Not(e, map[string]interface{}{"name": "gernest"})
+	s, err := PrepareQuerySQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT u1.* FROM users AS u1 JOIN users AS u2 ON u1.name = u2.name AND u1.id != u2.id WHERE (u1.name <> $1)"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	e.Scope = model.NewScope()
+	var user fixture.User
+	search.Where(e, "name = ?", "gernest")
+	search.Limit(e, 1)
+	e.Scope.Set(model.QueryOption, "-- dry run")
+	s, args, err := ToSQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT * FROM users  WHERE (name = $1) LIMIT 1 -- dry run"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(args) != 1 || args[0] != "gernest" {
+		t.Errorf("expected [gernest] got %v", args)
+	}
+}
+
+func TestWhereNamed(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	params := struct {
+		Name string
+		Age  int
+		IDs  []int64 `gorm:"column:ids"`
+	}{"gernest", 18, []int64{1, 2}}
+	search.WhereNamed(e, "name = :name AND age > :age AND id IN (:ids) AND note <> ':name' AND age::text <> ''", params)
+	s, err := WhereSQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "WHERE (name = $1 AND age > $2 AND id IN ($3,$4) AND note <> ':name' AND age::text <> '')"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	if len(e.Scope.SQLVars) != 4 {
+		t.Errorf("expected 4 vars got %v", e.Scope.SQLVars)
+	}
+
+	e.Search.WhereConditions = nil
+	search.WhereNamed(e, "name = :nick", params)
+	_, err = WhereSQL(e, &user)
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	e.Search.WhereConditions = nil
+	params.IDs = nil
+	search.WhereNamed(e, "id IN (:ids)", params)
+	_, err = WhereSQL(e, &user)
+	if err == nil || !strings.Contains(err.Error(), "ids") {
+		t.Errorf("expected an error for the empty slice got %v", err)
+	}
+
+	e.Search.WhereConditions = nil
+	search.Where(e, clause.Raw("id IN (?)", []int64{}))
+	_, err = WhereSQL(e, &user)
+	if err == nil {
+		t.Error("expected an error for the empty raw slice")
+	}
+}
+
+func TestGroupedConditions(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	search.Where(e, clause.Group(
+		clause.Or(clause.Eq("name", "gernest"), clause.Raw("email IN (?)", []string{"a", "b"})),
+		clause.And(clause.Gte("age", 18), clause.NotIn("id", []int{})),
+	))
+	s, err := WhereSQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "WHERE (((name = $1) OR (email IN ($2,$3))) AND ((age >= $4)))"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+
+	e.Search.WhereConditions = nil
+	search.Where(e, clause.Or(clause.Raw("name = ?")))
+	_, err = WhereSQL(e, &user)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestPlanCache(t *testing.T) {
+	plans := model.NewPlanCache(10)
+	build := func(name string, ids []int) (string, []interface{}) {
+		e := fixture.TestEngine()
+		e.Dialect = ql.Memory()
+		e.Plans = plans
+		var users []fixture.User
+		search.Where(e, "name = ?", name)
+		search.Where(e, "id IN (?)", ids)
+		search.Order(e, "id")
+		s, err := PrepareQuerySQL(e, &users)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s, e.Scope.SQLVars
+	}
+	s1, args1 := build("gernest", []int{1, 2})
+	s2, args2 := build("kilimahewa", []int{3, 4})
+	if s1 != s2 {
+		t.Errorf("expected %s got %s", s1, s2)
+	}
+	expect := []interface{}{"kilimahewa", 3, 4}
+	if !reflect.DeepEqual(args2, expect) {
+		t.Errorf("expected %v got %v", expect, args2)
+	}
+	if len(args1) != 3 {
+		t.Errorf("expected 3 args got %v", args1)
+	}
+	if hits, misses := plans.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("expected 1 hit and 1 miss got %d and %d", hits, misses)
+	}
+
+	// A different number of IN values changes the search structure.
+	s3, _ := build("gernest", []int{1, 2, 3})
+	if s3 == s1 {
+		t.Errorf("expected a different statement got %s", s3)
+	}
+	if hits, _ := plans.Stats(); hits != 1 {
+		t.Errorf("expected 1 hit got %d", hits)
+	}
+}
+
+func TestClauses(t *testing.T) {
+	RegisterClause("test_hint", Hint, func(e *engine.Engine, v interface{}) (string, error) {
+		return fmt.Sprintf("/*+ %v */", v), nil
+	})
+	RegisterClause("test_as_of", BeforeWhere, func(e *engine.Engine, v interface{}) (string, error) {
+		return "AS OF SYSTEM TIME " + scope.AddToVars(e, v), nil
+	})
+	RegisterClause("test_lock", AfterLimit, func(e *engine.Engine, v interface{}) (string, error) {
+		return "FOR UPDATE", nil
+	})
+	e := fixture.TestEngine()
+	e.Dialect = ql.Memory()
+	var user fixture.User
+	search.Where(e, "name = ?", "gernest")
+	search.Clause(e, "test_lock", nil)
+	search.Clause(e, "test_as_of", "-10s")
+	search.Clause(e, "test_hint", "INDEX(users idx_name)")
+	s, err := PrepareQuerySQL(e, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT /*+ INDEX(users idx_name) */ * FROM users AS OF SYSTEM TIME $1 WHERE (name = $2) FOR UPDATE"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+
+	search.Clause(e, "test_missing", nil)
+	_, err = PrepareQuerySQL(e, &user)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestCountSQL(t *testing.T) {
+	sample := []struct {
+		prepare func(e *engine.Engine)
+		expect  string
+	}{
+		{func(e *engine.Engine) {
+			search.Order(e, "name")
+			search.Limit(e, 10)
+		}, "SELECT count(*) FROM users  WHERE (name = $1)"},
+		{func(e *engine.Engine) {
+			search.Select(e, "DISTINCT name")
+		}, "SELECT count(*) FROM (SELECT DISTINCT name FROM users  WHERE (name = $1)) AS ngorm_count"},
+		{func(e *engine.Engine) {
+			_ = search.Group(e, "name")
+		}, "SELECT count(*) FROM (SELECT 1 FROM users  WHERE (name = $1) GROUP BY name) AS ngorm_count"},
+	}
+	for _, v := range sample {
+		e := fixture.TestEngine()
+		e.Dialect = ql.Memory()
+		search.Where(e, "name = ?", "gernest")
+		v.prepare(e)
+		var user fixture.User
+		s, args, err := CountSQL(e, &user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != v.expect {
+			t.Errorf("expected %s got %s", v.expect, s)
+		}
+		if len(args) != 1 {
+			t.Errorf("expected 1 argument got %v", args)
+		}
+		if e.Search.Limit == nil && len(e.Search.Orders) > 0 {
+			t.Error("expected the search to be restored")
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	sample := []struct {
+		q, expect string
+	}{
+		{"SELECT u1.* FROM users AS u1 JOIN users AS u2 ON u1.name = u2.name AND u1.id != u2.id  WHERE (u1.age > $1) OR (u1.role = $2) LIMIT 10",
+			"SELECT u1.*\nFROM users AS u1\nJOIN users AS u2 ON u1.name = u2.name\n  AND u1.id != u2.id\nWHERE (u1.age > $1)\n  OR (u1.role = $2)\nLIMIT 10"},
+		{"select * from users left outer join emails on emails.user_id = users.id where (age between $1 and $2) group by name having (count(*) > 1) order by name",
+			"select *\nfrom users\nleft outer join emails on emails.user_id = users.id\nwhere (age between $1 and $2)\ngroup by name\nhaving (count(*) > 1)\norder by name"},
+		{"SELECT * FROM users  WHERE (name = 'a from b where c') AND id IN (SELECT user_id FROM emails WHERE verified = $1)",
+			"SELECT *\nFROM users\nWHERE (name = 'a from b where c')\n  AND id IN (SELECT user_id FROM emails WHERE verified = $1)"},
+		{"BEGIN TRANSACTION;\n\tDELETE FROM foos  WHERE (id == $1) && (stuff == $2);\nCOMMIT;",
+			"BEGIN TRANSACTION;\nDELETE FROM foos\nWHERE (id == $1)\n  && (stuff == $2);\nCOMMIT;"},
+		{"UPDATE foos SET stuff = $1 WHERE id = $2 RETURNING id",
+			"UPDATE foos\nSET stuff = $1\nWHERE id = $2\nRETURNING id"},
+		{"INSERT INTO foos (stuff) VALUES ($1)", "INSERT INTO foos (stuff)\nVALUES ($1)"},
+	}
+	for _, v := range sample {
+		got := Format(v.q)
+		if got != v.expect {
+			t.Errorf("expected\n%s\ngot\n%s", v.expect, got)
+		}
+	}
+}
+
+type mysqlDialect struct {
+	*ql.QL
+}
+
+func (mysqlDialect) GetName() string { return "mysql" }
+
+func TestSplitStatements(t *testing.T) {
+	sample := []struct {
+		d      dialects.Dialect
+		script string
+		expect []string
+	}{
+		{ql.Memory(), "CREATE TABLE a (id int);\n INSERT INTO a VALUES (1) ;\n\n",
+			[]string{"CREATE TABLE a (id int)", "INSERT INTO a VALUES (1)"}},
+		{ql.Memory(), "INSERT INTO a VALUES ('x;y', \"z;\", `w;`); SELECT 1",
+			[]string{"INSERT INTO a VALUES ('x;y', \"z;\", `w;`)", "SELECT 1"}},
+		{ql.Memory(), "-- setup; fixtures\nSELECT 1; /* done; */\n-- trailing;",
+			[]string{"-- setup; fixtures\nSELECT 1"}},
+		{ql.Memory(), "SELECT 'it''s;'; SELECT $1",
+			[]string{"SELECT 'it''s;'", "SELECT $1"}},
+		{ql.Memory(), "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql; SELECT $$;$$",
+			[]string{"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql", "SELECT $$;$$"}},
+		{mysqlDialect{ql.Memory()}, `INSERT INTO a VALUES ('it\'s;'); SELECT 1`,
+			[]string{`INSERT INTO a VALUES ('it\'s;')`, "SELECT 1"}},
+	}
+	for _, v := range sample {
+		got := SplitStatements(v.d, v.script)
+		if !reflect.DeepEqual(got, v.expect) {
+			t.Errorf("expected %q got %q", v.expect, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package clause provides typed SQL conditions.
+//
+// The conditions defined here can be passed anywhere ngorm accepts a query
+// value, for instance search.Where or search.Having. They are rendered by the
+// builder package which takes care of quoting column names for the active
+// dialect and binding values as positional arguments, so no value is ever
+// interpolated into the generated SQL.
+//
+//  search.Where(e, clause.In("name", []string{"gernest", "kilimahewa"}))
+//  search.Where(e, clause.Between("age", 18, 30))
+//  search.Where(e, clause.IsNull("deleted_at"))
+//
+// Conditions can be combined with And and Or, which take care of the
+// parentheses
+//
+//  search.Where(e, clause.Or(clause.Eq("role", "admin"), clause.Gte("age", 18)))
+package clause
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+//Builder is the interface used by expressions to render themselves into SQL.
+//It is implemented by the builder package.
+type Builder interface {
+	// Quote returns column quoted for the current dialect.
+	Quote(column string) string
+
+	// AddToVars adds value to the positional arguments of the statement being
+	// built and returns the placeholder that refers to it.
+	AddToVars(value interface{}) string
+
+	// RowValues returns true if the dialect supports row value constructors.
+	RowValues() bool
+
+	// SubQuery returns the SELECT statement of q. Bind variables of q are
+	// added to the statement being built.
+	SubQuery(q *model.SubQuery) (string, error)
+}
+
+//Expression is a condition which knows how to render itself into SQL. An
+//empty string means the expression imposes no condition.
+type Expression interface {
+	Build(b Builder) (string, error)
+}
+
+type comparison struct {
+	column string
+	op     string
+	value  interface{}
+}
+
+func (c comparison) Build(b Builder) (string, error) {
+	return fmt.Sprintf("%s %s %s", b.Quote(c.column), c.op, b.AddToVars(c.value)), nil
+}
+
+//Eq returns column = value condition.
+func Eq(column string, value interface{}) Expression {
+	return comparison{column: column, op: "=", value: value}
+}
+
+//Neq returns column <> value condition.
+func Neq(column string, value interface{}) Expression {
+	return comparison{column: column, op: "<>", value: value}
+}
+
+//Gt returns column > value condition.
+func Gt(column string, value interface{}) Expression {
+	return comparison{column: column, op: ">", value: value}
+}
+
+//Gte returns column >= value condition.
+func Gte(column string, value interface{}) Expression {
+	return comparison{column: column, op: ">=", value: value}
+}
+
+//Lt returns column < value condition.
+func Lt(column string, value interface{}) Expression {
+	return comparison{column: column, op: "<", value: value}
+}
+
+//Lte returns column <= value condition.
+func Lte(column string, value interface{}) Expression {
+	return comparison{column: column, op: "<=", value: value}
+}
+
+type in struct {
+	column string
+	values interface{}
+	not    bool
+}
+
+func (i in) Build(b Builder) (string, error) {
+	values := Values(i.values)
+	if len(values) == 0 {
+		if i.not {
+			// Nothing is excluded.
+			return "", nil
+		}
+		// Nothing can match an empty set.
+		return "1 <> 1", nil
+	}
+	marks := make([]string, len(values))
+	for k, v := range values {
+		marks[k] = b.AddToVars(v)
+	}
+	op := "IN"
+	if i.not {
+		op = "NOT IN"
+	}
+	return fmt.Sprintf("%s %s (%s)", b.Quote(i.column), op, strings.Join(marks, ",")), nil
+}
+
+//In returns column IN (values) condition. values is expected to be a slice,
+//every element of the slice is bound as a separate positional argument. An
+//empty slice results in a condition that never matches.
+func In(column string, values interface{}) Expression {
+	return in{column: column, values: values}
+}
+
+//NotIn returns column NOT IN (values) condition. An empty slice results in no
+//condition at all.
+func NotIn(column string, values interface{}) Expression {
+	return in{column: column, values: values, not: true}
+}
+
+type between struct {
+	column       string
+	lower, upper interface{}
+}
+
+func (bt between) Build(b Builder) (string, error) {
+	return fmt.Sprintf("%s BETWEEN %s AND %s",
+		b.Quote(bt.column), b.AddToVars(bt.lower), b.AddToVars(bt.upper)), nil
+}
+
+//Between returns column BETWEEN lower AND upper condition.
+func Between(column string, lower, upper interface{}) Expression {
+	return between{column: column, lower: lower, upper: upper}
+}
+
+type null struct {
+	column string
+	not    bool
+}
+
+func (n null) Build(b Builder) (string, error) {
+	if n.not {
+		return b.Quote(n.column) + " IS NOT NULL", nil
+	}
+	return b.Quote(n.column) + " IS NULL", nil
+}
+
+//IsNull returns column IS NULL condition.
+func IsNull(column string) Expression {
+	return null{column: column}
+}
+
+//IsNotNull returns column IS NOT NULL condition.
+func IsNotNull(column string) Expression {
+	return null{column: column, not: true}
+}
+
+//Values returns the elements of v when v is a slice or an array, []byte is
+//treated as a single value. Any other value is returned as the only element.
+func Values(v interface{}) []interface{} {
+	if v == nil {
+		return nil
+	}
+	if _, ok := v.([]byte); ok {
+		return []interface{}{v}
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		o := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			o[i] = rv.Index(i).Interface()
+		}
+		return o
+	}
+	return []interface{}{v}
+}
@@ -0,0 +1,35 @@
+package clause
+
+import "github.com/ngorm/ngorm/model"
+
+type exists struct {
+	query *model.SubQuery
+	not   bool
+}
+
+//Exists returns EXISTS (subquery) condition. The subquery can refer to columns
+//of the outer query, for instance
+//
+//  search.Where(sub, "emails.user_id = users.id")
+//  search.Where(e, clause.Exists(&model.SubQuery{Search: sub.Search, Value: &Email{}}))
+//
+// Note that not all dialects support EXISTS, ql for instance does not.
+func Exists(q *model.SubQuery) Expression {
+	return exists{query: q}
+}
+
+//NotExists returns NOT EXISTS (subquery) condition.
+func NotExists(q *model.SubQuery) Expression {
+	return exists{query: q, not: true}
+}
+
+func (x exists) Build(b Builder) (string, error) {
+	s, err := b.SubQuery(x.query)
+	if err != nil {
+		return "", err
+	}
+	if x.not {
+		return "NOT EXISTS (" + s + ")", nil
+	}
+	return "EXISTS (" + s + ")", nil
+}
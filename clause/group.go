@@ -0,0 +1,108 @@
+package clause
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type group struct {
+	op    string
+	exprs []Expression
+}
+
+//And returns a condition that matches when all exprs match. Every expression
+//is parenthesized so they can be nested freely
+//
+//  And(Eq("name", "gernest"), Or(Lt("age", 18), Gt("age", 60)))
+//
+// gives
+//
+//  (name = $1) AND ((age < $2) OR (age > $3))
+//
+// Expressions that render to an empty string are skipped, an And with no
+// remaining expressions imposes no condition.
+func And(exprs ...Expression) Expression {
+	return group{op: "AND", exprs: exprs}
+}
+
+//Or returns a condition that matches when any of exprs match.
+func Or(exprs ...Expression) Expression {
+	return group{op: "OR", exprs: exprs}
+}
+
+//Group is the same as And, it exists for readability when wrapping other
+//groups.
+func Group(exprs ...Expression) Expression {
+	return And(exprs...)
+}
+
+func (g group) Build(b Builder) (string, error) {
+	var parts []string
+	for _, expr := range g.exprs {
+		if expr == nil {
+			continue
+		}
+		s, err := expr.Build(b)
+		if err != nil {
+			return "", err
+		}
+		if s != "" {
+			parts = append(parts, "("+s+")")
+		}
+	}
+	return strings.Join(parts, " "+g.op+" "), nil
+}
+
+type raw struct {
+	query string
+	args  []interface{}
+}
+
+//Raw returns query as a condition, ? placeholders are bound to args in order.
+//This is meant for conditions not covered by the other expressions, for
+//instance
+//
+//  Or(Raw("lower(name) = ?", "gernest"), IsNull("name"))
+//
+// Slice arguments are expanded the same way as with Named.
+func Raw(query string, args ...interface{}) Expression {
+	return raw{query: query, args: args}
+}
+
+func (r raw) Build(b Builder) (string, error) {
+	var buf bytes.Buffer
+	var quote byte
+	pos := 0
+	for i := 0; i < len(r.query); i++ {
+		c := r.query[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			buf.WriteByte(c)
+		case '?':
+			if pos >= len(r.args) {
+				return "", fmt.Errorf("clause: missing argument %d for %q", pos+1, r.query)
+			}
+			marks, err := bindNamed(b, r.args[pos])
+			if err != nil {
+				return "", fmt.Errorf("clause: argument %d for %q: %v", pos+1, r.query, err)
+			}
+			buf.WriteString(marks)
+			pos++
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	if pos != len(r.args) {
+		return "", fmt.Errorf("clause: expected %d arguments for %q got %d", pos, r.query, len(r.args))
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,128 @@
+package clause
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type named struct {
+	query  string
+	params interface{}
+}
+
+//Named returns query with :name placeholders bound to values from params.
+//
+// params is a struct, or a pointer to one, whose fields are matched by their
+// database names the same way columns are, so :user_name refers to a field
+// UserName or one tagged COLUMN:user_name. A map[string]interface{} keyed by
+// placeholder names is accepted too.
+//
+// Slices are expanded into a comma separated list of placeholders, which makes
+// them usable with IN, empty slices are an error. Placeholders inside quoted
+// strings and :: casts are left untouched.
+//
+//  Named("name = :name AND age > :age", struct {
+//  	Name string
+//  	Age  int
+//  }{"gernest", 18})
+func Named(query string, params interface{}) Expression {
+	return named{query: query, params: params}
+}
+
+func (n named) Build(b Builder) (string, error) {
+	lookup, err := n.lookup()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	var quote byte
+	q := n.query
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			buf.WriteByte(c)
+		case c == ':' && i+1 < len(q) && q[i+1] == ':':
+			buf.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(q) && isNameStart(q[i+1]):
+			j := i + 1
+			for j < len(q) && isNamePart(q[j]) {
+				j++
+			}
+			name := q[i+1 : j]
+			v, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("clause: missing value for named parameter %s", name)
+			}
+			marks, err := bindNamed(b, v)
+			if err != nil {
+				return "", fmt.Errorf("clause: named parameter %s: %v", name, err)
+			}
+			buf.WriteString(marks)
+			i = j - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), nil
+}
+
+// lookup returns a function which finds values of named parameters.
+func (n named) lookup() (func(string) (interface{}, bool), error) {
+	if m, ok := n.params.(map[string]interface{}); ok {
+		return func(name string) (interface{}, bool) {
+			v, ok := m[name]
+			return v, ok
+		}, nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(n.params))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("clause: unsupported named parameters %T", n.params)
+	}
+	fields := structFields(rv)
+	return func(name string) (interface{}, bool) {
+		f, ok := fields[name]
+		if !ok {
+			return nil, false
+		}
+		return f.Interface(), true
+	}, nil
+}
+
+func bindNamed(b Builder, v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if _, ok := v.([]byte); ok || rv.Kind() != reflect.Slice {
+		return b.AddToVars(v), nil
+	}
+	values := Values(v)
+	if len(values) == 0 {
+		// IN () is invalid and the placeholder can't be replaced by a
+		// condition, since the query around it is unknown.
+		return "", errors.New("empty slice")
+	}
+	marks := make([]string, len(values))
+	for k, value := range values {
+		marks[k] = b.AddToVars(value)
+	}
+	return strings.Join(marks, ","), nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,145 @@
+package clause
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/util"
+)
+
+type tupleIn struct {
+	columns []string
+	values  interface{}
+	not     bool
+}
+
+//TupleIn returns (columns...) IN ((?,?),(?,?)) condition.
+//
+// values is a slice where each element provides one tuple. An element can be a
+// slice or an array with exactly one value per column, or a struct in which
+// case the values are read from the fields whose database names match the
+// columns.
+//
+// Dialects that lack row value syntax get the equivalent
+//  (a = ? AND b = ?) OR (a = ? AND b = ?)
+func TupleIn(columns []string, values interface{}) Expression {
+	return tupleIn{columns: columns, values: values}
+}
+
+//TupleNotIn is like TupleIn but excludes the tuples.
+func TupleNotIn(columns []string, values interface{}) Expression {
+	return tupleIn{columns: columns, values: values, not: true}
+}
+
+func (t tupleIn) Build(b Builder) (string, error) {
+	if len(t.columns) == 0 {
+		return "", fmt.Errorf("clause: tuple condition has no columns")
+	}
+	rows, err := t.rows()
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		if t.not {
+			return "", nil
+		}
+		return "1 <> 1", nil
+	}
+	cols := make([]string, len(t.columns))
+	for k, v := range t.columns {
+		cols[k] = b.Quote(v)
+	}
+	if b.RowValues() {
+		tuples := make([]string, len(rows))
+		for k, row := range rows {
+			marks := make([]string, len(row))
+			for i, v := range row {
+				marks[i] = b.AddToVars(v)
+			}
+			tuples[k] = "(" + strings.Join(marks, ",") + ")"
+		}
+		op := "IN"
+		if t.not {
+			op = "NOT IN"
+		}
+		return fmt.Sprintf("(%s) %s (%s)",
+			strings.Join(cols, ","), op, strings.Join(tuples, ",")), nil
+	}
+	ors := make([]string, len(rows))
+	for k, row := range rows {
+		ands := make([]string, len(row))
+		for i, v := range row {
+			ands[i] = fmt.Sprintf("%s = %s", cols[i], b.AddToVars(v))
+		}
+		ors[k] = "(" + strings.Join(ands, " AND ") + ")"
+	}
+	if t.not {
+		return "NOT (" + strings.Join(ors, " OR ") + ")", nil
+	}
+	return strings.Join(ors, " OR "), nil
+}
+
+// rows returns the values of every tuple ordered by columns.
+func (t tupleIn) rows() ([][]interface{}, error) {
+	var rows [][]interface{}
+	for _, v := range Values(t.values) {
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		switch rv.Kind() {
+		case reflect.Struct:
+			row, err := structTuple(rv, t.columns)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		case reflect.Slice, reflect.Array:
+			if rv.Len() != len(t.columns) {
+				return nil, fmt.Errorf("clause: expected %d values in tuple got %d",
+					len(t.columns), rv.Len())
+			}
+			row := make([]interface{}, rv.Len())
+			for i := range row {
+				row[i] = rv.Index(i).Interface()
+			}
+			rows = append(rows, row)
+		default:
+			return nil, fmt.Errorf("clause: unsupported tuple value %T", v)
+		}
+	}
+	return rows, nil
+}
+
+// structTuple picks the values of fields of v matching columns. Fields are
+// matched by their database names, honoring the COLUMN tag.
+func structTuple(v reflect.Value, columns []string) ([]interface{}, error) {
+	fields := structFields(v)
+	row := make([]interface{}, len(columns))
+	for k, c := range columns {
+		f, ok := fields[c]
+		if !ok {
+			return nil, fmt.Errorf("clause: %s has no field for column %s", v.Type(), c)
+		}
+		row[k] = f.Interface()
+	}
+	return row, nil
+}
+
+// structFields returns exported fields of struct v keyed by their database
+// names.
+func structFields(v reflect.Value) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := util.ToDBName(f.Name)
+		if c, ok := model.ParseTagSetting(f.Tag)["COLUMN"]; ok {
+			name = c
+		}
+		fields[name] = v.Field(i)
+	}
+	return fields
+}
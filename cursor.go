@@ -0,0 +1,91 @@
+package ngorm
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/hooks"
+)
+
+//Cursor iterates over the rows of a query one at a time, without loading them
+//all in memory.
+//
+//    c := db.Model(&User{}).Where("age > ?", 18).Cursor()
+//    defer c.Close()
+//    for c.Next() {
+//        var u User
+//        if err := c.Scan(&u); err != nil {
+//            return err
+//        }
+//    }
+//    if err := c.Err(); err != nil {
+//        return err
+//    }
+//
+// The connection used by the query is held until the rows are exhausted or
+// Close is called.
+type Cursor struct {
+	db        *DB
+	rows      *sql.Rows
+	columnMap map[string]string
+	err       error
+}
+
+//Cursor executes the query built so far and returns a cursor over its rows. An
+//error executing the query is reported by Err, Next then returns false.
+func (db *DB) Cursor() *Cursor {
+	c := &Cursor{db: db}
+	if db.e != nil {
+		c.columnMap = db.e.Search.ColumnMap
+	}
+	c.rows, c.err = db.Rows()
+	return c
+}
+
+//Next prepares the next row for Scan, it returns false when there are no more
+//rows or an error occurred, in which case the cursor is closed.
+func (c *Cursor) Next() bool {
+	if c.err != nil || c.rows == nil {
+		return false
+	}
+	if c.rows.Next() {
+		return true
+	}
+	c.err = c.rows.Err()
+	c.Close()
+	return false
+}
+
+//Scan scans the current row into dest, a pointer to a struct, to a
+//map[string]interface{} or to a scalar, see hooks.ScanRows. Columns are
+//matched with fields like for Find, including the mappings set with
+//MapColumns.
+func (c *Cursor) Scan(dest interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.rows == nil {
+		return errors.New("ngorm: scan on a closed cursor")
+	}
+	e := c.db.NewEngine()
+	defer engine.Put(e)
+	e.Search.ColumnMap = c.columnMap
+	return hooks.ScanRows(e, c.rows, dest)
+}
+
+//Err returns the error that stopped the iteration, nil when the rows were
+//exhausted.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+//Close releases the rows, it is safe to call it more than once.
+func (c *Cursor) Close() error {
+	if c.rows == nil {
+		return nil
+	}
+	err := c.rows.Close()
+	c.rows = nil
+	return err
+}
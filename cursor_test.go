@@ -0,0 +1,64 @@
+package ngorm
+
+import "testing"
+
+func TestCursor(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testCursor, &Foo{})
+	}
+}
+
+func testCursor(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		err = db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := db.Model(&Foo{}).Where("stuff != ?", "b").Order("id").Cursor()
+	defer c.Close()
+	var got []string
+	for c.Next() {
+		var foo Foo
+		if err := c.Scan(&foo); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, foo.Stuff)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Errorf("expected [a c] got %v", got)
+	}
+	if c.Next() {
+		t.Error("expected the cursor to be exhausted")
+	}
+	if err := c.Scan(&Foo{}); err == nil {
+		t.Error("expected an error scanning a closed cursor")
+	}
+
+	c = db.Model(&Foo{}).Select("stuff").Where("stuff = ?", "b").Cursor()
+	defer c.Close()
+	var stuff string
+	for c.Next() {
+		if err := c.Scan(&stuff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stuff != "b" {
+		t.Errorf("expected b got %s", stuff)
+	}
+
+	c = db.Table("missing").Cursor()
+	if c.Next() {
+		t.Error("expected no rows")
+	}
+	if c.Err() == nil {
+		t.Error("expected an error")
+	}
+}
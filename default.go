@@ -0,0 +1,49 @@
+package ngorm
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// holder wraps *DB because atomic.Value can't store nil.
+type holder struct {
+	db *DB
+}
+
+var defaultDB atomic.Value
+
+type contextKey struct{}
+
+//SetDefault sets db as the default handle returned by Default. This is safe to
+//call from multiple goroutines, pass nil to clear the default.
+func SetDefault(db *DB) {
+	defaultDB.Store(holder{db: db})
+}
+
+//Default returns the handle set with SetDefault, nil is returned when no
+//default has been set.
+//
+// This allows libraries built on ngorm to obtain a handle without threading it
+// through every function. Use NewContext to override the default for a single
+// context, for instance in tests.
+func Default() *DB {
+	h, _ := defaultDB.Load().(holder)
+	return h.db
+}
+
+//NewContext returns a copy of ctx carrying db. FromContext returns db for the
+//returned context instead of the default.
+func NewContext(ctx context.Context, db *DB) context.Context {
+	return context.WithValue(ctx, contextKey{}, db)
+}
+
+//FromContext returns the handle carried by ctx, falling back to Default when
+//there is none.
+func FromContext(ctx context.Context) *DB {
+	if ctx != nil {
+		if db, ok := ctx.Value(contextKey{}).(*DB); ok && db != nil {
+			return db
+		}
+	}
+	return Default()
+}
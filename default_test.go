@@ -0,0 +1,43 @@
+package ngorm
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	defer SetDefault(nil)
+	if db := Default(); db != nil {
+		t.Fatalf("expected no default got %v", db)
+	}
+	a, b := &DB{}, &DB{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				SetDefault(a)
+			} else {
+				_ = Default()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if db := Default(); db != a {
+		t.Errorf("expected %p got %p", a, db)
+	}
+	ctx := context.Background()
+	if db := FromContext(ctx); db != a {
+		t.Errorf("expected the default got %p", db)
+	}
+	ctx = NewContext(ctx, b)
+	if db := FromContext(ctx); db != b {
+		t.Errorf("expected the override %p got %p", b, db)
+	}
+	SetDefault(nil)
+	if db := Default(); db != nil {
+		t.Errorf("expected no default got %v", db)
+	}
+}
@@ -0,0 +1,146 @@
+package dialects
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//TypeConverter is an optional interface implemented by dialects to convert
+//the values returned by their driver when scanning into interface{}
+//destinations.
+type TypeConverter interface {
+	// ConvertValue converts v, returned for a column of type dbType.
+	ConvertValue(dbType string, v interface{}) (interface{}, error)
+}
+
+//ConvertValue converts the value v returned by the driver of d for a column
+//of type dbType, as reported by sql.ColumnType.DatabaseTypeName, into the
+//matching Go type. Drivers using a text protocol return most values as
+//[]byte, which are converted into int64, float64, bool, time.Time or string.
+//Binary columns are left as []byte and any other value is returned as is.
+//
+// Dialects that don't implement TypeConverter, and a nil d, use the mapping
+// based on common type names.
+func ConvertValue(d Dialect, dbType string, v interface{}) (interface{}, error) {
+	if c, ok := d.(TypeConverter); ok {
+		return c.ConvertValue(dbType, v)
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return v, nil
+	}
+	typ := strings.ToUpper(dbType)
+	if i := strings.IndexByte(typ, '('); i != -1 {
+		typ = typ[:i]
+	}
+	typ = strings.TrimSpace(strings.TrimPrefix(typ, "UNSIGNED "))
+	s := string(b)
+	switch typ {
+	case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT",
+		"INT2", "INT4", "INT8", "SERIAL", "BIGSERIAL", "YEAR":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ngorm: cannot convert %q to %s", s, dbType)
+		}
+		return n, nil
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8", "DECIMAL", "NUMERIC":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ngorm: cannot convert %q to %s", s, dbType)
+		}
+		return f, nil
+	case "BOOL", "BOOLEAN":
+		v, err := ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("ngorm: cannot convert %q to %s", s, dbType)
+		}
+		return v, nil
+	case "DATE", "DATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		return ParseTime(s)
+	case "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "BYTEA", "BIT":
+		return b, nil
+	}
+	return s, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+//ParseTime parses s in the formats commonly used by databases for dates and
+//timestamps.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ngorm: cannot parse %q as time", s)
+}
+
+//Booleaner is an optional interface implemented by dialects to convert Go
+//booleans into the values they store.
+type Booleaner interface {
+	BoolValue(b bool) interface{}
+}
+
+//BoolValue returns the value bound in place of b with dialect d. Dialects
+//storing booleans as integers, like mysql with TINYINT(1) and sqlite3, get 1
+//or 0, other dialects get b. Dialects that don't implement Booleaner are
+//looked up by name.
+func BoolValue(d Dialect, b bool) interface{} {
+	if v, ok := d.(Booleaner); ok {
+		return v.BoolValue(b)
+	}
+	switch d.GetName() {
+	case "mysql", "sqlite3":
+		if b {
+			return int64(1)
+		}
+		return int64(0)
+	}
+	return b
+}
+
+//ParseBool converts the value v returned by a driver for a boolean column into
+//a bool. Depending on the dialect booleans are returned as bool, as the
+//integers 1 and 0 or in a text form like t, true, y or on.
+func ParseBool(v interface{}) (bool, error) {
+	switch value := v.(type) {
+	case bool:
+		return value, nil
+	case int64:
+		switch value {
+		case 1:
+			return true, nil
+		case 0:
+			return false, nil
+		}
+	case float64:
+		switch value {
+		case 1:
+			return true, nil
+		case 0:
+			return false, nil
+		}
+	case []byte:
+		return ParseBool(string(value))
+	case string:
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("ngorm: cannot convert %v to bool", v)
+}
@@ -5,9 +5,15 @@ package dialects
 import (
 	"database/sql"
 	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/regexes"
+	"github.com/ngorm/ngorm/types"
 )
 
 // Dialect interface contains behaviors that differ across SQL database
@@ -144,3 +150,283 @@ func Opener() *DefaultOpener {
 func IsQL(d Dialect) bool {
 	return d.GetName() == "ql" || d.GetName() == "ql-mem"
 }
+
+//RowValuer is an optional interface implemented by dialects that know
+//whether they support row value constructors like (a, b) IN ((1, 2), (3, 4)).
+type RowValuer interface {
+	RowValues() bool
+}
+
+//SupportsRowValues returns true if the dialect d supports row value
+//constructors. Dialects that don't implement RowValuer are looked up by name.
+func SupportsRowValues(d Dialect) bool {
+	if r, ok := d.(RowValuer); ok {
+		return r.RowValues()
+	}
+	switch d.GetName() {
+	case "postgres", "mysql":
+		return true
+	}
+	return false
+}
+
+//CaseExpressioner is an optional interface implemented by dialects that know
+//whether they support CASE expressions.
+type CaseExpressioner interface {
+	CaseExpressions() bool
+}
+
+//SupportsCase returns true if the dialect d supports CASE expressions.
+//Dialects that don't implement CaseExpressioner are looked up by name, all but
+//ql are assumed to support them.
+func SupportsCase(d Dialect) bool {
+	if c, ok := d.(CaseExpressioner); ok {
+		return c.CaseExpressions()
+	}
+	return !IsQL(d)
+}
+
+//ParamLimiter is an optional interface implemented by dialects to report the
+//maximum number of bind parameters a single statement can have.
+type ParamLimiter interface {
+	MaxParams() int
+}
+
+//MaxParams returns the maximum number of bind parameters supported by a
+//single statement of dialect d, zero means there is no known limit. Dialects
+//that don't implement ParamLimiter are looked up by name.
+func MaxParams(d Dialect) int {
+	if p, ok := d.(ParamLimiter); ok {
+		return p.MaxParams()
+	}
+	switch d.GetName() {
+	case "postgres", "mysql":
+		return 65535
+	case "mssql":
+		return 2100
+	}
+	return 0
+}
+
+//ColumnEncoder is an optional interface implemented by dialects that support
+//per column storage, compression or encoding options.
+type ColumnEncoder interface {
+	// ColumnEncoding returns the options appended to the definition of the
+	// column for field, or an empty string when there are none.
+	ColumnEncoding(field *model.StructField) (string, error)
+}
+
+var (
+	pgStorage = map[string]bool{
+		"PLAIN": true, "EXTERNAL": true, "EXTENDED": true, "MAIN": true,
+	}
+	encodingValue = regexp.MustCompile(`^[a-zA-Z0-9_]+(\([0-9, ]*\))?(, *[a-zA-Z0-9_]+(\([0-9, ]*\))?)*$`)
+)
+
+//ColumnEncoding returns the storage options for the column of field which are
+//set with the following tags
+//
+//  STORAGE      postgres storage strategy, one of plain, external, extended or main
+//  COMPRESSION  postgres compression method, for instance lz4
+//  CODEC        clickhouse codecs, for instance Delta,ZSTD(3)
+//
+// Tags which don't apply to dialect d are ignored. Dialects that don't
+// implement ColumnEncoder are looked up by name.
+//
+// Postgres accepts COMPRESSION in column definitions since version 14 and
+// STORAGE since version 16.
+func ColumnEncoding(d Dialect, field *model.StructField) (string, error) {
+	if c, ok := d.(ColumnEncoder); ok {
+		return c.ColumnEncoding(field)
+	}
+	var opts []string
+	switch d.GetName() {
+	case "postgres":
+		if v, ok := field.TagSettings["STORAGE"]; ok {
+			v = strings.ToUpper(strings.TrimSpace(v))
+			if !pgStorage[v] {
+				return "", fmt.Errorf("ngorm: invalid storage %q for column %s", v, field.DBName)
+			}
+			opts = append(opts, "STORAGE "+v)
+		}
+		if v, ok := field.TagSettings["COMPRESSION"]; ok {
+			v = strings.TrimSpace(v)
+			if !regexes.Identifier.MatchString(v) {
+				return "", fmt.Errorf("ngorm: invalid compression %q for column %s", v, field.DBName)
+			}
+			opts = append(opts, "COMPRESSION "+v)
+		}
+	case "clickhouse":
+		if v, ok := field.TagSettings["CODEC"]; ok {
+			v = strings.TrimSpace(v)
+			if !encodingValue.MatchString(v) {
+				return "", fmt.Errorf("ngorm: invalid codec %q for column %s", v, field.DBName)
+			}
+			opts = append(opts, "CODEC("+v+")")
+		}
+	}
+	return strings.Join(opts, " "), nil
+}
+
+//VectorTyper is an optional interface implemented by dialects that support
+//vector columns.
+type VectorTyper interface {
+	// VectorType returns the column type of a vector with dim dimensions, dim
+	// is zero when the dimension is not set.
+	VectorType(dim int) (string, error)
+}
+
+var (
+	vectorType = reflect.TypeOf(types.Vector{})
+	stringType = reflect.TypeOf("")
+)
+
+//DataTypeOf returns the column type of field. Vector fields are handled here
+//since dialects don't know about them, the dimension is set with the DIM tag.
+//Fields of an enum type registered with types.RegisterEnum get the column type
+//of the stored values, fields with the SERIALIZER tag the column type of
+//their serializer and fields with the ENCRYPTED tag a text column. Any other
+//field is passed to d.DataTypeOf.
+//
+// Fields with the TYPE tag are always passed to d.DataTypeOf. Dialects that
+// don't implement VectorTyper are looked up by name, only postgres with the
+// pgvector extension is supported.
+func DataTypeOf(d Dialect, field *model.StructField) (string, error) {
+	if _, ok := field.TagSettings["TYPE"]; ok {
+		return d.DataTypeOf(field)
+	}
+	if _, ok := field.TagSettings["ENCRYPTED"]; ok {
+		// The encrypted values are stored as text.
+		f := *field
+		f.Struct.Type = stringType
+		return d.DataTypeOf(&f)
+	}
+	if name, ok := field.TagSettings["SERIALIZER"]; ok {
+		s := types.SerializerFor(name)
+		if s == nil {
+			return "", fmt.Errorf("ngorm: no serializer named %s for column %s", name, field.DBName)
+		}
+		f := *field
+		f.Struct.Type = s.DBType()
+		return d.DataTypeOf(&f)
+	}
+	t := field.Struct.Type
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if en := types.EnumFor(t); en != nil {
+		// The column has the type of the stored values.
+		f := *field
+		f.Struct.Type = en.DBType()
+		return d.DataTypeOf(&f)
+	}
+	if t != vectorType {
+		return d.DataTypeOf(field)
+	}
+	dim := 0
+	if v, ok := field.TagSettings["DIM"]; ok {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("ngorm: invalid dimension %q for column %s", v, field.DBName)
+		}
+		dim = n
+	}
+	if v, ok := d.(VectorTyper); ok {
+		return v.VectorType(dim)
+	}
+	if d.GetName() != "postgres" {
+		return "", fmt.Errorf("ngorm: vector columns are not supported by %s", d.GetName())
+	}
+	if dim == 0 {
+		return "vector", nil
+	}
+	return fmt.Sprintf("vector(%d)", dim), nil
+}
+
+//JoinModifier is an optional interface implemented by dialects to build UPDATE
+//and DELETE statements whose conditions reference other tables. set is the
+//SET clause without the keyword and cond starts with WHERE.
+type JoinModifier interface {
+	UpdateFrom(table, set string, from []string, cond string) (string, error)
+	DeleteUsing(table string, from []string, cond string) (string, error)
+}
+
+//UpdateFrom returns an UPDATE statement of table which can reference the
+//tables in from in its conditions, like UPDATE ... FROM on postgres. Dialects
+//that don't implement JoinModifier are looked up by name.
+func UpdateFrom(d Dialect, table, set string, from []string, cond string) (string, error) {
+	if m, ok := d.(JoinModifier); ok {
+		return m.UpdateFrom(table, set, from, cond)
+	}
+	others := strings.Join(from, ", ")
+	switch d.GetName() {
+	case "postgres", "sqlite3":
+		return fmt.Sprintf("UPDATE %s SET %s FROM %s %s", table, set, others, cond), nil
+	case "mysql":
+		return fmt.Sprintf("UPDATE %s, %s SET %s %s", table, others, set, cond), nil
+	case "mssql":
+		return fmt.Sprintf("UPDATE %s SET %s FROM %s, %s %s", table, set, table, others, cond), nil
+	}
+	return "", fmt.Errorf("ngorm: %s doesn't support UPDATE statements referencing other tables", d.GetName())
+}
+
+//DeleteUsing returns a DELETE statement of table which can reference the
+//tables in from in its conditions, like DELETE ... USING on postgres. Dialects
+//that don't implement JoinModifier are looked up by name.
+func DeleteUsing(d Dialect, table string, from []string, cond string) (string, error) {
+	if m, ok := d.(JoinModifier); ok {
+		return m.DeleteUsing(table, from, cond)
+	}
+	others := strings.Join(from, ", ")
+	switch d.GetName() {
+	case "postgres":
+		return fmt.Sprintf("DELETE FROM %s USING %s %s", table, others, cond), nil
+	case "mysql", "mssql":
+		return fmt.Sprintf("DELETE %s FROM %s, %s %s", table, table, others, cond), nil
+	}
+	return "", fmt.Errorf("ngorm: %s doesn't support DELETE statements referencing other tables", d.GetName())
+}
+
+//InsertIDs tells how the ids generated by a multi-row INSERT are reported.
+type InsertIDs int
+
+const (
+	//InsertIDsUnknown means the generated ids can't be retrieved.
+	InsertIDsUnknown InsertIDs = iota
+
+	//InsertIDsReturning means the ids are returned as rows by the statement,
+	//in the order of the inserted rows, using LastInsertIDReturningSuffix.
+	InsertIDsReturning
+
+	//InsertIDsFirst means sql.Result.LastInsertId is the id of the first
+	//inserted row and the others follow consecutively.
+	InsertIDsFirst
+
+	//InsertIDsLast means sql.Result.LastInsertId is the id of the last
+	//inserted row and the others precede it consecutively.
+	InsertIDsLast
+)
+
+//BatchInserter is an optional interface implemented by dialects to report how
+//the ids generated by multi-row INSERT statements are retrieved.
+type BatchInserter interface {
+	BatchInsertIDs() InsertIDs
+}
+
+//BatchInsertIDs returns how the ids generated by a multi-row INSERT are
+//retrieved with dialect d. Dialects that don't implement BatchInserter are
+//looked up by name.
+func BatchInsertIDs(d Dialect) InsertIDs {
+	if b, ok := d.(BatchInserter); ok {
+		return b.BatchInsertIDs()
+	}
+	switch d.GetName() {
+	case "postgres":
+		return InsertIDsReturning
+	case "mysql":
+		return InsertIDsFirst
+	case "sqlite3", "ql", "ql-mem":
+		return InsertIDsLast
+	}
+	return InsertIDsUnknown
+}
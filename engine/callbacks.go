@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+//Callback is a step of the create, query, update or delete operations on
+//models. Returning an error aborts the operation with that error.
+type Callback func(*Engine) error
+
+//Condition returns a condition added to the WHERE clause of every statement
+//built for modelValue, or nil when there is none. Arguments are bound to the
+//? placeholders of the condition. modelValue is nil for the statements
+//without a model.
+type Condition func(e *Engine, modelValue interface{}) (*model.Expr, error)
+
+//Callbacks holds the chains of callbacks executing the create, query, update
+//and delete operations. The default callbacks, which generate and execute the
+//SQL, are registered by hooks.DefaultCallbacks and can be completed, replaced
+//or removed
+//
+//    err := db.Callback().Create().Before("ngorm:create_sql").Register("app:slug", setSlug)
+type Callbacks struct {
+	create, query, update, delete *Processor
+
+	mu         sync.RWMutex
+	plugins    []Plugin
+	statements []StatementHook
+	conditions []Condition
+}
+
+//NewCallbacks returns Callbacks with empty chains.
+func NewCallbacks() *Callbacks {
+	return &Callbacks{
+		create: &Processor{},
+		query:  &Processor{},
+		update: &Processor{},
+		delete: &Processor{},
+	}
+}
+
+//Create returns the chain of callbacks creating models.
+func (c *Callbacks) Create() *Processor {
+	return c.create
+}
+
+//Query returns the chain of callbacks querying models.
+func (c *Callbacks) Query() *Processor {
+	return c.query
+}
+
+//Update returns the chain of callbacks updating models.
+func (c *Callbacks) Update() *Processor {
+	return c.update
+}
+
+//Delete returns the chain of callbacks deleting models.
+func (c *Callbacks) Delete() *Processor {
+	return c.delete
+}
+
+//Clone returns a copy of c, the chains of the copy can be changed without
+//changing the ones of c. The plugins and statement hooks of c are used with
+//the copy too, like its conditions.
+func (c *Callbacks) Clone() *Callbacks {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return &Callbacks{
+		create:     c.create.clone(),
+		query:      c.query.clone(),
+		update:     c.update.clone(),
+		delete:     c.delete.clone(),
+		plugins:    append([]Plugin(nil), c.plugins...),
+		statements: append([]StatementHook(nil), c.statements...),
+		conditions: append([]Condition(nil), c.conditions...),
+	}
+}
+
+//AddCondition adds cond to the conditions of the statements, it is used by
+//plugins restricting the rows every statement can see, like scoping them to
+//a tenant.
+func (c *Callbacks) AddCondition(cond Condition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conditions = append(c.conditions[:len(c.conditions):len(c.conditions)], cond)
+}
+
+//Conditions returns the conditions added with AddCondition.
+func (c *Callbacks) Conditions() []Condition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conditions
+}
+
+//AddStatementHook adds h to the hooks notified around the execution of every
+//statement. The hooks are called in the order they are added before the
+//statement and in the reverse order after it.
+func (c *Callbacks) AddStatementHook(h StatementHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements[:len(c.statements):len(c.statements)], h)
+}
+
+//StatementHooks returns the statement hooks of c.
+func (c *Callbacks) StatementHooks() []StatementHook {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.statements
+}
+
+//Plugin returns the plugin name used with c, or nil when there is none.
+func (c *Callbacks) Plugin(name string) Plugin {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, p := range c.plugins {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c *Callbacks) addPlugin(p Plugin) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, used := range c.plugins {
+		if used.Name() == p.Name() {
+			return fmt.Errorf("ngorm: plugin %s is already used", p.Name())
+		}
+	}
+	c.plugins = append(c.plugins, p)
+	return nil
+}
+
+func (c *Callbacks) removePlugin(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.plugins {
+		if p.Name() == name {
+			c.plugins = append(c.plugins[:i:i], c.plugins[i+1:]...)
+			return
+		}
+	}
+}
+
+//Processor is an ordered chain of named callbacks. It is safe for concurrent
+//use, changes don't affect the operations already running.
+type Processor struct {
+	mu        sync.RWMutex
+	names     []string
+	callbacks []Callback
+}
+
+//Register adds fn at the end of the chain. Names are unique within a chain,
+//they are conventionally prefixed like app:name to avoid conflicts with the
+//callbacks of ngorm and of plugins.
+func (p *Processor) Register(name string, fn Callback) error {
+	return p.insert(name, fn, "", false)
+}
+
+//Before returns the position right before the callback name, to register
+//callbacks executed before it.
+func (p *Processor) Before(name string) *Position {
+	return &Position{p: p, name: name}
+}
+
+//After returns the position right after the callback name, to register
+//callbacks executed after it.
+func (p *Processor) After(name string) *Position {
+	return &Position{p: p, name: name, after: true}
+}
+
+//Replace replaces the callback name with fn, keeping its position.
+func (p *Processor) Replace(name string, fn Callback) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.index(name)
+	if i == -1 {
+		return fmt.Errorf("ngorm: no callback named %s", name)
+	}
+	callbacks := append([]Callback(nil), p.callbacks...)
+	callbacks[i] = fn
+	p.callbacks = callbacks
+	return nil
+}
+
+//Remove removes the callback name from the chain.
+func (p *Processor) Remove(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i := p.index(name)
+	if i == -1 {
+		return fmt.Errorf("ngorm: no callback named %s", name)
+	}
+	p.names = append(p.names[:i:i], p.names[i+1:]...)
+	p.callbacks = append(p.callbacks[:i:i], p.callbacks[i+1:]...)
+	return nil
+}
+
+//Get returns the callback name, or nil when there is none.
+func (p *Processor) Get(name string) Callback {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if i := p.index(name); i != -1 {
+		return p.callbacks[i]
+	}
+	return nil
+}
+
+//Names returns the names of the callbacks in the order they are executed.
+func (p *Processor) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]string(nil), p.names...)
+}
+
+//Run executes the callbacks in order with e, stopping at the first error.
+func (p *Processor) Run(e *Engine) error {
+	p.mu.RLock()
+	callbacks := p.callbacks
+	p.mu.RUnlock()
+	for _, fn := range callbacks {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert adds fn before, or after, the callback at. It is added at the end
+// when at is empty.
+func (p *Processor) insert(name string, fn Callback, at string, after bool) error {
+	if fn == nil {
+		return fmt.Errorf("ngorm: nil callback %s", name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.index(name) != -1 {
+		return fmt.Errorf("ngorm: callback %s is already registered", name)
+	}
+	i := len(p.names)
+	if at != "" {
+		i = p.index(at)
+		if i == -1 {
+			return fmt.Errorf("ngorm: no callback named %s", at)
+		}
+		if after {
+			i++
+		}
+	}
+	// The slices are never changed in place, so that the running chains are
+	// left alone.
+	names := make([]string, 0, len(p.names)+1)
+	names = append(append(append(names, p.names[:i]...), name), p.names[i:]...)
+	callbacks := make([]Callback, 0, len(p.callbacks)+1)
+	callbacks = append(append(append(callbacks, p.callbacks[:i]...), fn), p.callbacks[i:]...)
+	p.names, p.callbacks = names, callbacks
+	return nil
+}
+
+func (p *Processor) index(name string) int {
+	for i, n := range p.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *Processor) clone() *Processor {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return &Processor{
+		names:     append([]string(nil), p.names...),
+		callbacks: append([]Callback(nil), p.callbacks...),
+	}
+}
+
+//Position is a position in a chain of callbacks, returned by Processor.Before
+//and Processor.After.
+type Position struct {
+	p     *Processor
+	name  string
+	after bool
+}
+
+//Register adds fn at the position in the chain.
+func (pos *Position) Register(name string, fn Callback) error {
+	return pos.p.insert(name, fn, pos.name, pos.after)
+}
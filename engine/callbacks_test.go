@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+func TestProcessor(t *testing.T) {
+	var p Processor
+	var calls []string
+	fn := func(name string) Callback {
+		return func(*Engine) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	for _, name := range []string{"a", "c"} {
+		if err := p.Register(name, fn(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Before("c").Register("b", fn("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.After("c").Register("d", fn("d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Register("a", fn("a")); err == nil {
+		t.Error("expected an error registering a name twice")
+	}
+	if err := p.Before("x").Register("x", fn("x")); err == nil {
+		t.Error("expected an error registering before an unknown callback")
+	}
+	expect := []string{"a", "b", "c", "d"}
+	if names := p.Names(); !reflect.DeepEqual(names, expect) {
+		t.Errorf("expected %v got %v", expect, names)
+	}
+
+	if err := p.Replace("b", fn("B")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Remove("a"); err == nil {
+		t.Error("expected an error removing an unknown callback")
+	}
+	if err := p.Run(&Engine{}); err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"B", "c", "d"}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("expected %v got %v", expect, calls)
+	}
+
+	stop := errors.New("stop")
+	if err := p.Replace("c", func(*Engine) error { return stop }); err != nil {
+		t.Fatal(err)
+	}
+	calls = nil
+	if err := p.Run(&Engine{}); err != stop {
+		t.Errorf("expected %v got %v", stop, err)
+	}
+	if expect = []string{"B"}; !reflect.DeepEqual(calls, expect) {
+		t.Errorf("expected %v got %v", expect, calls)
+	}
+}
+
+func TestCallbacks_Clone(t *testing.T) {
+	c := NewCallbacks()
+	noop := func(*Engine) error { return nil }
+	if err := c.Create().Register("a", noop); err != nil {
+		t.Fatal(err)
+	}
+	n := c.Clone()
+	if err := n.Create().Register("b", noop); err != nil {
+		t.Fatal(err)
+	}
+	if names := c.Create().Names(); len(names) != 1 {
+		t.Errorf("expected the clone to leave the callbacks alone got %v", names)
+	}
+	if names := n.Create().Names(); len(names) != 2 {
+		t.Errorf("expected 2 callbacks got %v", names)
+	}
+
+	c.AddStatementHook(nopHook{})
+	n = c.Clone()
+	n.AddStatementHook(nopHook{})
+	if len(c.StatementHooks()) != 1 || len(n.StatementHooks()) != 2 {
+		t.Errorf("expected the clone to copy the statement hooks got %d %d",
+			len(c.StatementHooks()), len(n.StatementHooks()))
+	}
+
+	c.AddCondition(func(*Engine, interface{}) (*model.Expr, error) { return nil, nil })
+	n = c.Clone()
+	n.AddCondition(func(*Engine, interface{}) (*model.Expr, error) { return nil, nil })
+	if len(c.Conditions()) != 1 || len(n.Conditions()) != 2 {
+		t.Errorf("expected the clone to copy the conditions got %d %d",
+			len(c.Conditions()), len(n.Conditions()))
+	}
+}
+
+type nopHook struct{}
+
+func (nopHook) BeforeQuery(ctx context.Context, s *Statement) context.Context { return ctx }
+
+func (nopHook) AfterQuery(ctx context.Context, s *Statement) {}
@@ -16,34 +16,143 @@ import (
 type Engine struct {
 	RowsAffected int64
 
+	// LastInsertID is the generated primary key of the last inserted row.
+	LastInsertID int64
+
+	// Result receives RowsAffected and LastInsertID when the engine is put
+	// back in the pool, that is after the operation is done.
+	Result *model.Result
+
 	//When this field is set to true. The table names will not be pluralized.
 	//The default behavior is to pluralize table names e.g Order struct will
 	//give orders table name.
 	SingularTable bool
-	Ctx           context.Context
-	Dialect       dialects.Dialect
+
+	// Ctx is the context of the operation, it is passed to the statements and
+	// to the engines of the nested operations like saving associations and
+	// preloading, so hooks can read request scoped values from it.
+	Ctx     context.Context
+	Dialect dialects.Dialect
 
 	Search    *model.Search
 	Scope     *model.Scope
 	StructMap *model.SafeStructsMap
 	SQLDB     model.SQLCommon
 
+	// Tx is the transaction the engine is operating in. This is nil when
+	// statements are executed directly on the database.
+	Tx *model.Tx
+
+	// Listeners are notified with the tables modified by committed
+	// statements.
+	Listeners *model.Listeners
+
+	// Analyzer records statistics about executed queries when set.
+	Analyzer *model.Analyzer
+
+	// Plans caches SQL generated for queries when set.
+	Plans *model.PlanCache
+
+	// Timings records the execution time of statements when set.
+	Timings *model.Timings
+
+	// Unmapped is what happens to result columns without a matching field.
+	Unmapped model.Unmapped
+
+	// AssociationSaving is what saving models does with their associations
+	// by default, all of them are saved when nil.
+	AssociationSaving *model.AssociationSaving
+
+	// AutoPreload preloads all the associations of the queried models, except
+	// the ones tagged PRELOAD:false.
+	AutoPreload bool
+
+	// PreloadBatchSize is the maximum number of keys listed in the queries
+	// preloading associations, more keys are split in several queries. There
+	// is no maximum when it is zero.
+	PreloadBatchSize int
+
+	// PreloadConcurrent runs the queries of the batches of keys concurrently,
+	// except in transactions.
+	PreloadConcurrent bool
+
+	// Callbacks are the chains of callbacks executing the operations, the
+	// default ones of the hooks package are used when nil.
+	Callbacks *Callbacks
+
 	Now func() time.Time
+
+	// cancel releases the deadline set with Deadline.
+	cancel context.CancelFunc
+}
+
+//Deadline bounds the statements executed with e.Ctx to d from now, the
+//context is canceled when e is put back in the pool. Only the first call has
+//an effect, so that the deadline covers the whole operation.
+func (e *Engine) Deadline(d time.Duration) {
+	if e.cancel != nil {
+		return
+	}
+	ctx := e.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e.Ctx, e.cancel = context.WithTimeout(ctx, d)
+}
+
+//Context returns the context of the operation, context.Background when it
+//has none. Hooks use it to read request scoped values
+//
+//    func (o *Order) BeforeCreate(e *engine.Engine) error {
+//    	o.RequestID, _ = e.Context().Value(requestKey{}).(string)
+//    	return nil
+//    }
+func (e *Engine) Context() context.Context {
+	if e.Ctx == nil {
+		return context.Background()
+	}
+	return e.Ctx
 }
 
-// Clone returns a new copy of engine
+// Clone returns a new copy of engine, for a nested operation. The deadline of
+// the search is started so that it bounds the nested operation too.
 func (e *Engine) Clone() *Engine {
+	if e.Search != nil && e.Search.Timeout > 0 {
+		e.Deadline(e.Search.Timeout)
+	}
 	en := Get()
 	en.SingularTable = e.SingularTable
 	en.Ctx = e.Ctx
+	en.Now = e.Now
 	en.Dialect = e.Dialect
 	en.StructMap = e.StructMap
 	en.SQLDB = e.SQLDB
+	en.Tx = e.Tx
+	en.Listeners = e.Listeners
+	en.Analyzer = e.Analyzer
+	en.Plans = e.Plans
+	en.Timings = e.Timings
+	en.Unmapped = e.Unmapped
+	en.AssociationSaving = e.AssociationSaving
+	en.AutoPreload = e.AutoPreload
+	en.PreloadBatchSize = e.PreloadBatchSize
+	en.PreloadConcurrent = e.PreloadConcurrent
+	en.Callbacks = e.Callbacks
 	return en
 }
 
 func (e *Engine) reset() {
+	if e.Result != nil {
+		e.Result.RowsAffected = e.RowsAffected
+		e.Result.LastInsertID = e.LastInsertID
+	}
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
 	e.RowsAffected = 0
+	e.LastInsertID = 0
+	e.Result = nil
 	e.SingularTable = false
 	e.Ctx = nil
 	e.Dialect = nil
@@ -51,6 +160,17 @@ func (e *Engine) reset() {
 	e.Scope = model.NewScope()
 	e.StructMap = nil
 	e.SQLDB = nil
+	e.Tx = nil
+	e.Listeners = nil
+	e.Analyzer = nil
+	e.Plans = nil
+	e.Timings = nil
+	e.Unmapped = model.UnmappedIgnore
+	e.AssociationSaving = nil
+	e.AutoPreload = false
+	e.PreloadBatchSize = 0
+	e.PreloadConcurrent = false
+	e.Callbacks = nil
 	e.Now = nil
 }
 
@@ -1 +1,35 @@
 package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+type key struct{}
+
+func TestEngine_Clone(t *testing.T) {
+	e := Get()
+	defer Put(e)
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.Ctx = context.WithValue(context.Background(), key{}, "v")
+	e.Now = func() time.Time { return now }
+	e.Search = &model.Search{Timeout: time.Minute}
+
+	ne := e.Clone()
+	defer Put(ne)
+	if ne.Context().Value(key{}) != "v" {
+		t.Error("expected the context to be copied")
+	}
+	if _, ok := ne.Context().Deadline(); !ok {
+		t.Error("expected the deadline of the search to bound the clone")
+	}
+	if ne.Now == nil || !ne.Now().Equal(now) {
+		t.Error("expected the clock to be copied")
+	}
+	if (&Engine{}).Context() == nil {
+		t.Error("expected a context for an engine without one")
+	}
+}
@@ -0,0 +1,35 @@
+package engine
+
+import "github.com/ngorm/ngorm/model"
+
+//Encrypter encrypts the values of the fields with the ENCRYPTED tag before
+//they are written and decrypts them once they are scanned. It is implemented
+//by a plugin used with the engine, like hooks.Encryption.
+type Encrypter interface {
+	Encrypt(field *model.StructField, plain []byte) (string, error)
+	Decrypt(field *model.StructField, cipher string) ([]byte, error)
+}
+
+//Encrypter returns the first plugin used with the callbacks of e which
+//implements Encrypter, or nil when there is none.
+func (e *Engine) Encrypter() Encrypter {
+	if e.Callbacks == nil {
+		return nil
+	}
+	e.Callbacks.mu.RLock()
+	defer e.Callbacks.mu.RUnlock()
+	for _, p := range e.Callbacks.plugins {
+		if enc, ok := p.(Encrypter); ok {
+			return enc
+		}
+	}
+	return nil
+}
+
+//SearchEncrypter is implemented by Encrypters which can search the fields
+//they encrypt. EncryptSearch returns the values the column of field may have
+//for plain, for instance one per key when keys are rotated, and an error for
+//fields which can't be searched.
+type SearchEncrypter interface {
+	EncryptSearch(field *model.StructField, plain []byte) ([]string, error)
+}
@@ -0,0 +1,54 @@
+package engine
+
+//BeforeCreator is implemented by models checking or completing their values
+//before they are inserted. Returning an error aborts the insert.
+type BeforeCreator interface {
+	BeforeCreate(*Engine) error
+}
+
+//AfterCreator is implemented by models notified once they are inserted, with
+//their primary key set. Returning an error fails the operation, which is
+//rolled back when it runs in a transaction.
+type AfterCreator interface {
+	AfterCreate(*Engine) error
+}
+
+//BeforeUpdater is implemented by models checking or completing their values
+//before they are updated. Returning an error aborts the update.
+type BeforeUpdater interface {
+	BeforeUpdate(*Engine) error
+}
+
+//AfterUpdater is implemented by models notified once they are updated.
+//Returning an error fails the operation, which is rolled back when it runs in
+//a transaction.
+type AfterUpdater interface {
+	AfterUpdate(*Engine) error
+}
+
+//BeforeDeleter is implemented by models checked before they are deleted.
+//Returning an error aborts the delete.
+type BeforeDeleter interface {
+	BeforeDelete(*Engine) error
+}
+
+//AfterDeleter is implemented by models notified once they are deleted.
+//Returning an error fails the operation, which is rolled back when it runs in
+//a transaction.
+type AfterDeleter interface {
+	AfterDelete(*Engine) error
+}
+
+//AfterFinder is implemented by models completed once they are loaded from the
+//database, like computing fields which aren't stored. Returning an error fails
+//the query.
+type AfterFinder interface {
+	AfterFind(*Engine) error
+}
+
+//Validator is implemented by models checking their values before they are
+//created or updated. Returning an error aborts the operation, models report
+//the fields which failed with an *errmsg.ValidationError.
+type Validator interface {
+	Validate(*Engine) error
+}
@@ -0,0 +1,56 @@
+package engine
+
+import "fmt"
+
+//Plugin packages a feature built on the callbacks, like auditing, caching or
+//metrics, so that it is registered with a single call to Use.
+type Plugin interface {
+	// Name identifies the plugin, a plugin is used once per callbacks.
+	Name() string
+
+	// Initialize sets up the plugin, usually registering callbacks in
+	// e.Callbacks.
+	Initialize(e *Engine) error
+}
+
+//Use initializes p with e. The callbacks of e, which are shared by the engines
+//of the same ngorm.DB, record that p is used and using a plugin of the same
+//name again fails. p isn't recorded when Initialize fails.
+func (e *Engine) Use(p Plugin) error {
+	if e.Callbacks == nil {
+		return fmt.Errorf("ngorm: can't use plugin %s without callbacks", p.Name())
+	}
+	if err := e.Callbacks.addPlugin(p); err != nil {
+		return err
+	}
+	if err := p.Initialize(e); err != nil {
+		e.Callbacks.removePlugin(p.Name())
+		return err
+	}
+	return nil
+}
+
+//BatchCreator is implemented by the plugins completing the models created in
+//batches, which don't run the create callbacks. BeforeCreateBatch is called
+//with a pointer to each model before it is inserted, returning an error
+//aborts the insert.
+type BatchCreator interface {
+	BeforeCreateBatch(e *Engine, value interface{}) error
+}
+
+//BatchCreators returns the plugins used with the callbacks of e which
+//implement BatchCreator.
+func (e *Engine) BatchCreators() []BatchCreator {
+	if e.Callbacks == nil {
+		return nil
+	}
+	e.Callbacks.mu.RLock()
+	defer e.Callbacks.mu.RUnlock()
+	var o []BatchCreator
+	for _, p := range e.Callbacks.plugins {
+		if bc, ok := p.(BatchCreator); ok {
+			o = append(o, bc)
+		}
+	}
+	return o
+}
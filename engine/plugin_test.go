@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+type testPlugin struct {
+	name string
+	err  error
+}
+
+func (p *testPlugin) Name() string {
+	return p.name
+}
+
+func (p *testPlugin) Initialize(e *Engine) error {
+	if p.err != nil {
+		return p.err
+	}
+	return e.Callbacks.Query().Register(p.name+":query", func(*Engine) error { return nil })
+}
+
+func TestEngine_Use(t *testing.T) {
+	e := &Engine{}
+	if err := e.Use(&testPlugin{name: "a"}); err == nil {
+		t.Error("expected an error without callbacks")
+	}
+	e.Callbacks = NewCallbacks()
+	p := &testPlugin{name: "a"}
+	if err := e.Use(p); err != nil {
+		t.Fatal(err)
+	}
+	if e.Callbacks.Plugin("a") != p {
+		t.Error("expected the plugin to be recorded")
+	}
+	if e.Callbacks.Query().Get("a:query") == nil {
+		t.Error("expected the callback of the plugin to be registered")
+	}
+	if err := e.Use(&testPlugin{name: "a"}); err == nil {
+		t.Error("expected an error using a plugin twice")
+	}
+
+	fail := errors.New("fail")
+	if err := e.Use(&testPlugin{name: "b", err: fail}); err != fail {
+		t.Errorf("expected %v got %v", fail, err)
+	}
+	if e.Callbacks.Plugin("b") != nil {
+		t.Error("expected the failing plugin not to be recorded")
+	}
+	if c := e.Callbacks.Clone(); c.Plugin("a") != p {
+		t.Error("expected the clone to use the plugins")
+	}
+}
@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"context"
+	"time"
+)
+
+//Statement is a statement executed by ngorm, as seen by the statement hooks.
+type Statement struct {
+	SQL  string
+	Args []interface{}
+
+	// Table is the table of the model the statement operates on, it is empty
+	// when there is no model.
+	Table string
+
+	// Duration and Err are set once the statement is executed.
+	Duration time.Duration
+	Err      error
+}
+
+//StatementHook is notified around the execution of every statement, to
+//attach tracing, metrics or logging. BeforeQuery returns the context the
+//statement is executed with, which is passed to AfterQuery, so that hooks can
+//start a span in BeforeQuery and end it in AfterQuery
+//
+//    db.Callback().AddStatementHook(tracer)
+//
+// Hooks can't change or abort the statement. The statements the dialects
+// execute themselves, like the ones of HasTable and RemoveIndex, aren't
+// reported.
+type StatementHook interface {
+	BeforeQuery(ctx context.Context, s *Statement) context.Context
+	AfterQuery(ctx context.Context, s *Statement)
+}
@@ -2,6 +2,8 @@ package errmsg
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 )
 
 var (
@@ -23,6 +25,141 @@ var (
 	//ErrInvalidFieldValue invalid field value
 	ErrInvalidFieldValue = errors.New("ngorm: field value not valid")
 
+	// ErrPreconditionFailed is returned when an update guarded by an ETag finds
+	// the stored row was modified or deleted.
+	ErrPreconditionFailed = errors.New("ngorm: precondition failed")
+
+	// ErrBudgetExceeded is returned by statements executed with a context whose
+	// strict model.Budget is exhausted.
+	ErrBudgetExceeded = errors.New("ngorm: query budget exceeded")
+
+	// ErrVersionConflict is returned when appending events to an aggregate
+	// which was modified since the version the events are based on.
+	ErrVersionConflict = errors.New("ngorm: version conflict")
+
+	// ErrMissingWhereClause is returned by deletes without conditions, unless
+	// they are explicitly allowed with model.AllowGlobalDelete.
+	ErrMissingWhereClause = errors.New("ngorm: missing WHERE clause while deleting")
+
+	// ErrProjectionWrite is returned when creating or updating a projection
+	// registered with scope.RegisterProjection, which only holds some of the
+	// columns of its model.
+	ErrProjectionWrite = errors.New("ngorm: can't write a projection")
+
+	// ErrReadOnly is returned when creating, updating or deleting a read only
+	// model, see model.Struct.
+	ErrReadOnly = errors.New("ngorm: can't write a read only model")
+
+	// ErrMissingTenant is returned by the statements on models scoped to a
+	// tenant when the context of the operation has no tenant.
+	ErrMissingTenant = errors.New("ngorm: missing tenant")
+
 	// ErrMissingModel when the struct model is not set for the database operation
 	ErrMissingModel = errors.New("missing model")
 )
+
+//UnmappedColumnsError is returned by queries executed in
+//model.UnmappedStrict mode when the result has columns that don't match any
+//field of the destination.
+type UnmappedColumnsError struct {
+	Table   string
+	Columns []string
+}
+
+func (e *UnmappedColumnsError) Error() string {
+	return fmt.Sprintf("ngorm: columns %s of %s have no matching field",
+		strings.Join(e.Columns, ", "), e.Table)
+}
+
+//TooManyParamsError is returned before executing a statement which has more
+//bind parameters than the dialect supports.
+type TooManyParamsError struct {
+	Dialect string
+	Params  int
+	Max     int
+
+	// Rows is the number of rows the statement operates on, it is zero when
+	// unknown.
+	Rows int
+}
+
+//ChunkSize returns the maximum number of rows that can be sent in a single
+//statement without exceeding the limit. It is zero when Rows is unknown.
+func (e *TooManyParamsError) ChunkSize() int {
+	if e.Rows == 0 {
+		return 0
+	}
+	perRow := (e.Params + e.Rows - 1) / e.Rows
+	if perRow == 0 {
+		return 0
+	}
+	return e.Max / perRow
+}
+
+func (e *TooManyParamsError) Error() string {
+	msg := fmt.Sprintf("ngorm: statement has %d bind parameters but %s supports at most %d",
+		e.Params, e.Dialect, e.Max)
+	if n := e.ChunkSize(); n > 0 {
+		return fmt.Sprintf("%s, split the %d rows into chunks of at most %d", msg, e.Rows, n)
+	}
+	return msg + ", reduce the number of values in the statement"
+}
+
+//FieldError is the validation failure of a single field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+//ValidationError is returned when models fail validation, it lists every
+//failing field so that they can all be reported at once
+//
+//    func (u *User) Validate(e *engine.Engine) error {
+//    	v := &errmsg.ValidationError{}
+//    	if u.Name == "" {
+//    		v.Add("Name", "is required")
+//    	}
+//    	if u.Age < 0 {
+//    		v.Add("Age", "must be positive")
+//    	}
+//    	return v.Err()
+//    }
+type ValidationError struct {
+	Fields []FieldError
+}
+
+//Add records that field failed validation with message.
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+//Err returns e when fields failed validation, nil otherwise.
+func (e *ValidationError) Err() error {
+	if e == nil || len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+//Field returns the messages of field.
+func (e *ValidationError) Field(field string) []string {
+	var msgs []string
+	for _, f := range e.Fields {
+		if f.Field == field {
+			msgs = append(msgs, f.Message)
+		}
+	}
+	return msgs
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for k, f := range e.Fields {
+		msgs[k] = f.Error()
+	}
+	return "ngorm: validation failed: " + strings.Join(msgs, "; ")
+}
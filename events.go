@@ -0,0 +1,168 @@
+package ngorm
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/hooks"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+)
+
+//Event is a change of an aggregate recorded by an EventStore. Versions start
+//at 1 and increase by one with every event of the aggregate, ID orders the
+//events of all aggregates.
+type Event struct {
+	ID          int64
+	AggregateID string
+	Version     int64
+	Type        string
+	Data        []byte
+	CreatedAt   time.Time
+}
+
+//EventStore is an append-only table of events. Appending checks the version of
+//the aggregate so that concurrent writers can't both extend the same version,
+//the loser gets errmsg.ErrVersionConflict and is expected to reload the
+//aggregate and retry.
+type EventStore struct {
+	db    *DB
+	table string
+}
+
+//EventStore returns the event store kept in table.
+func (db *DB) EventStore(table string) *EventStore {
+	return &EventStore{db: db, table: table}
+}
+
+//Migrate creates the table of the store, with a unique index on the aggregate
+//and version columns when the dialect supports indexes on multiple columns.
+func (s *EventStore) Migrate() error {
+	e := s.db.NewEngine()
+	defer engine.Put(e)
+	search.Table(e, s.table)
+	err := scope.Automigrate(e, &Event{})
+	if err != nil {
+		return err
+	}
+	if !dialects.IsQL(e.Dialect) {
+		err = scope.AddIndex(e, true, &Event{}, "uix_"+s.table+"_aggregate_version",
+			"aggregate_id", "version")
+		if err != nil {
+			return err
+		}
+	}
+	var stmts []string
+	if e.Scope.SQL != "" {
+		stmts = append(stmts, e.Scope.SQL)
+	}
+	for _, expr := range e.Scope.Exprs {
+		stmts = append(stmts, strings.TrimSuffix(expr.Q, ";"))
+	}
+	return s.db.execDDL(stmts...)
+}
+
+//Version returns the current version of the aggregate, zero when it has no
+//events.
+func (s *EventStore) Version(aggregateID string) (int64, error) {
+	return s.version(s.db, aggregateID)
+}
+
+func (s *EventStore) version(db *DB, aggregateID string) (int64, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	var v sql.NullInt64
+	q := fmt.Sprintf("SELECT max(%s) FROM %s WHERE %s = %s",
+		scope.Quote(e, "version"), scope.Quote(e, s.table),
+		scope.Quote(e, "aggregate_id"), e.Dialect.BindVar(1))
+	err := hooks.ScanRow(e, q, []interface{}{aggregateID}, &v)
+	if err != nil {
+		return 0, err
+	}
+	return v.Int64, nil
+}
+
+//Append records events for the aggregate, which must be at version. The
+//events are numbered from version+1 and are all stored or none is. When the
+//aggregate isn't at version errmsg.ErrVersionConflict is returned.
+//
+// The events are appended in a transaction, or in the transaction of the store
+// db when there is one.
+func (s *EventStore) Append(aggregateID string, version int64, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if s.db.tx != nil {
+		return s.append(s.db, aggregateID, version, events)
+	}
+	tx, err := s.db.BeginTx()
+	if err != nil {
+		return err
+	}
+	err = s.append(tx, aggregateID, version, events)
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		_ = tx.Rollback()
+	}
+	if err == nil || err == errmsg.ErrVersionConflict {
+		return err
+	}
+	// The unique index rejects a concurrent append which passed the version
+	// check, report it as a conflict.
+	if v, verr := s.Version(aggregateID); verr == nil && v != version {
+		return errmsg.ErrVersionConflict
+	}
+	return err
+}
+
+func (s *EventStore) append(tx *DB, aggregateID string, version int64, events []Event) error {
+	current, err := s.version(tx, aggregateID)
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return errmsg.ErrVersionConflict
+	}
+	e := tx.NewEngine()
+	defer engine.Put(e)
+	columns := []string{"aggregate_id", "version", "type", "data", "created_at"}
+	quoted := make([]string, len(columns))
+	binds := make([]string, len(columns))
+	for k, c := range columns {
+		quoted[k] = scope.Quote(e, c)
+		binds[k] = e.Dialect.BindVar(k + 1)
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", scope.Quote(e, s.table),
+		strings.Join(quoted, ", "), strings.Join(binds, ", "))
+	now := time.Now
+	if e.Now != nil {
+		now = e.Now
+	}
+	created := now()
+	for k, ev := range events {
+		if ev.CreatedAt.IsZero() {
+			ev.CreatedAt = created
+		}
+		_, err := tx.ExecTx(q, aggregateID, version+int64(k)+1, ev.Type, ev.Data, ev.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Load returns the events of the aggregate with a version greater than after,
+//ordered by version.
+func (s *EventStore) Load(aggregateID string, after int64) ([]Event, error) {
+	var events []Event
+	err := s.db.Table(s.table).
+		Where("aggregate_id = ? AND version > ?", aggregateID, after).
+		Order("version").Find(&events)
+	return events, err
+}
@@ -0,0 +1,71 @@
+package ngorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ngorm/ngorm/errmsg"
+)
+
+func TestEventStore(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testEventStore, "order_events")
+	}
+}
+
+func testEventStore(t *testing.T, db *DB) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	db.now = func() time.Time { return now }
+	s := db.EventStore("order_events")
+	err := s.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Migrating again is a no-op.
+	err = s.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Append("order-1", 0,
+		Event{Type: "created", Data: []byte(`{"total":10}`)},
+		Event{Type: "paid"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Append("order-2", 0, Event{Type: "created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Append("order-1", 1, Event{Type: "cancelled"})
+	if err != errmsg.ErrVersionConflict {
+		t.Fatalf("expected %v got %v", errmsg.ErrVersionConflict, err)
+	}
+	err = s.Append("order-1", 2, Event{Type: "shipped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Version("order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 3 {
+		t.Errorf("expected version 3 got %d", v)
+	}
+	events, err := s.Load("order-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events got %d", len(events))
+	}
+	for k, typ := range []string{"paid", "shipped"} {
+		ev := events[k]
+		if ev.AggregateID != "order-1" || ev.Version != int64(k+2) || ev.Type != typ {
+			t.Errorf("unexpected event %+v", ev)
+		}
+		if !ev.CreatedAt.Equal(now) {
+			t.Errorf("expected created_at to be set with the clock of the db got %v", ev.CreatedAt)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/util"
+)
+
+type actorKey struct{}
+
+//WithActor returns a copy of ctx carrying actor, the user or service on
+//behalf of which the operations using the context are executed. It is read by
+//the Audit plugin
+//
+//    err := db.WithContext(hooks.WithActor(ctx, user.ID)).Save(&order)
+func WithActor(ctx context.Context, actor interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+//Actor returns the actor set with WithActor in ctx.
+func Actor(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	actor := ctx.Value(actorKey{})
+	return actor, actor != nil
+}
+
+//AuditLog is a row of the audit log written by the Audit plugin. The table is
+//created like any model
+//
+//    _, err := db.Automigrate(&hooks.AuditLog{})
+type AuditLog struct {
+	ID        int64
+	TableName string
+	RecordID  string
+	Action    string
+	Actor     string
+	Changes   string
+	CreatedAt time.Time
+}
+
+//Audit is a plugin filling the audit columns of the models with the actor of
+//the context of the operations, see WithActor. created_by is set when a model
+//is created and updated_by when it is created or updated, models without
+//these columns are left alone.
+//
+// When Log is set a row describing each create, update and delete is added to
+// the table Log, which has the columns of AuditLog, one for each model of a
+// slice. Changes is a JSON object with the written columns and their values,
+// only the changed ones when saving a model embedding model.Tracked. The row
+// is written with the connection of the operation, so it is part of its
+// transaction if any.
+//
+//    err := db.Use(&hooks.Audit{Log: "audit_logs"})
+type Audit struct {
+	// CreatedBy and UpdatedBy are the audit columns, created_by and
+	// updated_by when empty.
+	CreatedBy, UpdatedBy string
+
+	// Log is the table of the audit log, nothing is logged when empty.
+	Log string
+}
+
+//Name implements engine.Plugin.
+func (a *Audit) Name() string {
+	return "ngorm:audit"
+}
+
+//Initialize implements engine.Plugin.
+func (a *Audit) Initialize(e *engine.Engine) error {
+	c := e.Callbacks
+	err := c.Create().Before(model.HookCreateSQL).Register("audit:create", a.create)
+	if err != nil {
+		return err
+	}
+	err = c.Update().After(model.HookBeforeUpdate).Register("audit:update", a.update)
+	if err != nil {
+		return err
+	}
+	if a.Log == "" {
+		return nil
+	}
+	err = c.Create().After(model.HookCreateExec).Register("audit:log_create", a.logger("create"))
+	if err != nil {
+		return err
+	}
+	err = c.Update().After(model.HookUpdateExec).Register("audit:log_update", a.logger("update"))
+	if err != nil {
+		return err
+	}
+	return c.Delete().After(model.HookDeleteExec).Register("audit:log_delete", a.logger("delete"))
+}
+
+func (a *Audit) columns() (createdBy, updatedBy string) {
+	createdBy, updatedBy = a.CreatedBy, a.UpdatedBy
+	if createdBy == "" {
+		createdBy = "created_by"
+	}
+	if updatedBy == "" {
+		updatedBy = "updated_by"
+	}
+	return
+}
+
+func (a *Audit) create(e *engine.Engine) error {
+	actor, ok := Actor(e.Ctx)
+	if !ok {
+		return nil
+	}
+	createdBy, updatedBy := a.columns()
+	for _, column := range []string{createdBy, updatedBy} {
+		if scope.HasColumn(e, e.Scope.Value, column) {
+			if err := scope.SetColumn(e, column, actor); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Audit) update(e *engine.Engine) error {
+	actor, ok := Actor(e.Ctx)
+	if !ok {
+		return nil
+	}
+	if _, ok := e.Scope.Get(model.UpdateColumn); ok {
+		return nil
+	}
+	_, updatedBy := a.columns()
+	if !scope.HasColumn(e, e.Scope.Value, updatedBy) {
+		return nil
+	}
+	if attrs, ok := e.Scope.Get(model.UpdateInterface); ok {
+		// The update attributes are computed again from the update interface
+		// when the SQL is built, the column is added there.
+		e.Scope.Set(model.UpdateInterface, []interface{}{
+			attrs, map[string]interface{}{updatedBy: actor},
+		})
+	}
+	return scope.SetColumn(e, updatedBy, actor)
+}
+
+// logger returns the callback adding a row to the audit log after action, one
+// for each model of a slice.
+func (a *Audit) logger(action string) engine.Callback {
+	return func(e *engine.Engine) error {
+		if action != "create" && e.RowsAffected == 0 {
+			return nil
+		}
+		var actor string
+		if v, ok := Actor(e.Ctx); ok {
+			actor = fmt.Sprint(v)
+		}
+		now := time.Now
+		if e.Now != nil {
+			now = e.Now
+		}
+		var models []interface{}
+		if v := reflect.Indirect(e.Scope.ValueOf()); v.Kind() == reflect.Slice {
+			err := eachValue(e, func(_ int, v reflect.Value) error {
+				models = append(models, v.Interface())
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			models = append(models, e.Scope.Value)
+		}
+		table := scope.TableName(e, e.Scope.Value)
+		for _, m := range models {
+			changes, err := auditChanges(e, action, m)
+			if err != nil {
+				return err
+			}
+			values := []interface{}{
+				table, auditRecordID(e, m), action, actor, changes, now(),
+			}
+			if err := a.log(e, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// log adds the row with values to the audit log.
+func (a *Audit) log(e *engine.Engine, values []interface{}) error {
+	ne := e.Clone()
+	defer engine.Put(ne)
+	ne.Scope.SQLVars = nil
+	columns := []string{"table_name", "record_id", "action", "actor", "changes", "created_at"}
+	placeholders := make([]string, len(values))
+	for k, v := range values {
+		columns[k] = scope.Quote(ne, columns[k])
+		placeholders[k] = scope.AddToVars(ne, v)
+	}
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", scope.Quote(ne, a.Log),
+		strings.Join(columns, ","), strings.Join(placeholders, ","))
+	if dialects.IsQL(e.Dialect) {
+		q = util.WrapTX(q)
+	}
+	if _, err := exec(ne, q, ne.Scope.SQLVars...); err != nil {
+		return err
+	}
+	touch(ne, a.Log)
+	return nil
+}
+
+// auditChanges returns the JSON object of the columns of value written by
+// action. Updates with attributes give these attributes. Creates and saves
+// give the columns which aren't blank, or the changed columns when the model
+// tracks its changes and was loaded, see model.Tracked.
+func auditChanges(e *engine.Engine, action string, value interface{}) (string, error) {
+	if action == "delete" {
+		return "", nil
+	}
+	changes := make(map[string]interface{})
+	if attrs, ok := e.Scope.Get(model.UpdateAttrs); ok && action == "update" {
+		for k, v := range attrs.(map[string]interface{}) {
+			changes[k] = v
+		}
+	} else {
+		v := reflect.Indirect(reflect.ValueOf(value))
+		if v.Kind() != reflect.Struct {
+			return "", nil
+		}
+		fds, err := scope.Fields(e, value)
+		if err != nil {
+			return "", err
+		}
+		var original map[string]interface{}
+		if t, ok := value.(model.Tracker); ok && action == "update" {
+			original = t.Original()
+		}
+		for _, f := range fds {
+			if !f.IsNormal || f.IsIgnored {
+				continue
+			}
+			if original != nil {
+				if !scope.FieldChanged(e, original, f) {
+					continue
+				}
+			} else if f.IsBlank {
+				continue
+			}
+			// Logged as stored, so encrypted fields aren't revealed.
+			changes[f.DBName] = scope.FieldValue(e, f)
+		}
+	}
+	b, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// auditRecordID returns the primary key of value, joined with commas for
+// composite keys. It is empty for models without a key.
+func auditRecordID(e *engine.Engine, value interface{}) string {
+	if reflect.Indirect(reflect.ValueOf(value)).Kind() != reflect.Struct {
+		return ""
+	}
+	pfs, err := scope.PrimaryFields(e, value)
+	if err != nil {
+		return ""
+	}
+	keys := make([]string, 0, len(pfs))
+	for _, f := range pfs {
+		if f.IsBlank {
+			return ""
+		}
+		keys = append(keys, fmt.Sprint(f.Field.Interface()))
+	}
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,426 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ngorm/ngorm/builder"
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/util"
+)
+
+//CreateBatch inserts the elements of the slice e.Scope.Value with multi-row
+//INSERT statements of at most size rows each, size zero or less means a single
+//statement. The number of rows per statement is lowered when needed to stay
+//within the bind parameters limit of the dialect.
+//
+// The columns are the same for all the rows, a column is left out only when
+// it is a blank primary key or a blank column with a default value in every
+// row. Generated ids are set back on the rows when the dialect reports them,
+// see dialects.BatchInsertIDs. Associations are not saved and the create
+// callbacks don't run, the plugins implementing engine.BatchCreator complete
+// the rows instead.
+func CreateBatch(e *engine.Engine, size int) error {
+	rows := reflect.Indirect(reflect.ValueOf(e.Scope.Value))
+	if rows.Kind() != reflect.Slice {
+		return fmt.Errorf("ngorm: batch create needs a slice, got %T", e.Scope.Value)
+	}
+	if rows.Len() == 0 {
+		return nil
+	}
+	if err := writable(e); err != nil {
+		return err
+	}
+	if bcs := e.BatchCreators(); len(bcs) > 0 {
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Index(i)
+			if row.Kind() != reflect.Ptr {
+				row = row.Addr()
+			}
+			for _, bc := range bcs {
+				if err := bc.BeforeCreateBatch(e, row.Interface()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	records, err := batchRecords(e, rows)
+	if err != nil {
+		return err
+	}
+	columns, pk, err := batchColumns(e, records)
+	if err != nil {
+		return err
+	}
+	if size <= 0 || size > len(records) {
+		size = len(records)
+	}
+	if max := dialects.MaxParams(e.Dialect); max > 0 && size*len(columns) > max {
+		size = max / len(columns)
+		if size == 0 {
+			size = 1
+		}
+	}
+	for start := 0; start < len(records); start += size {
+		end := start + size
+		if end > len(records) {
+			end = len(records)
+		}
+		if err := createChunk(e, records[start:end], columns, pk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchRecords returns the fields of the elements of the slice rows, with
+// UpdatedAt set to the current time.
+func batchRecords(e *engine.Engine, rows reflect.Value) ([][]*model.Field, error) {
+	records := make([][]*model.Field, rows.Len())
+	now := time.Now()
+	for i := range records {
+		row := rows.Index(i)
+		if row.Kind() != reflect.Ptr {
+			row = row.Addr()
+		}
+		fds, err := scope.Fields(e, row.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := e.Scope.Get(model.UpdateColumn); !ok {
+			for _, field := range fds {
+				if field.Name == "UpdatedAt" {
+					if err := field.Set(now); err != nil {
+						return nil, err
+					}
+					field.IsBlank = false
+				}
+			}
+		}
+		records[i] = fds
+	}
+	return records, nil
+}
+
+// batchColumns returns the indexes of the fields inserted for records, and the
+// index of the primary key generated by the database or -1 when there is
+// none.
+func batchColumns(e *engine.Engine, records [][]*model.Field) ([]int, int, error) {
+	var columns []int
+	pk := -1
+	for k, field := range records[0] {
+		if !field.IsNormal || !scope.ChangeableField(e, field) {
+			continue
+		}
+		blank := 0
+		for _, fds := range records {
+			if fds[k].IsBlank {
+				blank++
+			}
+		}
+		switch {
+		case field.IsPrimaryKey && blank == len(records):
+			if pk == -1 {
+				pk = k
+			}
+		case field.IsPrimaryKey && blank > 0:
+			return nil, -1, errors.New("ngorm: batch create needs the primary key of either all or none of the rows")
+		case field.HasDefaultValue && blank == len(records):
+		default:
+			columns = append(columns, k)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, -1, errors.New("ngorm: batch create has no columns to insert")
+	}
+	if pk != -1 {
+		m, err := scope.GetModelStruct(e, e.Scope.Value)
+		if err != nil {
+			return nil, -1, err
+		}
+		if len(m.PrimaryFields) > 1 {
+			pk = -1
+		}
+	}
+	return columns, pk, nil
+}
+
+// createChunk inserts records with a single statement and sets the generated
+// primary key pk on them.
+func createChunk(e *engine.Engine, records [][]*model.Field, columns []int, pk int) error {
+	e.Scope.SQLVars = nil
+	tableName := insertTableName(e)
+	var cols []string
+	for _, k := range columns {
+		cols = append(cols, scope.Quote(e, records[0][k].DBName))
+	}
+	values := make([]string, len(records))
+	for i, fds := range records {
+		var placeholders []string
+		for _, k := range columns {
+			placeholders = append(placeholders, scope.AddToVars(e, scope.FieldValue(e, fds[k])))
+		}
+		values[i] = "(" + strings.Join(placeholders, ",") + ")"
+	}
+	var extraOption string
+	if str, ok := e.Scope.Get(model.InsertOptions); ok {
+		extraOption = fmt.Sprint(str)
+	}
+	mode := dialects.InsertIDsUnknown
+	if pk != -1 {
+		mode = dialects.BatchInsertIDs(e.Dialect)
+	}
+	var returning string
+	if mode == dialects.InsertIDsReturning {
+		returning = e.Dialect.LastInsertIDReturningSuffix(tableName,
+			scope.Quote(e, records[0][pk].DBName))
+	}
+	e.Scope.SQL = strings.Replace(fmt.Sprintf(
+		"INSERT INTO %v (%v) VALUES %v%v%v",
+		tableName,
+		strings.Join(cols, ","),
+		strings.Join(values, ","),
+		util.AddExtraSpaceIfExist(extraOption),
+		util.AddExtraSpaceIfExist(returning),
+	), "$$", "?", -1)
+	table := scope.TableName(e, e.Scope.Value)
+
+	if returning != "" {
+		rows, err := query(e, e.Scope.SQL, e.Scope.SQLVars...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		i := 0
+		for rows.Next() && i < len(records) {
+			f := records[i][pk]
+			if err := rows.Scan(f.Field.Addr().Interface()); err != nil {
+				return err
+			}
+			f.IsBlank = false
+			if v := reflect.Indirect(f.Field); v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64 {
+				e.LastInsertID = v.Int()
+			}
+			i++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		e.RowsAffected += int64(i)
+		touch(e, table)
+		return nil
+	}
+
+	result, err := exec(e, e.Scope.SQL, e.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	touch(e, table)
+	n, _ := result.RowsAffected()
+	e.RowsAffected += n
+	if mode != dialects.InsertIDsFirst && mode != dialects.InsertIDsLast {
+		return nil
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.LastInsertID = id
+	if mode == dialects.InsertIDsLast {
+		id -= int64(len(records) - 1)
+	} else {
+		e.LastInsertID += int64(len(records) - 1)
+	}
+	for i, fds := range records {
+		if err := fds[pk].Set(id + int64(i)); err != nil {
+			return err
+		}
+		fds[pk].IsBlank = false
+	}
+	if dialects.IsQL(e.Dialect) {
+		// The primary key column is set from id() like QLAfterCreate does for
+		// single rows.
+		q := fmt.Sprintf("UPDATE %v SET %v = id() WHERE id() >= %v && id() <= %v",
+			tableName, scope.Quote(e, records[0][pk].DBName),
+			e.Dialect.BindVar(1), e.Dialect.BindVar(2))
+		_, err = execTx(e, q, id, id+int64(len(records)-1))
+		return err
+	}
+	return nil
+}
+
+//UpdateBatch updates the elements of the slice e.Scope.Value matching them by
+//primary key, executing the statements built by UpdateBatchSQL.
+func UpdateBatch(e *engine.Engine, columns []string) error {
+	exprs, err := UpdateBatchSQL(e, columns)
+	if err != nil {
+		return err
+	}
+	for _, expr := range exprs {
+		result, err := exec(e, expr.Q, expr.Args...)
+		if err != nil {
+			return err
+		}
+		touch(e, scope.TableName(e, e.Scope.Value))
+		n, _ := result.RowsAffected()
+		e.RowsAffected += n
+	}
+	return nil
+}
+
+//UpdateBatchSQL builds the statements updating the elements of the slice
+//e.Scope.Value by primary key. Only the given columns are updated, or all the
+//fields but the primary key when there are none, UpdatedAt is always updated.
+//
+// Dialects supporting CASE expressions update as many rows per statement as
+// the bind parameters limit allows, with one CASE expression per column.
+// Other dialects update one row per statement.
+func UpdateBatchSQL(e *engine.Engine, columns []string) ([]*model.Expr, error) {
+	rows := reflect.Indirect(reflect.ValueOf(e.Scope.Value))
+	if rows.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("ngorm: bulk update needs a slice, got %T", e.Scope.Value)
+	}
+	if rows.Len() == 0 {
+		return nil, nil
+	}
+	if err := writable(e); err != nil {
+		return nil, err
+	}
+	records, err := batchRecords(e, rows)
+	if err != nil {
+		return nil, err
+	}
+	set, pk, err := updateColumns(e, records, columns)
+	if err != nil {
+		return nil, err
+	}
+	size := len(records)
+	if !dialects.SupportsCase(e.Dialect) {
+		size = 1
+	} else if max := dialects.MaxParams(e.Dialect); max > 0 && size*(2*len(set)+1) > max {
+		size = max / (2*len(set) + 1)
+		if size == 0 {
+			size = 1
+		}
+	}
+	var exprs []*model.Expr
+	for start := 0; start < len(records); start += size {
+		end := start + size
+		if end > len(records) {
+			end = len(records)
+		}
+		if err := updateChunk(e, records[start:end], set, pk); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, &model.Expr{Q: e.Scope.SQL, Args: e.Scope.SQLVars})
+	}
+	return exprs, nil
+}
+// updateColumns returns the indexes of the fields updated by UpdateBatch and
+// the index of the primary key.
+func updateColumns(e *engine.Engine, records [][]*model.Field, columns []string) ([]int, int, error) {
+	_, touchUpdatedAt := e.Scope.Get(model.UpdateColumn)
+	touchUpdatedAt = !touchUpdatedAt
+	found := make(map[string]bool)
+	var set []int
+	pk := -1
+	for k, field := range records[0] {
+		if !field.IsNormal {
+			continue
+		}
+		if field.IsPrimaryKey {
+			if pk != -1 {
+				return nil, -1, errors.New("ngorm: bulk update doesn't support composite primary keys")
+			}
+			pk = k
+			continue
+		}
+		if len(columns) == 0 {
+			if scope.ChangeableField(e, field) {
+				set = append(set, k)
+			}
+			continue
+		}
+		selected := false
+		for _, c := range columns {
+			if c == field.Name || c == field.DBName {
+				selected = true
+				found[c] = true
+			}
+		}
+		if selected || (touchUpdatedAt && field.Name == "UpdatedAt") {
+			set = append(set, k)
+		}
+	}
+	for _, c := range columns {
+		if !found[c] {
+			return nil, -1, fmt.Errorf("ngorm: unknown column %s", c)
+		}
+	}
+	if pk == -1 {
+		return nil, -1, errors.New("ngorm: bulk update needs a primary key")
+	}
+	if len(set) == 0 {
+		return nil, -1, errors.New("ngorm: bulk update has no columns to update")
+	}
+	for _, fds := range records {
+		if fds[pk].IsBlank {
+			return nil, -1, errors.New("ngorm: bulk update needs the primary key of all the rows")
+		}
+	}
+	return set, pk, nil
+}
+
+// updateChunk builds the statement updating records in e.Scope.SQL. The rows
+// are restricted by the conditions of the callbacks, like the tenant ones.
+func updateChunk(e *engine.Engine, records [][]*model.Field, set []int, pk int) error {
+	e.Scope.SQLVars = nil
+	tableName := insertTableName(e)
+	key := scope.Quote(e, records[0][pk].DBName)
+	var assigns []string
+	if len(records) == 1 {
+		for _, k := range set {
+			assigns = append(assigns, fmt.Sprintf("%v = %v",
+				scope.Quote(e, records[0][k].DBName),
+				scope.AddToVars(e, scope.FieldValue(e, records[0][k]))))
+		}
+		e.Scope.SQL = fmt.Sprintf("UPDATE %v SET %v WHERE %v = %v",
+			tableName, strings.Join(assigns, ", "), key,
+			scope.AddToVars(e, records[0][pk].Field.Interface()))
+	} else {
+		// The ELSE branch is never taken, it gives the CASE expression the
+		// type of the column on postgres where the bind parameters are
+		// untyped.
+		for _, k := range set {
+			column := scope.Quote(e, records[0][k].DBName)
+			var whens []string
+			for _, fds := range records {
+				whens = append(whens, fmt.Sprintf("WHEN %v THEN %v",
+					scope.AddToVars(e, fds[pk].Field.Interface()),
+					scope.AddToVars(e, scope.FieldValue(e, fds[k]))))
+			}
+			assigns = append(assigns, fmt.Sprintf("%v = CASE %v %v ELSE %v END",
+				column, key, strings.Join(whens, " "), column))
+		}
+		var ids []string
+		for _, fds := range records {
+			ids = append(ids, scope.AddToVars(e, fds[pk].Field.Interface()))
+		}
+		e.Scope.SQL = fmt.Sprintf("UPDATE %v SET %v WHERE %v IN (%v)",
+			tableName, strings.Join(assigns, ", "), key, strings.Join(ids, ","))
+	}
+	conds, err := builder.CallbackConditions(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	for _, c := range conds {
+		e.Scope.SQL += " AND " + c
+	}
+	return nil
+}
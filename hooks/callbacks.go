@@ -0,0 +1,112 @@
+package hooks
+
+import (
+	"sync"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/model"
+)
+
+var (
+	defaultsOnce sync.Once
+	defaults     *engine.Callbacks
+)
+
+//DefaultCallbacks returns new callbacks executing the operations like ngorm
+//does by default. The chains are
+//
+//	create: model.HookModelBeforeCreate, model.HookValidate,
+//	        model.HookCreateSQL, model.HookCreateExec, model.HookAfterCreate,
+//	        model.HookReloadDefaults, model.HookTrackChanges,
+//	        model.HookModelAfterCreate
+//	query:  model.HookQuerySQL, model.HookQueryExec, model.HookAfterQuery,
+//	        model.HookTrackChanges, model.HookModelAfterFind
+//	update: model.HookModelBeforeUpdate, model.HookValidate,
+//	        model.HookBeforeUpdate, model.HookUpdateSQL, model.HookUpdateExec,
+//	        model.HookAfterUpdate, model.HookTrackChanges,
+//	        model.HookModelAfterUpdate
+//	delete: model.HookModelBeforeDelete, model.HookBeforeDelete,
+//	        model.HookDeleteCascade, model.DeleteSQL, model.HookDeleteExec,
+//	        model.HookModelAfterDelete
+//
+// The model.HookModel callbacks call the methods of the models implementing
+// the lifecycle interfaces of the engine package, like engine.BeforeCreator.
+// model.HookValidate calls Validate and model.HookTrackChanges records the
+// values of the models embedding model.Tracked.
+func DefaultCallbacks() *engine.Callbacks {
+	c := engine.NewCallbacks()
+	register(c.Create(), []string{
+		model.HookModelBeforeCreate, model.HookValidate, model.HookCreateSQL,
+		model.HookCreateExec, model.HookAfterCreate, model.HookReloadDefaults,
+		model.HookTrackChanges, model.HookModelAfterCreate,
+	}, ModelBeforeCreate, Validate, CreateSQL, CreateExec, AfterCreate, ReloadDefaults,
+		TrackChanges, ModelAfterCreate)
+	register(c.Query(), []string{
+		model.HookQuerySQL, model.HookQueryExec, model.HookAfterQuery,
+		model.HookTrackChanges, model.HookModelAfterFind,
+	}, QuerySQL, QueryExec, AfterQuery, TrackChanges, ModelAfterFind)
+	register(c.Update(), []string{
+		model.HookModelBeforeUpdate, model.HookValidate, model.HookBeforeUpdate,
+		model.HookUpdateSQL, model.HookUpdateExec, model.HookAfterUpdate,
+		model.HookTrackChanges, model.HookModelAfterUpdate,
+	}, ModelBeforeUpdate, validateUpdate, beforeUpdate, UpdateSQL, updateExec, AfterUpdate,
+		TrackChanges, ModelAfterUpdate)
+	register(c.Delete(), []string{
+		model.HookModelBeforeDelete, model.HookBeforeDelete, model.HookDeleteCascade,
+		model.DeleteSQL, model.HookDeleteExec, model.HookModelAfterDelete,
+	}, ModelBeforeDelete, BeforeDelete, DeleteCascade, DeleteSQL, DeleteExec, ModelAfterDelete)
+	return c
+}
+
+func register(p *engine.Processor, names []string, fns ...engine.Callback) {
+	for i, name := range names {
+		// The names are distinct so this can't fail.
+		_ = p.Register(name, fns[i])
+	}
+}
+
+// callbacks returns the callbacks of e, or the default ones when it has none.
+func callbacks(e *engine.Engine) *engine.Callbacks {
+	if e.Callbacks != nil {
+		return e.Callbacks
+	}
+	defaultsOnce.Do(func() {
+		defaults = DefaultCallbacks()
+	})
+	return defaults
+}
+
+// beforeUpdate checks the precondition of the update before BeforeUpdate.
+func beforeUpdate(e *engine.Engine) error {
+	if _, err := ifMatch(e); err != nil {
+		return err
+	}
+	return BeforeUpdate(e)
+}
+
+// updateExec executes the update, which fails with
+// errmsg.ErrPreconditionFailed when the update is guarded and the row was
+// modified between the check and the update. Saving a tracked model which
+// didn't change executes nothing.
+func updateExec(e *engine.Engine) error {
+	if e.Scope.SQL == "" && tracked(e.Scope.Value) {
+		// Nothing changed since the model was loaded.
+		return nil
+	}
+	err := UpdateExec(e)
+	if err != nil {
+		return err
+	}
+	if _, guarded := e.Scope.Get(model.IfMatch); guarded && e.RowsAffected == 0 {
+		return errmsg.ErrPreconditionFailed
+	}
+	return nil
+}
+
+// tracked returns true when the changes of value are tracked, see
+// model.Tracked.
+func tracked(value interface{}) bool {
+	t, ok := value.(model.Tracker)
+	return ok && t.Original() != nil
+}
@@ -0,0 +1,223 @@
+package hooks
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/builder"
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/util"
+)
+
+// onDelete is the ON DELETE action of a foreign key referencing the rows of a
+// deleted model.
+type onDelete struct {
+	action string
+	field  string
+
+	// table and columns of the foreign key, referencing refs.
+	table   string
+	columns []string
+	refs    []string
+
+	// polymorphic type column and value of the referencing rows.
+	typeColumn, typeValue string
+
+	// value is a new value of the referencing model, nil for join tables.
+	value interface{}
+}
+
+// cascadeStep is a write applying the ON DELETE action of a relationship to
+// the referencing rows matching where and args.
+type cascadeStep struct {
+	onDelete
+	where string
+	args  []interface{}
+}
+
+//DeleteCascade applies the ON DELETE actions set with the CONSTRAINT tag to
+//the rows referencing the rows deleted by e, for the dialects like ql which
+//don't enforce foreign keys. Other databases apply the actions of the
+//constraints themselves.
+//
+// Only the has_one, has_many and many_to_many relationships declared on the
+// deleted model are followed. CASCADE deletes the referencing rows, and the
+// rows referencing them in turn, SET NULL clears their foreign keys while
+// RESTRICT and NO ACTION fail when there are referencing rows. Soft deletes
+// leave the referencing rows alone.
+//
+// The RESTRICT and NO ACTION checks of all the referencing rows are done
+// before the first write. Run it in the transaction of the delete, see
+// Cascades, so that the actions and the delete are applied together.
+func DeleteCascade(e *engine.Engine) error {
+	if !Cascades(e) {
+		return nil
+	}
+	c, err := builder.CombinedCondition(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	from := "FROM " + scope.QuotedTableName(e, e.Scope.Value) + util.AddExtraSpaceIfExist(c)
+	args := e.Scope.SQLVars
+	e.Scope.SQLVars = nil
+	steps, err := cascadeSteps(e, e.Scope.Value, from, args)
+	if err != nil {
+		return err
+	}
+	for _, s := range steps {
+		table := scope.Quote(e, s.table)
+		q := "DELETE FROM " + table + s.where
+		if s.action == "SET NULL" {
+			sets := make([]string, len(s.columns))
+			for i, c := range s.columns {
+				sets[i] = scope.Quote(e, c) + " = NULL"
+			}
+			q = "UPDATE " + table + " SET " + strings.Join(sets, ", ") + s.where
+		}
+		if _, err := exec(e, util.WrapTX(q), s.args...); err != nil {
+			return err
+		}
+		touch(e, s.table)
+	}
+	return nil
+}
+
+//Cascades returns true when deleting the rows of e applies ON DELETE actions
+//with DeleteCascade. The actions and the delete are then executed in a single
+//transaction.
+func Cascades(e *engine.Engine) bool {
+	if !dialects.IsQL(e.Dialect) || e.Scope.Value == nil {
+		return false
+	}
+	if !e.Search.Unscoped && scope.SoftDeleteOf(e, e.Scope.Value) != nil {
+		return false
+	}
+	actions, err := deleteActions(e, e.Scope.Value)
+	return err == nil && len(actions) > 0
+}
+
+// cascadeSteps returns the writes applying the ON DELETE actions of the
+// relationships of value to the rows referencing the rows selected with from
+// and args, the writes on the rows referencing them in turn first. Nothing is
+// written, so it fails on any RESTRICT or NO ACTION of the whole tree before
+// the first write.
+func cascadeSteps(e *engine.Engine, value interface{}, from string, args []interface{}) ([]cascadeStep, error) {
+	actions, err := deleteActions(e, value)
+	if err != nil || len(actions) == 0 {
+		return nil, err
+	}
+	ne := e.Clone()
+	defer engine.Put(ne)
+	var steps []cascadeStep
+	for _, a := range actions {
+		keys, err := selectKeys(e, a.refs, from, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		ne.Scope.SQLVars = nil
+		cond := scope.KeysConditionVars(ne, a.columns, keys)
+		if a.typeColumn != "" {
+			cond += fmt.Sprintf(" AND %s = %s",
+				scope.Quote(ne, a.typeColumn), scope.AddToVars(ne, a.typeValue))
+		}
+		s := cascadeStep{onDelete: a, where: " WHERE " + cond, args: ne.Scope.SQLVars}
+		table := scope.Quote(e, a.table)
+		switch a.action {
+		case "RESTRICT", "NO ACTION":
+			var n int64
+			q := "SELECT count(*) FROM " + table + s.where
+			if err := scanRow(e, q, s.args, &n); err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				return nil, fmt.Errorf("ngorm: can't delete, %d rows of %s reference it through %s",
+					n, a.table, a.field)
+			}
+		case "CASCADE":
+			if a.value != nil {
+				nested, err := cascadeSteps(e, a.value, "FROM "+table+s.where, s.args)
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, nested...)
+			}
+			steps = append(steps, s)
+		case "SET NULL":
+			steps = append(steps, s)
+		}
+	}
+	return steps, nil
+}
+
+// deleteActions returns the ON DELETE actions of the relationships of value.
+func deleteActions(e *engine.Engine, value interface{}) ([]onDelete, error) {
+	m, err := scope.GetModelStruct(e, value)
+	if err != nil {
+		return nil, err
+	}
+	var actions []onDelete
+	for _, f := range m.StructFields {
+		rel := f.Relationship
+		if rel == nil || rel.OnDelete == "" {
+			continue
+		}
+		a := onDelete{action: rel.OnDelete, field: f.Name}
+		switch rel.Kind {
+		case "has_one", "has_many":
+			t := f.Struct.Type
+			for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			a.value = reflect.New(t).Interface()
+			a.table = associationTable(e, a.value)
+			a.columns, a.refs = rel.ForeignDBNames, rel.AssociationForeignDBNames
+			a.typeColumn, a.typeValue = rel.PolymorphicDBName, rel.PolymorphicValue
+		case "many_to_many":
+			h := rel.JoinTableHandler
+			if h == nil {
+				continue
+			}
+			a.table = h.TableName
+			a.columns, a.refs = h.Source.DBNames(), h.Source.AssociationDBNames()
+		default:
+			continue
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// selectKeys returns the distinct values of columns of the rows selected with
+// from and args.
+func selectKeys(e *engine.Engine, columns []string, from string, args []interface{}) ([][]interface{}, error) {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = scope.Quote(e, c)
+	}
+	rows, err := query(e, fmt.Sprintf("SELECT DISTINCT %s %s", strings.Join(quoted, ","), from), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var keys [][]interface{}
+	for rows.Next() {
+		key := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range key {
+			dest[i] = &key[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
@@ -2,12 +2,17 @@
 package hooks
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"log"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ngorm/ngorm/builder"
@@ -20,29 +25,23 @@ import (
 	"github.com/ngorm/ngorm/util"
 )
 
-//Query executes sql Query without transaction. This first executes QuerySQL
-//which generates appropriate SQl query then QueryExec hook is executed to
-//execute the generated query.
-//
-// If all is well HookAfterQuery is executed, if this hook is not registered
-// then no error is returned.
+//Query executes sql Query without transaction. This runs the query callbacks
+//of e, by default QuerySQL which generates appropriate SQl query then
+//QueryExec to execute the generated query and AfterQuery.
 func Query(e *engine.Engine) error {
-	err := QuerySQL(e)
-	if err != nil {
-		return err
-	}
-	err = QueryExec(e)
-	if err != nil {
-		return err
-	}
-	return AfterQuery(e)
+	return callbacks(e).Query().Run(e)
 }
 
 //QueryExec  executes SQL queries and scans the result to the pointer object
 //that is in e.Scope.Value.
 //
 // The value stored in e.Scope.Value can only either be a struct or a slice
-// other types are not supported.
+// other types are not supported. The destination set with
+// model.QueryDestination can also be a map[string]interface{} or a
+// []map[string]interface{}, see IsMapDestination, a scalar receiving the
+// single column of the first row, see IsScalarDestination, or a slice of
+// scalars receiving the single column of all the rows, see
+// IsColumnDestination.
 //
 // NOTE: queries are not executed in transaction context.
 func QueryExec(e *engine.Engine) error {
@@ -55,6 +54,15 @@ func QueryExec(e *engine.Engine) error {
 	if value, ok := e.Scope.Get(model.QueryDestination); ok {
 		results = reflect.Indirect(reflect.ValueOf(value))
 	}
+	if IsMapDestination(results.Interface()) {
+		return queryMaps(e, results)
+	}
+	if results.CanAddr() && scope.IsScalar(results.Type()) {
+		return queryScalar(e, results)
+	}
+	if results.CanAddr() && IsColumnDestination(results.Addr().Interface()) {
+		return queryColumn(e, results)
+	}
 	if kind := results.Kind(); kind == reflect.Slice {
 		isSlice = true
 		resultType = results.Type().Elem()
@@ -72,7 +80,7 @@ func QueryExec(e *engine.Engine) error {
 		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
 	}
 
-	rows, err := e.SQLDB.Query(e.Scope.SQL, e.Scope.SQLVars...)
+	rows, err := query(e, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
@@ -91,7 +99,30 @@ func QueryExec(e *engine.Engine) error {
 		if err != nil {
 			return err
 		}
-		scope.Scan(rows, columns, fields)
+		joined, setJoined, err := joinedFields(e, elem)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, joined...)
+		if e.RowsAffected == 1 {
+			columns, err = scope.ScanColumns(columns, fields, e.Search.ColumnMap)
+			if err != nil {
+				return err
+			}
+			err = checkUnmapped(e, columns, fields)
+			if err != nil {
+				return err
+			}
+		}
+		err = scope.Scan(e, rows, columns, fields)
+		if err != nil {
+			return err
+		}
+		err = scope.DecryptFields(e, columns, fields)
+		if err != nil {
+			return err
+		}
+		setJoined()
 		if isSlice {
 			if isPtr {
 				results.Set(reflect.Append(results, elem.Addr()))
@@ -100,32 +131,453 @@ func QueryExec(e *engine.Engine) error {
 			}
 		}
 	}
+	if e.Analyzer != nil {
+		e.Analyzer.Observe(e.Ctx, scope.TableName(e, e.Scope.Value), e.Scope.SQL, int(e.RowsAffected))
+	}
 	if e.RowsAffected == 0 && !isSlice {
 		return errmsg.ErrRecordNotFound
 	}
 	return nil
 }
 
+var (
+	mapType      = reflect.TypeOf(map[string]interface{}{})
+	mapSliceType = reflect.TypeOf([]map[string]interface{}{})
+)
+
+//IsMapDestination returns true if value is a map[string]interface{} or a
+//[]map[string]interface{}, or a pointer to one of them, which QueryExec
+//populates with a key per column instead of struct fields.
+func IsMapDestination(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == mapType || t == mapSliceType
+}
+
+//IsScalarDestination returns true if value is a pointer to a scalar as
+//reported by scope.IsScalar, which QueryExec sets from the single column of
+//the first row.
+func IsScalarDestination(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	return t != nil && t.Kind() == reflect.Ptr && scope.IsScalar(t.Elem())
+}
+
+//IsColumnDestination returns true if value is a pointer to a slice of
+//scalars, like *[]int64, which QueryExec sets from the single column of all
+//the rows.
+func IsColumnDestination(value interface{}) bool {
+	t := reflect.TypeOf(value)
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice &&
+		!scope.IsScalar(t.Elem()) && scope.IsScalar(t.Elem().Elem())
+}
+
+// queryScalar executes the query and scans the single column of the first row
+// into result.
+func queryScalar(e *engine.Engine, result reflect.Value) error {
+	e.RowsAffected = 0
+	if str, ok := e.Scope.Get(model.QueryOption); ok {
+		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	rows, err := query(e, e.Scope.SQL, e.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return errmsg.ErrRecordNotFound
+	}
+	e.RowsAffected = 1
+	return scope.ScanScalar(e, rows, result)
+}
+
+// queryColumn executes the query and sets results, which is a slice of
+// scalars, to the values of the single column of the rows. The elements
+// results had are replaced.
+func queryColumn(e *engine.Engine, results reflect.Value) error {
+	results.Set(reflect.MakeSlice(results.Type(), 0, 0))
+	e.RowsAffected = 0
+	if str, ok := e.Scope.Get(model.QueryOption); ok {
+		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	err := scanColumn(e, e.Scope.SQL, e.Scope.SQLVars, results)
+	if err != nil {
+		return err
+	}
+	e.RowsAffected = int64(results.Len())
+	return nil
+}
+
+// queryMaps executes the query and scans the rows into results, which is either
+// a map[string]interface{} receiving the first row or a
+// []map[string]interface{} receiving all of them. Values are converted to Go
+// types according to the column types, see dialects.ConvertValue.
+func queryMaps(e *engine.Engine, results reflect.Value) error {
+	isSlice := results.Type() == mapSliceType
+	if isSlice {
+		results.Set(reflect.MakeSlice(mapSliceType, 0, 0))
+	} else if results.IsNil() {
+		if !results.CanSet() {
+			return errors.New("unsupported destination, map should be addressable or initialized")
+		}
+		results.Set(reflect.MakeMap(mapType))
+	}
+	e.RowsAffected = 0
+	if str, ok := e.Scope.Get(model.QueryOption); ok {
+		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	rows, err := query(e, e.Scope.SQL, e.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values, err := scope.ScanValues(e, rows)
+		if err != nil {
+			return err
+		}
+		e.RowsAffected++
+		m := make(map[string]interface{}, len(columns))
+		if !isSlice {
+			m = results.Interface().(map[string]interface{})
+		}
+		for k, c := range columns {
+			m[c] = values[k]
+		}
+		if !isSlice {
+			break
+		}
+		results.Set(reflect.Append(results, reflect.ValueOf(m)))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if e.Analyzer != nil {
+		e.Analyzer.Observe(e.Ctx, scope.TableName(e, e.Scope.Value), e.Scope.SQL, int(e.RowsAffected))
+	}
+	if e.RowsAffected == 0 && !isSlice {
+		return errmsg.ErrRecordNotFound
+	}
+	return nil
+}
+
+// checkUnmapped reports the columns without a matching field as configured by
+// e.Unmapped.
+func checkUnmapped(e *engine.Engine, columns []string, fields []*model.Field) error {
+	if e.Unmapped == model.UnmappedIgnore {
+		return nil
+	}
+	unmapped := scope.Unmapped(columns, fields)
+	if len(unmapped) == 0 {
+		return nil
+	}
+	err := &errmsg.UnmappedColumnsError{
+		Table:   scope.TableName(e, e.Scope.Value),
+		Columns: unmapped,
+	}
+	if e.Unmapped == model.UnmappedStrict {
+		return err
+	}
+	if w, ok := e.SQLDB.(*model.SQLCommonWrapper); ok {
+		w.Printf("%v in query %s", err, e.Scope.SQL)
+	} else {
+		log.Printf("%v in query %s", err, e.Scope.SQL)
+	}
+	return nil
+}
+
+//Rows builds the query for the search of e and executes it, returning the rows
+//for the caller to iterate with ScanRows and close. Use it to read results
+//which are too large to be loaded at once.
+func Rows(e *engine.Engine) (*sql.Rows, error) {
+	err := QuerySQL(e)
+	if err != nil {
+		return nil, err
+	}
+	if str, ok := e.Scope.Get(model.QueryOption); ok {
+		e.Scope.SQL += util.AddExtraSpaceIfExist(fmt.Sprint(str))
+	}
+	return query(e, e.Scope.SQL, e.Scope.SQLVars...)
+}
+
+//ScanRows scans the current row of rows into dest, which is a pointer to a
+//struct, to a map[string]interface{} or to a scalar receiving the single
+//column. The fields of the struct are matched with the columns the same way as
+//for QueryExec.
+func ScanRows(e *engine.Engine, rows *sql.Rows, dest interface{}) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errmsg.ErrUnaddressable
+	}
+	if v.Elem().Type() == mapType {
+		values, err := scope.ScanValues(e, rows)
+		if err != nil {
+			return err
+		}
+		if v.Elem().IsNil() {
+			v.Elem().Set(reflect.MakeMap(mapType))
+		}
+		m := v.Elem().Interface().(map[string]interface{})
+		for k, c := range columns {
+			m[c] = values[k]
+		}
+		return nil
+	}
+	if IsScalarDestination(dest) {
+		return scope.ScanScalar(e, rows, v.Elem())
+	}
+	if v.Elem().Kind() != reflect.Struct {
+		return errors.New("unsupported destination, should be a pointer to a struct, a map or a scalar")
+	}
+	fields, err := scope.Fields(e, dest)
+	if err != nil {
+		return err
+	}
+	columns, err = scope.ScanColumns(columns, fields, e.Search.ColumnMap)
+	if err != nil {
+		return err
+	}
+	err = checkUnmapped(e, columns, fields)
+	if err != nil {
+		return err
+	}
+	err = scope.Scan(e, rows, columns, fields)
+	if err != nil {
+		return err
+	}
+	return scope.DecryptFields(e, columns, fields)
+}
+
 //QuerySQL generates SQL for queries. This uses `builder.PrepareQuery` to build
 //the desired SQL query.
 func QuerySQL(e *engine.Engine) error {
-	if orderBy, ok := e.Scope.Get(model.OrderByPK); ok {
-		pf, err := scope.PrimaryField(e, e.Scope.ValueOf())
-		if err != nil {
-		} else {
-			search.Order(e, fmt.Sprintf("%v%v %v",
-				e.Dialect.QueryFieldName(
-					scope.QuotedTableName(e, e.Scope.ValueOf())),
-				scope.Quote(e, pf.DBName), orderBy))
+	if err := JoinPreloadSQL(e); err != nil {
+		return err
+	}
+	orderByPK(e)
+	return builder.PrepareQuery(e, e.Scope.ValueOf())
+}
+
+// orderByPK adds ORDER BY primary key when model.OrderByPK is set. Models with
+// a composite primary key are ordered by all the primary key columns.
+func orderByPK(e *engine.Engine) {
+	orderBy, ok := e.Scope.Get(model.OrderByPK)
+	if !ok {
+		return
+	}
+	pfs, err := scope.PrimaryFields(e, e.Scope.ValueOf())
+	if err != nil {
+		return
+	}
+	for _, pf := range pfs {
+		search.Order(e, fmt.Sprintf("%v%v %v",
+			e.Dialect.QueryFieldName(
+				scope.QuotedTableAlias(e, e.Scope.ValueOf())),
+			scope.Quote(e, pf.DBName), orderBy))
+	}
+}
+
+//ToSQL returns the statement for op together with its bind arguments without
+//executing it. op is one of model.Query, model.Create, model.Update or
+//model.Delete.
+//
+// The statement is the same as the one that would be executed, including the
+// transaction block used with ql for the state altering operations.
+func ToSQL(e *engine.Engine, op string) (string, []interface{}, error) {
+	var err error
+	switch op {
+	case model.Query:
+		orderByPK(e)
+		return builder.ToSQL(e, e.Scope.ValueOf())
+	case model.Create:
+		err = CreateSQL(e)
+	case model.Update:
+		err = UpdateSQL(e)
+	case model.Delete:
+		err = DeleteSQL(e)
+	default:
+		err = fmt.Errorf("ngorm: unknown operation %q", op)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return e.Scope.SQL, e.Scope.SQLVars, nil
+}
+
+//Count scans the number of rows matched by the search conditions of e on
+//modelValue into dest. ORDER BY, LIMIT and OFFSET are ignored, see
+//builder.CountSQL for distinct and grouped counts.
+func Count(e *engine.Engine, modelValue, dest interface{}) error {
+	q, args, err := builder.CountSQL(e, modelValue)
+	if err != nil {
+		return err
+	}
+	return scanRow(e, q, args, dest)
+}
+
+//Sum scans the sum of column over the rows matched by the search conditions
+//of e on modelValue into dest. See Aggregate.
+func Sum(e *engine.Engine, modelValue interface{}, column string, dest interface{}) error {
+	return Aggregate(e, modelValue, "sum", column, dest)
+}
+
+//Avg scans the average of column into dest. See Aggregate.
+func Avg(e *engine.Engine, modelValue interface{}, column string, dest interface{}) error {
+	return Aggregate(e, modelValue, "avg", column, dest)
+}
+
+//Min scans the smallest value of column into dest. See Aggregate.
+func Min(e *engine.Engine, modelValue interface{}, column string, dest interface{}) error {
+	return Aggregate(e, modelValue, "min", column, dest)
+}
+
+//Max scans the largest value of column into dest. See Aggregate.
+func Max(e *engine.Engine, modelValue interface{}, column string, dest interface{}) error {
+	return Aggregate(e, modelValue, "max", column, dest)
+}
+
+//Aggregate applies the aggregate function fn to column over the rows matched
+//by the search conditions of e on modelValue and scans the result into dest,
+//which must be a pointer. dest is set to its zero value when there are no
+//rows to aggregate.
+//
+// Grouped searches return a row per group, in which case dest must be a
+// pointer to a slice of structs or of map[string]interface{}. The rows have
+// the GROUP BY columns and the aggregate named after column, for instance
+//
+//    var totals []struct {
+//    	UserID int64
+//    	Amount int64
+//    }
+//    err := hooks.Sum(e, &Order{}, "amount", &totals) // grouped by user_id
+func Aggregate(e *engine.Engine, modelValue interface{}, fn, column string, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errmsg.ErrUnaddressable
+	}
+	v = v.Elem()
+	grouped := e.Search.Group != "" || len(e.Search.GroupExprs) > 0
+	if grouped {
+		if v.Kind() != reflect.Slice || (v.Type().Elem().Kind() != reflect.Struct && v.Type().Elem() != mapType) {
+			return fmt.Errorf("ngorm: grouped aggregates need a slice of structs or maps, not %s", v.Type())
 		}
+	}
+	q, args, err := builder.AggregateSQL(e, modelValue, fn, column)
+	if err != nil {
+		return err
+	}
+	if grouped {
+		return scanGroups(e, q, args, v)
+	}
+	// scanning into a pointer to dest allows NULL results.
+	value := reflect.New(reflect.PtrTo(v.Type()))
+	if err := scanRow(e, q, args, value.Interface()); err != nil {
+		return err
+	}
+	if value.Elem().IsNil() {
+		v.Set(reflect.Zero(v.Type()))
+	} else {
+		v.Set(value.Elem().Elem())
+	}
+	return nil
+}
 
+// scanGroups executes q and sets dest, a slice, to the rows it returns.
+func scanGroups(e *engine.Engine, q string, args []interface{}, dest reflect.Value) error {
+	rows, err := query(e, q, args...)
+	if err != nil {
+		return err
 	}
-	return builder.PrepareQuery(e, e.Scope.ValueOf())
+	defer func() { _ = rows.Close() }()
+	results := reflect.MakeSlice(dest.Type(), 0, 0)
+	for rows.Next() {
+		row := reflect.New(dest.Type().Elem())
+		if err := ScanRows(e, rows, row.Interface()); err != nil {
+			return err
+		}
+		results = reflect.Append(results, row.Elem())
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	dest.Set(results)
+	return nil
+}
+
+//Pluck scans column of the rows matched by the search conditions of e on
+//modelValue into dest, which must be a pointer to a slice, for instance
+//
+//  var names []string
+//  err := hooks.Pluck(e, &User{}, "name", &names)
+//
+// The values are appended to dest. NULL values are appended as the zero value
+// of the element type, use a slice of pointers or sql.Null* values to tell
+// them apart.
+func Pluck(e *engine.Engine, modelValue interface{}, column string, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errmsg.ErrUnaddressable
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("results should be a slice, not %s", v.Kind())
+	}
+	selects := e.Search.Selects
+	defer func() { e.Search.Selects = selects }()
+	search.Select(e, column)
+	q, err := builder.PrepareQuerySQL(e, modelValue)
+	if err != nil {
+		return err
+	}
+	return scanColumn(e, q, e.Scope.SQLVars, v)
+}
+
+// scanColumn executes q and appends the values of the first column of the
+// returned rows to dest, which is a slice.
+func scanColumn(e *engine.Engine, q string, args []interface{}, dest reflect.Value) error {
+	rows, err := query(e, q, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	typ := dest.Type().Elem()
+	for rows.Next() {
+		// The elements are scanned like struct fields, NULL gives the zero
+		// value and a nil pointer.
+		value := reflect.New(typ).Elem()
+		if err := scope.ScanScalar(e, rows, value); err != nil {
+			return err
+		}
+		dest.Set(reflect.Append(dest, value))
+	}
+	return rows.Err()
 }
 
 //AfterQuery executes any call back after the  Query hook has been executed. Any
 //callback registered with key model.HookQueryAfterFind will be executed.
 func AfterQuery(e *engine.Engine) error {
+	if err := AutoPreload(e); err != nil {
+		return err
+	}
 	if e.Search.Preload != nil {
 		err := Preload(e)
 		if err != nil {
@@ -135,17 +587,93 @@ func AfterQuery(e *engine.Engine) error {
 	return nil
 }
 
-//Create the hook executed to create a new record.
+//Create the hook executed to create a new record. This runs the create
+//callbacks of e, by default CreateSQL, CreateExec and AfterCreate.
 func Create(e *engine.Engine) error {
-	err := CreateSQL(e)
+	return callbacks(e).Create().Run(e)
+}
+
+//CreateMap inserts a row from values, which maps column names to their
+//values, into the table set with search.Table or else the table of the model
+//of e. This is for tables without a matching struct, all the columns must
+//exist on the table.
+func CreateMap(e *engine.Engine, values map[string]interface{}) error {
+	table := scope.TableName(e, e.Scope.Value)
+	if table == "" {
+		return errmsg.ErrMissingModel
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("ngorm: no columns to insert into %s", table)
+	}
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	// Sorted so the same map always builds the same statement.
+	sort.Strings(columns)
+	cols := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		if !e.Dialect.HasColumn(table, column) {
+			return fmt.Errorf("ngorm: table %s has no column %s", table, column)
+		}
+		cols[i] = scope.Quote(e, column)
+		placeholders[i] = scope.AddToVars(e, values[column])
+	}
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", scope.Quote(e, table),
+		strings.Join(cols, ","), strings.Join(placeholders, ","))
+	if dialects.IsQL(e.Dialect) {
+		sql = "BEGIN TRANSACTION;\n\t" + sql + ";\nCOMMIT;"
+	}
+	e.Scope.SQL = sql
+	result, err := exec(e, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
-	err = CreateExec(e)
+	touch(e, table)
+	e.RowsAffected, _ = result.RowsAffected()
+
+	// Not all drivers report the last insert id.
+	e.LastInsertID, _ = result.LastInsertId()
+	return nil
+}
+
+//Save creates e.Scope.Value when it is new and updates all its fields
+//otherwise, see IsNew.
+func Save(e *engine.Engine) error {
+	isNew, err := IsNew(e, e.Scope.Value)
 	if err != nil {
 		return err
 	}
-	return AfterCreate(e)
+	if isNew {
+		return Create(e)
+	}
+	return Update(e)
+}
+
+// writable returns errmsg.ErrProjectionWrite when the model of e is a
+// projection, which can't be created or updated, and errmsg.ErrReadOnly when
+// it is read only.
+func writable(e *engine.Engine) error {
+	return scope.Writable(e, e.Scope.Value)
+}
+
+//IsNew returns true when value wasn't saved yet, that is when one of its
+//primary keys is blank or when it has no primary key.
+func IsNew(e *engine.Engine, value interface{}) (bool, error) {
+	fds, err := scope.PrimaryFields(e, value)
+	if err != nil {
+		return false, err
+	}
+	if len(fds) == 0 {
+		return true, nil
+	}
+	for _, field := range fds {
+		if util.IsBlank(field.Field) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func create(e *engine.Engine) error {
@@ -160,15 +688,18 @@ func create(e *engine.Engine) error {
 		return err
 	}
 
+	// Blank columns chosen with Select are inserted even when they have a
+	// default value.
+	selected := len(scope.SelectAttrs(e)) > 0
 	for _, field := range fds {
 		if scope.ChangeableField(e, field) {
 			if field.IsNormal {
-				if field.IsBlank && field.HasDefaultValue {
-					cv = append(cv, scope.Quote(e, field.DBName))
+				if field.IsBlank && field.HasDefaultValue && !selected {
+					cv = append(cv, field.DBName)
 					e.Scope.Set(model.BlankColWithValue, cv)
 				} else if !field.IsPrimaryKey || !field.IsBlank {
 					cols = append(cols, scope.Quote(e, field.DBName))
-					placeholders = append(placeholders, scope.AddToVars(e, field.Field.Interface()))
+					placeholders = append(placeholders, scope.AddToVars(e, scope.FieldValue(e, field)))
 				}
 			} else if field.Relationship != nil && field.Relationship.Kind == "belongs_to" {
 				for _, foreignKey := range field.Relationship.ForeignDBNames {
@@ -188,7 +719,7 @@ func create(e *engine.Engine) error {
 
 	var (
 		returningColumn = "*"
-		tableName       = scope.QuotedTableName(e, e.Scope.ValueOf())
+		tableName       = insertTableName(e)
 
 		extraOption string
 	)
@@ -219,7 +750,7 @@ func create(e *engine.Engine) error {
 	} else {
 		sql := fmt.Sprintf(
 			"INSERT INTO %v (%v) VALUES (%v)%v%v",
-			scope.QuotedTableName(e, e.Scope.ValueOf()),
+			tableName,
 			strings.Join(cols, ","),
 			strings.Join(placeholders, ","),
 			util.AddExtraSpaceIfExist(extraOption),
@@ -241,34 +772,15 @@ func CreateExec(e *engine.Engine) error {
 	if primaryField != nil {
 		returningColumn = scope.Quote(e, primaryField.DBName)
 	}
-	tableName := scope.QuotedTableName(e, e.Scope.ValueOf())
+	tableName := insertTableName(e)
 	lastInsertIDReturningSuffix :=
 		e.Dialect.LastInsertIDReturningSuffix(tableName, returningColumn)
 	if lastInsertIDReturningSuffix == "" || primaryField == nil {
-		var result sql.Result
-		if dialects.IsQL(e.Dialect) {
-			tx, err := e.SQLDB.Begin()
-			if err != nil {
-				return err
-			}
-			result, err = tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-			if err != nil {
-				rerr := tx.Rollback()
-				if rerr != nil {
-					return rerr
-				}
-				return err
-			}
-			err = tx.Commit()
-			if err != nil {
-				return err
-			}
-		} else {
-			result, err = e.SQLDB.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-			if err != nil {
-				return err
-			}
+		result, err := exec(e, e.Scope.SQL, e.Scope.SQLVars...)
+		if err != nil {
+			return err
 		}
+		touch(e, scope.TableName(e, e.Scope.Value))
 
 		// set rows affected count
 		e.RowsAffected, _ = result.RowsAffected()
@@ -279,19 +791,25 @@ func CreateExec(e *engine.Engine) error {
 			if err != nil {
 				return err
 			}
+			e.LastInsertID = primaryValue
 			_ = primaryField.Set(primaryValue)
 		}
 	} else {
 		if primaryField.Field.CanAddr() {
-			err := e.SQLDB.QueryRow(
-				e.Scope.SQL,
-				e.Scope.SQLVars...,
-			).Scan(primaryField.Field.Addr().Interface())
+			err := scanRow(e, e.Scope.SQL, e.Scope.SQLVars,
+				primaryField.Field.Addr().Interface())
 			if err != nil {
 				return err
 			}
 			primaryField.IsBlank = false
 			e.RowsAffected = 1
+			switch v := reflect.Indirect(primaryField.Field); v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				e.LastInsertID = v.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				e.LastInsertID = int64(v.Uint())
+			}
+			touch(e, scope.TableName(e, e.Scope.Value))
 		} else {
 			return errmsg.ErrUnaddressable
 		}
@@ -307,11 +825,69 @@ func AfterCreate(e *engine.Engine) error {
 	return AfterAssociation(e)
 }
 
+//ReloadDefaults reads back the columns which were left out of the insert of
+//the model of e because they were blank and have a default value, so that the
+//model holds the values computed by the database. Nothing is read for models
+//without a primary key.
+func ReloadDefaults(e *engine.Engine) error {
+	v, ok := e.Scope.Get(model.BlankColWithValue)
+	if !ok {
+		return nil
+	}
+	columns, _ := v.([]string)
+	if len(columns) == 0 || reflect.Indirect(e.Scope.ValueOf()).Kind() != reflect.Struct {
+		return nil
+	}
+	fds, err := scope.Fields(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	ne := e.Clone()
+	defer engine.Put(ne)
+	ne.Scope.SQLVars = nil
+	var where []string
+	for _, f := range fds {
+		if !f.IsPrimaryKey {
+			continue
+		}
+		if f.IsBlank {
+			return nil
+		}
+		where = append(where, scope.Quote(ne, f.DBName)+" = "+scope.AddToVars(ne, f.Field.Interface()))
+	}
+	if len(where) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(columns))
+	for k, c := range columns {
+		quoted[k] = scope.Quote(ne, c)
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(quoted, ","),
+		insertTableName(e), strings.Join(where, " AND "))
+	rows, err := query(ne, q, ne.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	if !rows.Next() {
+		return rows.Err()
+	}
+	err = scope.Scan(e, rows, columns, fds)
+	if err != nil {
+		return err
+	}
+	return scope.DecryptFields(e, columns, fds)
+}
+
 //QLAfterCreate hook executed after a new record has been created. This is for
 //ql dialect use only.
 func QLAfterCreate(e *engine.Engine) error {
 	ne := e.Clone()
 	defer engine.Put(ne)
+
+	// The columns left out of the insert are left out of the update too.
+	ne.Search.Selects = e.Search.Selects
+	ne.Search.Omits = e.Search.Omits
 	ne.Scope.Set(model.IgnoreProtectedAttrs, true)
 	ne.Scope.Set(model.UpdateInterface, util.ToSearchableMap(e.Scope.Value))
 	ne.Scope.ContextValue(e.Scope.Value)
@@ -324,7 +900,11 @@ func QLAfterCreate(e *engine.Engine) error {
 	if err != nil {
 		return err
 	}
-	return UpdateExec(ne)
+
+	// This completes the insert, the table is already reported as touched so
+	// UpdateExec is not used here.
+	_, err = execTx(ne, ne.Scope.SQL, ne.Scope.SQLVars...)
+	return err
 }
 
 func fixWhere(s *model.Scope) error {
@@ -391,6 +971,32 @@ func BeforeUpdate(e *engine.Engine) error {
 	return nil
 }
 
+//UpdateColumns generates and executes sql query for updating the columns set
+//with model.UpdateInterface. Unlike Update, BeforeUpdate and AfterUpdate are
+//not called so UpdatedAt is left alone and associations are not saved, this is
+//meant for counters and denormalized columns.
+func UpdateColumns(e *engine.Engine) error {
+	guarded, err := ifMatch(e)
+	if err != nil {
+		return err
+	}
+	if !scope.HasConditions(e, e.Scope.Value) {
+		return errors.New("missing WHERE condition for update")
+	}
+	err = UpdateSQL(e)
+	if err != nil {
+		return err
+	}
+	err = UpdateExec(e)
+	if err != nil {
+		return err
+	}
+	if guarded && e.RowsAffected == 0 {
+		return errmsg.ErrPreconditionFailed
+	}
+	return nil
+}
+
 //AfterUpdate handles things needed to be done after updating records. This just
 //calls two hooks
 //
@@ -425,7 +1031,9 @@ func AssignUpdatingAttrs(e *engine.Engine) error {
 	return nil
 }
 
-//SaveBeforeAssociation saves associations on the model
+//SaveBeforeAssociation saves the belongs_to associations of the model, which
+//must exist before the model references them. New associations are created
+//and the others updated, see Save and scope.AssociationSaving.
 func SaveBeforeAssociation(e *engine.Engine) error {
 	if !scope.ShouldSaveAssociation(e) {
 		return nil
@@ -437,20 +1045,20 @@ func SaveBeforeAssociation(e *engine.Engine) error {
 	for _, field := range fds {
 		if ok, relationship := scope.SaveFieldAsAssociation(e, field); ok && relationship.Kind == "belongs_to" {
 			fieldValue := field.Field.Addr().Interface()
+			saving := scope.AssociationSaving(e, field)
 
 			// For the fieldValue, we need to make sure the value is saved into
-			// the database.
-			//
-			// We have two hooks to use here, one model.HookCreateSQL which will
-			// build sql for creating the new record and model.HookCreateExec
-			// which will execute the generates SQL.
+			// the database. It is created when new and updated otherwise.
 			ne := e.Clone()
 			defer engine.Put(ne)
 			ne.Scope.ContextValue(fieldValue)
-			err = Create(ne)
+			saved, err := saveAssociation(ne, saving)
 			if err != nil {
 				return err
 			}
+			if !saving.SaveReference || !saved {
+				continue
+			}
 			if len(relationship.ForeignFieldNames) != 0 {
 				// set value's foreign key
 				for idx, fieldName := range relationship.ForeignFieldNames {
@@ -471,7 +1079,25 @@ func SaveBeforeAssociation(e *engine.Engine) error {
 	return nil
 }
 
-//AfterAssociation saves associations on the model
+// saveAssociation saves the association value of ne when saving allows it,
+// and returns true when the association exists in the database.
+func saveAssociation(ne *engine.Engine, saving model.AssociationSaving) (bool, error) {
+	isNew, err := IsNew(ne, ne.Scope.Value)
+	if err != nil {
+		return false, err
+	}
+	if (isNew && !saving.AutoCreate) || (!isNew && !saving.AutoUpdate) {
+		return !isNew, nil
+	}
+	if err := Save(ne); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//AfterAssociation saves the has_one, has_many and many_to_many associations
+//of the model once it is saved, setting their foreign keys. New associations
+//are created and the others updated, see Save and scope.AssociationSaving.
 func AfterAssociation(e *engine.Engine) error {
 	if !scope.ShouldSaveAssociation(e) {
 		return nil
@@ -486,99 +1112,27 @@ func AfterAssociation(e *engine.Engine) error {
 			case "has_many",
 				"has_one",
 				"many_to_many":
+				saving := scope.AssociationSaving(e, field)
 				value := field.Field
+				var elems []interface{}
 				switch value.Kind() {
 				case reflect.Slice:
 					for i := 0; i < value.Len(); i++ {
-						ne := e.Clone()
-						defer engine.Put(ne)
 						vi := value.Index(i)
-						var elem interface{}
 						if vi.Kind() == reflect.Ptr {
-							elem = vi.Interface()
+							elems = append(elems, vi.Interface())
 						} else {
-							elem = vi.Addr().Interface()
-						}
-						ne.Scope.ContextValue(elem)
-						if rel.JoinTableHandler == nil && len(rel.ForeignFieldNames) != 0 {
-							for idx, fieldName := range rel.ForeignFieldNames {
-								associationForeignName := rel.AssociationForeignFieldNames[idx]
-								for _, fd := range fds {
-									if fd.Name == associationForeignName {
-										err = scope.SetColumn(ne, fieldName, fd.Field.Interface())
-										if err != nil {
-											return err
-										}
-									}
-								}
-							}
+							elems = append(elems, vi.Addr().Interface())
 						}
-						if rel.PolymorphicType != "" {
-							err = scope.SetColumn(ne, rel.PolymorphicType, rel.PolymorphicValue)
-							if err != nil {
-								return err
-							}
-						}
-						err = Create(ne)
-						if err != nil {
-							return err
-						}
-						if h := rel.JoinTableHandler; h != nil {
-							ne.Scope.SQL = ""
-							ne.Scope.SQLVars = nil
-							expr, err := scope.AddJoinRelation(h.TableName, h, ne, e.Scope.Value, ne.Scope.Value)
-							if err != nil {
-								return err
-							}
-							if dialects.IsQL(e.Dialect) {
-								expr.Q = util.WrapTX(expr.Q)
-								tx, err := ne.SQLDB.Begin()
-								if err != nil {
-									return err
-								}
-								_, err = tx.Exec(expr.Q, expr.Args...)
-								if err != nil {
-									tx.Rollback()
-									return err
-								}
-								if err = tx.Commit(); err != nil {
-									return err
-								}
-							} else {
-								_, err = ne.SQLDB.Exec(expr.Q, expr.Args...)
-								if err != nil {
-									return err
-								}
-							}
-						}
-
 					}
 				default:
-					fieldValue := field.Field.Addr().Interface()
+					elems = append(elems, value.Addr().Interface())
+				}
+				for _, elem := range elems {
 					ne := e.Clone()
 					defer engine.Put(ne)
-					ne.Scope.ContextValue(fieldValue)
-					if rel.PolymorphicType != "" {
-						err = scope.SetColumn(ne, rel.PolymorphicType, rel.PolymorphicValue)
-						if err != nil {
-							return err
-						}
-					}
-					if len(rel.ForeignFieldNames) != 0 {
-						// set value's foreign key
-						for idx, fieldName := range rel.ForeignFieldNames {
-							associationForeignName := rel.AssociationForeignFieldNames[idx]
-							for _, fd := range fds {
-								if fd.Name == associationForeignName {
-									err = scope.SetColumn(ne, fieldName, fd.Field.Interface())
-									if err != nil {
-										return err
-									}
-								}
-							}
-						}
-					}
-					err = Create(ne)
+					ne.Scope.ContextValue(elem)
+					err = saveAssociated(e, ne, rel, saving, fds)
 					if err != nil {
 						return err
 					}
@@ -589,8 +1143,88 @@ func AfterAssociation(e *engine.Engine) error {
 	return nil
 }
 
+// saveAssociated saves the has_one, has_many or many_to_many association
+// value of ne for the model of e, whose fields are fds.
+func saveAssociated(e, ne *engine.Engine, rel *model.Relationship, saving model.AssociationSaving, fds []*model.Field) error {
+	// The columns referencing the model.
+	refs := make(map[string]interface{})
+	if rel.JoinTableHandler == nil {
+		for idx, fieldName := range rel.ForeignFieldNames {
+			associationForeignName := rel.AssociationForeignFieldNames[idx]
+			for _, fd := range fds {
+				if fd.Name == associationForeignName {
+					refs[fieldName] = fd.Field.Interface()
+				}
+			}
+		}
+		if rel.PolymorphicType != "" {
+			refs[rel.PolymorphicType] = rel.PolymorphicValue
+		}
+	}
+	isNew, err := IsNew(ne, ne.Scope.Value)
+	if err != nil {
+		return err
+	}
+	if (isNew && saving.AutoCreate) || (!isNew && saving.AutoUpdate) {
+		if saving.SaveReference {
+			for name, v := range refs {
+				if err := scope.SetColumn(ne, name, v); err != nil {
+					return err
+				}
+			}
+		}
+		if err := Save(ne); err != nil {
+			return err
+		}
+	} else if isNew || !saving.SaveReference {
+		return nil
+	} else if len(refs) > 0 {
+		// Only the references of the association are updated.
+		columns := make(map[string]interface{})
+		for name, v := range refs {
+			if err := scope.SetColumn(ne, name, v); err != nil {
+				return err
+			}
+			f, err := scope.FieldByName(ne, ne.Scope.Value, name)
+			if err != nil {
+				return err
+			}
+			columns[f.DBName] = v
+		}
+		ne.Scope.Set(model.UpdateColumn, true)
+		ne.Scope.Set(model.SaveAssociations, false)
+		ne.Scope.Set(model.UpdateInterface, columns)
+		if err := UpdateColumns(ne); err != nil {
+			return err
+		}
+	}
+	h := rel.JoinTableHandler
+	if h == nil || !saving.SaveReference {
+		return nil
+	}
+	ne.Scope.SQL = ""
+	ne.Scope.SQLVars = nil
+	expr, err := scope.AddJoinRelation(h.TableName, h, ne, e.Scope.Value, ne.Scope.Value)
+	if err != nil {
+		return err
+	}
+	q := expr.Q
+	if dialects.IsQL(e.Dialect) {
+		q = util.WrapTX(q)
+	}
+	_, err = exec(ne, q, expr.Args...)
+	if err != nil {
+		return err
+	}
+	touch(ne, h.TableName)
+	return nil
+}
+
 //CreateSQL generates SQL for creating new record
 func CreateSQL(e *engine.Engine) error {
+	if err := writable(e); err != nil {
+		return err
+	}
 	if scope.ShouldSaveAssociation(e) {
 		err := SaveBeforeAssociation(e)
 		if err != nil {
@@ -626,27 +1260,46 @@ func CreateSQL(e *engine.Engine) error {
 //UpdateSQL builds query for updating records.
 func UpdateSQL(e *engine.Engine) error {
 	var sqls []string
-	err := AssignUpdatingAttrs(e)
+	err := writable(e)
+	if err != nil {
+		return err
+	}
+	err = AssignUpdatingAttrs(e)
 	if err != nil {
 		return err
 	}
 	if updateAttrs, ok := e.Scope.Get(model.UpdateAttrs); ok {
-		for column, value := range updateAttrs.(map[string]interface{}) {
+		attrs := updateAttrs.(map[string]interface{})
+		columns := make([]string, 0, len(attrs))
+		for column := range attrs {
+			columns = append(columns, column)
+		}
+		// Sorted so the same update always builds the same statement.
+		sort.Strings(columns)
+		for _, column := range columns {
 			sqls = append(sqls, fmt.Sprintf("%v = %v",
 				scope.Quote(e, column),
-				scope.AddToVars(e, value)))
+				scope.AddToVars(e, attrs[column])))
 		}
 	} else {
 		fds, err := scope.Fields(e, e.Scope.Value)
 		if err != nil {
 			return err
 		}
+		// Only the changed columns of tracked models are updated.
+		var original map[string]interface{}
+		if t, ok := e.Scope.Value.(model.Tracker); ok {
+			original = t.Original()
+		}
 		for _, field := range fds {
 			if scope.ChangeableField(e, field) {
 				if !field.IsPrimaryKey && field.IsNormal {
+					if original != nil && !scope.FieldChanged(e, original, field) {
+						continue
+					}
 					sqls = append(sqls, fmt.Sprintf("%v = %v",
 						scope.Quote(e, field.DBName),
-						scope.AddToVars(e, field.Field.Interface())))
+						scope.AddToVars(e, scope.FieldValue(e, field))))
 				} else if rel := field.Relationship; rel != nil && rel.Kind == "belongs_to" {
 					for _, foreignKey := range rel.ForeignDBNames {
 						foreignField, err := scope.FieldByName(e, e.Scope.Value, foreignKey)
@@ -676,97 +1329,423 @@ func UpdateSQL(e *engine.Engine) error {
 		if err != nil {
 			return err
 		}
-		e.Scope.SQL = fmt.Sprintf(
-			"UPDATE %v SET %v%v%v",
-			scope.QuotedTableName(e, e.Scope.Value),
-			strings.Join(sqls, ", "),
-			util.AddExtraSpaceIfExist(c),
-			util.AddExtraSpaceIfExist(extraOption),
-		)
+		if from := e.Search.TableNames; len(from) > 0 {
+			q, err := dialects.UpdateFrom(e.Dialect, scope.QuotedTableName(e, e.Scope.Value),
+				strings.Join(sqls, ", "), from, strings.TrimSpace(c))
+			if err != nil {
+				return err
+			}
+			e.Scope.SQL = q + util.AddExtraSpaceIfExist(extraOption)
+		} else {
+			e.Scope.SQL = fmt.Sprintf(
+				"UPDATE %v SET %v%v%v",
+				scope.QuotedTableName(e, e.Scope.Value),
+				strings.Join(sqls, ", "),
+				util.AddExtraSpaceIfExist(c),
+				util.AddExtraSpaceIfExist(extraOption),
+			)
+		}
+		if dialects.IsQL(e.Dialect) {
+			e.Scope.SQL = util.WrapTX(e.Scope.SQL)
+		}
+	}
+	return nil
+}
 
+//UpdateExec executes UPDATE sql. This assumes the query is already in
+//e.Scope.SQL.
+func UpdateExec(e *engine.Engine) error {
+	if e.Scope.SQL == "" {
+		return errors.New("missing update sql ")
+	}
+	if err := CheckParams(e, e.Scope.SQLVars); err != nil {
+		return err
+	}
+	result, err := execTx(e, e.Scope.SQL, e.Scope.SQLVars...)
+	if err != nil {
+		return err
+	}
+	r, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	e.RowsAffected = r
+	touch(e, scope.TableName(e, e.Scope.Value))
+	return nil
+}
+
+// exec executes q with args. Statements for ql are executed inside a
+// transaction.
+func exec(e *engine.Engine, q string, args ...interface{}) (sql.Result, error) {
+	if err := CheckParams(e, args); err != nil {
+		return nil, err
 	}
 	if dialects.IsQL(e.Dialect) {
-		e.Scope.SQL = util.WrapTX(e.Scope.SQL)
+		return execTx(e, q, args...)
+	}
+	if err := checkBudget(e); err != nil {
+		return nil, err
+	}
+	ctx, done := statement(e, q, args)
+	var (
+		result sql.Result
+		err    error
+	)
+	if c, ok := e.SQLDB.(model.SQLCommonContext); ok {
+		result, err = c.ExecContext(ctx, q, args...)
+	} else {
+		result, err = e.SQLDB.Exec(q, args...)
+	}
+	done(err)
+	return result, err
+}
+
+// statementContext returns the context statements of e are executed with,
+// starting the deadline set with search.Timeout.
+func statementContext(e *engine.Engine) context.Context {
+	if e.Search != nil && e.Search.Timeout > 0 {
+		e.Deadline(e.Search.Timeout)
+	}
+	return e.Context()
+}
+
+//QueryRaw executes the statement q with args and returns the resulting rows,
+//with the same checks as the queries built for the search of e: the number
+//of parameters, the budget and the recorded timings.
+func QueryRaw(e *engine.Engine, q string, args ...interface{}) (*sql.Rows, error) {
+	return query(e, q, args...)
+}
+
+//ExecRaw executes the statement q with args, with the same checks as the
+//statements built for the search of e: the number of parameters, the budget,
+//the statement hooks and the recorded timings. Statements for ql are executed
+//inside a transaction.
+func ExecRaw(e *engine.Engine, q string, args ...interface{}) (sql.Result, error) {
+	return exec(e, q, args...)
+}
+
+//ExecRawTx executes the statement q with args like ExecRaw, inside the
+//transaction of e or in a new one which is committed before returning.
+func ExecRawTx(e *engine.Engine, q string, args ...interface{}) (sql.Result, error) {
+	if err := CheckParams(e, args); err != nil {
+		return nil, err
+	}
+	return execTx(e, q, args...)
+}
+
+//ScanRow executes the statement q with args like QueryRaw and scans the first
+//row into dest. This returns sql.ErrNoRows when there is no row.
+func ScanRow(e *engine.Engine, q string, args []interface{}, dest ...interface{}) error {
+	return scanRow(e, q, args, dest...)
+}
+
+// query executes q with args and returns the resulting rows.
+func query(e *engine.Engine, q string, args ...interface{}) (*sql.Rows, error) {
+	if err := CheckParams(e, args); err != nil {
+		return nil, err
+	}
+	if err := checkBudget(e); err != nil {
+		return nil, err
+	}
+	ctx, done := statement(e, q, args)
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if c, ok := e.SQLDB.(model.SQLCommonContext); ok {
+		rows, err = c.QueryContext(ctx, q, args...)
+	} else {
+		rows, err = e.SQLDB.Query(q, args...)
+	}
+	done(err)
+	return rows, err
+}
+
+// scanRow executes q with args and scans the first row into dest. This
+// returns sql.ErrNoRows when there is no row.
+func scanRow(e *engine.Engine, q string, args []interface{}, dest ...interface{}) error {
+	if err := CheckParams(e, args); err != nil {
+		return err
+	}
+	if err := checkBudget(e); err != nil {
+		return err
+	}
+	ctx, done := statement(e, q, args)
+	var row *sql.Row
+	if c, ok := e.SQLDB.(model.SQLCommonContext); ok {
+		row = c.QueryRowContext(ctx, q, args...)
+	} else {
+		row = e.SQLDB.QueryRow(q, args...)
+	}
+	err := row.Scan(dest...)
+	if err == sql.ErrNoRows {
+		// Not finding a row isn't a failure of the statement.
+		done(nil)
+	} else {
+		done(err)
+	}
+	return err
+}
+
+// checkBudget returns errmsg.ErrBudgetExceeded when the strict budget of the
+// context of e is exhausted.
+func checkBudget(e *engine.Engine) error {
+	if b := model.BudgetFrom(e.Ctx); b != nil {
+		return b.Check()
+	}
+	return nil
+}
+
+// statement starts the execution of q with args. It returns the context to
+// execute q with, as returned by the BeforeQuery method of the statement
+// hooks, and the function to call with the error of the execution which
+// records the timings and calls the AfterQuery methods.
+func statement(e *engine.Engine, q string, args []interface{}) (context.Context, func(error)) {
+	ctx := statementContext(e)
+	hs := callbacks(e).StatementHooks()
+	if len(hs) == 0 {
+		start := time.Now()
+		return ctx, func(error) {
+			observe(e, q, start)
+		}
+	}
+	s := &engine.Statement{SQL: q, Args: args, Table: scope.TableName(e, e.Scope.Value)}
+	for _, h := range hs {
+		if c := h.BeforeQuery(ctx, s); c != nil {
+			ctx = c
+		}
+	}
+	start := time.Now()
+	return ctx, func(err error) {
+		observe(e, q, start)
+		s.Duration = time.Since(start)
+		s.Err = err
+		for i := len(hs) - 1; i >= 0; i-- {
+			hs[i].AfterQuery(ctx, s)
+		}
+	}
+}
+
+// observe records the time taken by statement q started at start in
+// e.Timings and in the budget of the context of e.
+func observe(e *engine.Engine, q string, start time.Time) {
+	d := time.Since(start)
+	if b := model.BudgetFrom(e.Ctx); b != nil {
+		b.Spend(d)
+	}
+	if e.Timings == nil {
+		return
+	}
+	op := strings.TrimSpace(q)
+	if len(op) > 18 && strings.EqualFold(op[:18], "BEGIN TRANSACTION;") {
+		op = strings.TrimSpace(op[18:])
+	}
+	if i := strings.IndexAny(op, " \t\n"); i != -1 {
+		op = op[:i]
+	}
+	e.Timings.Observe(scope.TableName(e, e.Scope.Value), strings.ToUpper(op), d)
+}
+
+// CheckParams returns *errmsg.TooManyParamsError when args has more values than
+// the dialect allows in a single statement. This saves a round trip and
+// replaces the cryptic errors drivers return in that case.
+func CheckParams(e *engine.Engine, args []interface{}) error {
+	max := dialects.MaxParams(e.Dialect)
+	if max <= 0 || len(args) <= max {
+		return nil
+	}
+	err := &errmsg.TooManyParamsError{
+		Dialect: e.Dialect.GetName(),
+		Params:  len(args),
+		Max:     max,
+	}
+	if v := reflect.Indirect(reflect.ValueOf(e.Scope.Value)); v.Kind() == reflect.Slice {
+		err.Rows = v.Len()
+	}
+	return err
+}
+
+// execTx executes query inside a transaction. When e is already part of a
+// transaction the query is executed in it, otherwise a new transaction is
+// started and committed before returning.
+func execTx(e *engine.Engine, query string, args ...interface{}) (sql.Result, error) {
+	if err := checkBudget(e); err != nil {
+		return nil, err
 	}
-	return nil
+	ctx, done := statement(e, query, args)
+	result, err := execInTx(e, ctx, query, args...)
+	done(err)
+	return result, err
 }
 
-//UpdateExec executes UPDATE sql. This assumes the query is already in
-//e.Scope.SQL.
-func UpdateExec(e *engine.Engine) error {
-	if e.Scope.SQL == "" {
-		return errors.New("missing update sql ")
+// execInTx executes query with ctx in the transaction of e, or in a new one.
+func execInTx(e *engine.Engine, ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if e.Tx != nil {
+		if c, ok := e.SQLDB.(model.SQLCommonContext); ok {
+			return c.ExecContext(ctx, query, args...)
+		}
+		return e.SQLDB.Exec(query, args...)
+	}
+	var tx *sql.Tx
+	var err error
+	if b, ok := e.SQLDB.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+	}); ok {
+		tx, err = b.BeginTx(ctx, nil)
+	} else {
+		tx, err = e.SQLDB.Begin()
 	}
-	tx, err := e.SQLDB.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		rerr := tx.Rollback()
 		if rerr != nil {
-			return rerr
+			return nil, rerr
 		}
-		return err
+		return nil, err
 	}
-	r, err := result.RowsAffected()
+	err = tx.Commit()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return result, nil
+}
+
+// touch records that table was modified by e. Outside of a transaction the
+// statement is already committed so the listeners are notified right away.
+func touch(e *engine.Engine, table string) {
+	if e.Tx != nil {
+		e.Tx.Touch(table)
+		return
+	}
+	if e.Listeners != nil {
+		e.Listeners.Notify([]string{table})
 	}
-	e.RowsAffected = r
-	return tx.Commit()
 }
 
-//Update generates and executes sql query for updating records.This relies on
-//two hooks.
+//Update generates and executes sql query for updating records. This runs the
+//update callbacks of e, by default
+//
+//	model.HookBeforeUpdate
+//
+// which checks the precondition and calls BeforeUpdate,
+//
 //	model.HookUpdateSQL
-// Which generates the sql for UPDATE
+//
+// which generates the sql for UPDATE,
 //
 //	model.HookUpdateExec
-//which executes the UPDATE sql.
+//
+// which executes the UPDATE sql, and AfterUpdate.
 func Update(e *engine.Engine) error {
+	return callbacks(e).Update().Run(e)
+}
 
-	// run before update hooks
-	err := BeforeUpdate(e)
+// ifMatch checks the model.Precondition set on e against the stored row and
+// returns errmsg.ErrPreconditionFailed when the ETags don't match. The stored
+// values are added to the conditions of the update, so that it doesn't
+// affect the row if it is modified after the check.
+//
+// This returns true when the update is guarded.
+func ifMatch(e *engine.Engine) (bool, error) {
+	v, ok := e.Scope.Get(model.IfMatch)
+	if !ok {
+		return false, nil
+	}
+	p := v.(*model.Precondition)
+	pk, err := scope.PrimaryField(e, e.Scope.Value)
 	if err != nil {
-		return err
+		return false, err
 	}
-
-	// generate update sql
-	err = UpdateSQL(e)
+	if pk.IsBlank {
+		return false, errmsg.ErrPreconditionFailed
+	}
+	stored := reflect.New(reflect.Indirect(reflect.ValueOf(e.Scope.Value)).Type()).Interface()
+	fields, err := scope.ETagFields(e, stored, p.Columns...)
 	if err != nil {
-		return err
+		return false, err
+	}
+	columns := make([]string, len(fields))
+	dest := make([]interface{}, len(fields))
+	for k, f := range fields {
+		columns[k] = scope.Quote(e, f.DBName)
+		dest[k] = f.Field.Addr().Interface()
+	}
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s",
+		strings.Join(columns, ","), scope.QuotedTableName(e, e.Scope.Value),
+		scope.Quote(e, pk.DBName), e.Dialect.BindVar(1))
+	err = scanRow(e, q, []interface{}{pk.Field.Interface()}, dest...)
+	if err == sql.ErrNoRows {
+		return false, errmsg.ErrPreconditionFailed
 	}
-
-	// execute update sql
-	err = UpdateExec(e)
 	if err != nil {
-		return err
+		return false, err
 	}
-
-	// execute update sql
-	return AfterUpdate(e)
+	if tag := strings.TrimPrefix(p.ETag, "W/"); tag != "*" {
+		current, err := scope.ETag(e, stored, p.Columns...)
+		if err != nil {
+			return false, err
+		}
+		if tag != current {
+			return false, errmsg.ErrPreconditionFailed
+		}
+	}
+	for k, f := range fields {
+		value := f.Field.Interface()
+		if f.Field.Kind() == reflect.Ptr && f.Field.IsNil() {
+			value = nil
+		} else if valuer, ok := value.(driver.Valuer); ok {
+			if dv, err := valuer.Value(); err == nil && dv == nil {
+				value = nil
+			}
+		}
+		if value == nil {
+			search.Where(e, columns[k]+" IS NULL")
+			continue
+		}
+		search.Where(e, columns[k]+" = ?", value)
+	}
+	return true, nil
 }
 
-// DeleteSQL generatesSQL for deleting records.
+// DeleteSQL generatesSQL for deleting records. Models with a soft delete
+// strategy are soft deleted by setting its column, unless the search is
+// unscoped, see model.SoftDelete.
 func DeleteSQL(e *engine.Engine) error {
 	var extraOption string
 	if str, ok := e.Scope.Get(model.DeleteOption); ok {
 		extraOption = fmt.Sprint(str)
 	}
 
-	if e.Dialect.HasColumn(scope.TableName(e, e.Scope.Value), "DeletedAt") {
+	from := e.Search.TableNames
+	var sd model.SoftDelete
+	if !e.Search.Unscoped {
+		sd = scope.SoftDeleteOf(e, e.Scope.Value)
+	}
+	if sd != nil {
+		set := fmt.Sprintf("%s=%v", scope.Quote(e, sd.Column()),
+			scope.AddToVars(e, sd.DeletedValue(e.Now())))
 		c, err := builder.CombinedCondition(e, e.Scope.Value)
 		if err != nil {
 			return err
 		}
-		e.Scope.SQL = fmt.Sprintf(
-			"UPDATE %v SET deleted_at=%v%v%v",
-			scope.QuotedTableName(e, e.Scope.Value),
-			scope.AddToVars(e, e.Now()),
-			util.AddExtraSpaceIfExist(c),
-			util.AddExtraSpaceIfExist(extraOption),
-		)
+		if len(from) > 0 {
+			q, err := dialects.UpdateFrom(e.Dialect, scope.QuotedTableName(e, e.Scope.Value), set, from, strings.TrimSpace(c))
+			if err != nil {
+				return err
+			}
+			e.Scope.SQL = q + util.AddExtraSpaceIfExist(extraOption)
+		} else {
+			e.Scope.SQL = fmt.Sprintf(
+				"UPDATE %v SET %v%v%v",
+				scope.QuotedTableName(e, e.Scope.Value),
+				set,
+				util.AddExtraSpaceIfExist(c),
+				util.AddExtraSpaceIfExist(extraOption),
+			)
+		}
 		if e.Dialect.GetName() == "ql" || e.Dialect.GetName() == "ql-mem" {
 			e.Scope.SQL = util.WrapTX(e.Scope.SQL)
 		}
@@ -775,12 +1754,20 @@ func DeleteSQL(e *engine.Engine) error {
 		if err != nil {
 			return err
 		}
-		e.Scope.SQL = fmt.Sprintf(
-			"DELETE FROM %v%v%v",
-			scope.QuotedTableName(e, e.Scope.Value),
-			util.AddExtraSpaceIfExist(c),
-			util.AddExtraSpaceIfExist(extraOption),
-		)
+		if len(from) > 0 {
+			q, err := dialects.DeleteUsing(e.Dialect, scope.QuotedTableName(e, e.Scope.Value), from, strings.TrimSpace(c))
+			if err != nil {
+				return err
+			}
+			e.Scope.SQL = q + util.AddExtraSpaceIfExist(extraOption)
+		} else {
+			e.Scope.SQL = fmt.Sprintf(
+				"DELETE FROM %v%v%v",
+				scope.QuotedTableName(e, e.Scope.Value),
+				util.AddExtraSpaceIfExist(c),
+				util.AddExtraSpaceIfExist(extraOption),
+			)
+		}
 		if e.Dialect.GetName() == "ql" || e.Dialect.GetName() == "ql-mem" {
 			e.Scope.SQL = util.WrapTX(e.Scope.SQL)
 		}
@@ -788,61 +1775,111 @@ func DeleteSQL(e *engine.Engine) error {
 	return nil
 }
 
-// BeforeDelete is called before deleting any record
+// BeforeDelete is called before deleting any record. Deleting without
+// conditions fails with errmsg.ErrMissingWhereClause unless
+// model.AllowGlobalDelete is set to true, deleting a read only model fails
+// with errmsg.ErrReadOnly.
 func BeforeDelete(e *engine.Engine) error {
+	if e.Scope.Value != nil {
+		if m, err := scope.GetModelStruct(e, e.Scope.Value); err == nil && m.ReadOnly {
+			return errmsg.ErrReadOnly
+		}
+	}
 	if !scope.HasConditions(e, e.Scope.Value) {
-		return errors.New("Missing WHERE clause while deleting")
+		if allow, ok := e.Scope.Get(model.AllowGlobalDelete); !ok || allow != true {
+			return errmsg.ErrMissingWhereClause
+		}
 	}
 	return nil
 }
 
-// Delete deletes records. This makes sure to call BeforeDelete hook before
-// deleting anything and also calls AfterDelete before exiting.
+// Delete deletes records. This runs the delete callbacks of e, by default
+// BeforeDelete before deleting anything, DeleteCascade which applies the ON
+// DELETE actions of the relationships, DeleteSQL and DeleteExec.
 func Delete(e *engine.Engine) error {
-	err := BeforeDelete(e)
+	return callbacks(e).Delete().Run(e)
+}
+
+//DeleteExec executes the DELETE sql generated by DeleteSQL.
+func DeleteExec(e *engine.Engine) error {
+	result, err := exec(e, e.Scope.SQL, e.Scope.SQLVars...)
 	if err != nil {
 		return err
 	}
-
-	err = DeleteSQL(e)
+	a, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	e.RowsAffected = a
+	touch(e, scope.TableName(e, e.Scope.Value))
+	return nil
+}
 
-	if dialects.IsQL(e.Dialect) {
-		tx, err := e.SQLDB.Begin()
-		if err != nil {
-			return err
+//AutoPreload adds to the preloads of e the associations of the queried model
+//tagged PRELOAD:true, or all of them but the ones tagged PRELOAD:false when
+//e.AutoPreload is set. The model.AutoPreload setting of the scope overrides
+//e.AutoPreload.
+//
+// The associations preloaded explicitly, or loaded with JoinPreload, are left
+// as they are. The associations of the preloaded records are auto preloaded
+// in turn, except the ones leading back to a model on the way, which would
+// never end.
+func AutoPreload(e *engine.Engine) error {
+	if _, ok := e.Scope.Get(model.QueryDestination); ok || e.Scope.Value == nil {
+		return nil
+	}
+	auto := e.AutoPreload
+	if v, ok := e.Scope.Get(model.AutoPreload); ok {
+		auto, _ = v.(bool)
+	}
+	m, err := scope.GetModelStruct(e, e.Scope.Value)
+	if err != nil {
+		return err
+	}
+	skip := map[reflect.Type]bool{m.ModelType: true}
+	if path, ok := e.Scope.Get(model.AutoPreloadPath); ok {
+		for _, t := range path.([]reflect.Type) {
+			skip[t] = true
 		}
-		result, err := tx.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-		if err != nil {
-			_ = tx.Rollback()
-			return err
+	}
+	loaded := make(map[string]bool)
+	for _, p := range e.Search.Preload {
+		loaded[strings.Split(p.Schema, ".")[0]] = true
+	}
+	if v, ok := e.Scope.Get(model.JoinPreload); ok {
+		for _, column := range v.([]string) {
+			loaded[column] = true
 		}
-		a, err := result.RowsAffected()
-		if err != nil {
-			return err
+	}
+	for _, f := range m.StructFields {
+		if f.Relationship == nil || loaded[f.Name] {
+			continue
 		}
-		e.RowsAffected = a
-		err = tx.Commit()
-		if err != nil {
-			return err
+		if tag, ok := f.TagSettings["PRELOAD"]; ok {
+			if strings.EqualFold(tag, "false") {
+				continue
+			}
+		} else if !auto {
+			continue
 		}
-	} else {
-		result, err := e.SQLDB.Exec(e.Scope.SQL, e.Scope.SQLVars...)
-		if err != nil {
-			return err
+		t := f.Struct.Type
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
 		}
-		a, err := result.RowsAffected()
-		if err != nil {
-			return err
+		if skip[t] {
+			continue
 		}
-		e.RowsAffected = a
+		search.Preload(e, f.Name)
 	}
 	return nil
 }
 
-// Preload executes preload conditions.
+// Preload executes preload conditions. Dotted paths like Orders.Items.Product
+// are walked level by level, each level is loaded with a query per
+// relationship over the keys of all the records of the previous level.
+//
+// Paths may come back to a model on the way, like Orders.Shop.Orders, they
+// are only walked as deep as they are written.
 func Preload(e *engine.Engine) error {
 	if e.Search.Preload == nil {
 		return nil
@@ -864,10 +1901,10 @@ func Preload(e *engine.Engine) error {
 		for idx, preloadField := range preloadFields {
 			var conds []interface{}
 
-			if cs == nil {
-				continue
+			m, err := scope.GetModelStruct(cs, cs.Scope.Value)
+			if err != nil {
+				return err
 			}
-
 			// if not preloaded
 			if preloadKey := strings.Join(preloadFields[:idx+1], "."); !preloadedMap[preloadKey] {
 
@@ -911,10 +1948,6 @@ func Preload(e *engine.Engine) error {
 				}
 
 				if !preloadedMap[preloadKey] {
-					m, err := scope.GetModelStruct(e, e.Scope.Value)
-					if err != nil {
-						return err
-					}
 					return fmt.Errorf("can't preload field %s for %s",
 						preloadField, m.ModelType)
 				}
@@ -940,9 +1973,6 @@ func Preload(e *engine.Engine) error {
 func PreloadBelongsTo(e *engine.Engine, field *model.Field, conditions []interface{}) error {
 	relation := field.Relationship
 
-	// preload conditions
-	pdb, pCond := PreloadDBWithConditions(e, conditions)
-
 	// get relations's primary keys
 	primaryKeys := util.ColumnAsArray(relation.ForeignFieldNames, e.Scope.Value)
 	if len(primaryKeys) == 0 {
@@ -950,17 +1980,10 @@ func PreloadBelongsTo(e *engine.Engine, field *model.Field, conditions []interfa
 	}
 
 	// find relations
-	query := fmt.Sprintf("%v IN (%v)",
-		scope.ToQueryCondition(e, relation.AssociationForeignDBNames),
-		util.ToQueryMarks(primaryKeys))
-	values := util.ToQueryValues(primaryKeys)
-
 	results := util.MakeSlice(field.Struct.Type)
-	search.Where(pdb, query, values...)
-	search.Inline(pdb, pCond...)
-	pdb.Scope.ContextValue(results)
-
-	err := Query(pdb)
+	err := preloadQuery(e, conditions, primaryKeys, results, func(keys [][]interface{}) (string, []interface{}) {
+		return scope.KeysCondition(e, relation.AssociationForeignDBNames, keys)
+	})
 	if err != nil {
 		return err
 	}
@@ -985,7 +2008,7 @@ func PreloadBelongsTo(e *engine.Engine, field *model.Field, conditions []interfa
 					object = object.Elem()
 				}
 				if util.EqualAsString(util.GetValueFromFields(object, relation.ForeignFieldNames), value) {
-					object.FieldByName(field.Name).Set(result)
+					structField(object, field.StructField).Set(result)
 				}
 			}
 		} else {
@@ -998,195 +2021,144 @@ func PreloadBelongsTo(e *engine.Engine, field *model.Field, conditions []interfa
 	return nil
 }
 
-// PreloadManyToMany preloads many_to_many relation
+// PreloadManyToMany preloads many_to_many relation. The rows of the join table
+// linking the records to their associations are loaded first, then the
+// associations with a second query.
 func PreloadManyToMany(e *engine.Engine, field *model.Field, conditions []interface{}) error {
 	var (
-		relation         = field.Relationship
-		joinTableHandler = relation.JoinTableHandler
-		fieldType        = field.Struct.Type.Elem()
-		foreignKeyValue  interface{}
-		foreignKeyType   = reflect.ValueOf(&foreignKeyValue).Type()
-		linkHash         = map[string][]reflect.Value{}
-		isPtr            bool
+		relation = field.Relationship
+		handler  = relation.JoinTableHandler
+		elemType = field.Struct.Type.Elem()
 	)
 
-	if fieldType.Kind() == reflect.Ptr {
-		isPtr = true
-		fieldType = fieldType.Elem()
-	}
-
-	var sourceKeys = []string{}
-	for _, key := range joinTableHandler.Source.ForeignKeys {
-		sourceKeys = append(sourceKeys, key.DBName)
-	}
-
-	// preload conditions
-	preloadDB, preloadConditions := PreloadDBWithConditions(e, conditions)
-
-	// generate query with join table
-	newScope := e.Clone()
-	defer engine.Put(newScope)
-	newScope.Scope.ContextValue(reflect.New(fieldType).Interface())
-	search.Table(newScope, scope.TableName(newScope, newScope.Scope.Value))
-	search.Select(newScope, "*")
-
-	preloadDB, err := JoinWith(preloadDB, joinTableHandler, joinTableHandler, e.Scope.Value)
-	if err != nil {
-		return err
+	// The fields of the records and of the associations referenced by the
+	// join table.
+	var sourceFields, destFields []string
+	for _, name := range handler.Source.AssociationDBNames() {
+		f, err := scope.FieldByName(e, e.Scope.Value, name)
+		if err != nil {
+			return err
+		}
+		sourceFields = append(sourceFields, f.Name)
 	}
-
-	// preload inline conditions
-	if len(preloadConditions) > 0 {
-		search.Where(preloadDB, preloadConditions[0], preloadConditions[1:]...)
+	dest := reflect.New(handler.Destination.ModelType).Interface()
+	for _, name := range handler.Destination.AssociationDBNames() {
+		f, err := scope.FieldByName(e, dest, name)
+		if err != nil {
+			return err
+		}
+		destFields = append(destFields, f.Name)
 	}
 
-	err = builder.PrepareQuery(preloadDB, preloadDB.Scope.Value)
-	if err != nil {
-		return err
+	sourceKeys := util.ColumnAsArray(sourceFields, e.Scope.Value)
+	if len(sourceKeys) == 0 {
+		return nil
 	}
-
-	rows, err := preloadDB.SQLDB.Query(preloadDB.Scope.SQL, preloadDB.Scope.SQLVars...)
+	links, destKeys, err := joinTableLinks(e, handler, sourceKeys)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
-	columns, _ := rows.Columns()
-	for rows.Next() {
-		var (
-			elem = reflect.New(fieldType).Elem()
-		)
-		fields, err := scope.Fields(e, elem.Addr().Interface())
+	results := util.MakeSlice(field.Struct.Type)
+	if len(destKeys) > 0 {
+		err = preloadQuery(e, conditions, destKeys, results, func(keys [][]interface{}) (string, []interface{}) {
+			return scope.KeysCondition(e, handler.Destination.AssociationDBNames(), keys)
+		})
 		if err != nil {
 			return err
 		}
+	}
+	rVal := reflect.ValueOf(results).Elem()
 
-		// register foreign keys in join tables
-		var joinTableFields []*model.Field
-		for _, sourceKey := range sourceKeys {
-			joinTableFields = append(joinTableFields, &model.Field{
-				StructField: &model.StructField{DBName: sourceKey, IsNormal: true},
-				Field:       reflect.New(foreignKeyType).Elem()})
-		}
-
-		scope.Scan(rows, columns, append(fields, joinTableFields...))
-
-		var foreignKeys = make([]interface{}, len(sourceKeys))
-		// generate hashed forkey keys in join table
-		for idx, joinTableField := range joinTableFields {
-			if !joinTableField.Field.IsNil() {
-				foreignKeys[idx] = joinTableField.Field.Elem().Interface()
+	// assign find results, in the order they were found
+	assign := func(object reflect.Value) {
+		linked := links[util.ToString(util.GetValueFromFields(object, sourceFields))]
+		f := structField(object, field.StructField)
+		f.Set(reflect.MakeSlice(f.Type(), 0, len(linked)))
+		for i := 0; i < rVal.Len(); i++ {
+			result := rVal.Index(i)
+			if !linked[util.ToString(util.GetValueFromFields(result, destFields))] {
+				continue
 			}
+			if elemType.Kind() == reflect.Ptr && result.Kind() != reflect.Ptr {
+				result = result.Addr()
+			}
+			f.Set(reflect.Append(f, result))
 		}
-		hashedSourceKeys := util.ToString(foreignKeys)
-
-		if isPtr {
-			linkHash[hashedSourceKeys] = append(linkHash[hashedSourceKeys], elem.Addr())
-		} else {
-			linkHash[hashedSourceKeys] = append(linkHash[hashedSourceKeys], elem)
-		}
-	}
-
-	// assign find results
-	indirectScopeValue := reflect.ValueOf(e.Scope.Value)
-	if indirectScopeValue.Kind() == reflect.Ptr {
-		indirectScopeValue = indirectScopeValue.Elem()
 	}
-	var (
-		fieldsSourceMap   = map[string][]reflect.Value{}
-		foreignFieldNames = []string{}
-	)
-
-	for _, dbName := range relation.ForeignFieldNames {
-		if field, err := scope.FieldByName(e, e.Scope.Value, dbName); err == nil {
-			foreignFieldNames = append(foreignFieldNames, field.Name)
+	iScopeVal := reflect.Indirect(reflect.ValueOf(e.Scope.Value))
+	if iScopeVal.Kind() == reflect.Slice {
+		for j := 0; j < iScopeVal.Len(); j++ {
+			assign(reflect.Indirect(iScopeVal.Index(j)))
 		}
+	} else if iScopeVal.IsValid() {
+		assign(iScopeVal)
 	}
+	return nil
+}
 
-	if indirectScopeValue.Kind() == reflect.Slice {
-		for j := 0; j < indirectScopeValue.Len(); j++ {
-			object := indirectScopeValue.Index(j)
-			if object.Kind() == reflect.Ptr {
-				object = object.Elem()
-			}
-			key := util.ToString(util.GetValueFromFields(object, foreignFieldNames))
-			fieldsSourceMap[key] = append(fieldsSourceMap[key], object.FieldByName(field.Name))
-		}
-	} else if indirectScopeValue.IsValid() {
-		key := util.ToString(util.GetValueFromFields(indirectScopeValue, foreignFieldNames))
-		fieldsSourceMap[key] = append(fieldsSourceMap[key], indirectScopeValue.FieldByName(field.Name))
-	}
-	for source, link := range linkHash {
-		for i, field := range fieldsSourceMap[source] {
-			//If not 0 this means Value is a pointer and we already added preloaded models to it
-			if fieldsSourceMap[source][i].Len() != 0 {
-				continue
-			}
-			field.Set(reflect.Append(fieldsSourceMap[source][i], link...))
+// joinTableLinks returns the destination keys linked to each of the source
+// keys in the join table of h, and all the linked destination keys.
+func joinTableLinks(e *engine.Engine, h *model.JoinTableHandler, sourceKeys [][]interface{}) (map[string]map[string]bool, [][]interface{}, error) {
+	links := make(map[string]map[string]bool)
+	seen := make(map[string]bool)
+	var destKeys [][]interface{}
+	for _, keys := range keyBatches(e, sourceKeys) {
+		var err error
+		destKeys, err = scanJoinTableLinks(e, h, keys, links, seen, destKeys)
+		if err != nil {
+			return nil, nil, err
 		}
-
 	}
-	return nil
+	return links, destKeys, nil
 }
 
-// JoinWith does sql join
-func JoinWith(e *engine.Engine, s, handler *model.JoinTableHandler, source interface{}) (*engine.Engine, error) {
+// scanJoinTableLinks adds to links the rows of the join table of h linking
+// the records with sourceKeys, and appends to destKeys the keys of the
+// associations not already seen.
+func scanJoinTableLinks(e *engine.Engine, h *model.JoinTableHandler, sourceKeys [][]interface{},
+	links map[string]map[string]bool, seen map[string]bool, destKeys [][]interface{}) ([][]interface{}, error) {
 	ne := e.Clone()
 	defer engine.Put(ne)
-	ne.Scope.ContextValue(source)
-	tableName := handler.TableName
-	quotedTableName := scope.Quote(ne, tableName)
-	var (
-		joinConditions []string
-		values         []interface{}
-	)
-	m, err := scope.GetModelStruct(ne, source)
+	expr := scope.JoinRelationsSQL(ne, h, sourceKeys)
+	n := len(h.Source.ForeignKeys)
+	cols := n + len(h.Destination.ForeignKeys)
+	rows, err := query(ne, expr.Q, expr.Args...)
 	if err != nil {
 		return nil, err
 	}
-
-	if s.Source.ModelType == m.ModelType {
-		destinationTableName := scope.QuotedTableName(ne, reflect.New(s.Destination.ModelType).Interface())
-		for _, foreignKey := range s.Destination.ForeignKeys {
-			joinConditions = append(joinConditions, fmt.Sprintf("%v.%v = %v.%v",
-				quotedTableName, scope.Quote(e, foreignKey.DBName),
-				destinationTableName, scope.Quote(ne, foreignKey.AssociationDBName)))
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		values := make([]interface{}, cols)
+		ptrs := make([]interface{}, cols)
+		for i := range values {
+			ptrs[i] = &values[i]
 		}
-
-		var foreignDBNames []string
-		var foreignFieldNames []string
-
-		for _, foreignKey := range s.Source.ForeignKeys {
-			foreignDBNames = append(foreignDBNames, foreignKey.DBName)
-			if field, err := scope.FieldByName(ne, source, foreignKey.AssociationDBName); err == nil {
-				foreignFieldNames = append(foreignFieldNames, field.Name)
-			}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
 		}
-
-		foreignFieldValues := util.ColumnAsArray(foreignFieldNames, e.Scope.Value)
-
-		var condString string
-		if len(foreignFieldValues) > 0 {
-			var quotedForeignDBNames []string
-			for _, dbName := range foreignDBNames {
-				quotedForeignDBNames = append(quotedForeignDBNames, tableName+"."+dbName)
-			}
-
-			condString = fmt.Sprintf("%v IN (%v)",
-				scope.ToQueryCondition(e, quotedForeignDBNames),
-				util.ToQueryMarks(foreignFieldValues))
-
-			keys := util.ColumnAsArray(foreignFieldNames, e.Scope.Value)
-			values = append(values, util.ToQueryValues(keys))
-		} else {
-			condString = fmt.Sprintf("1 <> 1")
+		source := util.ToString(values[:n])
+		destKey := values[n:]
+		d := util.ToString(destKey)
+		if links[source] == nil {
+			links[source] = make(map[string]bool)
 		}
-		search.Join(ne, fmt.Sprintf("INNER JOIN %v ON %v",
-			quotedTableName, strings.Join(joinConditions, " AND ")))
-		search.Where(ne, condString, util.ToQueryValues(foreignFieldValues)...)
-		return ne, nil
+		links[source][d] = true
+		if !seen[d] {
+			seen[d] = true
+			destKeys = append(destKeys, destKey)
+		}
+	}
+	return destKeys, rows.Err()
+}
+
+// structField returns the field of the struct v, which is in an embedded
+// struct of v for the fields of embedded structs.
+func structField(v reflect.Value, field *model.StructField) reflect.Value {
+	for _, name := range field.Names {
+		v = reflect.Indirect(v).FieldByName(name)
 	}
-	return nil, errors.New("wrong source type for join table handler")
+	return v
 }
 
 // ColumnAsScope returnsnew Engine withthe value of the column used asscope.
@@ -1195,51 +2167,59 @@ func ColumnAsScope(e *engine.Engine, column string) (*engine.Engine, error) {
 	if iv.Kind() == reflect.Ptr {
 		iv = iv.Elem()
 	}
+	m, err := scope.GetModelStruct(e, e.Scope.Value)
+	if err != nil {
+		return nil, err
+	}
+	var fieldStruct *model.StructField
+	for _, f := range m.StructFields {
+		if f.Name == column {
+			fieldStruct = f
+			break
+		}
+	}
+	if fieldStruct == nil {
+		return nil, errors.New("can get engine out of column " + column)
+	}
 
 	switch iv.Kind() {
 	case reflect.Slice:
-		m, err := scope.GetModelStruct(e, e.Scope.Value)
-		if err != nil {
-			return nil, err
+		fieldType := fieldStruct.Struct.Type
+		if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
 		}
-		if fieldStruct, ok := m.ModelType.FieldByName(column); ok {
-			fieldType := fieldStruct.Type
-			if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Ptr {
-				fieldType = fieldType.Elem()
-			}
 
-			// a map of results
-			rm := map[interface{}]bool{}
+		// a map of results
+		rm := map[interface{}]bool{}
 
-			results := reflect.New(reflect.SliceOf(reflect.PtrTo(fieldType))).Elem()
+		results := reflect.New(reflect.SliceOf(reflect.PtrTo(fieldType))).Elem()
 
-			for i := 0; i < iv.Len(); i++ {
-				result := iv.Index(i)
-				if result.Kind() == reflect.Ptr {
-					result = result.Elem()
-				}
-				result = result.FieldByName(column)
-				if result.Kind() == reflect.Ptr {
-					result = result.Elem()
-				}
-				if result.Kind() == reflect.Slice {
-					for j := 0; j < result.Len(); j++ {
-						if elem := result.Index(j); elem.CanAddr() && rm[elem.Addr()] != true {
-							rm[elem.Addr()] = true
-							results = reflect.Append(results, elem.Addr())
-						}
+		for i := 0; i < iv.Len(); i++ {
+			result := iv.Index(i)
+			if result.Kind() == reflect.Ptr {
+				result = result.Elem()
+			}
+			result = structField(result, fieldStruct)
+			if result.Kind() == reflect.Ptr {
+				result = result.Elem()
+			}
+			if result.Kind() == reflect.Slice {
+				for j := 0; j < result.Len(); j++ {
+					if elem := result.Index(j); elem.CanAddr() && rm[elem.Addr()] != true {
+						rm[elem.Addr()] = true
+						results = reflect.Append(results, elem.Addr())
 					}
-				} else if result.CanAddr() && rm[result.Addr()] != true {
-					rm[result.Addr()] = true
-					results = reflect.Append(results, result.Addr())
 				}
+			} else if result.CanAddr() && rm[result.Addr()] != true {
+				rm[result.Addr()] = true
+				results = reflect.Append(results, result.Addr())
 			}
-			ne := e.Clone()
-			ne.Scope.ContextValue(results.Interface())
-			return ne, nil
 		}
+		ne := e.Clone()
+		ne.Scope.ContextValue(results.Interface())
+		return ne, nil
 	case reflect.Struct:
-		if field := iv.FieldByName(column); field.CanAddr() {
+		if field := structField(iv, fieldStruct); field.CanAddr() {
 			ne := e.Clone()
 			ne.Scope.ContextValue(field.Addr().Interface())
 			return ne, nil
@@ -1258,25 +2238,16 @@ func PreloadHasOne(e *engine.Engine, field *model.Field, conditions []interface{
 		return nil
 	}
 
-	// preload conditions
-	pdb, pCond := PreloadDBWithConditions(e, conditions)
-
 	// find relations
-	query := fmt.Sprintf("%v IN (%v)",
-		scope.ToQueryCondition(e, rel.ForeignDBNames),
-		util.ToQueryMarks(primaryKeys))
-	values := util.ToQueryValues(primaryKeys)
-	if rel.PolymorphicType != "" {
-		query += fmt.Sprintf(" AND %v = ?", scope.Quote(e, rel.PolymorphicDBName))
-		values = append(values, rel.PolymorphicValue)
-	}
-
 	results := util.MakeSlice(field.Struct.Type)
-	search.Where(pdb, query, values...)
-	search.Inline(pdb, pCond...)
-	pdb.Scope.ContextValue(results)
-
-	err := Query(pdb)
+	err := preloadQuery(e, conditions, primaryKeys, results, func(keys [][]interface{}) (string, []interface{}) {
+		query, values := scope.KeysCondition(e, rel.ForeignDBNames, keys)
+		if rel.PolymorphicType != "" {
+			query += fmt.Sprintf(" AND %v = ?", scope.Quote(e, rel.PolymorphicDBName))
+			values = append(values, rel.PolymorphicValue)
+		}
+		return query, values
+	})
 	if err != nil {
 		return err
 	}
@@ -1301,7 +2272,7 @@ func PreloadHasOne(e *engine.Engine, field *model.Field, conditions []interface{
 					iVal = iVal.Elem()
 				}
 				if util.EqualAsString(util.GetValueFromFields(iVal, rel.AssociationForeignFieldNames), foreignValues) {
-					iVal.FieldByName(field.Name).Set(result)
+					structField(iVal, field.StructField).Set(result)
 					break
 				}
 			}
@@ -1318,7 +2289,9 @@ func PreloadHasOne(e *engine.Engine, field *model.Field, conditions []interface{
 	return nil
 }
 
-// PreloadHasMany preloads has_many relation
+// PreloadHasMany preloads has_many relation. The records are sorted by the
+// order of the relationship unless the conditions set one, and at most its
+// limit of records are preloaded for each model.
 func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface{}) error {
 	rel := field.Relationship
 
@@ -1327,27 +2300,26 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 	if len(primaryKeys) == 0 {
 		return nil
 	}
-
-	// preload conditions
-	pdb, pCond := PreloadDBWithConditions(e, conditions)
-
-	// find relations
-	query := fmt.Sprintf("%v IN (%v)",
-		scope.ToQueryCondition(e, rel.ForeignDBNames),
-		util.ToQueryMarks(primaryKeys))
-	values := util.ToQueryValues(primaryKeys)
-	if rel.PolymorphicType != "" {
-		query += fmt.Sprintf(" AND %v = ?",
-			scope.Quote(e, rel.PolymorphicDBName))
-		values = append(values, rel.PolymorphicValue)
+	if rel.Order != "" {
+		// Called after the conditions, which take precedence.
+		conditions = append(conditions[:len(conditions):len(conditions)], func(pe *engine.Engine) {
+			if len(pe.Search.Orders) == 0 {
+				search.Order(pe, rel.Order)
+			}
+		})
 	}
 
+	// find relations
 	results := util.MakeSlice(field.Struct.Type)
-	search.Where(pdb, query, values...)
-	search.Inline(pdb, pCond...)
-	pdb.Scope.ContextValue(results)
-
-	err := Query(pdb)
+	err := preloadQuery(e, conditions, primaryKeys, results, func(keys [][]interface{}) (string, []interface{}) {
+		query, values := scope.KeysCondition(e, rel.ForeignDBNames, keys)
+		if rel.PolymorphicType != "" {
+			query += fmt.Sprintf(" AND %v = ?",
+				scope.Quote(e, rel.PolymorphicDBName))
+			values = append(values, rel.PolymorphicValue)
+		}
+		return query, values
+	})
 	if err != nil {
 		return err
 	}
@@ -1376,14 +2348,20 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 				object = object.Elem()
 			}
 			objectRealValue := util.GetValueFromFields(object, rel.AssociationForeignFieldNames)
-			f := object.FieldByName(field.Name)
+			f := structField(object, field.StructField)
 			if results, ok := preloadMap[util.ToString(objectRealValue)]; ok {
+				if rel.Limit > 0 && len(results) > rel.Limit {
+					results = results[:rel.Limit]
+				}
 				f.Set(reflect.Append(f, results...))
 			} else {
 				f.Set(reflect.MakeSlice(f.Type(), 0, 0))
 			}
 		}
 	} else {
+		if rel.Limit > 0 && rVal.Len() > rel.Limit {
+			rVal = rVal.Slice(0, rel.Limit)
+		}
 		err := field.Set(rVal)
 		if err != nil {
 			return err
@@ -1392,15 +2370,125 @@ func PreloadHasMany(e *engine.Engine, field *model.Field, conditions []interface
 	return nil
 }
 
-// PreloadDBWithConditions returns engine with preload conditions set
+// PreloadDBWithConditions returns engine with preload conditions set. The
+// func(*engine.Engine) conditions are called with the returned engine, the
+// other conditions are returned as inline conditions of the query.
 func PreloadDBWithConditions(e *engine.Engine, conditions []interface{}) (*engine.Engine, []interface{}) {
 	var (
 		preloadDB         = e.Clone()
 		preloadConditions []interface{}
 	)
 
+	// The preloaded associations don't auto preload the models on the way.
+	path, _ := e.Scope.Get(model.AutoPreloadPath)
+	types, _ := path.([]reflect.Type)
+	if m, err := scope.GetModelStruct(e, e.Scope.Value); err == nil {
+		types = append(types[:len(types):len(types)], m.ModelType)
+	}
+	preloadDB.Scope.Set(model.AutoPreloadPath, types)
+
 	for _, condition := range conditions {
+		if fn, ok := condition.(func(*engine.Engine)); ok {
+			fn(preloadDB)
+			continue
+		}
 		preloadConditions = append(preloadConditions, condition)
 	}
 	return preloadDB, preloadConditions
 }
+
+// preloadQuery finds the records of a preloaded association matching keys and
+// appends them to results, a pointer to a slice. where returns the condition
+// matching a list of keys.
+//
+// The keys are split in batches of e.PreloadBatchSize keys, each queried on
+// its own, concurrently with e.PreloadConcurrent. The records are appended in
+// the order of the batches whichever query returns first.
+func preloadQuery(e *engine.Engine, conditions []interface{}, keys [][]interface{},
+	results interface{}, where func([][]interface{}) (string, []interface{})) error {
+	batches := keyBatches(e, keys)
+	if len(batches) == 1 {
+		query, values := where(keys)
+		return preloadBatch(e, conditions, query, values, results)
+	}
+	var (
+		found = make([]interface{}, len(batches))
+		errs  = make([]error, len(batches))
+		typ   = reflect.TypeOf(results).Elem()
+		wg    sync.WaitGroup
+	)
+	for i, batch := range batches {
+		found[i] = reflect.New(typ).Interface()
+		query, values := where(batch)
+		if !e.PreloadConcurrent || e.Tx != nil {
+			errs[i] = preloadBatch(e, conditions, query, values, found[i])
+			if errs[i] != nil {
+				return errs[i]
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = preloadBatch(e, conditions, query, values, found[i])
+		}(i)
+	}
+	wg.Wait()
+	rVal := reflect.ValueOf(results).Elem()
+	for i := range batches {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		rVal.Set(reflect.AppendSlice(rVal, reflect.ValueOf(found[i]).Elem()))
+	}
+	return nil
+}
+
+// preloadBatch finds the records of a preloaded association matching the
+// query into results.
+func preloadBatch(e *engine.Engine, conditions []interface{}, query string,
+	values []interface{}, results interface{}) error {
+	pdb, pCond := PreloadDBWithConditions(e, conditions)
+	defer engine.Put(pdb)
+	search.Where(pdb, query, values...)
+	search.Inline(pdb, pCond...)
+	pdb.Scope.ContextValue(results)
+	return Query(pdb)
+}
+
+// keyBatches splits the distinct keys in batches of e.PreloadBatchSize keys,
+// there is a single batch of all the keys when no size is set.
+func keyBatches(e *engine.Engine, keys [][]interface{}) [][][]interface{} {
+	size := e.PreloadBatchSize
+	if size <= 0 {
+		return [][][]interface{}{keys}
+	}
+	seen := make(map[string]bool)
+	distinct := keys[:0:0]
+	for _, k := range keys {
+		if s := util.ToString(k); !seen[s] {
+			seen[s] = true
+			distinct = append(distinct, k)
+		}
+	}
+	keys = distinct
+	if len(keys) <= size {
+		return [][][]interface{}{keys}
+	}
+	var batches [][][]interface{}
+	for len(keys) > size {
+		batches = append(batches, keys[:size])
+		keys = keys[size:]
+	}
+	return append(batches, keys)
+}
+
+// insertTableName returns the quoted name of the table rows are inserted into.
+// Aliases set with search.Table are dropped since INSERT statements don't
+// accept them on all dialects.
+func insertTableName(e *engine.Engine) string {
+	if scope.TableAlias(e) != "" {
+		return scope.Quote(e, scope.TableName(e, e.Scope.ValueOf()))
+	}
+	return scope.QuotedTableName(e, e.Scope.ValueOf())
+}
@@ -0,0 +1,295 @@
+package hooks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/types"
+)
+
+//KeyProvider gives the AES keys, of 16, 24 or 32 bytes, of the Encryption
+//plugin. Keys have an id so that they can be rotated, values are encrypted
+//with the current key and decrypted with the key they were encrypted with.
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error)
+	Key(id string) ([]byte, error)
+}
+
+//KeyLister is implemented by KeyProviders which can list the ids of their
+//keys. The fields with the ENCRYPTED:deterministic tag are then searched with
+//the values encrypted with every key, so that rows written before the keys
+//were rotated are still found. Without it only the current key is used.
+type KeyLister interface {
+	KeyIDs() ([]string, error)
+}
+
+//StaticKey is a KeyProvider with a single key, which has an empty id.
+type StaticKey []byte
+
+//CurrentKey implements KeyProvider.
+func (k StaticKey) CurrentKey() (string, []byte, error) {
+	return "", k, nil
+}
+
+//Key implements KeyProvider.
+func (k StaticKey) Key(id string) ([]byte, error) {
+	if id != "" {
+		return nil, fmt.Errorf("ngorm: unknown key %q", id)
+	}
+	return k, nil
+}
+
+//Encryption is a plugin encrypting the fields with the ENCRYPTED tag with
+//AES-GCM before they are written, and decrypting them once they are read.
+//Fields must be strings or []byte, the values are stored as text
+//
+//    type Patient struct {
+//    	ID    int64
+//    	Notes string `gorm:"ENCRYPTED"`
+//    	SSN   string `gorm:"ENCRYPTED:deterministic"`
+//    }
+//
+//    err := db.Use(&hooks.Encryption{Keys: hooks.StaticKey(key)})
+//
+// Each write of a field uses a random nonce, so equal values have different
+// ciphertexts. Fields tagged ENCRYPTED:deterministic always give the same
+// ciphertext for the same value and key, which reveals equal values but allows
+// searching them. Struct conditions on them match the values encrypted with
+// each key listed by a KeyLister, other conditions use Deterministic or
+// DeterministicAll
+//
+//    db.Where(&Patient{SSN: ssn}).First(&p)
+//    db.Where("ssn IN (?)", enc.DeterministicAll(ssn)).First(&p)
+//
+// Struct conditions on the other encrypted fields fail, since their values
+// can't be found.
+type Encryption struct {
+	Keys KeyProvider
+}
+
+//Name implements engine.Plugin.
+func (enc *Encryption) Name() string {
+	return "ngorm:encryption"
+}
+
+//Initialize implements engine.Plugin, there is nothing to register since the
+//fields are encrypted when they are bound and decrypted when they are
+//scanned.
+func (enc *Encryption) Initialize(e *engine.Engine) error {
+	if enc.Keys == nil {
+		return errors.New("ngorm: encryption without keys")
+	}
+	return nil
+}
+
+//Encrypt implements engine.Encrypter.
+func (enc *Encryption) Encrypt(field *model.StructField, plain []byte) (string, error) {
+	return enc.encrypt(plain, strings.EqualFold(field.TagSettings["ENCRYPTED"], "deterministic"))
+}
+
+//Decrypt implements engine.Encrypter.
+func (enc *Encryption) Decrypt(field *model.StructField, c string) ([]byte, error) {
+	return enc.decrypt(c)
+}
+
+func (enc *Encryption) decrypt(c string) ([]byte, error) {
+	var id string
+	if i := strings.LastIndex(c, ":"); i != -1 {
+		id, c = c[:i], c[i+1:]
+	}
+	key, err := enc.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(c)
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("ngorm: encrypted value is too short")
+	}
+	return aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+//Serializer returns a types.Serializer storing the values encoded by s
+//encrypted, for the fields which aren't strings or []byte, like maps and
+//structs. Register it to use it with the SERIALIZER tag
+//
+//    err := types.RegisterSerializer("secret_json", enc.Serializer(types.JSON{}))
+//
+//    type Patient struct {
+//    	ID      int64
+//    	History map[string]string `gorm:"SERIALIZER:secret_json"`
+//    }
+//
+// The values are encrypted with a random nonce like the fields with the
+// ENCRYPTED tag, they can't be searched.
+func (enc *Encryption) Serializer(s types.Serializer) types.Serializer {
+	return encryptedSerializer{enc: enc, s: s}
+}
+
+type encryptedSerializer struct {
+	enc *Encryption
+	s   types.Serializer
+}
+
+func (es encryptedSerializer) DBType() reflect.Type {
+	return reflect.TypeOf("")
+}
+
+func (es encryptedSerializer) Serialize(v interface{}) (driver.Value, error) {
+	dv, err := es.s.Serialize(v)
+	if err != nil {
+		return nil, err
+	}
+	var plain []byte
+	switch value := dv.(type) {
+	case string:
+		plain = []byte(value)
+	case []byte:
+		plain = value
+	default:
+		return nil, fmt.Errorf("ngorm: can't encrypt %T", dv)
+	}
+	return es.enc.encrypt(plain, false)
+}
+
+func (es encryptedSerializer) Deserialize(src []byte, dest interface{}) error {
+	plain, err := es.enc.decrypt(string(src))
+	if err != nil {
+		return err
+	}
+	return es.s.Deserialize(plain, dest)
+}
+
+//Deterministic returns the value stored for plain in the fields with the
+//ENCRYPTED:deterministic tag with the current key, to search them with
+//conditions which aren't structs. The empty string is returned when plain
+//can't be encrypted.
+func (enc *Encryption) Deterministic(plain string) string {
+	c, err := enc.encrypt([]byte(plain), true)
+	if err != nil {
+		return ""
+	}
+	return c
+}
+
+//DeterministicAll is like Deterministic but returns the values stored for
+//plain with each key listed by the KeyLister of enc, the current key first.
+//Use it to search the rows written before the keys were rotated.
+func (enc *Encryption) DeterministicAll(plain string) []string {
+	cs, err := enc.deterministicAll([]byte(plain))
+	if err != nil {
+		return nil
+	}
+	return cs
+}
+
+//EncryptSearch implements engine.SearchEncrypter. Only the fields with the
+//ENCRYPTED:deterministic tag can be searched.
+func (enc *Encryption) EncryptSearch(field *model.StructField, plain []byte) ([]string, error) {
+	if !strings.EqualFold(field.TagSettings["ENCRYPTED"], "deterministic") {
+		return nil, errors.New("only the fields tagged ENCRYPTED:deterministic can be searched")
+	}
+	return enc.deterministicAll(plain)
+}
+
+func (enc *Encryption) deterministicAll(plain []byte) ([]string, error) {
+	id, key, err := enc.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	c, err := encryptWith(id, key, plain, true)
+	if err != nil {
+		return nil, err
+	}
+	cs := []string{c}
+	l, ok := enc.Keys.(KeyLister)
+	if !ok {
+		return cs, nil
+	}
+	ids, err := l.KeyIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range ids {
+		if other == id {
+			continue
+		}
+		key, err := enc.Keys.Key(other)
+		if err != nil {
+			return nil, err
+		}
+		c, err := encryptWith(other, key, plain, true)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+func (enc *Encryption) encrypt(plain []byte, deterministic bool) (string, error) {
+	id, key, err := enc.Keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	return encryptWith(id, key, plain, deterministic)
+}
+
+// encryptWith encrypts plain with key, which has the given id.
+func encryptWith(id string, key, plain []byte, deterministic bool) (string, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if deterministic {
+		// The nonce is derived from the value so that equal values are
+		// encrypted the same way, with a MAC key derived from key so that the
+		// AES key isn't used for anything else.
+		mac := hmac.New(sha256.New, nonceKey(key))
+		mac.Write(plain)
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	c := base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plain, nil))
+	if id != "" {
+		c = id + ":" + c
+	}
+	return c, nil
+}
+
+// nonceKey returns the key of the MAC giving the nonces of the deterministic
+// values encrypted with key.
+func nonceKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("ngorm:deterministic-nonce"))
+	return mac.Sum(nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
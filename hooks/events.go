@@ -0,0 +1,269 @@
+package hooks
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+)
+
+//Event is a change of a model published by the Events plugin, one of
+//ModelCreated, ModelUpdated and ModelDeleted.
+type Event interface {
+	// Table returns the table of the changed model.
+	Table() string
+}
+
+//ModelCreated is published once a model is created. New is a pointer to a
+//copy of the model, with its primary key set.
+type ModelCreated struct {
+	TableName string
+	New       interface{}
+}
+
+//Table implements Event.
+func (ev ModelCreated) Table() string {
+	return ev.TableName
+}
+
+//ModelUpdated is published once a model is updated. New is a pointer to a
+//copy of the model after the update. Old has the values of the columns before
+//the update when the model embeds model.Tracked, it is nil otherwise. Changes
+//has the updated columns when the update was given attributes.
+type ModelUpdated struct {
+	TableName string
+	Old       map[string]interface{}
+	New       interface{}
+	Changes   map[string]interface{}
+}
+
+//Table implements Event.
+func (ev ModelUpdated) Table() string {
+	return ev.TableName
+}
+
+//ModelDeleted is published once a model is deleted. Old is a pointer to a
+//copy of the model given to Delete, it only has the fields which were set.
+//
+// Deleting with conditions, like db.Where("age > ?", 20).Delete(&User{}),
+// publishes a single event whose Old is the model given to Delete, not one
+// event per deleted row.
+type ModelDeleted struct {
+	TableName string
+	Old       interface{}
+}
+
+//Table implements Event.
+func (ev ModelDeleted) Table() string {
+	return ev.TableName
+}
+
+//Events is a plugin publishing an Event for each model which is created,
+//updated or deleted. Updates and deletes which don't affect any row publish
+//nothing, neither do raw statements and the batch operations, which don't run
+//the callbacks.
+//
+// Handlers are called with the engine of the operation right after it is
+// executed, returning an error fails it, and rolls it back when it runs in a
+// transaction. Writing to an outbox table with the engine makes the write part
+// of the transaction of the operation, if any. Channels receive the events
+// once they are committed, that is at the end of the transaction or right away
+// outside of one. The sends block the operation, or the commit of its
+// transaction, until they are received, so channels must be buffered or
+// drained.
+//
+//    events := &hooks.Events{}
+//    events.Subscribe(ch)
+//    err := db.Use(events)
+type Events struct {
+	mu       sync.RWMutex
+	handlers []func(*engine.Engine, Event) error
+	chans    []chan<- Event
+}
+
+//Name implements engine.Plugin.
+func (ev *Events) Name() string {
+	return "ngorm:events"
+}
+
+//Initialize implements engine.Plugin.
+func (ev *Events) Initialize(e *engine.Engine) error {
+	c := e.Callbacks
+	err := c.Create().Before(model.HookTrackChanges).Register("events:create", ev.created)
+	if err != nil {
+		return err
+	}
+	// Before the changes are tracked again, so the old values are still known.
+	err = c.Update().Before(model.HookTrackChanges).Register("events:update", ev.updated)
+	if err != nil {
+		return err
+	}
+	return c.Delete().After(model.HookDeleteExec).Register("events:delete", ev.deleted)
+}
+
+//Handle registers fn to be called with the events of each operation.
+func (ev *Events) Handle(fn func(e *engine.Engine, event Event) error) {
+	ev.mu.Lock()
+	ev.handlers = append(ev.handlers, fn)
+	ev.mu.Unlock()
+}
+
+//Subscribe registers ch to receive the committed events.
+func (ev *Events) Subscribe(ch chan<- Event) {
+	ev.mu.Lock()
+	ev.chans = append(ev.chans, ch)
+	ev.mu.Unlock()
+}
+
+func (ev *Events) created(e *engine.Engine) error {
+	table := scope.TableName(e, e.Scope.Value)
+	return ev.each(e, func(v reflect.Value) Event {
+		return ModelCreated{TableName: table, New: copyModel(v)}
+	})
+}
+
+func (ev *Events) updated(e *engine.Engine) error {
+	if e.RowsAffected == 0 {
+		return nil
+	}
+	table := scope.TableName(e, e.Scope.Value)
+	var changes map[string]interface{}
+	if attrs, ok := e.Scope.Get(model.UpdateAttrs); ok {
+		changes = attrs.(map[string]interface{})
+	}
+	return ev.each(e, func(v reflect.Value) Event {
+		var old map[string]interface{}
+		if t, ok := v.Interface().(model.Tracker); ok {
+			old = t.Original()
+		}
+		return ModelUpdated{TableName: table, Old: old, New: copyModel(v), Changes: changes}
+	})
+}
+
+func (ev *Events) deleted(e *engine.Engine) error {
+	if e.RowsAffected == 0 {
+		return nil
+	}
+	table := scope.TableName(e, e.Scope.Value)
+	return ev.each(e, func(v reflect.Value) Event {
+		return ModelDeleted{TableName: table, Old: copyModel(v)}
+	})
+}
+
+// each publishes the event made by fn for the model of e, or for each model of
+// a slice.
+func (ev *Events) each(e *engine.Engine, fn func(reflect.Value) Event) error {
+	ev.mu.RLock()
+	handlers, chans := ev.handlers, ev.chans
+	ev.mu.RUnlock()
+	if len(handlers) == 0 && len(chans) == 0 {
+		return nil
+	}
+	var events []Event
+	err := eachValue(e, func(_ int, v reflect.Value) error {
+		if reflect.Indirect(v).Kind() != reflect.Struct {
+			return nil
+		}
+		event := fn(v)
+		for _, h := range handlers {
+			if err := h(e, event); err != nil {
+				return err
+			}
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil || len(chans) == 0 || len(events) == 0 {
+		return err
+	}
+	send := func() {
+		for _, event := range events {
+			for _, ch := range chans {
+				ch <- event
+			}
+		}
+	}
+	if e.Tx != nil {
+		e.Tx.AfterCommit(send)
+	} else {
+		send()
+	}
+	return nil
+}
+
+// copyModel returns a pointer to a deep copy of the model v, so that the
+// events don't change with the model or its associations.
+func copyModel(v reflect.Value) interface{} {
+	v = reflect.Indirect(v)
+	c := reflect.New(v.Type())
+	c.Elem().Set(deepCopy(v, make(map[copied]reflect.Value)))
+	return c.Interface()
+}
+
+type copied struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// deepCopy returns a copy of v sharing none of its pointers, slices and maps.
+// The unexported fields of structs are copied shallowly. seen has the copies
+// of the pointers already copied, so cycles are kept.
+func deepCopy(v reflect.Value, seen map[copied]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := copied{ptr: v.Pointer(), typ: v.Type()}
+		if c, ok := seen[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		seen[key] = c
+		c.Elem().Set(deepCopy(v.Elem(), seen))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, deepCopy(v.MapIndex(k), seen))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), seen))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), seen))
+			}
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), seen))
+		return c
+	}
+	return v
+}
@@ -0,0 +1,182 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+	"github.com/ngorm/ngorm/util"
+)
+
+// joinSeparator separates the name of a joined association from the name of
+// its columns in the selected column names, like CreditCard__number.
+const joinSeparator = "__"
+
+//JoinPreloadSQL adds to the query of e the LEFT JOIN and the columns loading
+//the associations set with search.JoinPreload, so they are loaded together
+//with the records in a single query. Only has_one and belongs_to
+//associations can be joined.
+//
+// The joined tables are aliased with the name of the association field and
+// their columns are selected with the name of the field as prefix, which
+// QueryExec uses to scan them into the association. The associations without
+// a matching row are left blank, or nil for pointers.
+func JoinPreloadSQL(e *engine.Engine) error {
+	columns := e.Search.JoinPreload
+	if len(columns) == 0 {
+		return nil
+	}
+	if len(e.Search.Selects) > 0 {
+		return errors.New("ngorm: joined associations can't be loaded with Select")
+	}
+	value := e.Scope.ValueOf()
+	m, err := scope.GetModelStruct(e, value)
+	if err != nil {
+		return err
+	}
+	table := scope.QuotedTableAlias(e, value)
+	var selects []string
+	for _, f := range m.StructFields {
+		if f.IsNormal {
+			selects = append(selects, fmt.Sprintf("%s.%s AS %s",
+				table, scope.Quote(e, f.DBName), scope.Quote(e, f.DBName)))
+		}
+	}
+	for _, column := range columns {
+		field, err := joinedField(m, column)
+		if err != nil {
+			return err
+		}
+		rel := field.Relationship
+		typ := field.Struct.Type
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		assoc := reflect.New(typ).Interface()
+		am, err := scope.GetModelStruct(e, assoc)
+		if err != nil {
+			return err
+		}
+		alias := scope.Quote(e, column)
+		for _, f := range am.StructFields {
+			if f.IsNormal {
+				selects = append(selects, fmt.Sprintf("%s.%s AS %s",
+					alias, scope.Quote(e, f.DBName),
+					scope.Quote(e, column+joinSeparator+f.DBName)))
+			}
+		}
+		var (
+			on   []string
+			args []interface{}
+		)
+		for i, fk := range rel.ForeignDBNames {
+			if rel.Kind == "belongs_to" {
+				on = append(on, fmt.Sprintf("%s.%s = %s.%s",
+					alias, scope.Quote(e, rel.AssociationForeignDBNames[i]),
+					table, scope.Quote(e, fk)))
+			} else {
+				on = append(on, fmt.Sprintf("%s.%s = %s.%s",
+					alias, scope.Quote(e, fk),
+					table, scope.Quote(e, rel.AssociationForeignDBNames[i])))
+			}
+		}
+		if rel.PolymorphicType != "" {
+			on = append(on, fmt.Sprintf("%s.%s = ?",
+				alias, scope.Quote(e, rel.PolymorphicDBName)))
+			args = append(args, rel.PolymorphicValue)
+		}
+		if !e.Search.Unscoped {
+			if sd := scope.SoftDeleteOf(e, assoc); sd != nil {
+				expr := sd.NotDeleted(alias + "." + scope.Quote(e, sd.Column()))
+				on = append(on, expr.Q)
+				args = append(args, expr.Args...)
+			}
+		}
+		search.Join(e, fmt.Sprintf("LEFT JOIN %s AS %s ON %s",
+			scope.Quote(e, associationTable(e, assoc)), alias,
+			strings.Join(on, " AND ")), args...)
+	}
+	search.Select(e, strings.Join(selects, ", "))
+
+	// The joins are added once, the scanning still needs the columns.
+	e.Scope.Set(model.JoinPreload, columns)
+	e.Search.JoinPreload = nil
+	return nil
+}
+
+// associationTable returns the name of the table of the association value,
+// which unlike the table of the query isn't set on e.
+func associationTable(e *engine.Engine, value interface{}) string {
+	ne := e.Clone()
+	defer engine.Put(ne)
+	return scope.TableName(ne, value)
+}
+
+// joinedField returns the field of m which is the association column.
+func joinedField(m *model.Struct, column string) (*model.StructField, error) {
+	for _, f := range m.StructFields {
+		if f.Name != column {
+			continue
+		}
+		if f.Relationship == nil ||
+			(f.Relationship.Kind != "has_one" && f.Relationship.Kind != "belongs_to") {
+			return nil, fmt.Errorf("ngorm: can't join %s of %s, only has_one and belongs_to associations can be joined",
+				column, m.ModelType)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("ngorm: %s has no association %s", m.ModelType, column)
+}
+
+// joinedFields returns the fields of the associations of elem loaded with
+// JoinPreloadSQL, named like their selected columns. The returned function
+// sets the associations which are pointers once the row is scanned.
+func joinedFields(e *engine.Engine, elem reflect.Value) ([]*model.Field, func(), error) {
+	v, ok := e.Scope.Get(model.JoinPreload)
+	if !ok {
+		return nil, func() {}, nil
+	}
+	var (
+		fields []*model.Field
+		sets   []func()
+	)
+	for _, column := range v.([]string) {
+		f := elem.FieldByName(column)
+		target := f
+		if f.Kind() == reflect.Ptr {
+			target = reflect.New(f.Type().Elem()).Elem()
+		}
+		afs, err := scope.Fields(e, target.Addr().Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, af := range afs {
+			sf := af.StructField.Clone()
+			sf.DBName = column + joinSeparator + af.DBName
+			fields = append(fields, &model.Field{StructField: sf, Field: af.Field})
+		}
+		if f.Kind() == reflect.Ptr {
+			f, target, afs := f, target, afs
+			sets = append(sets, func() {
+				// Only the associations found are set.
+				for _, af := range afs {
+					if af.IsPrimaryKey && !util.IsBlank(af.Field) {
+						f.Set(target.Addr())
+						return
+					}
+				}
+				f.Set(reflect.Zero(f.Type()))
+			})
+		}
+	}
+	return fields, func() {
+		for _, set := range sets {
+			set()
+		}
+	}, nil
+}
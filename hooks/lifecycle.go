@@ -0,0 +1,140 @@
+package hooks
+
+import (
+	"reflect"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+)
+
+// ModelBeforeCreate calls the BeforeCreate method of the models of e which
+// implement engine.BeforeCreator.
+func ModelBeforeCreate(e *engine.Engine) error {
+	return eachModel(e, (*engine.BeforeCreator)(nil), func(v interface{}) error {
+		return v.(engine.BeforeCreator).BeforeCreate(e)
+	})
+}
+
+// ModelAfterCreate calls the AfterCreate method of the models of e which
+// implement engine.AfterCreator.
+func ModelAfterCreate(e *engine.Engine) error {
+	return eachModel(e, (*engine.AfterCreator)(nil), func(v interface{}) error {
+		return v.(engine.AfterCreator).AfterCreate(e)
+	})
+}
+
+// ModelBeforeUpdate calls the BeforeUpdate method of the models of e which
+// implement engine.BeforeUpdater.
+func ModelBeforeUpdate(e *engine.Engine) error {
+	return eachModel(e, (*engine.BeforeUpdater)(nil), func(v interface{}) error {
+		return v.(engine.BeforeUpdater).BeforeUpdate(e)
+	})
+}
+
+// ModelAfterUpdate calls the AfterUpdate method of the models of e which
+// implement engine.AfterUpdater.
+func ModelAfterUpdate(e *engine.Engine) error {
+	return eachModel(e, (*engine.AfterUpdater)(nil), func(v interface{}) error {
+		return v.(engine.AfterUpdater).AfterUpdate(e)
+	})
+}
+
+// ModelBeforeDelete calls the BeforeDelete method of the models of e which
+// implement engine.BeforeDeleter.
+func ModelBeforeDelete(e *engine.Engine) error {
+	return eachModel(e, (*engine.BeforeDeleter)(nil), func(v interface{}) error {
+		return v.(engine.BeforeDeleter).BeforeDelete(e)
+	})
+}
+
+// ModelAfterDelete calls the AfterDelete method of the models of e which
+// implement engine.AfterDeleter.
+func ModelAfterDelete(e *engine.Engine) error {
+	return eachModel(e, (*engine.AfterDeleter)(nil), func(v interface{}) error {
+		return v.(engine.AfterDeleter).AfterDelete(e)
+	})
+}
+
+// TrackChanges records the values of the columns of the models of e which
+// implement model.Tracker, once they are loaded, created or updated. Nothing
+// is recorded for queries scanning into another destination.
+func TrackChanges(e *engine.Engine) error {
+	if _, ok := e.Scope.Get(model.QueryDestination); ok {
+		return nil
+	}
+	return eachModel(e, (*model.Tracker)(nil), func(v interface{}) error {
+		return scope.Track(e, v)
+	})
+}
+
+// ModelAfterFind calls the AfterFind method of the models found by the query
+// of e which implement engine.AfterFinder. Nothing is called for queries
+// scanning into another destination, like maps or columns.
+func ModelAfterFind(e *engine.Engine) error {
+	if _, ok := e.Scope.Get(model.QueryDestination); ok {
+		return nil
+	}
+	return eachModel(e, (*engine.AfterFinder)(nil), func(v interface{}) error {
+		return v.(engine.AfterFinder).AfterFind(e)
+	})
+}
+
+//Implements returns true when the models of value, a struct or a slice of
+//structs, implement iface which is a nil pointer to one of the lifecycle
+//interfaces like (*engine.AfterCreator)(nil).
+func Implements(value, iface interface{}) bool {
+	if value == nil {
+		return false
+	}
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	it := reflect.TypeOf(iface).Elem()
+	return t.Kind() == reflect.Struct && (t.Implements(it) || reflect.PtrTo(t).Implements(it))
+}
+
+// eachModel calls fn with the model of e, or each model of a slice, when they
+// implement iface. Addressable structs are passed by pointer so that methods
+// with a pointer receiver are called.
+func eachModel(e *engine.Engine, iface interface{}, fn func(interface{}) error) error {
+	if !Implements(e.Scope.Value, iface) {
+		return nil
+	}
+	it := reflect.TypeOf(iface).Elem()
+	return eachValue(e, func(_ int, v reflect.Value) error {
+		if !v.Type().Implements(it) {
+			return nil
+		}
+		return fn(v.Interface())
+	})
+}
+
+// eachValue calls fn with the model of e, or each model of a slice with its
+// index, as a pointer when the model is addressable. The index is -1 when e
+// has a single model. Nil pointers are skipped.
+func eachValue(e *engine.Engine, fn func(int, reflect.Value) error) error {
+	call := func(i int, v reflect.Value) error {
+		if v.Kind() != reflect.Ptr && v.CanAddr() {
+			v = v.Addr()
+		}
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		return fn(i, v)
+	}
+	v := reflect.ValueOf(e.Scope.Value)
+	if !v.IsValid() {
+		return nil
+	}
+	if iv := reflect.Indirect(v); iv.Kind() == reflect.Slice {
+		for i := 0; i < iv.Len(); i++ {
+			if err := call(i, iv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return call(-1, v)
+}
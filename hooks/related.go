@@ -0,0 +1,143 @@
+package hooks
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+	"github.com/ngorm/ngorm/util"
+)
+
+//Related loads into value the records associated to source through its
+//relationship field column. The query is built from the relationship when
+//asked for, which suits the associations that aren't always needed better
+//than Preload
+//
+//    var emails []Email
+//    err := hooks.Related(e, &user, &emails, "Emails")
+//
+// The conditions set on e, like Where or Order, are combined with the ones of
+// the relationship. Except for many_to_many relationships source can be a
+// slice, loading the associations of all its records at once. When source
+// has no key, a slice value is left empty and a struct value fails with
+// errmsg.ErrRecordNotFound.
+func Related(e *engine.Engine, source, value interface{}, column string) error {
+	found, err := relatedSearch(e, source, column)
+	if err != nil {
+		return err
+	}
+	if !found {
+		v := reflect.Indirect(reflect.ValueOf(value))
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			return nil
+		}
+		return errmsg.ErrRecordNotFound
+	}
+	e.Scope.ContextValue(value)
+	return Query(e)
+}
+
+//CountRelated scans into dest the number of records associated to source
+//through its relationship field column, like Related without loading them
+//
+//    var n int
+//    err := hooks.CountRelated(e, &user, "Emails", &n)
+//
+// The rows are counted with a COUNT query over the foreign keys, or the join
+// table for many_to_many relationships.
+func CountRelated(e *engine.Engine, source interface{}, column string, dest interface{}) error {
+	found, err := relatedSearch(e, source, column)
+	if err != nil {
+		return err
+	}
+	if !found {
+		v := reflect.ValueOf(dest)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return errmsg.ErrUnaddressable
+		}
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		return nil
+	}
+	return Count(e, e.Scope.Value, dest)
+}
+
+// relatedSearch adds to e the conditions matching the records associated to
+// source through its relationship field column, and sets a value of their
+// model. This returns false when source has no key, so nothing is related.
+func relatedSearch(e *engine.Engine, source interface{}, column string) (bool, error) {
+	m, err := scope.GetModelStruct(e, source)
+	if err != nil {
+		return false, err
+	}
+	var field *model.StructField
+	for _, f := range m.StructFields {
+		if f.Name == column && f.Relationship != nil {
+			field = f
+		}
+	}
+	if field == nil {
+		return false, fmt.Errorf("ngorm: %s of %s is not an association", column, m.ModelType)
+	}
+	rel := field.Relationship
+	var (
+		keys    [][]interface{}
+		columns []string
+	)
+	switch rel.Kind {
+	case "many_to_many":
+		join := scope.JoinWith
+		if dialects.IsQL(e.Dialect) {
+			join = scope.JoinWithQL
+		}
+		err = join(rel.JoinTableHandler, e, source)
+		if err != nil {
+			return false, err
+		}
+		keys = util.ColumnAsArray(sourceFieldNames(m, rel.JoinTableHandler.Source), source)
+	case "belongs_to":
+		keys = util.ColumnAsArray(rel.ForeignFieldNames, source)
+		columns = rel.AssociationForeignDBNames
+	case "has_one", "has_many":
+		keys = util.ColumnAsArray(rel.AssociationForeignFieldNames, source)
+		columns = rel.ForeignDBNames
+	default:
+		return false, fmt.Errorf("ngorm: unknown relationship %s of %s", rel.Kind, column)
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+	if columns != nil {
+		q, values := scope.KeysCondition(e, columns, keys)
+		if rel.PolymorphicType != "" {
+			q += fmt.Sprintf(" AND %v = ?", scope.Quote(e, rel.PolymorphicDBName))
+			values = append(values, rel.PolymorphicValue)
+		}
+		search.Where(e, q, values...)
+	}
+	t := field.Struct.Type
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	e.Scope.ContextValue(reflect.New(t).Interface())
+	return true, nil
+}
+
+// sourceFieldNames returns the names of the fields of m referenced by the
+// join table keys of src.
+func sourceFieldNames(m *model.Struct, src model.JoinTableSource) []string {
+	var names []string
+	for _, fk := range src.ForeignKeys {
+		for _, f := range m.StructFields {
+			if f.DBName == fk.AssociationDBName {
+				names = append(names, f.Name)
+			}
+		}
+	}
+	return names
+}
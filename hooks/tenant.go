@@ -0,0 +1,151 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+)
+
+type (
+	tenantKey     struct{}
+	allTenantsKey struct{}
+)
+
+//WithTenant returns a copy of ctx carrying tenant, to which the Tenancy
+//plugin scopes the operations using the context
+//
+//    db := db.WithContext(hooks.WithTenant(r.Context(), account.ID))
+func WithTenant(ctx context.Context, tenant interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+//TenantFrom returns the tenant set with WithTenant in ctx.
+func TenantFrom(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+//AllTenants returns a copy of ctx with which the operations aren't scoped by
+//the Tenancy plugin, for the admin paths working across tenants.
+func AllTenants(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, allTenantsKey{}, true)
+}
+
+//Tenancy is a plugin scoping the operations on models with a tenant column to
+//the tenant of their context, see WithTenant. A condition on the column is
+//added to every query, update and delete, bulk updates included, and the
+//column of the created models is set to the tenant, batch creates included.
+//
+// Operations without a tenant fail with errmsg.ErrMissingTenant, unless the
+// context is made with AllTenants. Creating a model of another tenant fails.
+// Raw statements are left alone.
+//
+//    err := db.Use(&hooks.Tenancy{Models: []interface{}{&Invoice{}, &Customer{}}})
+type Tenancy struct {
+	// Column is the tenant column, tenant_id when empty.
+	Column string
+
+	// Models are the scoped models, all the models with the column are scoped
+	// when empty.
+	Models []interface{}
+
+	types map[reflect.Type]bool
+}
+
+//Name implements engine.Plugin.
+func (t *Tenancy) Name() string {
+	return "ngorm:tenancy"
+}
+
+//Initialize implements engine.Plugin.
+func (t *Tenancy) Initialize(e *engine.Engine) error {
+	if t.Column == "" {
+		t.Column = "tenant_id"
+	}
+	t.types = make(map[reflect.Type]bool)
+	for _, m := range t.Models {
+		typ := modelType(m)
+		if typ == nil {
+			return fmt.Errorf("ngorm: can't scope %T which isn't a struct", m)
+		}
+		t.types[typ] = true
+	}
+	err := e.Callbacks.Create().Before(model.HookModelBeforeCreate).Register("tenancy:create", t.create)
+	if err != nil {
+		return err
+	}
+	e.Callbacks.AddCondition(t.condition)
+	return nil
+}
+
+func (t *Tenancy) scoped(e *engine.Engine, value interface{}) bool {
+	if len(t.types) > 0 && !t.types[modelType(value)] {
+		return false
+	}
+	return modelType(value) != nil && scope.HasColumn(e, value, t.Column)
+}
+
+// tenant returns the tenant of e, or nil when the operation isn't scoped.
+func (t *Tenancy) tenant(e *engine.Engine) (interface{}, error) {
+	if e.Ctx != nil && e.Ctx.Value(allTenantsKey{}) != nil {
+		return nil, nil
+	}
+	tenant, ok := TenantFrom(e.Ctx)
+	if !ok {
+		return nil, errmsg.ErrMissingTenant
+	}
+	return tenant, nil
+}
+
+func (t *Tenancy) condition(e *engine.Engine, value interface{}) (*model.Expr, error) {
+	if !t.scoped(e, value) {
+		return nil, nil
+	}
+	tenant, err := t.tenant(e)
+	if err != nil || tenant == nil {
+		return nil, err
+	}
+	column := e.Dialect.QueryFieldName(scope.QuotedTableAlias(e, value)) + scope.Quote(e, t.Column)
+	return &model.Expr{Q: column + " = ?", Args: []interface{}{tenant}}, nil
+}
+
+func (t *Tenancy) create(e *engine.Engine) error {
+	return eachValue(e, func(_ int, v reflect.Value) error {
+		return t.BeforeCreateBatch(e, v.Interface())
+	})
+}
+
+//BeforeCreateBatch implements engine.BatchCreator, the models created in
+//batches get the tenant like the ones created with Create.
+func (t *Tenancy) BeforeCreateBatch(e *engine.Engine, value interface{}) error {
+	if reflect.Indirect(reflect.ValueOf(value)).Kind() != reflect.Struct || !t.scoped(e, value) {
+		return nil
+	}
+	tenant, err := t.tenant(e)
+	if err != nil || tenant == nil {
+		return err
+	}
+	field, err := scope.FieldByName(e, value, t.Column)
+	if err != nil {
+		return err
+	}
+	if !field.IsBlank && fmt.Sprint(field.Field.Interface()) != fmt.Sprint(tenant) {
+		return errors.New("ngorm: can't create a model of another tenant")
+	}
+	return field.Set(tenant)
+}
@@ -0,0 +1,115 @@
+package hooks
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
+)
+
+//ValidateFunc validates value, a pointer to a model, like the Validate method
+//of engine.Validator.
+type ValidateFunc func(e *engine.Engine, value interface{}) error
+
+var validators = struct {
+	mu sync.RWMutex
+	m  map[reflect.Type]ValidateFunc
+}{m: make(map[reflect.Type]ValidateFunc)}
+
+//RegisterValidator registers fn to validate the models of the type of value
+//before they are created or updated, for models which can't implement
+//engine.Validator. Registering a type again replaces its validator, a nil fn
+//removes it.
+func RegisterValidator(value interface{}, fn ValidateFunc) error {
+	t := modelType(value)
+	if t == nil {
+		return fmt.Errorf("ngorm: can't validate %T which isn't a struct", value)
+	}
+	validators.mu.Lock()
+	defer validators.mu.Unlock()
+	if fn == nil {
+		delete(validators.m, t)
+	} else {
+		validators.m[t] = fn
+	}
+	return nil
+}
+
+func validatorFor(value interface{}) ValidateFunc {
+	t := modelType(value)
+	if t == nil {
+		return nil
+	}
+	validators.mu.RLock()
+	defer validators.mu.RUnlock()
+	return validators.m[t]
+}
+
+// modelType returns the struct type of value, a struct or a slice of structs,
+// or nil.
+func modelType(value interface{}) reflect.Type {
+	if value == nil {
+		return nil
+	}
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// Validate validates the models of e with their Validate method, when they
+// implement engine.Validator, and the validator registered for their type.
+// The fields failing for every model are reported by a single
+// *errmsg.ValidationError, the fields of the models of a slice are prefixed
+// with their index like [1].Name. Other errors are returned as is.
+func Validate(e *engine.Engine) error {
+	fn := validatorFor(e.Scope.Value)
+	if fn == nil && !Implements(e.Scope.Value, (*engine.Validator)(nil)) {
+		return nil
+	}
+	verr := &errmsg.ValidationError{}
+	err := eachValue(e, func(i int, v reflect.Value) error {
+		var errs []error
+		if val, ok := v.Interface().(engine.Validator); ok {
+			errs = append(errs, val.Validate(e))
+		}
+		if fn != nil {
+			errs = append(errs, fn(e, v.Interface()))
+		}
+		for _, err := range errs {
+			if err == nil {
+				continue
+			}
+			ve, ok := err.(*errmsg.ValidationError)
+			if !ok {
+				return err
+			}
+			for _, f := range ve.Fields {
+				if i >= 0 {
+					f.Field = fmt.Sprintf("[%d].%s", i, f.Field)
+				}
+				verr.Fields = append(verr.Fields, f)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return verr.Err()
+}
+
+// validateUpdate validates the models of e once the updated attributes are
+// assigned to them.
+func validateUpdate(e *engine.Engine) error {
+	if err := AssignUpdatingAttrs(e); err != nil {
+		return err
+	}
+	return Validate(e)
+}
@@ -0,0 +1,262 @@
+package ngorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/hooks"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+)
+
+//Orphans reports the rows of Table whose Columns don't reference an existing
+//row of RefTable through RefColumns, as declared by the relationship Field of
+//Model.
+type Orphans struct {
+	Model      string
+	Field      string
+	Table      string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+
+	// Count is the number of orphaned rows that were found, or deleted when
+	// returned by DeleteOrphans.
+	Count int64
+
+	// polymorphic type column and value of the rows referencing RefTable.
+	typeColumn, typeValue string
+
+	// actions of the foreign key constraint set with the CONSTRAINT tag.
+	onDelete, onUpdate string
+}
+
+func (o Orphans) String() string {
+	return fmt.Sprintf("%s.%s: %d rows of %s(%s) without %s(%s)",
+		o.Model, o.Field, o.Count, o.Table, strings.Join(o.Columns, ","),
+		o.RefTable, strings.Join(o.RefColumns, ","))
+}
+
+//CheckIntegrity counts the rows violating the relationships declared by
+//models, that is rows with foreign keys referencing rows which don't exist.
+//This is useful for databases that don't enforce foreign key constraints.
+//
+// Rows with NULL foreign keys are not reported. Composite foreign keys are
+// checked with NOT EXISTS which isn't supported by ql.
+func (db *DB) CheckIntegrity(models ...interface{}) ([]Orphans, error) {
+	refs, err := db.references(models)
+	if err != nil {
+		return nil, err
+	}
+	for k := range refs {
+		e := db.NewEngine()
+		cond, err := orphanCondition(e, &refs[k])
+		if err == nil {
+			q := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", scope.Quote(e, refs[k].Table), cond)
+			err = hooks.ScanRow(e, q, e.Scope.SQLVars, &refs[k].Count)
+		}
+		engine.Put(e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+//DeleteOrphans deletes the rows reported by CheckIntegrity. Rows are deleted
+//batchSize distinct foreign keys at a time so that large tables are not
+//locked for long, the returned Orphans have the number of deleted rows.
+func (db *DB) DeleteOrphans(batchSize int, models ...interface{}) ([]Orphans, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("ngorm: invalid batch size %d", batchSize)
+	}
+	refs, err := db.references(models)
+	if err != nil {
+		return nil, err
+	}
+	for k := range refs {
+		for {
+			n, err := db.deleteOrphans(&refs[k], batchSize)
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				break
+			}
+			refs[k].Count += n
+		}
+	}
+	return refs, nil
+}
+
+// deleteOrphans deletes the rows having one batch of dangling foreign keys
+// and returns the number of deleted rows.
+func (db *DB) deleteOrphans(o *Orphans, batchSize int) (int64, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	cond, err := orphanCondition(e, o)
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]string, len(o.Columns))
+	for k, c := range o.Columns {
+		columns[k] = scope.Quote(e, c)
+	}
+	q := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s%s",
+		strings.Join(columns, ","), scope.Quote(e, o.Table), cond,
+		e.Dialect.LimitAndOffsetSQL(batchSize, nil))
+	rows, err := hooks.QueryRaw(e, q, e.Scope.SQLVars...)
+	if err != nil {
+		return 0, err
+	}
+	var keys [][]interface{}
+	for rows.Next() {
+		key := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for k := range key {
+			dest[k] = &key[k]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	e.Scope.SQLVars = nil
+	var or []string
+	for _, key := range keys {
+		var and []string
+		for k, v := range key {
+			and = append(and, fmt.Sprintf("%s = %s", columns[k], scope.AddToVars(e, v)))
+		}
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+
+	// The rows are checked again, the same keys can reference another
+	// polymorphic owner or a row inserted since the SELECT.
+	cond, err = orphanCondition(e, o)
+	if err != nil {
+		return 0, err
+	}
+	r, err := db.ExecTx(fmt.Sprintf("DELETE FROM %s WHERE (%s) AND %s",
+		scope.Quote(e, o.Table), strings.Join(or, " OR "), cond), e.Scope.SQLVars...)
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
+
+// orphanCondition returns the condition matching the orphaned rows of o, the
+// bind variables are added to e.
+func orphanCondition(e *engine.Engine, o *Orphans) (string, error) {
+	var conds []string
+	for _, c := range o.Columns {
+		conds = append(conds, scope.Quote(e, c)+" IS NOT NULL")
+	}
+	if o.typeColumn != "" {
+		conds = append(conds, fmt.Sprintf("%s = %s",
+			scope.Quote(e, o.typeColumn), scope.AddToVars(e, o.typeValue)))
+	}
+	if len(o.Columns) == 1 {
+		conds = append(conds, fmt.Sprintf("%s NOT IN (SELECT %s FROM %s)",
+			scope.Quote(e, o.Columns[0]), scope.Quote(e, o.RefColumns[0]), scope.Quote(e, o.RefTable)))
+		return strings.Join(conds, " AND "), nil
+	}
+	if dialects.IsQL(e.Dialect) {
+		return "", fmt.Errorf("ngorm: can't check composite foreign key %s.%s with %s",
+			o.Model, o.Field, e.Dialect.GetName())
+	}
+	var eq []string
+	for k, c := range o.Columns {
+		eq = append(eq, fmt.Sprintf("%s.%s = %s.%s",
+			scope.Quote(e, o.RefTable), scope.Quote(e, o.RefColumns[k]),
+			scope.Quote(e, o.Table), scope.Quote(e, c)))
+	}
+	conds = append(conds, fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE %s)",
+		scope.Quote(e, o.RefTable), strings.Join(eq, " AND ")))
+	return strings.Join(conds, " AND "), nil
+}
+
+// references returns the foreign keys declared by the relationships of models.
+// A foreign key declared on both sides of a relationship is only returned once.
+func (db *DB) references(models []interface{}) ([]Orphans, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	tableOf := func(value interface{}) string {
+		return scope.TableNameOf(e, value)
+	}
+	tableOfType := func(t reflect.Type) string {
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return tableOf(reflect.New(t).Interface())
+	}
+	var refs []Orphans
+	seen := make(map[string]int)
+	add := func(o Orphans) {
+		key := fmt.Sprint(o.Table, o.Columns, o.RefTable, o.RefColumns, o.typeValue)
+		if len(o.Columns) == 0 {
+			return
+		}
+		if i, ok := seen[key]; ok {
+			// The actions may be set on either side.
+			if o.onDelete != "" {
+				refs[i].onDelete = o.onDelete
+			}
+			if o.onUpdate != "" {
+				refs[i].onUpdate = o.onUpdate
+			}
+			return
+		}
+		seen[key] = len(refs)
+		refs = append(refs, o)
+	}
+	for _, m := range models {
+		ms, err := scope.GetModelStruct(e, m)
+		if err != nil {
+			return nil, err
+		}
+		table := tableOf(m)
+		for _, f := range ms.StructFields {
+			rel := f.Relationship
+			if rel == nil {
+				continue
+			}
+			o := Orphans{Model: ms.ModelType.Name(), Field: f.Name,
+				onDelete: rel.OnDelete, onUpdate: rel.OnUpdate}
+			switch rel.Kind {
+			case "belongs_to":
+				o.Table, o.Columns = table, rel.ForeignDBNames
+				o.RefTable, o.RefColumns = tableOfType(f.Struct.Type), rel.AssociationForeignDBNames
+				add(o)
+			case "has_one", "has_many":
+				o.Table, o.Columns = tableOfType(f.Struct.Type), rel.ForeignDBNames
+				o.RefTable, o.RefColumns = table, rel.AssociationForeignDBNames
+				o.typeColumn, o.typeValue = rel.PolymorphicDBName, rel.PolymorphicValue
+				add(o)
+			case "many_to_many":
+				h := rel.JoinTableHandler
+				if h == nil {
+					continue
+				}
+				for _, src := range []model.JoinTableSource{h.Source, h.Destination} {
+					j := o
+					j.Table, j.RefTable = h.TableName, tableOfType(src.ModelType)
+					j.Columns, j.RefColumns = src.DBNames(), src.AssociationDBNames()
+					add(j)
+				}
+			}
+		}
+	}
+	return refs, nil
+}
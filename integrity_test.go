@@ -0,0 +1,134 @@
+package ngorm
+
+import (
+	"testing"
+
+	"github.com/ngorm/ngorm/fixture"
+)
+
+type OrphanParent struct {
+	ID       int64
+	Name     string
+	Children []OrphanChild
+}
+
+type OrphanChild struct {
+	ID             int64
+	OrphanParentID int64
+}
+
+func TestDB_CheckIntegrity(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBCheckIntegrity, &OrphanParent{}, &OrphanChild{})
+	}
+}
+
+func testDBCheckIntegrity(t *testing.T, db *DB) {
+	// The orphans can't be created with the constraints.
+	db.MigrateForeignKeys(false)
+	_, err := db.Automigrate(&OrphanParent{}, &OrphanChild{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&OrphanParent{Name: "parent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{1, 1, 10, 11, 11} {
+		err = db.Create(&OrphanChild{OrphanParentID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	o, err := db.CheckIntegrity(&OrphanParent{}, &OrphanChild{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 1 {
+		t.Fatalf("expected 1 relationship got %v", o)
+	}
+	if o[0].Count != 3 {
+		t.Errorf("expected 3 orphans got %s", o[0])
+	}
+	o, err = db.DeleteOrphans(1, &OrphanParent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o[0].Count != 3 {
+		t.Errorf("expected 3 deleted rows got %s", o[0])
+	}
+	var count int
+	err = db.Model(&OrphanChild{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 rows got %d", count)
+	}
+	o, err = db.CheckIntegrity(&OrphanParent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o[0].Count != 0 {
+		t.Errorf("expected no orphans got %s", o[0])
+	}
+}
+
+func TestDB_DeleteOrphansPolymorphic(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDeleteOrphansPolymorphic, &fixture.Cat{}, &fixture.Dog{}, &fixture.Toy{})
+	}
+}
+
+func testDBDeleteOrphansPolymorphic(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&fixture.Cat{}, &fixture.Dog{}, &fixture.Toy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&fixture.Cat{Name: "tom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&fixture.Dog{Name: "max"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dog := fixture.Dog{Name: "rex", Toys: []fixture.Toy{{Name: "ball"}, {Name: "bone"}}}
+	err = db.Create(&dog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The toy of a missing cat has the same owner id as the toys of the dog.
+	var cat fixture.Cat
+	err = db.First(&cat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cat.ID == dog.ID {
+		t.Fatalf("expected the cat and the dog to have different ids got %d", cat.ID)
+	}
+	err = db.Create(&fixture.Toy{Name: "mouse", OwnerID: dog.ID, OwnerType: "cats"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := db.DeleteOrphans(10, &fixture.Cat{}, &fixture.Dog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deleted int64
+	for _, v := range o {
+		deleted += v.Count
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted row got %v", o)
+	}
+	var toys []fixture.Toy
+	err = db.Order("name").Find(&toys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toys) != 2 || toys[0].Name != "ball" || toys[1].Name != "bone" {
+		t.Errorf("expected the toys of the dog to be kept got %+v", toys)
+	}
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+)
+
+//SizeBuckets are the upper bounds of the buckets used by Histogram. Result
+//sets larger than the last bound are counted in an extra bucket.
+var SizeBuckets = []int{0, 1, 10, 100, 1000, 10000}
+
+//Histogram is the distribution of the number of rows returned by a query.
+type Histogram struct {
+	// Counts has one entry per bound in SizeBuckets plus one for larger
+	// result sets.
+	Counts []int64
+	Count  int64
+	Sum    int64
+	Max    int
+}
+
+func (h *Histogram) observe(rows int) {
+	if h.Counts == nil {
+		h.Counts = make([]int64, len(SizeBuckets)+1)
+	}
+	i := 0
+	for i < len(SizeBuckets) && rows > SizeBuckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += int64(rows)
+	if rows > h.Max {
+		h.Max = rows
+	}
+}
+
+type queryCountsKey struct{}
+
+type queryCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+//WithQueryCounts returns a copy of ctx that keeps count of the queries executed
+//with it. An Analyzer reports queries that are executed too many times within
+//such a context, this is usually done for every incoming request.
+func WithQueryCounts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryCountsKey{}, &queryCounts{counts: make(map[string]int)})
+}
+
+//Analyzer is meant to be used during development. It records the distribution
+//of result set sizes per query and detects N+1 patterns, where the same query
+//is executed again and again with different arguments, usually in a loop over
+//the results of another query.
+//
+// N+1 detection only works for queries executed with a context returned by
+// WithQueryCounts.
+type Analyzer struct {
+	// Threshold is the number of times a query can be executed within a context
+	// before it is reported, the default is 10.
+	Threshold int
+
+	// Logf is used to report N+1 queries, the default is log.Printf.
+	Logf func(format string, args ...interface{})
+
+	mu    sync.Mutex
+	sizes map[string]*Histogram
+}
+
+//Observe records that query on table returned rows. ctx is the context the
+//query was executed with.
+func (a *Analyzer) Observe(ctx context.Context, table, query string, rows int) {
+	fp := Fingerprint(query)
+	a.mu.Lock()
+	if a.sizes == nil {
+		a.sizes = make(map[string]*Histogram)
+	}
+	h, ok := a.sizes[fp]
+	if !ok {
+		h = &Histogram{}
+		a.sizes[fp] = h
+	}
+	h.observe(rows)
+	a.mu.Unlock()
+
+	if ctx == nil {
+		return
+	}
+	c, ok := ctx.Value(queryCountsKey{}).(*queryCounts)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.counts[fp]++
+	n := c.counts[fp]
+	c.mu.Unlock()
+	threshold := a.Threshold
+	if threshold <= 0 {
+		threshold = 10
+	}
+	if n != threshold+1 {
+		return
+	}
+	logf := a.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	logf("ngorm: possible N+1 query, executed more than %d times in the same context, consider Preload(%q) on the parent query: %s",
+		threshold, preloadName(table), fp)
+}
+
+//Histograms returns a copy of the result set size distributions keyed by query
+//fingerprint.
+func (a *Analyzer) Histograms() map[string]Histogram {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	o := make(map[string]Histogram, len(a.sizes))
+	for k, v := range a.sizes {
+		h := *v
+		h.Counts = append([]int64(nil), v.Counts...)
+		o[k] = h
+	}
+	return o
+}
+
+// preloadName guesses the name of the field holding records of table, for
+// instance user_languages gives UserLanguages.
+func preloadName(table string) string {
+	if i := strings.LastIndex(table, "."); i != -1 {
+		table = table[i+1:]
+	}
+	parts := strings.Split(table, "_")
+	for k, v := range parts {
+		if v != "" {
+			parts[k] = strings.ToUpper(v[:1]) + v[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+//Fingerprint returns a normalized form of query which is the same for queries
+//that only differ in their arguments. Literals and placeholders are replaced
+//with ?, lists of them are collapsed into a single ? and whitespace is
+//collapsed.
+//
+//  SELECT * FROM users WHERE id IN ($1,$2,$3) AND name = 'gernest'
+//
+// gives
+//
+//  SELECT * FROM users WHERE id IN (?) AND name = ?
+func Fingerprint(query string) string {
+	var buf bytes.Buffer
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		case c == '\'':
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			i = j
+			c = '?'
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			for i+1 < len(query) && isDigit(query[i+1]) {
+				i++
+			}
+			c = '?'
+		case isDigit(c) && (space || !isIdentPart(prev(&buf))):
+			for i+1 < len(query) && (isDigit(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			c = '?'
+		}
+		if c == '?' && bytes.HasSuffix(buf.Bytes(), []byte("?,")) {
+			// collapse lists of values
+			buf.Truncate(buf.Len() - 1)
+			space = false
+			continue
+		}
+		if space && buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		space = false
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+func prev(buf *bytes.Buffer) byte {
+	if buf.Len() == 0 {
+		return 0
+	}
+	return buf.Bytes()[buf.Len()-1]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentPart(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
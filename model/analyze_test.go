@@ -0,0 +1,59 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	sample := []struct {
+		src, expect string
+	}{
+		{"SELECT * FROM users WHERE id = $1", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT *  FROM users\n\tWHERE id IN ($1, $2,$3)", "SELECT * FROM users WHERE id IN (?)"},
+		{"SELECT * FROM users WHERE name = 'it''s' AND age > 18", "SELECT * FROM users WHERE name = ? AND age > ?"},
+		{"SELECT * FROM users2 WHERE id IN (?,?) LIMIT 10", "SELECT * FROM users2 WHERE id IN (?) LIMIT ?"},
+	}
+	for _, v := range sample {
+		got := Fingerprint(v.src)
+		if got != v.expect {
+			t.Errorf("expected %s got %s", v.expect, got)
+		}
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	var logs []string
+	a := &Analyzer{
+		Threshold: 2,
+		Logf: func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}
+	ctx := WithQueryCounts(context.Background())
+	for i := 0; i < 5; i++ {
+		a.Observe(ctx, "user_emails", fmt.Sprintf("SELECT * FROM user_emails WHERE user_id = %d", i), i)
+	}
+	a.Observe(context.Background(), "user_emails", "SELECT * FROM user_emails WHERE user_id = $1", 100)
+	if len(logs) != 1 {
+		t.Fatalf("expected one report got %v", logs)
+	}
+	expect := `ngorm: possible N+1 query, executed more than 2 times in the same context, consider Preload("UserEmails") on the parent query: SELECT * FROM user_emails WHERE user_id = ?`
+	if logs[0] != expect {
+		t.Errorf("expected %s got %s", expect, logs[0])
+	}
+	h, ok := a.Histograms()["SELECT * FROM user_emails WHERE user_id = ?"]
+	if !ok {
+		t.Fatal("expected a histogram")
+	}
+	if h.Count != 6 || h.Max != 100 || h.Sum != 110 {
+		t.Errorf("unexpected histogram %+v", h)
+	}
+	counts := []int64{1, 1, 3, 1, 0, 0, 0}
+	for i, v := range counts {
+		if h.Counts[i] != v {
+			t.Errorf("bucket %d: expected %d got %d", i, v, h.Counts[i])
+		}
+	}
+}
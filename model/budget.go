@@ -0,0 +1,112 @@
+package model
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ngorm/ngorm/errmsg"
+)
+
+type budgetKey struct{}
+
+//Budget limits the number of statements and the cumulative database time
+//spent within a context, usually a single incoming request. Use it in
+//development to catch endpoints doing too much work.
+//
+//    ctx := model.WithBudget(r.Context(), &model.Budget{MaxStatements: 20})
+//    db.WithContext(ctx).Find(&users)
+//
+// A Budget is safe for concurrent use, it must not be shared between
+// contexts that are meant to be accounted separately.
+type Budget struct {
+	// MaxStatements is the maximum number of statements, zero means no limit.
+	MaxStatements int
+
+	// MaxDuration is the maximum cumulative execution time, zero means no
+	// limit.
+	MaxDuration time.Duration
+
+	// Strict makes statements fail with errmsg.ErrBudgetExceeded once the
+	// budget is exhausted, otherwise exceeding the budget is logged once.
+	Strict bool
+
+	// Logf is used to report exceeded budgets, the default is log.Printf.
+	Logf func(format string, args ...interface{})
+
+	mu         sync.Mutex
+	statements int
+	elapsed    time.Duration
+	reported   bool
+}
+
+//WithBudget returns a copy of ctx carrying b.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+//BudgetFrom returns the budget attached to ctx with WithBudget, or nil when
+//there is none.
+func BudgetFrom(ctx context.Context) *Budget {
+	if ctx == nil {
+		return nil
+	}
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
+
+//Check is called before executing a statement. It returns
+//errmsg.ErrBudgetExceeded when the budget is strict and executing another
+//statement would exceed it.
+func (b *Budget) Check() error {
+	if !b.Strict {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if (b.MaxStatements > 0 && b.statements >= b.MaxStatements) ||
+		(b.MaxDuration > 0 && b.elapsed > b.MaxDuration) {
+		return errmsg.ErrBudgetExceeded
+	}
+	return nil
+}
+
+//Spend records a statement that took d to execute.
+func (b *Budget) Spend(d time.Duration) {
+	b.mu.Lock()
+	b.statements++
+	b.elapsed += d
+	exceeded := (b.MaxStatements > 0 && b.statements > b.MaxStatements) ||
+		(b.MaxDuration > 0 && b.elapsed > b.MaxDuration)
+	report := exceeded && !b.Strict && !b.reported
+	if report {
+		b.reported = true
+	}
+	statements, elapsed := b.statements, b.elapsed
+	b.mu.Unlock()
+	if !report {
+		return
+	}
+	logf := b.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	logf("ngorm: query budget exceeded, %d statements (max %d) and %v of database time (max %v)",
+		statements, b.MaxStatements, elapsed, b.MaxDuration)
+}
+
+//Statements returns the number of statements executed so far.
+func (b *Budget) Statements() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.statements
+}
+
+//Elapsed returns the cumulative execution time of the statements executed so
+//far.
+func (b *Budget) Elapsed() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.elapsed
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLoggedValue is the number of characters of a single value that are
+// written when interpolating queries for logging.
+const maxLoggedValue = 64
+
+//Interpolate returns q with the placeholders replaced by args rendered as SQL
+//literals, strings are quoted and escaped. This is useful when logging or
+//debugging queries, for instance
+//
+//  q, args, err := hooks.ToSQL(e, model.Query)
+//  ...
+//  fmt.Println(model.Interpolate(q, args))
+//
+// The result is only an approximation of what the database executes, it is
+// meant to be read by humans and must never be executed.
+func Interpolate(q string, args []interface{}) string {
+	return interpolate(q, args, 0)
+}
+
+// interpolate replaces the placeholders in q with the values in args. Both
+// numbered $n placeholders and positional ? placeholders are supported, and
+// placeholders inside quoted strings are left untouched.
+//
+// The result is only an approximation of what the database executes, it is
+// meant to be read by humans and must never be executed. Values longer than
+// max characters are truncated, use max <= 0 to keep whole values.
+func interpolate(q string, args []interface{}, max int) string {
+	var buf bytes.Buffer
+	pos := 0
+	var quote byte
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			buf.WriteByte(c)
+		case '?':
+			if pos < len(args) {
+				buf.WriteString(formatValue(args[pos], max))
+				pos++
+				continue
+			}
+			buf.WriteByte(c)
+		case '$':
+			j := i + 1
+			for j < len(q) && q[j] >= '0' && q[j] <= '9' {
+				j++
+			}
+			n, err := strconv.Atoi(q[i+1 : j])
+			if err != nil || n < 1 || n > len(args) {
+				buf.WriteByte(c)
+				continue
+			}
+			buf.WriteString(formatValue(args[n-1], max))
+			i = j - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// formatValue returns v as a SQL literal.
+func formatValue(v interface{}, max int) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(v); !(rv.Kind() == reflect.Ptr && rv.IsNil()) {
+			if dv, err := valuer.Value(); err == nil {
+				v = dv
+			}
+		}
+	}
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case *Expr:
+		return value.Q
+	case string:
+		return quoteString(value, max)
+	case []byte:
+		s := fmt.Sprintf("%x", value)
+		if max > 0 && len(s) > 2*max {
+			s = s[:2*max] + "..."
+		}
+		return "X'" + s + "'"
+	case time.Time:
+		return "'" + value.Format("2006-01-02 15:04:05.999999999-07:00") + "'"
+	case bool:
+		if value {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return formatValue(rv.Elem().Interface(), max)
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v)
+	case reflect.String:
+		return quoteString(rv.String(), max)
+	}
+	return quoteString(fmt.Sprint(v), max)
+}
+
+func quoteString(s string, max int) string {
+	if max > 0 && utf8.RuneCountInString(s) > max {
+		s = string([]rune(s)[:max]) + "..."
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterpolate(t *testing.T) {
+	now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	name := "gernest"
+	sample := []struct {
+		q      string
+		args   []interface{}
+		expect string
+	}{
+		{"SELECT * FROM users WHERE name = $1 AND age > $2", []interface{}{"o'neil", 20},
+			"SELECT * FROM users WHERE name = 'o''neil' AND age > 20"},
+		{"SELECT * FROM users WHERE name = ? AND age > ?", []interface{}{&name, nil},
+			"SELECT * FROM users WHERE name = 'gernest' AND age > NULL"},
+		{"UPDATE users SET note = '$1?' WHERE id = $1", []interface{}{10},
+			"UPDATE users SET note = '$1?' WHERE id = 10"},
+		{"INSERT INTO users (created_at,active,hash) VALUES ($1,$2,$3)",
+			[]interface{}{now, true, []byte{0xca, 0xfe}},
+			"INSERT INTO users (created_at,active,hash) VALUES ('2017-03-01 10:00:00+00:00',TRUE,X'cafe')"},
+		{"SELECT $2", []interface{}{1}, "SELECT $2"},
+	}
+	for _, v := range sample {
+		s := interpolate(v.q, v.args, maxLoggedValue)
+		if s != v.expect {
+			t.Errorf("expected %s got %s", v.expect, s)
+		}
+	}
+	s := interpolate("SELECT $1", []interface{}{strings.Repeat("a", 100)}, 10)
+	expect := "SELECT 'aaaaaaaaaa...'"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+	s = Interpolate("SELECT $1", []interface{}{strings.Repeat("a", 100)})
+	expect = "SELECT '" + strings.Repeat("a", 100) + "'"
+	if s != expect {
+		t.Errorf("expected %s got %s", expect, s)
+	}
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//PlanCache keeps the SQL generated for queries keyed by the shape of their
+//search, so repeated queries which only differ in their arguments skip
+//building the statement.
+//
+// The cache holds at most the number of entries it was created with, it is
+// emptied when full. Call Reset after changes which affect generated SQL
+// without changing the search, like migrations adding a deleted_at column.
+type PlanCache struct {
+	mu     sync.RWMutex
+	max    int
+	plans  map[string]string
+	hits   int64
+	misses int64
+}
+
+//NewPlanCache returns a PlanCache holding at most max entries.
+func NewPlanCache(max int) *PlanCache {
+	return &PlanCache{max: max, plans: make(map[string]string)}
+}
+
+//Get returns the SQL cached for key.
+func (p *PlanCache) Get(key string) (string, bool) {
+	p.mu.RLock()
+	q, ok := p.plans[key]
+	p.mu.RUnlock()
+	if ok {
+		atomic.AddInt64(&p.hits, 1)
+	} else {
+		atomic.AddInt64(&p.misses, 1)
+	}
+	return q, ok
+}
+
+//Set caches q for key.
+func (p *PlanCache) Set(key, q string) {
+	p.mu.Lock()
+	if len(p.plans) >= p.max {
+		p.plans = make(map[string]string)
+	}
+	p.plans[key] = q
+	p.mu.Unlock()
+}
+
+//Reset removes all cached entries.
+func (p *PlanCache) Reset() {
+	p.mu.Lock()
+	p.plans = make(map[string]string)
+	p.mu.Unlock()
+}
+
+//Stats returns the number of cache hits and misses.
+func (p *PlanCache) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&p.hits), atomic.LoadInt64(&p.misses)
+}
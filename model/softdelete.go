@@ -0,0 +1,95 @@
+package model
+
+import "time"
+
+//SoftDelete is a strategy for soft deleting the rows of a model. Deleting
+//marks the rows by setting a column instead of removing them, and queries
+//skip the marked rows unless they are unscoped.
+//
+// The strategy of a model is, in order of precedence, the one returned by its
+// SoftDelete method when it implements SoftDeleter, the one of its field with
+// the SOFT_DELETE tag, or DeletedAt("deleted_at") when it has a deleted_at
+// column. The tag picks the strategy from the type of the field, bool fields
+// use DeletedFlag, integer fields DeletedAtMilli and the others DeletedAt. The
+// tag value can name it too, as flag, unix_milli or timestamp
+//
+//    type Post struct {
+//    	ID      int64
+//    	Removed bool `gorm:"SOFT_DELETE"`
+//    	Gone    int64 `gorm:"SOFT_DELETE:unix_milli"`
+//    }
+type SoftDelete interface {
+	// Column returns the column marking the deleted rows.
+	Column() string
+
+	// DeletedValue returns the value set on the column of the rows deleted at
+	// now.
+	DeletedValue(now time.Time) interface{}
+
+	// NotDeleted returns the condition matching the rows which aren't
+	// deleted, column is the quoted and possibly qualified column.
+	NotDeleted(column string) *Expr
+}
+
+//SoftDeleter is implemented by models choosing their soft delete strategy.
+type SoftDeleter interface {
+	SoftDelete() SoftDelete
+}
+
+//DeletedAt is the soft delete strategy setting the column to the time of the
+//delete, the rows which aren't deleted have a NULL column.
+type DeletedAt string
+
+//Column implements SoftDelete.
+func (d DeletedAt) Column() string {
+	return string(d)
+}
+
+//DeletedValue implements SoftDelete.
+func (d DeletedAt) DeletedValue(now time.Time) interface{} {
+	return now
+}
+
+//NotDeleted implements SoftDelete.
+func (d DeletedAt) NotDeleted(column string) *Expr {
+	return &Expr{Q: column + " IS NULL"}
+}
+
+//DeletedFlag is the soft delete strategy setting a boolean column to true,
+//the rows which aren't deleted have a false or NULL column.
+type DeletedFlag string
+
+//Column implements SoftDelete.
+func (d DeletedFlag) Column() string {
+	return string(d)
+}
+
+//DeletedValue implements SoftDelete.
+func (d DeletedFlag) DeletedValue(now time.Time) interface{} {
+	return true
+}
+
+//NotDeleted implements SoftDelete.
+func (d DeletedFlag) NotDeleted(column string) *Expr {
+	return &Expr{Q: "(" + column + " IS NULL OR " + column + " = ?)", Args: []interface{}{false}}
+}
+
+//DeletedAtMilli is the soft delete strategy setting an integer column to the
+//time of the delete in milliseconds since the Unix epoch, the rows which
+//aren't deleted have a zero or NULL column.
+type DeletedAtMilli string
+
+//Column implements SoftDelete.
+func (d DeletedAtMilli) Column() string {
+	return string(d)
+}
+
+//DeletedValue implements SoftDelete.
+func (d DeletedAtMilli) DeletedValue(now time.Time) interface{} {
+	return now.UnixNano() / int64(time.Millisecond)
+}
+
+//NotDeleted implements SoftDelete.
+func (d DeletedAtMilli) NotDeleted(column string) *Expr {
+	return &Expr{Q: "(" + column + " IS NULL OR " + column + " = ?)", Args: []interface{}{int64(0)}}
+}
@@ -3,6 +3,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
@@ -55,12 +56,32 @@ const (
 	HookBeforeDelete        = "ngorm:before_delete_hook"
 	AfterDelete             = "ngorm:after_delete"
 	HookAfterDelete         = "ngorm:after_delete_hook"
+	HookDeleteCascade       = "ngorm:delete_cascade"
+	HookDeleteExec          = "ngorm:delete_exec"
+	HookModelBeforeCreate   = "ngorm:model_before_create"
+	HookModelAfterCreate    = "ngorm:model_after_create"
+	HookModelBeforeUpdate   = "ngorm:model_before_update"
+	HookModelAfterUpdate    = "ngorm:model_after_update"
+	HookModelBeforeDelete   = "ngorm:model_before_delete"
+	HookModelAfterDelete    = "ngorm:model_after_delete"
+	HookModelAfterFind      = "ngorm:model_after_find"
+	HookValidate            = "ngorm:validate"
+	HookReloadDefaults      = "ngorm:reload_defaults"
+	HookTrackChanges        = "ngorm:track_changes"
 	Delete                  = "ngorm:delete"
 	DeleteSQL               = "ngorm:delete_sql"
 	SaveAssociations        = "ngorm:save_associations"
+	AssociationAutoCreate   = "ngorm:association_autocreate"
+	AssociationAutoUpdate   = "ngorm:association_autoupdate"
+	AssociationSaveRefs     = "ngorm:association_save_reference"
 	Preload                 = "ngorm:preload"
 	HookSaveAfterAss        = "ngorm:save_after_association"
 	AssociationSource       = "ngorm:association:source"
+	IfMatch                 = "ngorm:if_match"
+	AllowGlobalDelete       = "ngorm:allow_global_delete"
+	JoinPreload             = "ngorm:join_preload"
+	AutoPreload             = "ngorm:auto_preload"
+	AutoPreloadPath         = "ngorm:auto_preload_path"
 )
 
 //Model defines common fields that are used for defining SQL Tables. This is a
@@ -94,6 +115,15 @@ type Struct struct {
 	StructFields     []*StructField
 	ModelType        reflect.Type
 	DefaultTableName string
+
+	// ProjectionOf is the model the struct loads a subset of the columns of,
+	// nil unless the struct is registered as a projection.
+	ProjectionOf reflect.Type
+
+	// ReadOnly is true for the models which can't be written, like the ones
+	// mapped to views or replicated tables. It is set with the READONLY tag of
+	// a blank field or with scope.RegisterReadOnly.
+	ReadOnly bool
 }
 
 // StructField model field's struct definition
@@ -152,6 +182,17 @@ type Relationship struct {
 	AssociationForeignFieldNames []string
 	AssociationForeignDBNames    []string
 	JoinTableHandler             *JoinTableHandler
+
+	// OnDelete and OnUpdate are the actions of the foreign key constraint
+	// set with the CONSTRAINT tag, like CASCADE or SET NULL.
+	OnDelete string
+	OnUpdate string
+
+	// Order and Limit are the default order and maximum number of the records
+	// preloaded for each model, set on has_many relationships with the ORDER
+	// and LIMIT tags.
+	Order string
+	Limit int
 }
 
 //ParseTagSetting returns a map[string]string for the tags that are set.
@@ -185,6 +226,39 @@ func (s *SafeStructsMap) Set(value *Struct) {
 	s.v = append(s.v, value)
 }
 
+//Replace safely stores value in place of the stored *Struct of the same
+//model type. Use it to change a *Struct which was already stored, since the
+//stored value can be read concurrently.
+func (s *SafeStructsMap) Replace(value *Struct) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.v {
+		if v.ModelType == value.ModelType {
+			s.v[i] = value
+			return
+		}
+	}
+	s.v = append(s.v, value)
+}
+
+//Modify stores in place of the stored *Struct of the model type key a copy
+//changed by fn. The copy is read, changed and stored under the lock, so
+//concurrent modifications aren't lost. It returns false when nothing is
+//stored for key.
+func (s *SafeStructsMap) Modify(key reflect.Type, fn func(*Struct)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.v {
+		if v.ModelType == key {
+			c := *v
+			fn(&c)
+			s.v[i] = &c
+			return true
+		}
+	}
+	return false
+}
+
 //Get retrieves the value stored with the given key.
 func (s *SafeStructsMap) Get(key reflect.Type) *Struct {
 	s.mu.RLock()
@@ -297,14 +371,20 @@ type Search struct {
 	Omits            []string
 	Orders           []interface{}
 	Preload          []SearchPreload
+	JoinPreload      []string
 	Offset           interface{}
 	Limit            interface{}
 	Group            string
+	GroupExprs       []*Expr
 	TableName        string
 	TableNames       []string
+	Alias            string
+	Timeout          time.Duration
+	ColumnMap        map[string]string
 	Raw              bool
 	Unscoped         bool
 	IgnoreOrderQuery bool
+	Clauses          []SearchClause
 }
 
 //SearchPreload is the preload search condition.
@@ -313,6 +393,13 @@ type SearchPreload struct {
 	Conditions []interface{}
 }
 
+//SearchClause is a custom clause added to the search. The clause is rendered
+//by the builder registered under Name.
+type SearchClause struct {
+	Name  string
+	Value interface{}
+}
+
 //SQLCommon is the interface for SQL database interactions.
 type SQLCommon interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
@@ -323,12 +410,58 @@ type SQLCommon interface {
 	Close() error
 }
 
+//SQLCommonContext is implemented by SQLCommon values executing statements with
+//a context, like *sql.DB and *sql.Tx. Statements are canceled when the context
+//is done.
+type SQLCommonContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+//Result receives the outcome of the statements executed by an operation.
+type Result struct {
+	// RowsAffected is the number of rows inserted, updated, deleted or found.
+	RowsAffected int64
+
+	// LastInsertID is the generated primary key of the last inserted row, it
+	// is zero when the dialect doesn't report it or nothing was inserted.
+	LastInsertID int64
+}
+
 // Expr is SQL expression
 type Expr struct {
 	Q    string
 	Args []interface{}
 }
 
+//Precondition is the ETag an update expects the stored row to have, it is
+//computed from Columns or from all columns when Columns is empty.
+type Precondition struct {
+	ETag    string
+	Columns []string
+}
+
+//SubQuery is a query on Value that is embedded in another statement. The bind
+//variables of the subquery are merged with the ones of the outer statement.
+type SubQuery struct {
+	Search *Search
+	Value  interface{}
+}
+
+//AssociationSaving controls what saving a model does with its associations.
+type AssociationSaving struct {
+	// AutoCreate creates the associations which are new.
+	AutoCreate bool
+
+	// AutoUpdate updates the associations which are already saved.
+	AutoUpdate bool
+
+	// SaveReference saves the references between the model and its saved
+	// associations, that is the foreign keys and the rows of join tables.
+	SaveReference bool
+}
+
 //JoinTableForeignKey info that point to a key to use in join table.
 type JoinTableForeignKey struct {
 	DBName            string
@@ -341,6 +474,26 @@ type JoinTableSource struct {
 	ForeignKeys []JoinTableForeignKey
 }
 
+//DBNames returns the names of the columns of the join table referencing the
+//model.
+func (s JoinTableSource) DBNames() []string {
+	names := make([]string, len(s.ForeignKeys))
+	for i, k := range s.ForeignKeys {
+		names[i] = k.DBName
+	}
+	return names
+}
+
+//AssociationDBNames returns the names of the fields of the model referenced by
+//the join table, in the order of DBNames.
+func (s JoinTableSource) AssociationDBNames() []string {
+	names := make([]string, len(s.ForeignKeys))
+	for i, k := range s.ForeignKeys {
+		names[i] = k.AssociationDBName
+	}
+	return names
+}
+
 // JoinTableHandler default join table handler
 type JoinTableHandler struct {
 	TableName   string          `sql:"-"`
@@ -350,14 +503,21 @@ type JoinTableHandler struct {
 
 type SQLCommonWrapper struct {
 	SQLCommon
-	verbose bool
-	o       io.Writer
+	verbose     bool
+	interpolate bool
+	format      func(string) string
+	o           io.Writer
 }
 
 func (s *SQLCommonWrapper) printQuery(w, q string, args ...interface{}) {
 	if s.o == nil {
 		s.o = os.Stdout
 	}
+	q = s.Format(q)
+	if s.interpolate {
+		fmt.Fprintf(s.o, "ngorm:[%s] /* approximate */ %s\n", w, interpolate(q, args, maxLoggedValue))
+		return
+	}
 	fmt.Fprintf(s.o, "ngorm:[%s] %s \t ==> ARGS %v\n", w, q, args)
 }
 
@@ -381,6 +541,97 @@ func (s *SQLCommonWrapper) QueryRow(query string, args ...interface{}) *sql.Row
 	return s.SQLCommon.QueryRow(query, args...)
 }
 
+//ExecContext is like Exec and executes query with ctx when the wrapped
+//SQLCommon supports it.
+func (s *SQLCommonWrapper) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c, ok := s.SQLCommon.(SQLCommonContext)
+	if !ok {
+		return s.Exec(query, args...)
+	}
+	if s.verbose {
+		s.printQuery("EXEC", query, args...)
+	}
+	return c.ExecContext(ctx, query, args...)
+}
+
+//QueryContext is like Query and executes query with ctx when the wrapped
+//SQLCommon supports it.
+func (s *SQLCommonWrapper) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c, ok := s.SQLCommon.(SQLCommonContext)
+	if !ok {
+		return s.Query(query, args...)
+	}
+	if s.verbose {
+		s.printQuery("QUERY", query, args...)
+	}
+	return c.QueryContext(ctx, query, args...)
+}
+
+//QueryRowContext is like QueryRow and executes query with ctx when the wrapped
+//SQLCommon supports it.
+func (s *SQLCommonWrapper) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	c, ok := s.SQLCommon.(SQLCommonContext)
+	if !ok {
+		return s.QueryRow(query, args...)
+	}
+	if s.verbose {
+		s.printQuery("QUERY", query, args...)
+	}
+	return c.QueryRowContext(ctx, query, args...)
+}
+
+//BeginTx is like Begin and starts the transaction with ctx when the wrapped
+//SQLCommon supports it.
+func (s *SQLCommonWrapper) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	c, ok := s.SQLCommon.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+	})
+	if !ok {
+		return s.Begin()
+	}
+	return c.BeginTx(ctx, opts)
+}
+
 func (s *SQLCommonWrapper) Verbose(b bool) {
 	s.verbose = b
 }
+
+//SetOutput sets where the logged queries and messages are written, os.Stdout
+//by default.
+func (s *SQLCommonWrapper) SetOutput(w io.Writer) {
+	s.o = w
+}
+
+//Printf writes a message formatted like fmt.Printf to the output of s.
+func (s *SQLCommonWrapper) Printf(format string, args ...interface{}) {
+	if s.o == nil {
+		s.o = os.Stdout
+	}
+	fmt.Fprintf(s.o, "ngorm: "+format+"\n", args...)
+}
+
+//Interpolate when set to true, the logged queries have the bind values
+//inlined. The logged query is only an approximation of what is executed, long
+//values are truncated.
+func (s *SQLCommonWrapper) Interpolate(b bool) {
+	s.interpolate = b
+}
+
+//SetFormat sets the function the logged queries are passed through, for
+//instance to pretty print them. nil logs the queries as they are.
+func (s *SQLCommonWrapper) SetFormat(fn func(string) string) {
+	s.format = fn
+}
+
+//Format returns q passed through the function set with SetFormat.
+func (s *SQLCommonWrapper) Format(q string) string {
+	if s.format == nil {
+		return q
+	}
+	return s.format(q)
+}
+
+//Wrap returns a new wrapper around c which shares the settings of s.
+func (s *SQLCommonWrapper) Wrap(c SQLCommon) *SQLCommonWrapper {
+	return &SQLCommonWrapper{SQLCommon: c, verbose: s.verbose, interpolate: s.interpolate, format: s.format, o: s.o}
+}
@@ -0,0 +1,208 @@
+package model
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+//DurationBuckets are the upper bounds of the buckets used by TableTiming.
+//Durations longer than the last bound are counted in an extra bucket.
+var DurationBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// timingSlots is the number of slots the window of Timings is divided into,
+// old observations expire a slot at a time.
+const timingSlots = 10
+
+//TableTiming is the distribution of execution times of an operation on a
+//table.
+type TableTiming struct {
+	Table string
+
+	// Op is the statement kind, one of SELECT, INSERT, UPDATE or DELETE.
+	Op    string
+	Count int64
+	Total time.Duration
+	Max   time.Duration
+
+	// Counts has one entry per bound in DurationBuckets plus one for longer
+	// executions.
+	Counts []int64
+}
+
+//Mean returns the average execution time.
+func (t TableTiming) Mean() time.Duration {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Count)
+}
+
+func (t *TableTiming) observe(d time.Duration) {
+	if t.Counts == nil {
+		t.Counts = make([]int64, len(DurationBuckets)+1)
+	}
+	i := 0
+	for i < len(DurationBuckets) && d > DurationBuckets[i] {
+		i++
+	}
+	t.Counts[i]++
+	t.Count++
+	t.Total += d
+	if d > t.Max {
+		t.Max = d
+	}
+}
+
+func (t *TableTiming) merge(o *TableTiming) {
+	if t.Counts == nil {
+		t.Counts = make([]int64, len(DurationBuckets)+1)
+	}
+	for k, v := range o.Counts {
+		t.Counts[k] += v
+	}
+	t.Count += o.Count
+	t.Total += o.Total
+	if o.Max > t.Max {
+		t.Max = o.Max
+	}
+}
+
+type timingKey struct {
+	table, op string
+}
+
+//Timings aggregates the execution times of statements per table and
+//operation over a sliding window, to find the tables that need indexing
+//without an external APM. It is safe for concurrent use.
+//
+// The time measured is the time taken by the database to execute the
+// statement, reading the rows of a query is not included.
+type Timings struct {
+	// Window is the period covered by Report, the default is five minutes.
+	Window time.Duration
+
+	// Now returns the current time, the default is time.Now.
+	Now func() time.Time
+
+	mu    sync.Mutex
+	slots map[int64]map[timingKey]*TableTiming
+}
+
+func (t *Timings) slot() int64 {
+	w := t.Window
+	if w <= 0 {
+		w = 5 * time.Minute
+	}
+	now := time.Now
+	if t.Now != nil {
+		now = t.Now
+	}
+	return now().UnixNano() / int64(w/timingSlots)
+}
+
+//Observe records that an op statement on table took d.
+func (t *Timings) Observe(table, op string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := t.slot()
+	if t.slots == nil {
+		t.slots = make(map[int64]map[timingKey]*TableTiming)
+	}
+	for k := range t.slots {
+		if k <= cur-timingSlots {
+			delete(t.slots, k)
+		}
+	}
+	s, ok := t.slots[cur]
+	if !ok {
+		s = make(map[timingKey]*TableTiming)
+		t.slots[cur] = s
+	}
+	key := timingKey{table: table, op: op}
+	v, ok := s[key]
+	if !ok {
+		v = &TableTiming{Table: table, Op: op}
+		s[key] = v
+	}
+	v.observe(d)
+}
+
+//Report returns the timings observed within the window, the slowest first
+//that is by descending total time.
+func (t *Timings) Report() []TableTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cur := t.slot()
+	all := make(map[timingKey]*TableTiming)
+	for k, s := range t.slots {
+		if k <= cur-timingSlots {
+			continue
+		}
+		for key, v := range s {
+			m, ok := all[key]
+			if !ok {
+				m = &TableTiming{Table: key.table, Op: key.op}
+				all[key] = m
+			}
+			m.merge(v)
+		}
+	}
+	o := make([]TableTiming, 0, len(all))
+	for _, v := range all {
+		o = append(o, *v)
+	}
+	sort.Slice(o, func(i, j int) bool {
+		if o[i].Total != o[j].Total {
+			return o[i].Total > o[j].Total
+		}
+		if o[i].Table != o[j].Table {
+			return o[i].Table < o[j].Table
+		}
+		return o[i].Op < o[j].Op
+	})
+	return o
+}
+
+//WriteTo writes the report as a text table to w, this can be served as is
+//from a debug endpoint.
+func (t *Timings) WriteTo(w io.Writer) (int64, error) {
+	c := &countWriter{w: w}
+	tw := tabwriter.NewWriter(c, 0, 4, 2, ' ', 0)
+	head := []string{"TABLE", "OP", "COUNT", "TOTAL", "MEAN", "MAX"}
+	for _, b := range DurationBuckets {
+		head = append(head, "<="+b.String())
+	}
+	head = append(head, ">"+DurationBuckets[len(DurationBuckets)-1].String())
+	fmt.Fprintln(tw, strings.Join(head, "\t"))
+	for _, v := range t.Report() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%v\t%v\t%v", v.Table, v.Op, v.Count, v.Total, v.Mean(), v.Max)
+		for _, n := range v.Counts {
+			fmt.Fprintf(tw, "\t%d", n)
+		}
+		fmt.Fprintln(tw)
+	}
+	err := tw.Flush()
+	return c.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	now := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	tm := &Timings{Window: time.Minute, Now: func() time.Time { return now }}
+	tm.Observe("users", "SELECT", 2*time.Millisecond)
+	tm.Observe("users", "SELECT", 20*time.Millisecond)
+	tm.Observe("emails", "INSERT", 50*time.Millisecond)
+	r := tm.Report()
+	if len(r) != 2 {
+		t.Fatalf("expected 2 timings got %v", r)
+	}
+	if r[0].Table != "emails" || r[1].Table != "users" {
+		t.Errorf("expected the slowest table first got %v", r)
+	}
+	u := r[1]
+	if u.Count != 2 || u.Max != 20*time.Millisecond || u.Mean() != 11*time.Millisecond {
+		t.Errorf("unexpected timing %+v", u)
+	}
+	if u.Counts[1] != 1 || u.Counts[2] != 1 {
+		t.Errorf("unexpected distribution %v", u.Counts)
+	}
+
+	now = now.Add(30 * time.Second)
+	tm.Observe("users", "SELECT", time.Second)
+	r = tm.Report()
+	if r[0].Table != "users" || r[0].Count != 3 {
+		t.Errorf("expected users first got %v", r)
+	}
+
+	// the first observations are out of the window
+	now = now.Add(45 * time.Second)
+	r = tm.Report()
+	if len(r) != 1 || r[0].Count != 1 {
+		t.Errorf("expected only the last observation got %v", r)
+	}
+
+	var buf bytes.Buffer
+	n, err := tm.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("expected %d got %d", buf.Len(), n)
+	}
+	if !strings.Contains(buf.String(), "users") || !strings.HasPrefix(buf.String(), "TABLE") {
+		t.Errorf("unexpected report %s", buf.String())
+	}
+}
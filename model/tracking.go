@@ -0,0 +1,33 @@
+package model
+
+//Tracked is embedded in the models whose changes are tracked. The values of
+//their columns are recorded when they are loaded, created or updated, so that
+//Save only updates the columns which changed since and hooks can check them
+//with scope.Changed
+//
+//    type User struct {
+//    	model.Tracked
+//    	ID    int64
+//    	Name  string
+//    	Email string
+//    }
+type Tracked struct {
+	original map[string]interface{}
+}
+
+//Tracker is implemented by the models embedding Tracked.
+type Tracker interface {
+	Original() map[string]interface{}
+	SetOriginal(values map[string]interface{})
+}
+
+//Original returns the recorded values of the columns by column name, it is nil
+//until the model is loaded, created or updated.
+func (t *Tracked) Original() map[string]interface{} {
+	return t.original
+}
+
+//SetOriginal records values as the values of the columns.
+func (t *Tracked) SetOriginal(values map[string]interface{}) {
+	t.original = values
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/ngorm/ngorm/errmsg"
+)
+
+//Tx is an ongoing database transaction. It implements SQLCommon so it can be
+//used in place of the database handle, statements executed through it are part
+//of the transaction.
+//
+// Tx keeps track of the tables that were modified so they can be reported once
+// the transaction is committed.
+type Tx struct {
+	*sql.Tx
+
+	mu            sync.Mutex
+	tables        []string
+	afterCommit   []func()
+	afterRollback []func()
+}
+
+//Begin returns errmsg.ErrInvalidTransaction because nested transactions are not
+//supported.
+func (t *Tx) Begin() (*sql.Tx, error) {
+	return nil, errmsg.ErrInvalidTransaction
+}
+
+//Close does nothing, the transaction is finished with Commit or Rollback.
+func (t *Tx) Close() error {
+	return nil
+}
+
+//Touch records that table was modified in this transaction.
+func (t *Tx) Touch(table string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, v := range t.tables {
+		if v == table {
+			return
+		}
+	}
+	t.tables = append(t.tables, table)
+}
+
+//Tables returns the names of tables modified in this transaction in the order
+//they were first touched.
+func (t *Tx) Tables() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o := make([]string, len(t.tables))
+	copy(o, t.tables)
+	return o
+}
+
+//AfterCommit registers fn to be called once the transaction is committed.
+func (t *Tx) AfterCommit(fn func()) {
+	t.mu.Lock()
+	t.afterCommit = append(t.afterCommit, fn)
+	t.mu.Unlock()
+}
+
+//AfterRollback registers fn to be called once the transaction is rolled back.
+func (t *Tx) AfterRollback(fn func()) {
+	t.mu.Lock()
+	t.afterRollback = append(t.afterRollback, fn)
+	t.mu.Unlock()
+}
+
+//Committed calls the functions registered with AfterCommit in the order they
+//were registered.
+func (t *Tx) Committed() {
+	t.mu.Lock()
+	fns := t.afterCommit
+	t.afterCommit, t.afterRollback = nil, nil
+	t.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+//RolledBack calls the functions registered with AfterRollback in the order
+//they were registered.
+func (t *Tx) RolledBack() {
+	t.mu.Lock()
+	fns := t.afterRollback
+	t.afterCommit, t.afterRollback = nil, nil
+	t.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+//Listeners is a registry of functions that are notified with the names of the
+//tables touched by committed statements. This allows things like external
+//caches to be invalidated only after the changes are visible.
+type Listeners struct {
+	mu  sync.RWMutex
+	fns []func(tables []string)
+}
+
+//Add registers fn.
+func (l *Listeners) Add(fn func(tables []string)) {
+	l.mu.Lock()
+	l.fns = append(l.fns, fn)
+	l.mu.Unlock()
+}
+
+//Notify calls all registered functions with tables. Nothing is called when
+//tables is empty.
+func (l *Listeners) Notify(tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+	l.mu.RLock()
+	fns := l.fns
+	l.mu.RUnlock()
+	for _, fn := range fns {
+		fn(tables)
+	}
+}
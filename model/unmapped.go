@@ -0,0 +1,19 @@
+package model
+
+//Unmapped is what happens when the result of a query has columns which don't
+//match any field of the destination struct, which usually is a typo in a
+//Select or a schema that drifted from the models.
+type Unmapped int
+
+// Supported Unmapped values
+const (
+	// UnmappedIgnore ignores the unmapped columns, this is the default.
+	UnmappedIgnore Unmapped = iota
+
+	// UnmappedLog logs the unmapped columns of the queries returning rows,
+	// the columns are only known once there is a row to scan.
+	UnmappedLog
+
+	// UnmappedStrict fails the query with *errmsg.UnmappedColumnsError.
+	UnmappedStrict
+)
@@ -23,6 +23,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"time"
@@ -33,7 +34,6 @@ import (
 	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/hooks"
 	"github.com/ngorm/ngorm/model"
-	"github.com/ngorm/ngorm/regexes"
 	"github.com/ngorm/ngorm/scope"
 	"github.com/ngorm/ngorm/search"
 	"github.com/ngorm/ngorm/util"
@@ -56,6 +56,18 @@ type DB struct {
 	e             *engine.Engine
 	err           error
 	now           func() time.Time
+	tx            *model.Tx
+	listeners     *model.Listeners
+	analyzer      *model.Analyzer
+	plans         *model.PlanCache
+	timings       *model.Timings
+	unmapped      model.Unmapped
+	assocSaving   *model.AssociationSaving
+	noForeignKeys bool
+	autoPreload   bool
+	preloadBatch  int
+	preloadConc   bool
+	callbacks     *engine.Callbacks
 }
 
 func (db *DB) clone() *DB {
@@ -66,7 +78,19 @@ func (db *DB) clone() *DB {
 		cancel:        db.cancel,
 		singularTable: db.singularTable,
 		structMap:     db.structMap,
-		now:           time.Now,
+		now:           db.now,
+		tx:            db.tx,
+		listeners:     db.listeners,
+		analyzer:      db.analyzer,
+		plans:         db.plans,
+		timings:       db.timings,
+		unmapped:      db.unmapped,
+		assocSaving:   db.assocSaving,
+		noForeignKeys: db.noForeignKeys,
+		autoPreload:   db.autoPreload,
+		preloadBatch:  db.preloadBatch,
+		preloadConc:   db.preloadConc,
+		callbacks:     db.callbacks,
 		e:             db.NewEngine(),
 	}
 }
@@ -112,6 +136,9 @@ func OpenWithOpener(opener Opener, dialect string, args ...interface{}) (*DB, er
 		structMap: model.NewStructsMap(),
 		ctx:       ctx,
 		cancel:    cancel,
+		listeners: &model.Listeners{},
+		now:       time.Now,
+		callbacks: hooks.DefaultCallbacks(),
 	}, nil
 }
 
@@ -123,6 +150,17 @@ func (db *DB) NewEngine() *engine.Engine {
 	e.Ctx = db.ctx
 	e.Dialect = db.dialect
 	e.SQLDB = db.db
+	e.Tx = db.tx
+	e.Listeners = db.listeners
+	e.Analyzer = db.analyzer
+	e.Plans = db.plans
+	e.Timings = db.timings
+	e.Unmapped = db.unmapped
+	e.AssociationSaving = db.assocSaving
+	e.AutoPreload = db.autoPreload
+	e.PreloadBatchSize = db.preloadBatch
+	e.PreloadConcurrent = db.preloadConc
+	e.Callbacks = db.callbacks
 	e.Now = db.now
 	return e
 }
@@ -136,7 +174,7 @@ func (db *DB) CreateTable(models ...interface{}) (sql.Result, error) {
 	if isQL(db) {
 		return db.ExecTx(query.Q, query.Args...)
 	}
-	return db.SQLCommon().Exec(query.Q, query.Args...)
+	return db.exec(query.Q, query.Args...)
 
 }
 
@@ -148,27 +186,167 @@ func (db *DB) Verbose(b bool) {
 	db.db.Verbose(b)
 }
 
+//LogOutput sets where the queries printed in verbose mode and the unmapped
+//columns logged with model.UnmappedLog are written, os.Stdout by default.
+func (db *DB) LogOutput(w io.Writer) {
+	db.db.SetOutput(w)
+}
+
+//WithContext returns a copy of db which executes queries with ctx. The context
+//reaches every statement of the operations, including the ones saving the
+//associations and preloading, and the hooks through engine.Context.
+//
+// Transactions started with BeginTx are bound to the context, they are rolled
+// back when it is canceled.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	c := db.clone()
+	c.ctx = ctx
+	c.e.Ctx = ctx
+	return c
+}
+
+//Analyze enables a, which records the sizes of result sets and reports N+1
+//queries. This is meant to be used during development, pass nil to disable.
+//
+//    db.Analyze(&model.Analyzer{Threshold: 5})
+//    ctx := model.WithQueryCounts(r.Context())
+//    db.WithContext(ctx).Find(&users)
+func (db *DB) Analyze(a *model.Analyzer) {
+	db.analyzer = a
+}
+
+//RecordTimings records the execution time of every statement per table in t,
+//pass nil to disable. The slowest tables can be served from a debug endpoint
+//
+//    timings := &model.Timings{Window: 10 * time.Minute}
+//    db.RecordTimings(timings)
+//    http.HandleFunc("/debug/tables", func(w http.ResponseWriter, r *http.Request) {
+//        timings.WriteTo(w)
+//    })
+func (db *DB) RecordTimings(t *model.Timings) {
+	db.timings = t
+}
+
+//CachePlans enables caching of the SQL generated for queries, holding at most
+//size statements. Queries with the same model and search structure reuse the
+//cached SQL and only bind their arguments. Pass 0 to disable the cache.
+//
+// Only searches made of string conditions with plain arguments are cached, and
+// not the ones on models with the conditions of plugins like hooks.Tenancy.
+func (db *DB) CachePlans(size int) {
+	if size <= 0 {
+		db.plans = nil
+		return
+	}
+	db.plans = model.NewPlanCache(size)
+}
+
+//PlanCache returns the cache enabled with CachePlans or nil.
+func (db *DB) PlanCache() *model.PlanCache {
+	return db.plans
+}
+
+//UnmappedColumns sets what happens when the result of a query has columns
+//which don't match any field of the destination struct. They are ignored by
+//default, model.UnmappedLog logs them to the output set with LogOutput and
+//model.UnmappedStrict fails the query with *errmsg.UnmappedColumnsError.
+//
+// The columns are checked on the first row, queries returning no rows aren't
+// checked.
+func (db *DB) UnmappedColumns(mode model.Unmapped) {
+	db.unmapped = mode
+}
+
+//LogInterpolated when set to true, queries printed in verbose mode have the
+//bind values inlined so they can be copied into a SQL console. The printed
+//queries are marked as approximate since values are quoted by ngorm and not by
+//the database, and long values are truncated.
+func (db *DB) LogInterpolated(b bool) {
+	db.db.Interpolate(b)
+}
+
+//FormatSQL when set to true, queries printed in verbose mode and the
+//statements returned without being executed by FirstSQL, FindSQL, CreateSQL,
+//UpdatesSQL, DeleteSQL and the like are pretty printed with builder.Format,
+//a clause per line. This makes statements with many joins reviewable during
+//development.
+func (db *DB) FormatSQL(b bool) {
+	if b {
+		db.db.SetFormat(builder.Format)
+	} else {
+		db.db.SetFormat(nil)
+	}
+}
+
+// statement returns the statement q with args as returned by the methods
+// building SQL without executing it, formatted when enabled with FormatSQL.
+func (db *DB) statement(q string, args []interface{}) *model.Expr {
+	return &model.Expr{Q: db.db.Format(q), Args: args}
+}
+
 //ExecTx wraps the query execution in a Transaction. This ensure all operations
-//are Rolled back in case the execution fails.
+//are Rolled back in case the execution fails. The statement goes through the
+//statement hooks and the recorded timings like the ones built by ngorm.
 func (db *DB) ExecTx(query string, args ...interface{}) (sql.Result, error) {
-	tx, err := db.db.Begin()
-	if err != nil {
-		return nil, err
+	e := db.NewEngine()
+	defer engine.Put(e)
+	return hooks.ExecRawTx(e, query, args...)
+}
+
+// exec executes query with args like the statements built by ngorm, with the
+// context of db, the statement hooks and the recorded timings.
+func (db *DB) exec(query string, args ...interface{}) (sql.Result, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	return hooks.ExecRaw(e, query, args...)
+}
+
+//ExecScript executes the statements of script, separated by semicolons, in
+//order. This is meant for schema files and fixtures
+//
+//    err := db.ExecScript(`
+//        CREATE TABLE users (id int, name string);
+//        INSERT INTO users VALUES (1, "gernest");
+//    `)
+//
+// All the statements are executed in a single transaction, or in the
+// transaction of db when there is one, which is also what ql requires for
+// statements modifying the database. The BEGIN TRANSACTION and COMMIT
+// statements of the script, like the ones in the output of CreateTableSQL with
+// ql, are skipped. The statements executed before a failing statement are
+// rolled back.
+func (db *DB) ExecScript(script string) error {
+	stmts := builder.SplitStatements(db.dialect, script)
+	tx := db
+	if db.tx == nil {
+		var err error
+		tx, err = db.BeginTx()
+		if err != nil {
+			return err
+		}
 	}
-	r, err := tx.Exec(query, args...)
-	if err != nil {
-		_ = tx.Rollback()
-		return nil, err
+	for i, q := range stmts {
+		switch strings.ToUpper(strings.Join(strings.Fields(q), " ")) {
+		case "BEGIN", "BEGIN TRANSACTION", "START TRANSACTION", "COMMIT":
+			continue
+		}
+		if _, err := tx.exec(q); err != nil {
+			if tx != db {
+				_ = tx.Rollback()
+			}
+			return fmt.Errorf("ngorm: statement %d of the script: %v", i+1, err)
+		}
 	}
-	err = tx.Commit()
-	if err != nil {
-		return nil, err
+	if tx != db {
+		return tx.Commit()
 	}
-	return r, nil
+	return nil
 }
 
 //CreateTableSQL return the sql query for creating tables for all the given
-//models. The queries are wrapped in a TRANSACTION block.
+//models. The queries are wrapped in a TRANSACTION block. The foreign key
+//constraints of the relationships are added after the tables, see
+//MigrateForeignKeys.
 func (db *DB) CreateTableSQL(models ...interface{}) (*model.Expr, error) {
 	var scopeVars map[string]interface{}
 	if db.e != nil {
@@ -196,6 +374,13 @@ func (db *DB) CreateTableSQL(models ...interface{}) (*model.Expr, error) {
 			}
 		}
 	}
+	stmts, err := db.migrationConstraintsSQL(models)
+	if err != nil {
+		return nil, err
+	}
+	for _, sql := range stmts {
+		_, _ = buf.WriteString("\t" + sql + "\n")
+	}
 	if isQL(db) {
 		_, _ = buf.WriteString("COMMIT;")
 	}
@@ -242,7 +427,7 @@ func (db *DB) DropTable(models ...interface{}) (sql.Result, error) {
 	if isQL(db) {
 		return db.ExecTx(query.Q, query.Args...)
 	}
-	return db.SQLCommon().Exec(query.Q, query.Args...)
+	return db.exec(query.Q, query.Args...)
 }
 
 //Automigrate creates tables that map to models if the tables don't exist yet in
@@ -256,10 +441,12 @@ func (db *DB) Automigrate(models ...interface{}) (sql.Result, error) {
 	if isQL(db) {
 		return db.ExecTx(query.Q, query.Args...)
 	}
-	return db.SQLCommon().Exec(query.Q, query.Args...)
+	return db.exec(query.Q, query.Args...)
 }
 
-//AutomigrateSQL generates sql query for running migrations on models.
+//AutomigrateSQL generates sql query for running migrations on models. The
+//missing foreign key constraints of the relationships are added after the
+//tables, see MigrateForeignKeys.
 func (db *DB) AutomigrateSQL(models ...interface{}) (*model.Expr, error) {
 	// var buf bytes.Buffer
 	buf := util.B.Get()
@@ -301,6 +488,13 @@ func (db *DB) AutomigrateSQL(models ...interface{}) (*model.Expr, error) {
 			}
 		}
 	}
+	stmts, err := db.migrationConstraintsSQL(models)
+	if err != nil {
+		return nil, err
+	}
+	for _, sql := range stmts {
+		buf.WriteString("\t" + sql + "\n")
+	}
 	if isQL(db) {
 		buf.WriteString("COMMIT;")
 	}
@@ -318,29 +512,186 @@ func (db *DB) Close() error {
 //
 // You can hijack the execution of the generated SQL by overriding
 // model.HookCreateExec hook.
+//
+// The inserted columns can be limited with Select or Omit, leaving the other
+// columns to their database defaults
+//
+//    db.Omit("CreatedAt").Create(&user)
+//    db.Select("Name", "Age").Create(&user)
+//
+// Blank fields with the DEFAULT tag are left out of the insert too, unless
+// they are selected, and the values computed by the database are read back
+// into value once it is inserted
+//
+//    type Ticket struct {
+//    	ID       int64
+//    	Priority int `gorm:"DEFAULT:3"`
+//    }
+//
+// The associations held by the fields of value are saved too, see
+// SkipAssociations. New associations are created and the others updated, all
+// in a single transaction, or in the transaction of db when there is one.
+//
+// The BeforeCreate and AfterCreate methods of value are called before and after
+// the insert, see engine.BeforeCreator and engine.AfterCreator. Models with an
+// AfterCreate method are created in a transaction too, so that an error of the
+// method rolls back the insert. Models implementing engine.Validator, or with
+// a validator registered with hooks.RegisterValidator, are validated after
+// BeforeCreate and aren't inserted when the validation fails.
+//
+// value can also be a map[string]interface{} of column names to values, to
+// insert into a table without a matching struct. The table is set with Table
+// or Model and must have all the columns of the map
+//
+//    err := db.Table("audit_logs").Create(map[string]interface{}{
+//        "action": "login",
+//        "user_id": 42,
+//    })
 func (db *DB) Create(value interface{}) error {
-	e := db.NewEngine()
-	defer engine.Put(e)
-	e.Scope.ContextValue(value)
-	return hooks.Create(e)
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	if m, ok := value.(map[string]interface{}); ok {
+		return hooks.CreateMap(db.e, m)
+	}
+	db.e.Scope.ContextValue(value)
+	if savesAssociations(db.e) || hooks.Implements(value, (*engine.AfterCreator)(nil)) {
+		return db.batchTx(hooks.Create)
+	}
+	return hooks.Create(db.e)
+}
+
+// savesAssociations returns true when saving the value of e saves some of its
+// associations too, which is done in a single transaction.
+func savesAssociations(e *engine.Engine) bool {
+	if !scope.ShouldSaveAssociation(e) {
+		return false
+	}
+	fds, err := scope.Fields(e, e.Scope.Value)
+	if err != nil {
+		return false
+	}
+	for _, f := range fds {
+		if ok, _ := scope.SaveFieldAsAssociation(e, f); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//SetAssociationSaving sets what saving models does with their associations
+//by default, for all the operations of db. The SAVE_ASSOCIATIONS,
+//ASSOCIATION_AUTOCREATE, ASSOCIATION_AUTOUPDATE and ASSOCIATION_SAVE_REFERENCE
+//tags of the fields and the settings of a single call take precedence, see
+//scope.AssociationSaving
+//
+//    // Only link the associations which are already saved.
+//    db.SetAssociationSaving(model.AssociationSaving{SaveReference: true})
+func (db *DB) SetAssociationSaving(s model.AssociationSaving) {
+	db.assocSaving = &s
+	if db.e != nil {
+		db.e.AssociationSaving = db.assocSaving
+	}
+}
+
+//SkipAssociations disables saving the associations of the model with the
+//following Create, Save or Update, only the model itself is saved.
+//
+//    db.SkipAssociations().Create(&user) // user.Emails aren't inserted
+func (db *DB) SkipAssociations() *DB {
+	return db.Set(model.SaveAssociations, false)
+}
+
+//CreateInBatches inserts the rows of the slice values, which is a slice of
+//structs or of pointers to structs, with multi-row INSERT statements of at
+//most size rows each. A size of zero or less inserts all the rows with a
+//single statement.
+//
+//    users := []User{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+//    err := db.CreateInBatches(&users, 100)
+//
+// The statements are executed in a single transaction, or in the transaction
+// of db when there is one. Auto increment ids are set back on the rows on
+// dialects which report them, see dialects.BatchInsertIDs. Unlike Create,
+// associations are not saved.
+func (db *DB) CreateInBatches(values interface{}, size int) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(values)
+	return db.batchTx(func(e *engine.Engine) error {
+		return hooks.CreateBatch(e, size)
+	})
+}
+
+//BulkUpdate updates the rows of the slice values, which is a slice of structs
+//or of pointers to structs, matching them by primary key. Only columns are
+//updated, or all the fields but the primary key when there are none. Each
+//statement updates many rows using CASE expressions,
+//
+//    UPDATE users SET name = CASE id WHEN 1 THEN 'a' WHEN 2 THEN 'b' ELSE name END
+//    WHERE id IN (1, 2)
+//
+// On dialects without CASE expressions, like ql, the rows are updated one at a
+// time. The statements are executed in a single transaction, or in the
+// transaction of db when there is one. UpdatedAt is set on all the rows, hooks
+// and associations are skipped.
+func (db *DB) BulkUpdate(values interface{}, columns ...string) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(values)
+	return db.batchTx(func(e *engine.Engine) error {
+		return hooks.UpdateBatch(e, columns)
+	})
+}
+
+//BulkUpdateSQL returns the statements BulkUpdate executes for values.
+func (db *DB) BulkUpdateSQL(values interface{}, columns ...string) ([]*model.Expr, error) {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(values)
+	return hooks.UpdateBatchSQL(db.e, columns)
+}
+
+// batchTx calls fn with the engine of db in a transaction, or in the
+// transaction of db when there is one.
+func (db *DB) batchTx(fn func(*engine.Engine) error) error {
+	if db.tx != nil {
+		return fn(db.e)
+	}
+	tx, err := db.BeginTx()
+	if err != nil {
+		return err
+	}
+	db.e.SQLDB = tx.db
+	db.e.Tx = tx.tx
+	err = fn(db.e)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 //CreateSQL generates SQl query for creating a new record/records for value.
 // The end query is wrapped under for ql dialectTRANSACTION block.
 func (db *DB) CreateSQL(value interface{}) (*model.Expr, error) {
-	var e *engine.Engine
-	if db.e != nil {
-		e = db.e
-	} else {
-		e = db.NewEngine()
+	if db.e == nil {
+		db.e = db.NewEngine()
 	}
-	defer engine.Put(e)
-	e.Scope.ContextValue(value)
-	err := hooks.CreateSQL(e)
+	defer db.recycle()
+	db.e.Scope.ContextValue(value)
+	err := hooks.CreateSQL(db.e)
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: e.Scope.SQL, Args: e.Scope.SQLVars}, nil
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
 }
 
 //Dialect return the dialect that is used by DB
@@ -362,19 +713,34 @@ func (db *DB) SaveSQL(value interface{}) (*model.Expr, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: e.Scope.SQL, Args: e.Scope.SQLVars}, nil
+	return db.statement(e.Scope.SQL, e.Scope.SQLVars), nil
 }
 
-// Save update value in database, if the value doesn't have primary key, will insert it
+//Save inserts value when it is new, that is when its primary key is blank, and
+//otherwise updates all its fields, blank ones included, in the row matching the
+//primary key.
+//
+//    user := User{Name: "gernest"}
+//    db.Save(&user) // INSERT, user.ID is set
+//    user.Name = ""
+//    db.Save(&user) // UPDATE users SET name = '' ... WHERE id = 1
+//
+// The hooks of Create or Update run accordingly. Select and Omit restrict the
+// updated columns. The associations are saved like with Create.
+//
+// Models embedding model.Tracked only update the columns which changed since
+// they were loaded or last saved, nothing is executed when none changed.
 func (db *DB) Save(value interface{}) error {
-	e := db.NewEngine()
-	defer engine.Put(e)
-	e.Scope.ContextValue(value)
-	field, _ := scope.PrimaryField(e, value)
-	if field == nil || field.IsBlank {
-		return db.Create(value)
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(value)
+	if savesAssociations(db.e) || hooks.Implements(value, (*engine.AfterCreator)(nil)) ||
+		hooks.Implements(value, (*engine.AfterUpdater)(nil)) {
+		return db.batchTx(hooks.Save)
 	}
-	return hooks.Update(e)
+	return hooks.Save(db.e)
 }
 
 //Model sets value as the database model. This model will be used for future
@@ -407,9 +773,40 @@ func (db *DB) Updates(values interface{}, ignoreProtectedAttrs ...bool) error {
 	}
 	db.e.Scope.Set(model.IgnoreProtectedAttrs, ignore)
 	db.e.Scope.Set(model.UpdateInterface, values)
+	if hooks.Implements(db.e.Scope.Value, (*engine.AfterUpdater)(nil)) {
+		return db.batchTx(hooks.Update)
+	}
 	return hooks.Update(db.e)
 }
 
+//ETag returns a strong HTTP entity tag for value, which must be a struct that
+//was read from the database. The tag is computed from columns, or from all
+//columns when none is given, and changes whenever one of them is modified.
+func (db *DB) ETag(value interface{}, columns ...string) (string, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	return scope.ETag(e, value, columns...)
+}
+
+//IfMatch guards the next Update or Updates with etag, which is usually the
+//value of the If-Match header of the request. The update fails with
+//errmsg.ErrPreconditionFailed when the ETag of the stored row, computed from
+//columns, doesn't match or when the row doesn't exist. A "*" etag only
+//requires the row to exist.
+//
+//	err := db.Model(&user).IfMatch(r.Header.Get("If-Match")).Update("name", name)
+//
+// MySQL reports no affected rows when the values are not changed, use the
+// clientFoundRows=true connection parameter otherwise unchanged updates fail
+// with errmsg.ErrPreconditionFailed.
+func (db *DB) IfMatch(etag string, columns ...string) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	db.e.Scope.Set(model.IfMatch, &model.Precondition{ETag: etag, Columns: columns})
+	return db
+}
+
 //UpdateSQL generates SQL that will be executed when you use db.Update
 func (db *DB) UpdateSQL(attrs ...interface{}) (*model.Expr, error) {
 	return db.UpdatesSQL(util.ToSearchableMap(attrs), true)
@@ -431,7 +828,7 @@ func (db *DB) UpdatesSQL(values interface{}, ignoreProtectedAttrs ...bool) (*mod
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: db.e.Scope.SQL, Args: db.e.Scope.SQLVars}, nil
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
 }
 
 //Set sets scope key to value.
@@ -482,7 +879,7 @@ func (db *DB) First(out interface{}, where ...interface{}) error {
 	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
+	db.setDestination(out)
 	return hooks.Query(db.e)
 }
 
@@ -490,22 +887,24 @@ func (db *DB) First(out interface{}, where ...interface{}) error {
 //key.
 func (db *DB) FirstSQL(out interface{}, where ...interface{}) (*model.Expr, error) {
 	db.Set(model.OrderByPK, "ASC")
+	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
+	db.setDestination(out)
 	err := hooks.QuerySQL(db.e)
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: db.e.Scope.SQL, Args: db.e.Scope.SQLVars}, nil
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
 }
 
 //Last finds the last record and order by primary key.
 func (db *DB) Last(out interface{}, where ...interface{}) error {
 	db.Set(model.OrderByPK, "DESC")
+	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
+	db.setDestination(out)
 	return hooks.Query(db.e)
 }
 
@@ -513,14 +912,45 @@ func (db *DB) Last(out interface{}, where ...interface{}) error {
 //key.
 func (db *DB) LastSQL(out interface{}, where ...interface{}) (*model.Expr, error) {
 	db.Set(model.OrderByPK, "DESC")
+	defer db.recycle()
 	search.Inline(db.e, where...)
 	search.Limit(db.e, 1)
-	db.e.Scope.ContextValue(out)
+	db.setDestination(out)
 	err := hooks.QuerySQL(db.e)
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: db.e.Scope.SQL, Args: db.e.Scope.SQLVars}, nil
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
+}
+
+//Take finds a record matching the given conditions without any ordering. Like
+//First and Last, where can be a primary key value and errmsg.ErrRecordNotFound
+//is returned when no record matches.
+func (db *DB) Take(out interface{}, where ...interface{}) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	search.Inline(db.e, where...)
+	search.Limit(db.e, 1)
+	db.setDestination(out)
+	return hooks.Query(db.e)
+}
+
+//TakeSQL returns SQL query for retrieving a record without any ordering.
+func (db *DB) TakeSQL(out interface{}, where ...interface{}) (*model.Expr, error) {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	search.Inline(db.e, where...)
+	search.Limit(db.e, 1)
+	db.setDestination(out)
+	err := hooks.QuerySQL(db.e)
+	if err != nil {
+		return nil, err
+	}
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
 }
 
 // Limit specify the number of records to be retrieved
@@ -539,12 +969,23 @@ func (db *DB) FindSQL(out interface{}, where ...interface{}) (*model.Expr, error
 	}
 	defer db.recycle()
 	search.Inline(db.e, where...)
-	db.e.Scope.ContextValue(out)
+	db.setDestination(out)
 	err := hooks.QuerySQL(db.e)
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: db.e.Scope.SQL, Args: db.e.Scope.SQLVars}, nil
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
+}
+
+// setDestination sets out as the value the query results are scanned into.
+// Maps and scalars are only a destination, the model is the one given with
+// Model or the table the one given with Table.
+func (db *DB) setDestination(out interface{}) {
+	if hooks.IsMapDestination(out) || hooks.IsScalarDestination(out) || hooks.IsColumnDestination(out) {
+		db.e.Scope.Set(model.QueryDestination, out)
+		return
+	}
+	db.e.Scope.ContextValue(out)
 }
 
 // Find find records that match given conditions
@@ -554,7 +995,30 @@ func (db *DB) Find(out interface{}, where ...interface{}) error {
 	}
 	defer db.recycle()
 	search.Inline(db.e, where...)
-	db.e.Scope.ContextValue(out)
+	db.setDestination(out)
+	return hooks.Query(db.e)
+}
+
+//Scan executes the query built so far and scans the result into dest, which
+//can be a struct, a slice, a map, a scalar receiving a single column or a
+//slice of scalars receiving a single column of all the rows. Unlike Find, dest
+//doesn't need to be the model set with Model.
+//
+//    var name string
+//    db.Model(&User{}).Select("name").Where("id = ?", 10).Scan(&name)
+//
+//    var ids []int64
+//    db.Model(&User{}).Select("id").Where("age > ?", 18).Scan(&ids)
+func (db *DB) Scan(dest interface{}) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	if db.e.Scope.Value == nil {
+		db.setDestination(dest)
+	} else {
+		db.e.Scope.Set(model.QueryDestination, dest)
+	}
 	return hooks.Query(db.e)
 }
 
@@ -576,8 +1040,11 @@ func (db *DB) Assign(attrs ...interface{}) *DB {
 	return db
 }
 
-// Group specify the group method on the find
-func (db *DB) Group(query string) *DB {
+// Group specify the group method on the find. Calling Group multiple times
+// groups by all the given columns. Column names are validated and quoted, use
+// *model.Expr to group by expressions.
+//    db.Group("name, age").Group(&model.Expr{Q: "length(email)"})
+func (db *DB) Group(query interface{}) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
@@ -603,6 +1070,55 @@ func (db *DB) Joins(query string, args ...interface{}) *DB {
 	return db
 }
 
+//Alias sets the alias of the table of the model, the table is selected AS
+//alias and the columns in conditions are qualified with it. Together with
+//JoinAs this joins a table with itself
+//
+//    db.Model(&User{}).Alias("u1").
+//        JoinAs(&User{}, "u2", "u2.email = u1.email AND u2.id <> u1.id").
+//        Select("u1.*").Find(&duplicates)
+func (db *DB) Alias(alias string) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Alias(db.e, alias)
+	return db
+}
+
+//JoinAs joins the table of value, a model or a table name, under alias with
+//the condition on. The table and the alias are quoted.
+func (db *DB) JoinAs(value interface{}, alias, on string, args ...interface{}) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	table, ok := value.(string)
+	if !ok {
+		e := db.NewEngine()
+		table = scope.TableName(e, value)
+		engine.Put(e)
+	}
+	q := fmt.Sprintf("JOIN %s AS %s ON %s", scope.Quote(db.e, table), scope.Quote(db.e, alias), on)
+	search.Join(db.e, q, args...)
+	return db
+}
+
+//From adds tables the conditions can reference besides the table of the model,
+//for instance to update or delete rows depending on the rows of another table
+//
+//    db.Model(&Order{}).From("customers").
+//        Where("orders.customer_id = customers.id AND customers.banned = ?", true).
+//        Update("status", "cancelled")
+//
+// The statements are translated for the dialect, UPDATE ... FROM and
+// DELETE ... USING on postgres or multiple table statements on mysql.
+func (db *DB) From(tables ...string) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.From(db.e, tables...)
+	return db
+}
+
 // Offset specify the number of records to skip before starting to return the records
 func (db *DB) Offset(offset interface{}) *DB {
 	if db.e == nil {
@@ -616,6 +1132,9 @@ func (db *DB) Offset(offset interface{}) *DB {
 // `true` to overwrite defined conditions
 //     db.Order("name DESC")
 //     db.Order("name DESC", true) // reorder
+//
+// value is a string, a *model.Expr or a clause.Expression like the ones
+// returned by types.OrderByDistance.
 func (db *DB) Order(value interface{}, reorder ...bool) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
@@ -673,36 +1192,169 @@ func (db *DB) Where(query interface{}, args ...interface{}) *DB {
 	return db
 }
 
-// FirstOrInit find first matched record or initialize a new one with given
-//conditions (only works with struct, map conditions)
-func (db *DB) FirstOrInit(out interface{}, where ...interface{}) error {
+// WhereStruct is like Where with a struct condition, except that fields listed
+// in include are used even when they hold zero values.
+//    db.WhereStruct(&User{Name: "gernest", Age: 0}, "Age").Find(&users)
+func (db *DB) WhereStruct(value interface{}, include ...string) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
-	defer db.recycle()
-	db.e.Scope.ContextValue(out)
-	err := db.Begin().First(out, where...)
-	if err != nil {
-		if err != errmsg.ErrRecordNotFound {
-			return err
-		}
-		search.Inline(db.e, where...)
-		scope.Initialize(db.e)
-		return nil
-	}
-	_, _ = scope.UpdatedAttrsWithValues(db.e, db.e.Search.AssignAttrs)
-	return nil
+	search.WhereStruct(db.e, value, include...)
+	return db
 }
 
-// Begin gives back a fresh copy of DB ready for chaining methods that operates
-// on the same model..
-func (db *DB) Begin() *DB {
-	return db.clone()
+// Clause adds the custom clause registered with builder.RegisterClause under
+// name to the query.
+func (db *DB) Clause(name string, value interface{}) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Clause(db.e, name, value)
+	return db
 }
 
-func (db *DB) recycle() {
-	engine.Put(db.e)
-	db.e = nil
+//Timeout bounds the following operation to d, its statements are canceled
+//and it fails with context.DeadlineExceeded when it takes longer
+//
+//    err := db.Timeout(2 * time.Second).Where("name LIKE ?", "%a%").Find(&users)
+func (db *DB) Timeout(d time.Duration) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Timeout(db.e, d)
+	return db
+}
+
+//Result sets r to receive the number of affected rows and the last insert id
+//of the following operation, so that no-op updates can be detected without
+//querying again
+//
+//    var r model.Result
+//    err := db.Model(&user).Result(&r).Update("name", "gernest")
+//    if err == nil && r.RowsAffected == 0 {
+//        // nothing was updated
+//    }
+//
+// The last insert id is only set by dialects reporting it, like mysql, sqlite3
+// and ql, or returning it, like postgres.
+func (db *DB) Result(r *model.Result) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	db.e.Result = r
+	return db
+}
+
+//MapColumns maps the columns of the results to the fields of the destination,
+//keys are column names and values are field names or DBNames
+//
+//    db.Table("orders").Select("user_id, sum(amount) AS total_amount").
+//        Group("user_id").MapColumns(map[string]string{"total_amount": "Total"}).
+//        Find(&totals)
+//
+// Fields can also list the columns they are scanned from with the SCAN tag,
+// see scope.ScanColumns.
+func (db *DB) MapColumns(m map[string]string) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.MapColumns(db.e, m)
+	return db
+}
+
+//Unscoped disables the automatic conditions for the rest of the chain, soft
+//deleted rows are found and Delete removes rows for good
+//
+//    db.Unscoped().Where("deleted_at IS NOT NULL").Find(&users)
+//    db.Unscoped().Delete(&user)
+func (db *DB) Unscoped() *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.Unscoped(db.e, true)
+	return db
+}
+
+// Scopes applies funcs to the query being built. This allows common conditions
+// to be packaged as functions and reused with any query
+//    func Active(e *engine.Engine) *engine.Engine {
+//    	search.Where(e, "active = ?", true)
+//    	return e
+//    }
+//
+//    db.Scopes(Active, Recent).Find(&users)
+func (db *DB) Scopes(funcs ...func(*engine.Engine) *engine.Engine) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	for _, fn := range funcs {
+		if e := fn(db.e); e != nil {
+			db.e = e
+		}
+	}
+	return db
+}
+
+// WhereNamed is like Where but binds :name placeholders in query to the fields
+// of params, which are matched using their database names.
+//    db.WhereNamed("name = :name AND age > :age", struct {
+//    	Name string
+//    	Age  int
+//    }{"gernest", 18})
+func (db *DB) WhereNamed(query string, params interface{}) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.WhereNamed(db.e, query, params)
+	return db
+}
+
+//SubQuery returns the search built so far on db as a subquery. The result can
+//be used with conditions that embed other queries, for instance
+//
+//  sub := db.Model(&Email{}).Where("emails.user_id = users.id").SubQuery()
+//  db.Where(clause.Exists(sub)).Find(&users)
+func (db *DB) SubQuery() *model.SubQuery {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	return &model.SubQuery{Search: db.e.Search, Value: db.e.Scope.Value}
+}
+
+// FirstOrInit find first matched record or initialize a new one with given
+//conditions (only works with struct, map conditions)
+//
+// Nothing is written to the database. A new record is initialized from the
+// conditions and the values given with Attrs and Assign, a found record only
+// gets the values given with Assign. This is handy to pre-populate forms.
+func (db *DB) FirstOrInit(out interface{}, where ...interface{}) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(out)
+	err := db.finder().First(out, where...)
+	if err != nil {
+		if err != errmsg.ErrRecordNotFound {
+			return err
+		}
+		search.Inline(db.e, where...)
+		scope.Initialize(db.e)
+		return nil
+	}
+	_, _ = scope.UpdatedAttrsWithValues(db.e, db.e.Search.AssignAttrs)
+	return nil
+}
+
+// Begin gives back a fresh copy of DB ready for chaining methods that operates
+// on the same model..
+func (db *DB) Begin() *DB {
+	return db.clone()
+}
+
+func (db *DB) recycle() {
+	engine.Put(db.e)
+	db.e = nil
 }
 
 // Table specify the table you would like to run db operations
@@ -712,52 +1364,107 @@ func (db *DB) Table(name string) *DB {
 	return ndb
 }
 
-// Pluck used to query single column from a model as a map
-//     var ages []int64
-//     db.Find(&users).Pluck("age", &ages)
-func (db *DB) Pluck(column string, value interface{}) error {
-	dest := reflect.ValueOf(value)
-	if dest.Kind() == reflect.Ptr {
-		dest = dest.Elem()
+//Rows executes the query built so far and returns the rows, which must be
+//closed. Each row can be scanned with ScanRows, this allows iterating large
+//results without loading them in memory.
+//
+//    rows, err := db.Model(&User{}).Where("age > ?", 18).Rows()
+//    if err != nil {
+//        return err
+//    }
+//    defer rows.Close()
+//    for rows.Next() {
+//        var user User
+//        if err := db.ScanRows(rows, &user); err != nil {
+//            return err
+//        }
+//    }
+//    return rows.Err()
+func (db *DB) Rows() (*sql.Rows, error) {
+	if db.e == nil {
+		db.e = db.NewEngine()
 	}
 	defer db.recycle()
-	search.Select(db.e, column)
-	if dest.Kind() != reflect.Slice {
-		return fmt.Errorf("results should be a slice, not %s", dest.Kind())
-	}
-	err := builder.PrepareQuery(db.e, db.e.Scope.Value)
-	if err != nil {
-		return err
-	}
-	rows, err := db.SQLCommon().Query(db.e.Scope.SQL, db.e.Scope.SQLVars...)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = rows.Close() }()
-	for rows.Next() {
-		elem := reflect.New(dest.Type().Elem()).Interface()
-		err := rows.Scan(elem)
-		if err != nil {
-			return err
+	if d := db.e.Search.Timeout; d > 0 {
+		// The rows outlive db.e, so the deadline is released when it is over
+		// instead of when db.e is recycled.
+		ctx := db.e.Ctx
+		if ctx == nil {
+			ctx = context.Background()
 		}
-		dest.Set(reflect.Append(dest, reflect.ValueOf(elem).Elem()))
+		ctx, cancel := context.WithTimeout(ctx, d)
+		time.AfterFunc(d, cancel)
+		db.e.Ctx = ctx
+		db.e.Search.Timeout = 0
 	}
-	return nil
+	return hooks.Rows(db.e)
+}
+
+//ScanRows scans the current row of rows into dest, a pointer to a struct or
+//to a map[string]interface{}.
+func (db *DB) ScanRows(rows *sql.Rows, dest interface{}) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	return hooks.ScanRows(e, rows, dest)
 }
 
-// Count get how many records for a model
+// Pluck used to query single column from a model into a slice, the values are
+// appended to the slice
+//     var ages []int64
+//     db.Model(&User{}).Where("role = ?", "admin").Pluck("age", &ages)
+func (db *DB) Pluck(column string, value interface{}) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	return hooks.Pluck(db.e, db.e.Scope.Value, column, value)
+}
+
+// Count get how many records for a model. Ordering, limit and offset are
+// ignored.
+//
+//     db.Model(&User{}).Select("DISTINCT name").Count(&n)  // distinct names
+//     db.Model(&User{}).Group("name").Count(&n)            // number of groups
 func (db *DB) Count(value interface{}) error {
-	query, ok := db.e.Search.Selects["query"]
-	if !ok || regexes.CountingQuery.MatchString(fmt.Sprint(query)) {
-		search.Select(db.e, "count(*)")
+	if db.e == nil {
+		db.e = db.NewEngine()
 	}
 	defer db.recycle()
-	db.e.Search.IgnoreOrderQuery = true
-	err := builder.PrepareQuery(db.e, db.e.Scope.Value)
-	if err != nil {
-		return err
+	return hooks.Count(db.e, db.e.Scope.Value, value)
+}
+
+// Sum scans the sum of column into value.
+//     var total int64
+//     db.Model(&Order{}).Where("paid = ?", true).Sum("amount", &total)
+//
+// value is set to its zero value when no rows match. Grouped queries need a
+// pointer to a slice of structs or maps, which receive the GROUP BY columns
+// and the aggregate named after column for each group.
+func (db *DB) Sum(column string, value interface{}) error {
+	return db.aggregate("sum", column, value)
+}
+
+// Avg scans the average of column into value. See Sum.
+func (db *DB) Avg(column string, value interface{}) error {
+	return db.aggregate("avg", column, value)
+}
+
+// Min scans the smallest value of column into value. See Sum.
+func (db *DB) Min(column string, value interface{}) error {
+	return db.aggregate("min", column, value)
+}
+
+// Max scans the largest value of column into value. See Sum.
+func (db *DB) Max(column string, value interface{}) error {
+	return db.aggregate("max", column, value)
+}
+
+func (db *DB) aggregate(fn, column string, value interface{}) error {
+	if db.e == nil {
+		db.e = db.NewEngine()
 	}
-	return db.SQLCommon().QueryRow(db.e.Scope.SQL, db.e.Scope.SQLVars...).Scan(value)
+	defer db.recycle()
+	return hooks.Aggregate(db.e, db.e.Scope.Value, fn, column, value)
 }
 
 // AddIndexSQL generates SQL to add index for columns with given name
@@ -781,7 +1488,7 @@ func (db *DB) AddIndex(indexName string, columns ...string) (sql.Result, error)
 	if isQL(db) {
 		return db.ExecTx(util.WrapTX(sql.Q), sql.Args...)
 	}
-	return db.SQLCommon().Exec(sql.Q, sql.Args...)
+	return db.exec(sql.Q, sql.Args...)
 }
 
 // DropTableIfExists drop table if it is exist
@@ -800,25 +1507,137 @@ func (db *DB) DropTableIfExists(values ...interface{}) error {
 // Delete delete value match given conditions, if the value has primary key,
 //then will including the primary key as condition
 func (db *DB) Delete(value interface{}, where ...interface{}) error {
-	e := db.NewEngine()
-	defer engine.Put(e)
-	e.Scope.ContextValue(value)
-	search.Inline(e, where...)
-	return hooks.Delete(e)
+	_, err := db.DeleteRows(value, where...)
+	return err
+}
+
+//DeleteRows is like Delete and returns the number of deleted rows. The inline
+//conditions where are combined with the ones set with Where, Or and Not
+//
+//    n, err := db.Where("age > ?", 60).DeleteRows(&User{}, "role = ?", "guest")
+//
+// Deleting without any condition fails with errmsg.ErrMissingWhereClause,
+// unless it is allowed with AllowGlobalDelete. On ql the ON DELETE actions of
+// the relationships, see hooks.DeleteCascade, are applied in the same
+// transaction as the delete.
+func (db *DB) DeleteRows(value interface{}, where ...interface{}) (int64, error) {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(value)
+	search.Inline(db.e, where...)
+	var err error
+	if hooks.Cascades(db.e) || hooks.Implements(value, (*engine.AfterDeleter)(nil)) {
+		err = db.batchTx(hooks.Delete)
+	} else {
+		err = hooks.Delete(db.e)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return db.e.RowsAffected, nil
+}
+
+//AllowGlobalDelete allows the following Delete to run without conditions,
+//deleting all the rows of the table.
+func (db *DB) AllowGlobalDelete() *DB {
+	return db.Set(model.AllowGlobalDelete, true)
+}
+
+//DeleteInBatches deletes the rows matching the conditions like DeleteRows,
+//at most size rows at a time and each batch in its own transaction. This
+//keeps locks short and the transaction logs small when deleting many rows of
+//a big table
+//
+//    n, err := db.Where("created_at < ?", cutoff).DeleteInBatches(&Event{}, 1000)
+//
+// The primary keys of each batch are looked up first, then the rows are
+// deleted by primary key, so value must have a single primary key. On a *DB
+// in a transaction all the batches are executed in that transaction. The
+// number of rows deleted by the committed batches is returned along with the
+// error of the failing batch.
+func (db *DB) DeleteInBatches(value interface{}, size int, where ...interface{}) (int64, error) {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	if size <= 0 {
+		return 0, fmt.Errorf("ngorm: invalid batch size %d", size)
+	}
+	db.e.Scope.ContextValue(value)
+	search.Inline(db.e, where...)
+	if err := hooks.BeforeDelete(db.e); err != nil {
+		return 0, err
+	}
+	m, err := scope.GetModelStruct(db.e, value)
+	if err != nil {
+		return 0, err
+	}
+	if len(m.PrimaryFields) != 1 {
+		return 0, fmt.Errorf("ngorm: deleting %s in batches needs a single primary key", m.ModelType)
+	}
+	pk := m.PrimaryFields[0]
+	in := fmt.Sprintf("%s IN (?)", db.Dialect().Quote(pk.DBName))
+	var total int64
+	for {
+		tx := db
+		if db.tx == nil {
+			tx, err = db.BeginTx()
+			if err != nil {
+				return total, err
+			}
+		}
+		n, err := tx.deleteBatch(db.e.Search, value, pk, in, size)
+		if tx != db {
+			if err != nil {
+				_ = tx.Rollback()
+			} else {
+				err = tx.Commit()
+			}
+		}
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < int64(size) {
+			return total, nil
+		}
+	}
+}
+
+// deleteBatch deletes up to size rows of value matching the conditions of s.
+func (db *DB) deleteBatch(s *model.Search, value interface{}, pk *model.StructField, in string, size int) (int64, error) {
+	ids := reflect.New(reflect.SliceOf(pk.Struct.Type))
+	ndb := db.withConditions(s)
+	ndb.e.Scope.ContextValue(value)
+	err := ndb.Limit(size).Pluck(pk.DBName, ids.Interface())
+	if err != nil {
+		return 0, err
+	}
+	if ids.Elem().Len() == 0 {
+		return 0, nil
+	}
+	ndb = db.clone()
+	ndb.e.Search.TableName = s.TableName
+	ndb.e.Search.Unscoped = s.Unscoped
+	return ndb.Where(in, ids.Elem().Interface()).DeleteRows(value)
 }
 
 // DeleteSQL  generates SQL to delete value match given conditions, if the value has primary key,
 //then will including the primary key as condition
 func (db *DB) DeleteSQL(value interface{}, where ...interface{}) (*model.Expr, error) {
-	e := db.NewEngine()
-	defer engine.Put(e)
-	e.Scope.ContextValue(value)
-	search.Inline(e, where...)
-	err := hooks.DeleteSQL(e)
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	defer db.recycle()
+	db.e.Scope.ContextValue(value)
+	search.Inline(db.e, where...)
+	err := hooks.DeleteSQL(db.e)
 	if err != nil {
 		return nil, err
 	}
-	return &model.Expr{Q: e.Scope.SQL, Args: e.Scope.SQLVars}, nil
+	return db.statement(db.e.Scope.SQL, db.e.Scope.SQLVars), nil
 }
 
 // UpdateColumn update attributes without callbacks
@@ -826,7 +1645,10 @@ func (db *DB) UpdateColumn(attrs ...interface{}) error {
 	return db.UpdateColumns(util.ToSearchableMap(attrs...))
 }
 
-// UpdateColumns update attributes without
+// UpdateColumns update attributes without callbacks, UpdatedAt is not touched
+// and associations are not saved. Combined with Expr it suits counters
+//
+//	db.Model(&post).UpdateColumn("views", ngorm.Expr("views + ?", 1))
 func (db *DB) UpdateColumns(values interface{}) error {
 	if db.e == nil || db.e.Scope.Value == nil {
 		return errmsg.ErrMissingModel
@@ -835,7 +1657,14 @@ func (db *DB) UpdateColumns(values interface{}) error {
 	db.e.Scope.Set(model.UpdateColumn, true)
 	db.e.Scope.Set(model.SaveAssociations, false)
 	db.e.Scope.Set(model.UpdateInterface, values)
-	return hooks.Update(db.e)
+	return hooks.UpdateColumns(db.e)
+}
+
+//Expr returns an SQL expression, the ? in query are replaced by the bind
+//variables of args. Expressions are used as is where values are expected, for
+//instance in updates.
+func Expr(query string, args ...interface{}) *model.Expr {
+	return &model.Expr{Q: query, Args: args}
 }
 
 // AddUniqueIndex add unique index for columns with given name
@@ -850,7 +1679,7 @@ func (db *DB) AddUniqueIndex(indexName string, columns ...string) (sql.Result, e
 	if isQL(db) {
 		return db.ExecTx(util.WrapTX(db.e.Scope.SQL), db.e.Scope.SQLVars...)
 	}
-	return db.SQLCommon().Exec(db.e.Scope.SQL, db.e.Scope.SQLVars...)
+	return db.exec(db.e.Scope.SQL, db.e.Scope.SQLVars...)
 }
 
 // RemoveIndex remove index with name
@@ -876,7 +1705,7 @@ func (db *DB) DropColumn(column string) (sql.Result, error) {
 			util.WrapTX(db.e.Scope.SQL), db.e.Scope.SQLVars...,
 		)
 	}
-	return db.SQLCommon().Exec(db.e.Scope.SQL, db.e.Scope.SQLVars...)
+	return db.exec(db.e.Scope.SQL, db.e.Scope.SQLVars...)
 }
 
 // ModifyColumn modify column to type
@@ -905,23 +1734,208 @@ func (db *DB) Ping() error {
 
 // Preload preload associations with given conditions
 //    db.Preload("Orders", "state NOT IN (?)", "cancelled").Find(&users)
+//
+// Nested associations are preloaded with dotted paths, each level is loaded
+// with a single query
+//    db.Preload("Orders.Items.Product").Find(&users)
+//
+// A func(*DB) *DB condition is called with the query loading the
+// associations, to order or limit them. The limit applies to the query, not to
+// the associations of each record, and to each batch of keys when they are
+// split with PreloadBatch
+//    db.Preload("Comments", "approved = ?", true, func(db *DB) *DB {
+//        return db.Order("created_at DESC")
+//    }).Find(&posts)
+//
+// The ORDER and LIMIT tags of a has_many field set the order of its preloaded
+// records, unless a condition sets one, and the maximum number of records
+// preloaded for each model
+//    type Post struct {
+//        ID       int64
+//        Comments []Comment `gorm:"ORDER:created_at desc;LIMIT:10"`
+//    }
+//
+// Preloading the same path again replaces its conditions, so all the
+// conditions of a path must be given in the same call.
 func (db *DB) Preload(column string, conditions ...interface{}) *DB {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
-	search.Preload(db.e, column, conditions...)
+	conds := make([]interface{}, len(conditions))
+	for i, c := range conditions {
+		if fn, ok := c.(func(*DB) *DB); ok {
+			c = func(e *engine.Engine) {
+				ndb := db.clone()
+				engine.Put(ndb.e)
+				ndb.e = e
+				fn(ndb)
+			}
+		}
+		conds[i] = c
+	}
+	search.Preload(db.e, column, conds...)
+	return db
+}
+
+//AutoPreload enables or disables preloading all the associations of the
+//models queried with db, except the ones tagged PRELOAD:false. Without it only
+//the associations tagged PRELOAD:true are always preloaded
+//
+//    type User struct {
+//        ID     int64
+//        Emails []Email `gorm:"PRELOAD:true"`
+//    }
+//
+// A single query can change it with db.Set(model.AutoPreload, false). The
+// associations leading back to a model being preloaded aren't preloaded
+// again, see hooks.AutoPreload.
+func (db *DB) AutoPreload(enable bool) {
+	db.autoPreload = enable
+	if db.e != nil {
+		db.e.AutoPreload = enable
+	}
+}
+
+//RegisterProjection registers projection as a reduced struct of the model
+//value, loading only some of its columns. Queries on the projection read the
+//table of value and select only the columns of the projection, so associations
+//typed with a projection are preloaded without loading the whole rows
+//
+//    type CommentSummary struct {
+//        ID     int64
+//        PostID int64
+//    }
+//
+//    type Post struct {
+//        ID       int64
+//        Comments []CommentSummary
+//    }
+//
+//    err := db.RegisterProjection(&CommentSummary{}, &Comment{})
+//
+// The projection must be registered before it is queried, and every column of
+// the projection must be a column of value. Projections are read only, creating
+// or updating one returns errmsg.ErrProjectionWrite.
+func (db *DB) RegisterProjection(projection, value interface{}) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	return scope.RegisterProjection(e, projection, value)
+}
+
+//RegisterReadOnly makes the models read only, creating, updating or deleting
+//them fails with errmsg.ErrReadOnly. This is meant for the models mapped to
+//views or replicated tables, which can also be tagged
+//
+//    type Report struct {
+//    	_     struct{} `gorm:"READONLY"`
+//    	ID    int64
+//    	Total int64
+//    }
+//
+//    err := db.RegisterReadOnly(&Replica{})
+func (db *DB) RegisterReadOnly(values ...interface{}) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	for _, v := range values {
+		if err := scope.RegisterReadOnly(e, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//PreloadBatch limits the number of keys listed in the IN conditions of the
+//queries preloading associations to size, the records with more keys are
+//preloaded with a query per batch of size keys. Some databases limit the
+//number of parameters of a statement, like 999 for older sqlite versions.
+//
+// With concurrent the queries of the batches run concurrently, except in
+// transactions. The preloaded records are assigned in the order of the
+// batches either way, but the conditions like Order and Limit passed to
+// Preload apply to each batch and not to the records of all the batches. A
+// size of zero lists all the keys in a single query, which is the default.
+func (db *DB) PreloadBatch(size int, concurrent bool) {
+	db.preloadBatch = size
+	db.preloadConc = concurrent
+	if db.e != nil {
+		db.e.PreloadBatchSize = size
+		db.e.PreloadConcurrent = concurrent
+	}
+}
+
+//Callback returns the chains of callbacks executing the create, query, update
+//and delete operations of db, its transactions and the *DB derived from it.
+//Callbacks can be added to the default ones, or replace them
+//
+//    err := db.Callback().Create().Before("ngorm:create_sql").Register("app:slug",
+//        func(e *engine.Engine) error {
+//            if p, ok := e.Scope.Value.(*Post); ok && p.Slug == "" {
+//                p.Slug = slugify(p.Title)
+//            }
+//            return nil
+//        })
+//
+// The names of the default callbacks are listed in hooks.DefaultCallbacks.
+func (db *DB) Callback() *engine.Callbacks {
+	if db.callbacks == nil {
+		db.callbacks = hooks.DefaultCallbacks()
+		if db.e != nil {
+			db.e.Callbacks = db.callbacks
+		}
+	}
+	return db.callbacks
+}
+
+//Use initializes the plugin p with an engine of db, registering its callbacks
+//for db, its transactions and the *DB derived from it. Using two plugins of
+//the same name fails
+//
+//    err := db.Use(&audit.Plugin{Actor: currentUser})
+func (db *DB) Use(p engine.Plugin) error {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	e.Callbacks = db.Callback()
+	return e.Use(p)
+}
+
+//JoinPreload loads the has_one or belongs_to association column together
+//with the records, with a LEFT JOIN in the same query instead of the
+//separate query of Preload
+//
+//    var users []User
+//    err := db.JoinPreload("CreditCard").JoinPreload("Company").Find(&users)
+//
+// The joined table is aliased with the name of the association, conditions on
+// its columns use the alias, like "CreditCard.number = ?", and the columns of
+// the model should be qualified with its table when the names clash. Order
+// uses the names of the selected columns, like "id" or "CreditCard__number".
+// With ql a single association can be joined.
+func (db *DB) JoinPreload(column string) *DB {
+	if db.e == nil {
+		db.e = db.NewEngine()
+	}
+	search.JoinPreload(db.e, column)
 	return db
 }
 
 // FirstOrCreate find first matched record or create a new one with given
 //conditions (only works with struct, map conditions)
+//
+// The record is created from the conditions and the values given with Attrs
+// and Assign. When the record is found the values given with Assign are
+// updated, Attrs are only used for new records.
+//
+//    db.Where(User{Name: "gernest"}).
+//        Attrs(User{Age: 20}).
+//        Assign(User{LastSeen: now}).
+//        FirstOrCreate(&user)
 func (db *DB) FirstOrCreate(out interface{}, where ...interface{}) error {
 	if db.e == nil {
 		db.e = db.NewEngine()
 	}
 	defer db.recycle()
 	db.e.Scope.ContextValue(out)
-	err := db.Begin().First(out, where...)
+	err := db.finder().First(out, where...)
 	if err != nil {
 		if err != errmsg.ErrRecordNotFound {
 			return err
@@ -936,18 +1950,37 @@ func (db *DB) FirstOrCreate(out interface{}, where ...interface{}) error {
 		return db.Create(out)
 	}
 	if len(db.e.Search.AssignAttrs) > 0 {
-		return db.Update(db.e.Search.AssignAttrs...)
+		return db.Updates(scope.ConvertInterfaceToMap(db.e, db.e.Search.AssignAttrs, false))
 	}
 	return nil
 }
 
+// finder returns a copy of db with the conditions of the search built so far
+// on db, which FirstOrInit and FirstOrCreate use to look up the record.
+func (db *DB) finder() *DB {
+	return db.withConditions(db.e.Search)
+}
+
+// withConditions returns a copy of db with the conditions of s.
+func (db *DB) withConditions(s *model.Search) *DB {
+	ndb := db.clone()
+	ns := ndb.e.Search
+	ns.WhereConditions = append(ns.WhereConditions, s.WhereConditions...)
+	ns.OrConditions = append(ns.OrConditions, s.OrConditions...)
+	ns.NotConditions = append(ns.NotConditions, s.NotConditions...)
+	ns.JoinConditions = append(ns.JoinConditions, s.JoinConditions...)
+	ns.TableName = s.TableName
+	ns.Unscoped = s.Unscoped
+	return ndb
+}
+
 // AddForeignKey adds foreign key to an existing table.
 func (db *DB) AddForeignKey(field string, dest string, onDelete string, onUpdate string) error {
 	sql, err := db.AddForeignKeySQL(field, dest, onDelete, onUpdate)
 	if err != nil {
 		return err
 	}
-	_, err = db.SQLCommon().Exec(sql)
+	_, err = db.exec(sql)
 	if err != nil {
 		return fmt.Errorf("%v \n %s", err, sql)
 	}
@@ -955,6 +1988,10 @@ func (db *DB) AddForeignKey(field string, dest string, onDelete string, onUpdate
 }
 
 // AddForeignKeySQL generates sql to adds foreign key to an existing table.
+// Composite foreign keys list their columns separated by commas
+//
+//    db.Model(&Badge{}).AddForeignKeySQL("org_id,user_id",
+//        "org_users(org_id,user_id)", "CASCADE", "CASCADE")
 func (db *DB) AddForeignKeySQL(field string, dest string, onDelete string, onUpdate string) (string, error) {
 	if db.e == nil || db.e.Scope.Value == nil {
 		return "", errmsg.ErrMissingModel
@@ -970,12 +2007,134 @@ func (db *DB) AddForeignKeySQL(field string, dest string, onDelete string, onUpd
 	if db.Dialect().HasForeignKey(name, keyName) {
 		return "", errors.New("key already exists")
 	}
-	var query = `ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s ON DELETE %s ON UPDATE %s;`
-	sql := fmt.Sprintf(query,
-		scope.QuotedTableName(db.e, db.e.Scope.Value),
-		scope.Quote(db.e, keyName),
-		scope.Quote(db.e, field), dest, onDelete, onUpdate)
-	return sql, nil
+	return foreignKeySQL(db.e, name, keyName, strings.Split(field, ","), dest, onDelete, onUpdate), nil
+}
+
+// foreignKeySQL returns the statement adding to table the foreign key
+// constraint keyName of columns referencing dest, the actions left empty are
+// omitted.
+func foreignKeySQL(e *engine.Engine, table, keyName string, columns []string, dest, onDelete, onUpdate string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = scope.Quote(e, strings.TrimSpace(column))
+	}
+	sql := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s",
+		scope.Quote(e, table), scope.Quote(e, keyName), strings.Join(quoted, ","), dest)
+	if onDelete != "" {
+		sql += " ON DELETE " + onDelete
+	}
+	if onUpdate != "" {
+		sql += " ON UPDATE " + onUpdate
+	}
+	return sql + ";"
+}
+
+// constraintSQL returns the name and the statement adding the foreign key
+// constraint declared by the relationship of o.
+func constraintSQL(e *engine.Engine, o Orphans) (string, string) {
+	refColumns := make([]string, len(o.RefColumns))
+	for i, c := range o.RefColumns {
+		refColumns[i] = scope.Quote(e, c)
+	}
+	keyName := e.Dialect.BuildForeignKeyName(o.Table, strings.Join(o.Columns, ","),
+		fmt.Sprintf("%s(%s)", o.RefTable, strings.Join(o.RefColumns, ",")))
+	dest := fmt.Sprintf("%s(%s)", scope.Quote(e, o.RefTable), strings.Join(refColumns, ","))
+	return keyName, foreignKeySQL(e, o.Table, keyName, o.Columns, dest, o.onDelete, o.onUpdate)
+}
+
+//ConstraintSQL generates the statements adding the foreign key constraints of
+//the relationship field of the model, with the actions set with the
+//CONSTRAINT tag of the field
+//
+//    type Shop struct {
+//        ID     int64
+//        Orders []Order `gorm:"CONSTRAINT:OnDelete:CASCADE,OnUpdate:CASCADE"`
+//    }
+//
+//    stmts, err := db.Model(&Shop{}).ConstraintSQL("Orders")
+//
+// The constraint is added to the table holding the foreign key, that is the
+// table of the association for has_one and has_many relationships and the
+// join table, with a constraint per side, for many_to_many relationships.
+// Polymorphic relationships reference several tables and have no constraint.
+func (db *DB) ConstraintSQL(field string) ([]string, error) {
+	if db.e == nil || db.e.Scope.Value == nil {
+		return nil, errmsg.ErrMissingModel
+	}
+	defer db.recycle()
+	if isQL(db) {
+		return nil, errors.New("ql does not support foreign key")
+	}
+	refs, err := db.references([]interface{}{db.e.Scope.Value})
+	if err != nil {
+		return nil, err
+	}
+	var stmts []string
+	for _, o := range refs {
+		if o.Field != field || o.typeColumn != "" {
+			continue
+		}
+		keyName, sql := constraintSQL(db.e, o)
+		if db.Dialect().HasForeignKey(o.Table, keyName) {
+			return nil, errors.New("key already exists")
+		}
+		stmts = append(stmts, sql)
+	}
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("ngorm: %s has no foreign key constraint", field)
+	}
+	return stmts, nil
+}
+
+// migrationConstraintsSQL returns the statements adding the foreign key
+// constraints of the relationships of models when migrating them, see
+// ConstraintSQL. The constraints which already exist and the ones of tables
+// which are neither migrated nor in the database are left out.
+func (db *DB) migrationConstraintsSQL(models []interface{}) ([]string, error) {
+	if isQL(db) || db.noForeignKeys {
+		return nil, nil
+	}
+	refs, err := db.references(models)
+	if err != nil {
+		return nil, err
+	}
+	e := db.NewEngine()
+	defer engine.Put(e)
+	migrated := make(map[string]bool)
+	for _, m := range models {
+		ms, err := scope.GetModelStruct(e, m)
+		if err != nil {
+			return nil, err
+		}
+		migrated[scope.TableNameOf(e, m)] = true
+		for _, f := range ms.StructFields {
+			if rel := f.Relationship; rel != nil && rel.JoinTableHandler != nil {
+				migrated[rel.JoinTableHandler.TableName] = true
+			}
+		}
+	}
+	exists := func(table string) bool {
+		return migrated[table] || db.Dialect().HasTable(table)
+	}
+	var stmts []string
+	for _, o := range refs {
+		if o.typeColumn != "" || !exists(o.Table) || !exists(o.RefTable) {
+			continue
+		}
+		keyName, sql := constraintSQL(e, o)
+		if db.Dialect().HasForeignKey(o.Table, keyName) {
+			continue
+		}
+		stmts = append(stmts, sql)
+	}
+	return stmts, nil
+}
+
+//MigrateForeignKeys enables or disables adding the foreign key constraints of
+//the relationships of the models with CreateTable and Automigrate. This is
+//enabled by default, except with ql which has no foreign keys.
+func (db *DB) MigrateForeignKeys(enable bool) {
+	db.noForeignKeys = !enable
 }
 
 // Association returns association object
@@ -1036,63 +2195,26 @@ func (db *DB) related(source, value interface{}, foreignKeys ...string) error {
 			return ndb.Where(sql, pfv).Find(value)
 		}
 
-		if rel := fromField.Relationship; rel != nil {
-			if rel.Kind == "many_to_many" {
-				h := rel.JoinTableHandler
-				if isQL(db) {
-					err = scope.JoinWithQL(h, ndb.e, sdb.e.Scope.Value)
-					if err != nil {
-						return err
-					}
-				} else {
-					err = scope.JoinWith(h, ndb.e, sdb.e.Scope.Value)
-					if err != nil {
-						return err
-					}
-				}
-
-				return ndb.Find(value)
-			} else if rel.Kind == "belongs_to" {
-				for idx, foreignKey := range rel.ForeignDBNames {
-					if field, ok := scope.FieldByName(sdb.e, sdb.e.Scope.ValueOf(), foreignKey); ok == nil {
-						ndb = ndb.Where(fmt.Sprintf("%v = ?",
-							scope.Quote(ndb.e, rel.AssociationForeignDBNames[idx])),
-							field.Field.Interface())
-					}
-				}
-				return ndb.Find(value)
-			} else if rel.Kind == "has_many" || rel.Kind == "has_one" {
-				for idx, foreignKey := range rel.ForeignDBNames {
-					field, err := scope.FieldByName(sdb.e, sdb.e.Scope.ValueOf(), rel.AssociationForeignDBNames[idx])
-					if err == nil {
-						ndb = ndb.Where(fmt.Sprintf("%v = ?",
-							scope.Quote(ndb.e, foreignKey)), field.Field.Interface())
-					}
-
-				}
-
-				if rel.PolymorphicType != "" {
-					ndb = ndb.Where(fmt.Sprintf("%v = ?",
-						scope.Quote(ndb.e, rel.PolymorphicDBName)), rel.PolymorphicValue)
-				}
-				return ndb.Find(value)
-			}
-		} else {
-			pk, err := scope.PrimaryKey(sdb.e, value)
-			if err != nil {
-				return err
-			}
-			sql := fmt.Sprintf("%v = ?",
-				scope.Quote(sdb.e, pk))
-			return ndb.Where(sql, fromField.Field.Interface()).Find(value)
+		if fromField.Relationship != nil {
+			defer ndb.recycle()
+			return hooks.Related(ndb.e, source, value, fromField.Name)
 		}
-		return nil
-
+		pk, err := scope.PrimaryKey(sdb.e, value)
+		if err != nil {
+			return err
+		}
+		sql := fmt.Sprintf("%v = ?",
+			scope.Quote(sdb.e, pk))
+		return ndb.Where(sql, fromField.Field.Interface()).Find(value)
 	}
 	return fmt.Errorf("invalid association %v", foreignKeys)
 }
 
-// Related get related associations
+// Related get related associations. The associations named after a
+// relationship field of the model are loaded with hooks.Related
+//
+//    var emails []Email
+//    err := db.Model(&user).Related(&emails, "Emails")
 func (db *DB) Related(value interface{}, foreignKeys ...string) error {
 	if db.e == nil || db.e.Scope.Value == nil {
 		return errmsg.ErrMissingModel
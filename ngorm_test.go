@@ -1,13 +1,27 @@
 package ngorm
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	_ "github.com/cznic/ql/driver"
+	"github.com/ngorm/ngorm/dialects"
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/fixture"
+	"github.com/ngorm/ngorm/hooks"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/scope"
+	"github.com/ngorm/ngorm/search"
+	"github.com/ngorm/ngorm/types"
+	"github.com/ngorm/ngorm/util"
 )
 
 type Foo struct {
@@ -43,6 +57,44 @@ func testDBCreateTable(t *testing.T, db *DB) {
 	}
 }
 
+func TestDB_ExecScript(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBExecScript, &Foo{})
+	}
+}
+
+func testDBExecScript(t *testing.T, db *DB) {
+	sql, err := db.CreateTableSQL(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote := "'"
+	if isQL(db) {
+		quote = `"`
+	}
+	script := sql.Q + `
+	-- fixtures
+	INSERT INTO foos (stuff) VALUES (` + quote + "a;b" + quote + `);
+	INSERT INTO foos (stuff) VALUES (` + quote + "c" + quote + `);
+	`
+	err = db.ExecScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stuff []string
+	err = db.Model(&Foo{}).Order("stuff").Pluck("stuff", &stuff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stuff, []string{"a;b", "c"}) {
+		t.Errorf("expected [a;b c] got %v", stuff)
+	}
+	err = db.ExecScript("INSERT INTO missing (stuff) VALUES (1);")
+	if err == nil || !strings.Contains(err.Error(), "statement 1") {
+		t.Errorf("expected the failing statement got %v", err)
+	}
+}
+
 func TestDB_DropTable(t *testing.T) {
 	for _, d := range allTestDB() {
 		runWrapDB(t, d, testDBDropTable)
@@ -159,6 +211,422 @@ func testDBCreate(t *testing.T, db *DB) {
 	}
 }
 
+func TestDB_CreateMap(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBCreateMap, &Foo{})
+	}
+}
+
+func testDBCreateMap(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Table("foos").Create(map[string]interface{}{"stuff": "from map"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Foo{}).Create(map[string]interface{}{"stuff": "from model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stuff []string
+	err = db.Model(&Foo{}).Order("stuff").Pluck("stuff", &stuff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stuff, []string{"from map", "from model"}) {
+		t.Errorf("expected [from map from model] got %v", stuff)
+	}
+
+	err = db.Table("foos").Create(map[string]interface{}{"stuff": "a", "missing": 1})
+	if err == nil {
+		t.Error("expected an error for a missing column")
+	}
+	err = db.Create(map[string]interface{}{"stuff": "a"})
+	if err != errmsg.ErrMissingModel {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingModel, err)
+	}
+}
+
+func TestDB_CreateSelectOmit(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBCreateSelectOmit, &FirstOrCreateUser{})
+	}
+}
+
+func testDBCreateSelectOmit(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&FirstOrCreateUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, err := db.Omit("age").CreateSQL(&FirstOrCreateUser{Name: "a", Age: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sql.Q, "age") {
+		t.Errorf("expected age to be omitted got %s", sql.Q)
+	}
+
+	a := FirstOrCreateUser{Name: "a", Age: 10}
+	err = db.Omit("age").Create(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := FirstOrCreateUser{Name: "b", Age: 20}
+	err = db.Select("Age").Create(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []FirstOrCreateUser
+	err = db.Order("age").Find(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users got %d", len(users))
+	}
+	if users[0].Name != "a" || users[0].Age != 0 {
+		t.Errorf("expected a without age got %v", users[0])
+	}
+	if users[1].Name != "" || users[1].Age != 20 {
+		t.Errorf("expected only the age 20 got %v", users[1])
+	}
+}
+
+func TestDB_CreateInBatches(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBCreateInBatches, &Foo{})
+	}
+}
+
+func testDBCreateInBatches(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foos := []Foo{{Stuff: "a"}, {Stuff: "b"}, {Stuff: "c"}, {Stuff: "d"}, {Stuff: "e"}}
+	err = db.CreateInBatches(&foos, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	more := []*Foo{{Stuff: "f"}, {Stuff: "g"}}
+	err = db.CreateInBatches(more, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foos = append(foos, *more[0], *more[1])
+	var got []Foo
+	err = db.Order("stuff").Find(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, foos) {
+		t.Errorf("expected %v got %v", foos, got)
+	}
+	for k, v := range foos {
+		if v.ID == 0 || (k > 0 && v.ID <= foos[k-1].ID) {
+			t.Errorf("expected increasing ids got %v", foos)
+			break
+		}
+	}
+
+	err = db.CreateInBatches(&[]Foo{{ID: 100, Stuff: "x"}, {Stuff: "y"}}, 0)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestDB_BulkUpdate(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBBulkUpdate, &Foo{})
+	}
+}
+
+func testDBBulkUpdate(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	foos := []Foo{{Stuff: "a"}, {Stuff: "b"}, {Stuff: "c"}}
+	err = db.CreateInBatches(&foos, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foos[0].Stuff = "x"
+	foos[2].Stuff = "z"
+	err = db.BulkUpdate(foos[:1:1], "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.BulkUpdate(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Foo
+	err = db.Order("id").Find(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, foos) {
+		t.Errorf("expected %v got %v", foos, got)
+	}
+	err = db.BulkUpdate(foos, "nope")
+	if err == nil {
+		t.Error("expected an error")
+	}
+	err = db.BulkUpdate([]Foo{{Stuff: "a"}})
+	if err == nil {
+		t.Error("expected an error")
+	}
+
+	rows := []Foo{{ID: 1, Stuff: "a"}, {ID: 2, Stuff: "b"}}
+	exprs, err := db.BulkUpdateSQL(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exprs) != 2 || exprs[0].Q != "UPDATE foos SET stuff = $1 WHERE id = $2" {
+		t.Errorf("unexpected statements %v", exprs)
+	}
+	d := db.dialect
+	defer func() {
+		db.dialect = d
+	}()
+	db.dialect = namedDialect{Dialect: d, name: "postgres"}
+	exprs, err = db.BulkUpdateSQL(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "UPDATE foos SET stuff = CASE id WHEN $1 THEN $2 WHEN $3 THEN $4 ELSE stuff END WHERE id IN ($5,$6)"
+	if len(exprs) != 1 || exprs[0].Q != expect {
+		t.Fatalf("expected %s got %v", expect, exprs)
+	}
+	args := []interface{}{1, "a", 2, "b", 1, 2}
+	if !reflect.DeepEqual(exprs[0].Args, args) {
+		t.Errorf("expected %v got %v", args, exprs[0].Args)
+	}
+}
+
+type EnumStatus int
+
+const (
+	EnumActive EnumStatus = iota + 1
+	EnumBanned
+)
+
+type EnumUser struct {
+	ID     int64
+	Name   string
+	Status EnumStatus
+	Prev   *EnumStatus
+}
+
+func TestDB_Enum(t *testing.T) {
+	err := types.RegisterEnum(map[interface{}]interface{}{
+		EnumActive: "active",
+		EnumBanned: "banned",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBEnum, &EnumUser{})
+	}
+}
+
+func testDBEnum(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&EnumUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := EnumActive
+	users := []EnumUser{
+		{Name: "a", Status: EnumActive},
+		{Name: "b", Status: EnumBanned, Prev: &prev},
+	}
+	for k := range users {
+		err = db.Create(&users[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var status []string
+	err = db.Model(&EnumUser{}).Order("status").Pluck("status", &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(status, []string{"active", "banned"}) {
+		t.Errorf("expected the statuses to be stored as strings got %v", status)
+	}
+	var got []EnumUser
+	err = db.Where("status = ?", EnumBanned).Find(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Status != EnumBanned || got[0].Prev == nil || *got[0].Prev != EnumActive {
+		t.Errorf("expected %v got %v", users[1:], got)
+	}
+	err = db.Create(&EnumUser{Name: "c", Status: 3})
+	if err == nil {
+		t.Error("expected an error for an undeclared value")
+	}
+
+	// The cached plans bind the enums like the built statements.
+	db.CachePlans(10)
+	defer db.CachePlans(0)
+	for _, status := range []interface{}{"banned", EnumBanned} {
+		err = db.Where("status = ?", status).Find(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Errorf("expected the banned user for %#v got %v", status, got)
+		}
+	}
+	err = db.Where("status = ?", EnumStatus(3)).Find(&got)
+	if err == nil {
+		t.Error("expected an error for an undeclared value with cached plans")
+	}
+}
+
+type ProfileAddress struct {
+	City string
+	Zip  string
+}
+
+type Profile struct {
+	ID       int64
+	Name     string
+	Settings map[string]string `gorm:"SERIALIZER:json"`
+	Address  *ProfileAddress   `gorm:"SERIALIZER:json"`
+	Tags     []string          `gorm:"SERIALIZER:gob"`
+}
+
+func TestDB_Serializer(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBSerializer, &Profile{})
+	}
+}
+
+func testDBSerializer(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Profile{
+		Name:     "a",
+		Settings: map[string]string{"theme": "dark"},
+		Address:  &ProfileAddress{City: "Dar", Zip: "255"},
+		Tags:     []string{"x", "y"},
+	}
+	err = db.Create(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw []string
+	err = db.Model(&Profile{}).Where("id = ?", p.ID).Pluck("settings", &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(raw, []string{`{"theme":"dark"}`}) {
+		t.Errorf("expected the settings to be stored as json got %v", raw)
+	}
+	var got Profile
+	err = db.First(&got, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("expected %v got %v", p, got)
+	}
+
+	err = db.Model(&got).Update("settings", map[string]string{"theme": "light"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Address = nil
+	got.Tags = append(got.Tags, "z")
+	err = db.Save(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Profile
+	err = db.First(&saved, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Settings["theme"] != "light" || saved.Address != nil ||
+		!reflect.DeepEqual(saved.Tags, []string{"x", "y", "z"}) {
+		t.Errorf("expected the updated values got %v", saved)
+	}
+
+	type BadProfile struct {
+		ID   int64
+		Data string `gorm:"SERIALIZER:nope"`
+	}
+	err = db.Create(&BadProfile{Data: "a"})
+	if err == nil {
+		t.Error("expected an error for an unknown serializer")
+	}
+}
+
+type BoolFlag bool
+
+type BoolItem struct {
+	ID     int64
+	Active bool
+	Flag   BoolFlag
+	Opt    *bool
+}
+
+func TestDB_Bool(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBBool, &BoolItem{})
+	}
+}
+
+func testDBBool(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&BoolItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	no := false
+	items := []BoolItem{{Active: true, Flag: true, Opt: &no}, {}}
+	for k := range items {
+		err = db.Create(&items[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []BoolItem
+	err = db.Where("active = ?", true).Find(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Active || !bool(got[0].Flag) || got[0].Opt == nil || *got[0].Opt {
+		t.Errorf("expected %v got %v", items[:1], got)
+	}
+
+	d := db.dialect
+	defer func() {
+		db.dialect = d
+	}()
+	for name, expect := range map[string]interface{}{
+		"mysql":    int64(1),
+		"sqlite3":  int64(1),
+		"postgres": true,
+	} {
+		db.dialect = namedDialect{Dialect: d, name: name}
+		sql, err := db.Where("flag = ?", BoolFlag(true)).FindSQL(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sql.Args) != 1 || sql.Args[0] != expect {
+			t.Errorf("%s: expected %#v got %#v", name, expect, sql.Args)
+		}
+	}
+}
+
 func TestDB_SaveSQL(t *testing.T) {
 	for _, d := range allTestDB() {
 		runWrapDB(t, d, testDBSaveSQL)
@@ -465,6 +933,37 @@ func testDBSave(t *testing.T, db *DB) {
 	if first.Stuff != fu.Stuff {
 		t.Errorf("expected %s got %s", fu.Stuff, first.Stuff)
 	}
+
+	// A blank primary key inserts, blank fields are updated.
+	foo := Foo{Stuff: "e"}
+	err = db.Save(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID == 0 {
+		t.Fatal("expected the id to be set")
+	}
+	foo.Stuff = ""
+	err = db.Save(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Foo
+	err = db.Begin().Where("id = ?", foo.ID).First(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Stuff != "" {
+		t.Errorf("expected blank stuff got %s", saved.Stuff)
+	}
+	var count int
+	err = db.Model(&Foo{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(sample)+1 {
+		t.Errorf("expected %d got %d", len(sample)+1, count)
+	}
 }
 
 func TestDB_Update(t *testing.T) {
@@ -505,7 +1004,65 @@ func testDBUpdate(t *testing.T, db *DB) {
 	}
 }
 
-func TestDB_Assign(t *testing.T) {
+func TestDB_IfMatch(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBIfMatch, &Foo{})
+	}
+}
+
+func testDBIfMatch(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Foo{Stuff: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fu := Foo{}
+	err = db.Begin().First(&fu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag, err := db.ETag(&fu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&fu).IfMatch(etag).Update("stuff", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&fu).IfMatch(etag).Update("stuff", "c")
+	if err != errmsg.ErrPreconditionFailed {
+		t.Errorf("expected %v got %v", errmsg.ErrPreconditionFailed, err)
+	}
+
+	first := Foo{}
+	err = db.Begin().First(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Stuff != "b" {
+		t.Errorf("expected b got %s", first.Stuff)
+	}
+	tag, err := db.ETag(&first, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag == etag {
+		t.Error("expected the etag to change")
+	}
+	err = db.Model(&first).IfMatch(tag, "stuff").Update("stuff", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Foo{ID: first.ID + 1}).IfMatch("*").Update("stuff", "d")
+	if err != errmsg.ErrPreconditionFailed {
+		t.Errorf("expected %v got %v", errmsg.ErrPreconditionFailed, err)
+	}
+}
+
+func TestDB_Assign(t *testing.T) {
 	for _, d := range allTestDB() {
 		runWrapDB(t, d, testDBAssign, &fixture.User{})
 	}
@@ -554,6 +1111,61 @@ func testDBPluck(t *testing.T, db *DB) {
 	if len(stuffs) != 4 {
 		t.Errorf("expected %d got %d", 4, len(stuffs))
 	}
+	var ids []int64
+	err = db.Model(&Foo{}).Where("stuff != ?", "a").Order("id").Pluck("id", &ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{2, 3, 4}) {
+		t.Errorf("expected [2 3 4] got %v", ids)
+	}
+	err = db.Model(&Foo{}).Pluck("stuff", stuffs)
+	if err != errmsg.ErrUnaddressable {
+		t.Errorf("expected %v got %v", errmsg.ErrUnaddressable, err)
+	}
+
+	// NULL gives nil pointers and zero values.
+	q := "INSERT INTO foos (id) VALUES ($1)"
+	if isQL(db) {
+		q = util.WrapTX(q)
+	}
+	_, err = db.ExecTx(q, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ptrs []*string
+	err = db.Model(&Foo{}).Where("id = ?", 4).Pluck("stuff", &ptrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 1 || ptrs[0] == nil || *ptrs[0] != "d" {
+		t.Errorf("expected [d] got %v", ptrs)
+	}
+	ptrs = nil
+	err = db.Model(&Foo{}).Where("id = ?", 5).Pluck("stuff", &ptrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 1 || ptrs[0] != nil {
+		t.Errorf("expected [<nil>] got %v", ptrs)
+	}
+	stuffs = nil
+	err = db.Model(&Foo{}).Where("id = ?", 5).Pluck("stuff", &stuffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stuffs, []string{""}) {
+		t.Errorf("expected [] got %q", stuffs)
+	}
+
+	// The values are appended to the slice.
+	err = db.Model(&Foo{}).Where("id = ?", 1).Pluck("stuff", &stuffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stuffs, []string{"", "a"}) {
+		t.Errorf("expected [ a] got %q", stuffs)
+	}
 }
 
 func TestDB_Count(t *testing.T) {
@@ -582,242 +1194,740 @@ func testDBCount(t *testing.T, db *DB) {
 	if stuffs != 4 {
 		t.Errorf("expected %d got %d", 4, stuffs)
 	}
-}
 
-func TestDB_AddIndexSQL(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBAddIndexSQL, &Foo{})
+	err = db.Create(&Foo{Stuff: "a"})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func testDBAddIndexSQL(t *testing.T, db *DB) {
-	_, err := db.Automigrate(&Foo{})
+	err = db.Model(&Foo{}).Order("stuff").Limit(2).Count(&stuffs)
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = db.AddIndexSQL("_idx_foo_stuff", "stuff")
-	if err == nil {
-		t.Fatal("expected an error")
+	if stuffs != 5 {
+		t.Errorf("expected %d got %d", 5, stuffs)
 	}
-
-	sql, err := db.Model(&Foo{}).AddIndexSQL("_idx_foo_stuff", "stuff")
+	err = db.Model(&Foo{}).Select("DISTINCT stuff").Count(&stuffs)
 	if err != nil {
 		t.Fatal(err)
 	}
-	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddIndexSQL)
-	sql.Q = strings.TrimSpace(sql.Q)
-	if sql.Q != expect {
-		t.Errorf("expected %s got %s", expect, sql.Q)
+	if stuffs != 4 {
+		t.Errorf("distinct: expected %d got %d", 4, stuffs)
+	}
+	err = db.Model(&Foo{}).Where("stuff != ?", "d").Group("stuff").Count(&stuffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stuffs != 3 {
+		t.Errorf("group: expected %d got %d", 3, stuffs)
 	}
 }
 
-func TestDB_AddIndex(t *testing.T) {
+func TestDB_Aggregate(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBAddIndex, &Foo{})
+		runWrapDB(t, d, testDBAggregate, &Foo{})
 	}
 }
 
-func testDBAddIndex(t *testing.T, db *DB) {
+func testDBAggregate(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	i := "idx_foo_stuff"
-	_, err = db.Model(&Foo{}).AddIndex(i, "stuff")
+	for _, v := range []string{"a", "b", "c", "d"} {
+		err := db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int64
+	sample := []struct {
+		fn     func(string, interface{}) error
+		expect int64
+	}{
+		{db.Model(&Foo{}).Sum, 10},
+		{db.Model(&Foo{}).Min, 1},
+		{db.Model(&Foo{}).Max, 4},
+		{db.Model(&Foo{}).Where("stuff != ?", "a").Order("stuff").Limit(1).Sum, 9},
+		{db.Model(&Foo{}).Where("stuff = ?", "z").Max, 0},
+	}
+	for k, v := range sample {
+		n = -1
+		err = v.fn("id", &n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != v.expect {
+			t.Errorf("%d: expected %d got %d", k, v.expect, n)
+		}
+	}
+	var avg float64
+	err = db.Model(&Foo{}).Where("id > ?", 1).Avg("id", &avg)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be created")
+	if avg != 3 {
+		t.Errorf("expected 3 got %v", avg)
+	}
+	var max []struct {
+		Stuff string
+		ID    int64
+	}
+	err = db.Model(&Foo{}).Group("stuff").Order("stuff desc").Max("id", &max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(max) != 4 {
+		t.Fatalf("expected 4 groups got %v", max)
+	}
+	if max[0].Stuff != "d" || max[0].ID != 4 || max[3].Stuff != "a" || max[3].ID != 1 {
+		t.Errorf("expected the groups in descending order got %v", max)
+	}
+	var ids []int64
+	err = db.Model(&Foo{}).Group("stuff").Max("id", &ids)
+	if err == nil {
+		t.Error("expected an error for a slice of scalars")
+	}
+	err = db.Model(&Foo{}).Sum("id; DROP TABLE foos", &n)
+	if err != errmsg.ErrInvalidSQL {
+		t.Errorf("expected %v got %v", errmsg.ErrInvalidSQL, err)
 	}
 }
 
-func TestDB_DeleteSQL(t *testing.T) {
+type limitedDialect struct {
+	dialects.Dialect
+	max int
+}
+
+func (l limitedDialect) MaxParams() int {
+	return l.max
+}
+
+func TestDB_MaxParams(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBDeleteSQL)
+		runWrapDB(t, d, testDBMaxParams, &Foo{})
 	}
 }
 
-func testDBDeleteSQL(t *testing.T, db *DB) {
+func testDBMaxParams(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	sql, err := db.DeleteSQL(&Foo{ID: 10})
+	dialect := db.dialect
+	max := 65535
+	if isQL(db) {
+		max = 0
+	}
+	if n := dialects.MaxParams(dialect); n != max {
+		t.Errorf("expected %d params for %s got %d", max, dialect.GetName(), n)
+	}
+	db.dialect = limitedDialect{Dialect: dialect, max: 2}
+	defer func() { db.dialect = dialect }()
+
+	var count int
+	err = db.Model(&Foo{}).Where("stuff IN (?)", []string{"a", "b", "c"}).Count(&count)
+	perr, ok := err.(*errmsg.TooManyParamsError)
+	if !ok {
+		t.Fatalf("expected *errmsg.TooManyParamsError got %v", err)
+	}
+	if perr.Params != 3 || perr.Max != 2 {
+		t.Errorf("expected 3 params and max 2 got %d and %d", perr.Params, perr.Max)
+	}
+	err = db.Model(&Foo{}).Where("stuff IN (?)", []string{"a", "b"}).Count(&count)
 	if err != nil {
 		t.Fatal(err)
 	}
-	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.DeleteSQL)
-	sql.Q = strings.TrimSpace(sql.Q)
-	if sql.Q != expect {
-		t.Errorf("expected %s got %s", expect, sql.Q)
+
+	perr = &errmsg.TooManyParamsError{Dialect: "postgres", Params: 70000, Max: 65535, Rows: 10000}
+	if n := perr.ChunkSize(); n != 9362 {
+		t.Errorf("expected 9362 got %d", n)
 	}
 }
 
-func TestDB_Delete(t *testing.T) {
+func TestToSQL(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBDelete, &Foo{})
+		runWrapDB(t, d, testToSQL, &Foo{})
 	}
 }
 
-func testDBDelete(t *testing.T, db *DB) {
+func testToSQL(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	f := Foo{Stuff: "halloween"}
-	err = db.Create(&f)
-	if err != nil {
-		t.Fatal(err)
+	sample := []struct {
+		op     string
+		value  *Foo
+		expect string
+		args   int
+	}{
+		{model.Query, &Foo{}, "SELECT * FROM foos", 0},
+		{model.Create, &Foo{Stuff: "dry"}, "INSERT INTO foos (stuff) VALUES ($1)", 1},
+		{model.Update, &Foo{ID: 1, Stuff: "dry"}, "UPDATE foos SET stuff = $1", 2},
+		{model.Delete, &Foo{ID: 1}, "DELETE FROM foos", 1},
 	}
-	if f.ID == 0 {
-		t.Fatalf("expected a new record to be created")
+	for _, v := range sample {
+		e := db.NewEngine()
+		e.Scope.ContextValue(v.value)
+		s, args, err := hooks.ToSQL(e, v.op)
+		engine.Put(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(s, v.expect) {
+			t.Errorf("expected %s to contain %s", s, v.expect)
+		}
+		if len(args) != v.args {
+			t.Errorf("%s: expected %d args got %v", v.op, v.args, args)
+		}
 	}
-
-	err = db.Delete(&f)
+	var count int
+	err = db.Model(&Foo{}).Count(&count)
 	if err != nil {
 		t.Fatal(err)
 	}
-	fu := Foo{}
-	err = db.Model(&Foo{ID: f.ID}).First(&fu)
+	if count != 0 {
+		t.Errorf("expected nothing to be executed got %d records", count)
+	}
+	e := db.NewEngine()
+	defer engine.Put(e)
+	_, _, err = hooks.ToSQL(e, "truncate")
 	if err == nil {
-		t.Fatal("expected an error")
+		t.Error("expected an error")
 	}
 }
 
-func TestDB_AddUniqueIndex(t *testing.T) {
+func TestDB_Analyze(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBAddUniqueIndex, &Foo{})
+		runWrapDB(t, d, testDBAnalyze, &Foo{})
 	}
 }
 
-func testDBAddUniqueIndex(t *testing.T, db *DB) {
+func testDBAnalyze(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	i := "idx_foo_stuff"
-	ndb := db.Model(&Foo{})
-	_, err = ndb.AddUniqueIndex(i, "stuff")
-	if err != nil {
-		t.Fatal(err)
+	var logs []string
+	a := &model.Analyzer{
+		Threshold: 2,
+		Logf: func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
 	}
-	if !db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be created")
+	db.Analyze(a)
+	defer db.Analyze(nil)
+	ctx := model.WithQueryCounts(context.Background())
+	for _, v := range []string{"a", "b", "c", "d"} {
+		var foos []Foo
+		err = db.WithContext(ctx).Where("stuff = ?", v).Find(&foos)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
-	q := ndb.e.Scope.SQL
-	q = strings.TrimSpace(q)
-	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddUniqueIndex)
-	if q != expect {
-		t.Errorf("expected %s got %s", expect, q)
+	if len(logs) != 1 {
+		t.Fatalf("expected one report got %v", logs)
+	}
+	if !strings.Contains(logs[0], `Preload("Foos")`) {
+		t.Errorf("expected a preload suggestion got %s", logs[0])
+	}
+	if len(a.Histograms()) != 1 {
+		t.Errorf("expected one histogram got %v", a.Histograms())
 	}
 }
 
-func TestDB_RemoveIndex(t *testing.T) {
+func TestDB_Budget(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBRemoveIndex, &Foo{})
+		runWrapDB(t, d, testDBBudget, &Foo{})
 	}
 }
 
-func testDBRemoveIndex(t *testing.T, db *DB) {
+func testDBBudget(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	i := "idx_foo_stuff"
-	ndb := db.Model(&Foo{})
-	_, err = ndb.AddUniqueIndex(i, "stuff")
-	if err != nil {
-		t.Fatal(err)
+	b := &model.Budget{MaxStatements: 2, Strict: true}
+	ctx := model.WithBudget(context.Background(), b)
+	var foos []Foo
+	for i := 0; i < 2; i++ {
+		err = db.WithContext(ctx).Find(&foos)
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
-	if !db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be created")
+	err = db.WithContext(ctx).Find(&foos)
+	if err != errmsg.ErrBudgetExceeded {
+		t.Errorf("expected %v got %v", errmsg.ErrBudgetExceeded, err)
 	}
-	err = db.Model(&Foo{}).RemoveIndex(i)
-	if err != nil {
-		t.Fatal(err)
+	if b.Statements() != 2 {
+		t.Errorf("expected 2 statements got %d", b.Statements())
 	}
-	if db.Dialect().HasIndex("foos", i) {
-		t.Error("expected index to be gone")
+
+	var logs []string
+	b = &model.Budget{
+		MaxStatements: 1,
+		Logf: func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}
+	ctx = model.WithBudget(context.Background(), b)
+	for i := 0; i < 3; i++ {
+		err = db.WithContext(ctx).Find(&foos)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(logs) != 1 {
+		t.Errorf("expected one report got %v", logs)
 	}
 }
 
-func TestDB_DropColumn(t *testing.T) {
+func TestDB_Scopes(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBDropColumn, &Foo{})
+		runWrapDB(t, d, testDBScopes, &Foo{})
 	}
 }
 
-func testDBDropColumn(t *testing.T, db *DB) {
+func testDBScopes(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	col := "stuff"
-	_, err = db.Model(&Foo{}).DropColumn(col)
+	for _, v := range []string{"a", "b", "c", "d"} {
+		err = db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	notA := func(e *engine.Engine) *engine.Engine {
+		search.Where(e, "stuff != ?", "a")
+		return e
+	}
+	recent := func(e *engine.Engine) *engine.Engine {
+		search.Order(e, "id DESC")
+		search.Limit(e, 2)
+		return e
+	}
+	var foos []Foo
+	err = db.Scopes(notA, recent).Find(&foos)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if db.Dialect().HasColumn("foos", col) {
-		t.Error("expected column to be gone")
+	var stuff []string
+	for _, v := range foos {
+		stuff = append(stuff, v.Stuff)
+	}
+	expect := []string{"d", "c"}
+	if strings.Join(stuff, ",") != strings.Join(expect, ",") {
+		t.Errorf("expected %v got %v", expect, stuff)
 	}
 }
 
-func TestDB_FirstOrCreate(t *testing.T) {
+func TestDB_RecordTimings(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBFirstOrCreate, &Foo{})
+		runWrapDB(t, d, testDBRecordTimings, &Foo{})
 	}
 }
 
-func testDBFirstOrCreate(t *testing.T, db *DB) {
+func testDBRecordTimings(t *testing.T, db *DB) {
 	_, err := db.Automigrate(&Foo{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	first := Foo{Stuff: "first"}
-	err = db.FirstOrCreate(&first)
+	timings := &model.Timings{}
+	db.RecordTimings(timings)
+	defer db.RecordTimings(nil)
+	err = db.Create(&Foo{Stuff: "timed"})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if first.ID == 0 {
-		t.Error("expected a new record")
-	}
-	second := Foo{}
-	err = db.Begin().Where(Foo{Stuff: first.Stuff}).FirstOrCreate(&second)
+	var foos []Foo
+	err = db.Find(&foos)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if second.ID != first.ID {
-		t.Errorf("expected %d got %d", first.ID, second.ID)
+	ops := make(map[string]int64)
+	for _, v := range timings.Report() {
+		if v.Table != "foos" {
+			t.Errorf("unexpected table %s", v.Table)
+		}
+		ops[v.Op] += v.Count
+	}
+	if ops["INSERT"] != 1 || ops["SELECT"] != 1 {
+		t.Errorf("expected an insert and a select got %v", ops)
 	}
 }
 
-func TestDB_Preload(t *testing.T) {
+func TestDB_CachePlans(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testDBPreload,
-			&fixture.User{},
-			&fixture.Email{},
-			&fixture.Language{},
-			&fixture.Company{},
-			&fixture.CreditCard{},
-			&fixture.Address{},
-		)
+		runWrapDB(t, d, testDBCachePlans, &Foo{})
 	}
 }
 
-func testDBPreload(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&fixture.User{},
-		&fixture.Email{},
-		&fixture.Language{},
-		&fixture.Company{},
-		&fixture.CreditCard{},
-		&fixture.Address{},
-	)
-	if err != nil {
-		t.Fatal(err)
-	}
-	user1, err := getPreparedUser(db, "user1", "Preload")
+func testDBCachePlans(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		err = db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.CachePlans(10)
+	defer db.CachePlans(0)
+	for _, v := range []string{"a", "b", "c"} {
+		var foos []Foo
+		err = db.Where("stuff = ?", v).Find(&foos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(foos) != 1 || foos[0].Stuff != v {
+			t.Errorf("expected %s got %v", v, foos)
+		}
+	}
+	if hits, _ := db.PlanCache().Stats(); hits != 2 {
+		t.Errorf("expected 2 hits got %d", hits)
+	}
+}
+
+func TestDB_AddIndexSQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAddIndexSQL, &Foo{})
+	}
+}
+
+func testDBAddIndexSQL(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.AddIndexSQL("_idx_foo_stuff", "stuff")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	sql, err := db.Model(&Foo{}).AddIndexSQL("_idx_foo_stuff", "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddIndexSQL)
+	sql.Q = strings.TrimSpace(sql.Q)
+	if sql.Q != expect {
+		t.Errorf("expected %s got %s", expect, sql.Q)
+	}
+}
+
+func TestDB_AddIndex(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAddIndex, &Foo{})
+	}
+}
+
+func testDBAddIndex(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := "idx_foo_stuff"
+	_, err = db.Model(&Foo{}).AddIndex(i, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be created")
+	}
+}
+
+func TestDB_DeleteSQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDeleteSQL)
+	}
+}
+
+func testDBDeleteSQL(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, err := db.DeleteSQL(&Foo{ID: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.DeleteSQL)
+	sql.Q = strings.TrimSpace(sql.Q)
+	if sql.Q != expect {
+		t.Errorf("expected %s got %s", expect, sql.Q)
+	}
+}
+
+func TestDB_Delete(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDelete, &Foo{})
+	}
+}
+
+func testDBDelete(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := Foo{Stuff: "halloween"}
+	err = db.Create(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ID == 0 {
+		t.Fatalf("expected a new record to be created")
+	}
+
+	err = db.Delete(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fu := Foo{}
+	err = db.Model(&Foo{ID: f.ID}).First(&fu)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, v := range []string{"a", "b", "b", "c"} {
+		err = db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := db.Where("stuff != ?", "a").DeleteRows(&Foo{}, "stuff = ?", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 got %d", n)
+	}
+	err = db.Delete(&Foo{})
+	if err != errmsg.ErrMissingWhereClause {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingWhereClause, err)
+	}
+	n, err = db.AllowGlobalDelete().DeleteRows(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ql truncates the table and reports no affected rows.
+	if n != 2 && !dialects.IsQL(db.Dialect()) {
+		t.Errorf("expected 2 got %d", n)
+	}
+	var count int
+	err = db.Model(&Foo{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no rows got %d", count)
+	}
+}
+
+func TestDB_DeleteInBatches(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDeleteInBatches, &Foo{})
+	}
+}
+
+func testDBDeleteInBatches(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "b", "b", "b", "b", "c"} {
+		err = db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.DeleteInBatches(&Foo{}, 2)
+	if err != errmsg.ErrMissingWhereClause {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingWhereClause, err)
+	}
+	_, err = db.DeleteInBatches(&Foo{}, 0, "stuff = ?", "b")
+	if err == nil {
+		t.Error("expected an error for an invalid batch size")
+	}
+	n, err := db.Where("stuff != ?", "a").DeleteInBatches(&Foo{}, 2, "stuff != ?", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5 got %d", n)
+	}
+	var stuff []string
+	err = db.Model(&Foo{}).Order("stuff").Pluck("stuff", &stuff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stuff, []string{"a", "c"}) {
+		t.Errorf("expected [a c] got %v", stuff)
+	}
+
+	// All the batches run in the transaction of db.
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = tx.DeleteInBatches(&Foo{}, 1, "stuff IN (?)", []string{"a", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 got %d", n)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	err = db.Model(&Foo{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no rows got %d", count)
+	}
+}
+
+func TestDB_AddUniqueIndex(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAddUniqueIndex, &Foo{})
+	}
+}
+
+func testDBAddUniqueIndex(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := "idx_foo_stuff"
+	ndb := db.Model(&Foo{})
+	_, err = ndb.AddUniqueIndex(i, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be created")
+	}
+	q := ndb.e.Scope.SQL
+	q = strings.TrimSpace(q)
+	expect := fixture.GetSQL(db.Dialect().GetName(), fixture.AddUniqueIndex)
+	if q != expect {
+		t.Errorf("expected %s got %s", expect, q)
+	}
+}
+
+func TestDB_RemoveIndex(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBRemoveIndex, &Foo{})
+	}
+}
+
+func testDBRemoveIndex(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := "idx_foo_stuff"
+	ndb := db.Model(&Foo{})
+	_, err = ndb.AddUniqueIndex(i, "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be created")
+	}
+	err = db.Model(&Foo{}).RemoveIndex(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Dialect().HasIndex("foos", i) {
+		t.Error("expected index to be gone")
+	}
+}
+
+func TestDB_DropColumn(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDropColumn, &Foo{})
+	}
+}
+
+func testDBDropColumn(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := "stuff"
+	_, err = db.Model(&Foo{}).DropColumn(col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Dialect().HasColumn("foos", col) {
+		t.Error("expected column to be gone")
+	}
+}
+
+func TestDB_FirstOrCreate(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFirstOrCreate, &Foo{})
+	}
+}
+
+func testDBFirstOrCreate(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := Foo{Stuff: "first"}
+	err = db.FirstOrCreate(&first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == 0 {
+		t.Error("expected a new record")
+	}
+	second := Foo{}
+	err = db.Begin().Where(Foo{Stuff: first.Stuff}).FirstOrCreate(&second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected %d got %d", first.ID, second.ID)
+	}
+}
+
+func TestDB_Preload(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreload,
+			&fixture.User{},
+			&fixture.Email{},
+			&fixture.Language{},
+			&fixture.Company{},
+			&fixture.CreditCard{},
+			&fixture.Address{},
+		)
+	}
+}
+
+func testDBPreload(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&fixture.User{},
+		&fixture.Email{},
+		&fixture.Language{},
+		&fixture.Company{},
+		&fixture.CreditCard{},
+		&fixture.Address{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user1, err := getPreparedUser(db, "user1", "Preload")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -825,279 +1935,4007 @@ func testDBPreload(t *testing.T, db *DB) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	preloadDB := db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	var user fixture.User
-	err = preloadDB.Find(&user)
+	preloadDB := db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company").Preload("Languages")
+	var user fixture.User
+	err = preloadDB.Find(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUserHasPreloadData(db, user, t)
+
+	user2, err := getPreparedUser(db, "user2", "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Save(user2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user3, err := getPreparedUser(db, "user3", "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Begin().Save(user3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []fixture.User
+	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company").Preload("Languages")
+	err = preloadDB.Find(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users {
+		checkUserHasPreloadData(db, user, t)
+	}
+
+	var users2 []*fixture.User
+	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company").Preload("Languages")
+	err = preloadDB.Find(&users2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users2 {
+		checkUserHasPreloadData(db, *user, t)
+	}
+
+	var users3 []*fixture.User
+	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
+		Preload("CreditCard").Preload("Emails").Preload("Company").Preload("Languages")
+	err = preloadDB.Preload("Emails", "email = ?", user3.Emails[0].Email).Find(&users3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range users3 {
+		if user.Name == user3.Name {
+			if len(user.Emails) != 1 {
+				t.Errorf("should only preload one emails for user3 when with condition")
+			}
+		} else if len(user.Emails) != 0 {
+			t.Errorf("should not preload any emails for other users when with condition")
+		} else if user.Emails == nil {
+			t.Errorf("should return an empty slice to indicate zero results")
+		}
+	}
+}
+
+type Shop struct {
+	ID     int64
+	Name   string
+	Orders []ShopOrder
+}
+
+type ShopOrder struct {
+	ID     int64
+	ShopID int64
+	Shop   *Shop
+	Items  []OrderItem
+}
+
+type OrderItem struct {
+	ID          int64
+	ShopOrderID int64
+	ProductID   int64
+	Product     ItemProduct
+}
+
+type ItemProduct struct {
+	ID   int64
+	Code string
+}
+
+type Warehouse struct {
+	ID   int64
+	Name string
+	Bins []Bin
+}
+
+type Bin struct {
+	ID          int64
+	WarehouseID int64
+	Label       string
+}
+
+func TestDB_SaveAssociations(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBSaveAssociations, &Shop{}, &ShopOrder{}, &Warehouse{})
+	}
+}
+
+func testDBSaveAssociations(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &ShopOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	countOrders := func(expect int) {
+		t.Helper()
+		var n int
+		if err := db.Model(&ShopOrder{}).Count(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != expect {
+			t.Errorf("expected %d orders got %d", expect, n)
+		}
+	}
+	shop := Shop{Name: "corner", Orders: []ShopOrder{{}, {}}}
+	err = db.Create(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range shop.Orders {
+		if o.ID == 0 || o.ShopID != shop.ID {
+			t.Errorf("expected the order to be saved got %+v", o)
+		}
+	}
+	countOrders(2)
+
+	// The saved associations are updated, not inserted again.
+	shop.Name = "market"
+	err = db.Save(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	countOrders(2)
+
+	err = db.SkipAssociations().Create(&Shop{Name: "kiosk", Orders: []ShopOrder{{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	countOrders(2)
+
+	// The model isn't saved when its associations fail to be.
+	_, err = db.Automigrate(&Warehouse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Warehouse{Name: "north", Bins: []Bin{{Label: "a"}}})
+	if err == nil {
+		t.Fatal("expected an error saving the bins without their table")
+	}
+	var n int
+	err = db.Model(&Warehouse{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected no warehouse got %d", n)
+	}
+}
+
+type Depot struct {
+	ID     int64
+	Name   string
+	Crates []Crate `gorm:"ASSOCIATION_AUTOCREATE:false"`
+}
+
+type Crate struct {
+	ID      int64
+	DepotID int64
+	Label   string
+}
+
+func TestDB_AssociationSaving(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAssociationSaving, &Depot{}, &Crate{}, &Warehouse{}, &Bin{})
+	}
+}
+
+func testDBAssociationSaving(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Depot{}, &Crate{}, &Warehouse{}, &Bin{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crates := func() map[string]int64 {
+		t.Helper()
+		var all []Crate
+		if err := db.Find(&all); err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]int64)
+		for _, c := range all {
+			m[c.Label] = c.DepotID
+		}
+		return m
+	}
+
+	// The tag disables creating the crates.
+	depot := Depot{Name: "east", Crates: []Crate{{Label: "new"}}}
+	err = db.Create(&depot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depot.ID == 0 {
+		t.Fatal("expected the depot to be saved")
+	}
+	if m := crates(); len(m) != 0 {
+		t.Errorf("expected no crate got %v", m)
+	}
+
+	// The saved crates are still updated and linked.
+	a, b := Crate{Label: "a"}, Crate{Label: "b"}
+	for _, c := range []*Crate{&a, &b} {
+		if err := db.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Label = "a1"
+	depot.Crates = []Crate{a}
+	err = db.Save(&depot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := crates(); m["a1"] != depot.ID {
+		t.Errorf("expected a1 in depot %d got %v", depot.ID, m)
+	}
+
+	// Only the references are saved without updating.
+	b.Label = "b1"
+	depot.Crates = []Crate{b}
+	err = db.Set(model.AssociationAutoUpdate, false).Save(&depot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := crates()
+	if _, ok := m["b1"]; ok {
+		t.Errorf("expected b not to be updated got %v", m)
+	}
+	if m["b"] != depot.ID {
+		t.Errorf("expected b in depot %d got %v", depot.ID, m)
+	}
+
+	// Nothing is saved when disabled for the whole db.
+	db.SetAssociationSaving(model.AssociationSaving{})
+	err = db.Create(&Warehouse{Name: "west", Bins: []Bin{{Label: "c"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	err = db.Model(&Bin{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected no bin got %d", n)
+	}
+
+	// The transactions of db keep the setting.
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&Warehouse{Name: "north", Bins: []Bin{{Label: "d"}}})
+	if err != nil {
+		_ = tx.Rollback()
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&Bin{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected no bin in the transaction got %d", n)
+	}
+}
+
+type Library struct {
+	ID      int64
+	Name    string
+	Books   []Book   `gorm:"CONSTRAINT:OnDelete:CASCADE,OnUpdate:CASCADE"`
+	Readers []Reader `gorm:"CONSTRAINT:OnDelete:SET NULL"`
+}
+
+type Book struct {
+	ID        int64
+	LibraryID int64
+	Title     string
+	Chapters  []Chapter `gorm:"CONSTRAINT:OnDelete:CASCADE"`
+	Loans     []Loan    `gorm:"CONSTRAINT:OnDelete:RESTRICT"`
+}
+
+type Chapter struct {
+	ID     int64
+	BookID int64
+	Title  string
+}
+
+type Reader struct {
+	ID        int64
+	LibraryID *int64
+	Name      string
+}
+
+type Loan struct {
+	ID     int64
+	BookID int64
+}
+
+func TestDB_DeleteCascade(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDeleteCascade, &Loan{}, &Chapter{}, &Reader{}, &Book{}, &Library{})
+	}
+}
+
+func testDBDeleteCascade(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Library{}, &Book{}, &Chapter{}, &Reader{}, &Loan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isQL(db) {
+		for _, field := range []string{"Books", "Readers"} {
+			stmts, err := db.Model(&Library{}).ConstraintSQL(field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = db.SQLCommon().Exec(stmts[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, field := range []string{"Chapters", "Loans"} {
+			stmts, err := db.Model(&Book{}).ConstraintSQL(field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = db.SQLCommon().Exec(stmts[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	libs := []Library{
+		{Name: "a", Books: []Book{
+			{Title: "a1", Chapters: []Chapter{{Title: "x"}, {Title: "y"}}},
+			{Title: "a2"},
+		}, Readers: []Reader{{Name: "r"}}},
+		{Name: "b", Books: []Book{{Title: "b1", Chapters: []Chapter{{Title: "z"}}}}},
+	}
+	for i := range libs {
+		if err := db.Create(&libs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(value interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.Model(value).Count(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	err = db.Delete(&libs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(&Book{}); n != 1 {
+		t.Errorf("expected 1 book got %d", n)
+	}
+	if n := count(&Chapter{}); n != 1 {
+		t.Errorf("expected 1 chapter got %d", n)
+	}
+	var reader Reader
+	err = db.First(&reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.LibraryID != nil {
+		t.Errorf("expected the reader to be detached got library %d", *reader.LibraryID)
+	}
+
+	// The loans prevent deleting the book and its library.
+	book := libs[1].Books[0]
+	err = db.Create(&Loan{BookID: book.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Delete(&libs[1])
+	if err == nil {
+		t.Fatal("expected an error deleting a book on loan")
+	}
+	if n := count(&Chapter{}); n != 1 {
+		t.Errorf("expected the chapter to be kept got %d", n)
+	}
+}
+
+type Gallery struct {
+	ID     int64
+	Name   string
+	Frames []Frame `gorm:"CONSTRAINT:OnDelete:CASCADE"`
+	Photos []Photo `gorm:"CONSTRAINT:OnDelete:CASCADE"`
+}
+
+type Frame struct {
+	ID        int64
+	GalleryID int64
+	Color     string
+}
+
+type Photo struct {
+	ID        int64
+	GalleryID int64
+	Title     string
+	Prints    []Print `gorm:"CONSTRAINT:OnDelete:RESTRICT"`
+}
+
+type Print struct {
+	ID      int64
+	PhotoID int64
+	Size    string
+}
+
+func TestDB_DeleteCascadeRestrict(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBDeleteCascadeRestrict, &Print{}, &Photo{}, &Frame{}, &Gallery{})
+	}
+}
+
+func testDBDeleteCascadeRestrict(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Gallery{}, &Frame{}, &Photo{}, &Print{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isQL(db) {
+		for _, c := range []struct {
+			value interface{}
+			field string
+		}{
+			{&Gallery{}, "Frames"}, {&Gallery{}, "Photos"}, {&Photo{}, "Prints"},
+		} {
+			stmts, err := db.Model(c.value).ConstraintSQL(c.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = db.SQLCommon().Exec(stmts[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	g := Gallery{
+		Name:   "a",
+		Frames: []Frame{{Color: "red"}, {Color: "blue"}},
+		Photos: []Photo{{Title: "x", Prints: []Print{{Size: "A4"}}}},
+	}
+	err = db.Create(&g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The print of the photo is checked before the frames are deleted.
+	err = db.Delete(&g)
+	if err == nil {
+		t.Fatal("expected an error deleting a gallery with a printed photo")
+	}
+	var n int
+	err = db.Model(&Frame{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected the frames to be kept got %d", n)
+	}
+}
+
+func TestDB_ConstraintSQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBConstraintSQL, &Reader{}, &Book{}, &Library{})
+	}
+}
+
+func testDBConstraintSQL(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Library{}, &Book{}, &Reader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := db.Model(&Library{}).ConstraintSQL("Books")
+	if isQL(db) {
+		if err == nil {
+			t.Error("expected an error")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 1 {
+		t.Fatalf("expected 1 statement got %v", stmts)
+	}
+	e := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s) ON DELETE CASCADE ON UPDATE CASCADE;",
+		db.Dialect().Quote("library_id"), db.Dialect().Quote("libraries"), db.Dialect().Quote("id"))
+	if !strings.Contains(stmts[0], e) {
+		t.Errorf("expected %s got %s", e, stmts[0])
+	}
+	_, err = db.Model(&Library{}).ConstraintSQL("Name")
+	if err == nil {
+		t.Error("expected an error for a field without relationship")
+	}
+}
+
+func TestDB_MigrateForeignKeys(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBMigrateForeignKeys, &Chapter{}, &Loan{}, &Book{})
+	}
+}
+
+func testDBMigrateForeignKeys(t *testing.T, db *DB) {
+	db.MigrateForeignKeys(true)
+	q, err := db.AutomigrateSQL(&Book{}, &Chapter{}, &Loan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isQL(db) {
+		if strings.Contains(q.Q, "FOREIGN KEY") {
+			t.Errorf("expected no foreign key with ql got %s", q.Q)
+		}
+		return
+	}
+	for _, table := range []string{"chapters", "loans"} {
+		e := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT", db.Dialect().Quote(table))
+		if !strings.Contains(q.Q, e) {
+			t.Errorf("expected %s got %s", e, q.Q)
+		}
+	}
+	if !strings.Contains(q.Q, "ON DELETE RESTRICT") {
+		t.Errorf("expected the action of the tag got %s", q.Q)
+	}
+	_, err = db.Automigrate(&Book{}, &Chapter{}, &Loan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Chapter{BookID: 404})
+	if err == nil {
+		t.Error("expected an error creating a chapter without its book")
+	}
+
+	// The existing constraints aren't added again.
+	q, err = db.AutomigrateSQL(&Book{}, &Chapter{}, &Loan{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(q.Q, "FOREIGN KEY") {
+		t.Errorf("expected no foreign key got %s", q.Q)
+	}
+
+	db.MigrateForeignKeys(false)
+	q, err = db.CreateTableSQL(&Book{}, &Chapter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(q.Q, "FOREIGN KEY") {
+		t.Errorf("expected no foreign key once disabled got %s", q.Q)
+	}
+
+	// The transactions of db keep the setting.
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	q, err = tx.CreateTableSQL(&Book{}, &Chapter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(q.Q, "FOREIGN KEY") {
+		t.Errorf("expected no foreign key in the transaction got %s", q.Q)
+	}
+}
+
+func TestRelated(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testRelated, &Shop{}, &ShopOrder{})
+	}
+}
+
+func testRelated(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &ShopOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shops := []Shop{
+		{Name: "a", Orders: []ShopOrder{{}, {}}},
+		{Name: "b", Orders: []ShopOrder{{}}},
+		{Name: "c", Orders: []ShopOrder{{}}},
+	}
+	for i := range shops {
+		if err := db.Create(&shops[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := db.NewEngine()
+	var orders []ShopOrder
+	err = hooks.Related(e, shops[:2], &orders, "Orders")
+	engine.Put(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 3 {
+		t.Errorf("expected 3 orders got %d", len(orders))
+	}
+	for _, o := range orders {
+		if o.ShopID == shops[2].ID {
+			t.Errorf("expected no order of %s", shops[2].Name)
+		}
+	}
+
+	e = db.NewEngine()
+	var shop Shop
+	err = hooks.Related(e, &orders[0], &shop, "Shop")
+	engine.Put(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shop.ID != orders[0].ShopID {
+		t.Errorf("expected shop %d got %d", orders[0].ShopID, shop.ID)
+	}
+
+	e = db.NewEngine()
+	err = hooks.Related(e, &ShopOrder{}, &shop, "Shop")
+	engine.Put(e)
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+	}
+
+	// The orders are counted without being loaded.
+	e = db.NewEngine()
+	var n int
+	err = hooks.CountRelated(e, shops, "Orders", &n)
+	engine.Put(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 orders got %d", n)
+	}
+	a, err := db.Model(&Shop{ID: shops[0].ID}).Association("Orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 orders got %d", n)
+	}
+}
+
+func TestDB_PreloadBatch(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadBatch, &Shop{}, &ShopOrder{})
+	}
+}
+
+func testDBPreloadBatch(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &ShopOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		shop := Shop{Name: fmt.Sprint(i), Orders: make([]ShopOrder, i)}
+		if err := db.Create(&shop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, concurrent := range []bool{false, true} {
+		timings := &model.Timings{}
+		db.RecordTimings(timings)
+		db.PreloadBatch(2, concurrent)
+		var shops []Shop
+		err = db.Preload("Orders").Preload("Orders.Shop").Order("id").Find(&shops)
+		db.PreloadBatch(0, false)
+		db.RecordTimings(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shops) != 5 {
+			t.Fatalf("expected 5 shops got %d", len(shops))
+		}
+		for i, shop := range shops {
+			if len(shop.Orders) != i {
+				t.Errorf("expected %d orders for shop %s got %d", i, shop.Name, len(shop.Orders))
+			}
+			for _, o := range shop.Orders {
+				if o.Shop == nil || o.Shop.ID != shop.ID {
+					t.Errorf("expected the shop of the order to be preloaded got %+v", o.Shop)
+				}
+			}
+		}
+
+		// The 5 shops and the 4 shops of the orders are preloaded in
+		// batches of 2 keys.
+		selects := make(map[string]int64)
+		for _, v := range timings.Report() {
+			if v.Op == "SELECT" {
+				selects[v.Table] += v.Count
+			}
+		}
+		if selects["shop_orders"] != 3 || selects["shops"] != 3 {
+			t.Errorf("expected 3 queries per table got %v", selects)
+		}
+	}
+
+	// The transactions of db keep the setting, the batches run one after
+	// the other.
+	timings := &model.Timings{}
+	db.RecordTimings(timings)
+	defer db.RecordTimings(nil)
+	db.PreloadBatch(2, true)
+	defer db.PreloadBatch(0, false)
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	var shops []Shop
+	err = tx.Preload("Orders").Find(&shops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var selects int64
+	for _, v := range timings.Report() {
+		if v.Op == "SELECT" && v.Table == "shop_orders" {
+			selects += v.Count
+		}
+	}
+	if selects != 3 {
+		t.Errorf("expected 3 queries of the orders in the transaction got %d", selects)
+	}
+}
+
+type Writer struct {
+	ID       int64
+	Name     string
+	Articles []Article `gorm:"PRELOAD:true"`
+	Bio      WriterBio
+	Avatar   WriterAvatar `gorm:"PRELOAD:false"`
+}
+
+type Article struct {
+	ID       int64
+	WriterID int64
+	Writer   *Writer
+	Notes    []ArticleNote
+}
+
+type ArticleNote struct {
+	ID        int64
+	ArticleID int64
+	Text      string
+}
+
+type WriterBio struct {
+	ID       int64
+	WriterID int64
+	Text     string
+}
+
+type WriterAvatar struct {
+	ID       int64
+	WriterID int64
+	URL      string
+}
+
+func TestDB_AutoPreload(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAutoPreload,
+			&Writer{}, &Article{}, &ArticleNote{}, &WriterBio{}, &WriterAvatar{})
+	}
+}
+
+func testDBAutoPreload(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Writer{}, &Article{}, &ArticleNote{}, &WriterBio{}, &WriterAvatar{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Writer{
+		Name:     "a",
+		Articles: []Article{{Notes: []ArticleNote{{Text: "n"}}}, {}},
+		Bio:      WriterBio{Text: "bio"},
+		Avatar:   WriterAvatar{URL: "a.png"},
+	}
+	err = db.Create(&w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the tagged associations are preloaded by default.
+	var writers []Writer
+	err = db.Find(&writers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(writers) != 1 || len(writers[0].Articles) != 2 {
+		t.Fatalf("expected the articles to be preloaded got %+v", writers)
+	}
+	if writers[0].Bio.ID != 0 {
+		t.Errorf("expected no bio got %+v", writers[0].Bio)
+	}
+	if len(writers[0].Articles[0].Notes)+len(writers[0].Articles[1].Notes) != 0 {
+		t.Error("expected no notes")
+	}
+
+	db.AutoPreload(true)
+	var found Writer
+	err = db.First(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Bio.Text != "bio" {
+		t.Errorf("expected the bio to be preloaded got %+v", found.Bio)
+	}
+	if found.Avatar.ID != 0 {
+		t.Errorf("expected no avatar got %+v", found.Avatar)
+	}
+	notes := 0
+	for _, a := range found.Articles {
+		notes += len(a.Notes)
+		if a.Writer != nil {
+			t.Error("expected the writer of the articles not to be preloaded again")
+		}
+	}
+	if notes != 1 {
+		t.Errorf("expected the notes of the articles to be preloaded got %d", notes)
+	}
+
+	found = Writer{}
+	err = db.Set(model.AutoPreload, false).First(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Bio.ID != 0 || len(found.Articles) != 2 {
+		t.Errorf("expected only the articles to be preloaded got %+v", found)
+	}
+
+	// The writer of an article is preloaded, not the articles of the writer.
+	var article Article
+	err = db.First(&article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Writer == nil || article.Writer.Name != "a" {
+		t.Fatalf("expected the writer to be preloaded got %+v", article.Writer)
+	}
+	if len(article.Writer.Articles) != 0 {
+		t.Errorf("expected no articles of the writer got %d", len(article.Writer.Articles))
+	}
+
+	// The transactions of db keep the setting.
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	found = Writer{}
+	err = tx.First(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Bio.Text != "bio" {
+		t.Errorf("expected the bio to be preloaded in the transaction got %+v", found.Bio)
+	}
+}
+
+type Customer struct {
+	ID       int64
+	Email    string    `gorm:"unique_index"`
+	Invoices []Invoice `gorm:"FOREIGNKEY:CustomerEmail;REFERENCES:Email"`
+}
+
+type Invoice struct {
+	ID            int64
+	CustomerEmail string
+	Customer      *Customer `gorm:"FOREIGNKEY:CustomerEmail;REFERENCES:Email"`
+	Total         int64
+}
+
+func TestDB_References(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBReferences, &Invoice{}, &Customer{})
+	}
+}
+
+func testDBReferences(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Customer{}, &Invoice{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := db.NewEngine()
+	for _, v := range []interface{}{&Customer{}, &Invoice{}} {
+		m, err := scope.GetModelStruct(e, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range m.StructFields {
+			if rel := f.Relationship; rel != nil {
+				if refs := rel.AssociationForeignDBNames; !reflect.DeepEqual(refs, []string{"email"}) {
+					t.Errorf("expected %s of %s to reference email got %v", f.Name, m.ModelType, refs)
+				}
+			}
+		}
+	}
+	engine.Put(e)
+
+	customers := []Customer{
+		{ID: 10, Email: "a@example.com", Invoices: []Invoice{{Total: 1}, {Total: 2}}},
+		{ID: 20, Email: "b@example.com", Invoices: []Invoice{{Total: 3}}},
+	}
+	for i := range customers {
+		if err := db.Create(&customers[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if customers[0].Invoices[0].CustomerEmail != "a@example.com" {
+		t.Errorf("expected the email to be referenced got %q", customers[0].Invoices[0].CustomerEmail)
+	}
+
+	var found []Customer
+	err = db.Preload("Invoices").Order("id").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || len(found[0].Invoices) != 2 || len(found[1].Invoices) != 1 {
+		t.Fatalf("expected the invoices by email got %+v", found)
+	}
+
+	var invoices []Invoice
+	err = db.Preload("Customer").Find(&invoices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range invoices {
+		if i.Customer == nil || i.Customer.Email != i.CustomerEmail {
+			t.Errorf("expected the customer %s got %+v", i.CustomerEmail, i.Customer)
+		}
+	}
+}
+
+type Post struct {
+	ID    int64
+	Title string
+	PostContent
+	Meta PostMeta `gorm:"EMBEDDED;EMBEDDED_PREFIX:meta_"`
+}
+
+type PostContent struct {
+	Body     string
+	Comments []PostComment
+}
+
+type PostMeta struct {
+	Slug  string
+	Cover PostCover
+}
+
+type PostComment struct {
+	ID     int64
+	PostID int64
+	Text   string
+}
+
+type PostCover struct {
+	ID     int64
+	PostID int64
+	URL    string
+}
+
+func TestDB_EmbeddedRelationships(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBEmbeddedRelationships, &Post{}, &PostComment{}, &PostCover{})
+	}
+}
+
+func testDBEmbeddedRelationships(t *testing.T, db *DB) {
+	e := db.NewEngine()
+	m, err := scope.GetModelStruct(e, &Post{})
+	engine.Put(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range m.StructFields {
+		switch f.Name {
+		case "Comments", "Cover":
+			if f.Relationship == nil {
+				t.Fatalf("expected a relationship for %s", f.Name)
+			}
+			if !reflect.DeepEqual(f.Relationship.ForeignDBNames, []string{"post_id"}) {
+				t.Errorf("expected the foreign key post_id for %s got %v",
+					f.Name, f.Relationship.ForeignDBNames)
+			}
+		}
+	}
+
+	_, err = db.Automigrate(&Post{}, &PostComment{}, &PostCover{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := Post{
+		Title: "a",
+		PostContent: PostContent{
+			Body:     "body",
+			Comments: []PostComment{{Text: "x"}, {Text: "y"}},
+		},
+		Meta: PostMeta{Slug: "a", Cover: PostCover{URL: "a.png"}},
+	}
+	err = db.Create(&post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Comments[0].PostID != post.ID || post.Meta.Cover.PostID != post.ID {
+		t.Fatalf("expected the associations to reference the post got %+v", post)
+	}
+
+	var posts []Post
+	err = db.Preload("Comments").Preload("Cover").Find(&posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 {
+		t.Fatalf("expected 1 post got %d", len(posts))
+	}
+	if len(posts[0].Comments) != 2 {
+		t.Errorf("expected 2 comments got %+v", posts[0].Comments)
+	}
+	if posts[0].Meta.Cover.URL != "a.png" || posts[0].Meta.Slug != "a" {
+		t.Errorf("expected the cover to be preloaded got %+v", posts[0].Meta)
+	}
+
+	var found Post
+	err = db.Preload("Cover").First(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Meta.Cover.URL != "a.png" {
+		t.Errorf("expected the cover to be preloaded got %+v", found.Meta.Cover)
+	}
+}
+
+type ShopSummary struct {
+	ID     int64
+	Name   string
+	Orders []OrderSummary `gorm:"FOREIGNKEY:ShopID"`
+}
+
+type OrderSummary struct {
+	ID     int64
+	ShopID int64
+}
+
+func TestDB_RegisterProjection(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBRegisterProjection, &Shop{}, &ShopOrder{})
+	}
+}
+
+func testDBRegisterProjection(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &ShopOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RegisterProjection(&ShopSummary{}, &Shop{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RegisterProjection(&OrderSummary{}, &ShopOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RegisterProjection(&OrderItem{}, &ShopOrder{})
+	if err == nil {
+		t.Error("expected an error for columns missing from the model")
+	}
+	for _, name := range []string{"a", "b"} {
+		shop := Shop{Name: name, Orders: []ShopOrder{{}, {}}}
+		if err := db.Create(&shop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q, err := db.FindSQL(&[]OrderSummary{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(q.Q, "*") || !strings.Contains(q.Q, "shop_orders") {
+		t.Errorf("expected only the columns of the projection got %s", q.Q)
+	}
+	err = db.Create(&OrderSummary{ShopID: 1})
+	if err != errmsg.ErrProjectionWrite {
+		t.Errorf("expected %v creating a projection got %v", errmsg.ErrProjectionWrite, err)
+	}
+	err = db.Save(&ShopSummary{ID: 1, Name: "c"})
+	if err != errmsg.ErrProjectionWrite {
+		t.Errorf("expected %v saving a projection got %v", errmsg.ErrProjectionWrite, err)
+	}
+	err = db.CreateInBatches(&[]OrderSummary{{ShopID: 1}}, 10)
+	if err != errmsg.ErrProjectionWrite {
+		t.Errorf("expected %v creating projections got %v", errmsg.ErrProjectionWrite, err)
+	}
+
+	var shops []ShopSummary
+	err = db.Preload("Orders").Order("id").Find(&shops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shops) != 2 || shops[0].Name != "a" {
+		t.Fatalf("expected 2 shops got %+v", shops)
+	}
+	for _, shop := range shops {
+		if len(shop.Orders) != 2 {
+			t.Errorf("expected 2 orders for %s got %d", shop.Name, len(shop.Orders))
+		}
+		for _, o := range shop.Orders {
+			if o.ShopID != shop.ID || o.ID == 0 {
+				t.Errorf("expected an order of %d got %+v", shop.ID, o)
+			}
+		}
+	}
+}
+
+type OrgUser struct {
+	ID     int64
+	OrgID  int64
+	UserID int64
+	Name   string
+	Badges []Badge `gorm:"FOREIGNKEY:HolderOrgID, HolderUserID;ASSOCIATIONFOREIGNKEY:OrgID, UserID"`
+}
+
+type Badge struct {
+	ID           int64
+	Title        string
+	HolderOrgID  int64
+	HolderUserID int64
+	Holder       OrgUser `gorm:"FOREIGNKEY:HolderOrgID,HolderUserID;ASSOCIATIONFOREIGNKEY:OrgID,UserID"`
+}
+
+func TestDB_PreloadCompositeKeys(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadCompositeKeys, &OrgUser{}, &Badge{})
+	}
+}
+
+func testDBPreloadCompositeKeys(t *testing.T, db *DB) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	for _, v := range []struct {
+		value       interface{}
+		field, kind string
+		fk, assoc   []string
+	}{
+		{&OrgUser{}, "Badges", "has_many", []string{"holder_org_id", "holder_user_id"}, []string{"org_id", "user_id"}},
+		{&Badge{}, "Holder", "belongs_to", []string{"holder_org_id", "holder_user_id"}, []string{"org_id", "user_id"}},
+	} {
+		f, err := scope.FieldByName(e, v.value, v.field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel := f.Relationship
+		if rel == nil || rel.Kind != v.kind {
+			t.Fatalf("expected %s to be %s got %+v", v.field, v.kind, rel)
+		}
+		if !reflect.DeepEqual(rel.ForeignDBNames, v.fk) {
+			t.Errorf("expected %v got %v", v.fk, rel.ForeignDBNames)
+		}
+		if !reflect.DeepEqual(rel.AssociationForeignDBNames, v.assoc) {
+			t.Errorf("expected %v got %v", v.assoc, rel.AssociationForeignDBNames)
+		}
+	}
+
+	_, err := db.Automigrate(&OrgUser{}, &Badge{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []OrgUser{
+		{OrgID: 1, UserID: 1, Name: "first"},
+		{OrgID: 1, UserID: 2, Name: "second"},
+		{OrgID: 2, UserID: 1, Name: "third"},
+	}
+	for i := range users {
+		if err := db.Begin().Create(&users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	badges := []Badge{
+		{Title: "a", HolderOrgID: 1, HolderUserID: 1},
+		{Title: "b", HolderOrgID: 1, HolderUserID: 2},
+		{Title: "c", HolderOrgID: 1, HolderUserID: 2},
+		{Title: "d", HolderOrgID: 2, HolderUserID: 2},
+	}
+	for i := range badges {
+		if err := db.Begin().Create(&badges[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var found []OrgUser
+	err = db.Preload("Badges").Order("name").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make(map[string][]string)
+	for _, u := range found {
+		for _, b := range u.Badges {
+			titles[u.Name] = append(titles[u.Name], b.Title)
+		}
+		sort.Strings(titles[u.Name])
+	}
+	expect := map[string][]string{"first": {"a"}, "second": {"b", "c"}}
+	if !reflect.DeepEqual(titles, expect) {
+		t.Errorf("expected %v got %v", expect, titles)
+	}
+
+	var holders []Badge
+	err = db.Preload("Holder").Order("title").Find(&holders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range holders {
+		names = append(names, b.Holder.Name)
+	}
+	if e := []string{"first", "second", "second", ""}; !reflect.DeepEqual(names, e) {
+		t.Errorf("expected %v got %v", e, names)
+	}
+}
+
+func TestDB_PreloadNested(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadNested,
+			&Shop{}, &ShopOrder{}, &OrderItem{}, &ItemProduct{},
+		)
+	}
+}
+
+func testDBPreloadNested(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &ShopOrder{}, &OrderItem{}, &ItemProduct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var products []ItemProduct
+	for _, code := range []string{"p1", "p2", "p3"} {
+		p := ItemProduct{Code: code}
+		err = db.Create(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		products = append(products, p)
+	}
+	// The codes of the products of the items of each order of each shop.
+	shops := map[string][][]string{
+		"a": {{"p1", "p2"}, {"p3"}},
+		"b": {{"p2"}},
+	}
+	for _, name := range []string{"a", "b"} {
+		shop := Shop{Name: name}
+		err = db.Create(&shop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, codes := range shops[name] {
+			order := ShopOrder{ShopID: shop.ID}
+			err = db.Create(&order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, code := range codes {
+				for _, p := range products {
+					if p.Code == code {
+						err = db.Create(&OrderItem{ShopOrderID: order.ID, ProductID: p.ID})
+						if err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+			}
+		}
+	}
+	codes := func(shop Shop) [][]string {
+		var c [][]string
+		for _, o := range shop.Orders {
+			var oc []string
+			for _, i := range o.Items {
+				oc = append(oc, i.Product.Code)
+			}
+			sort.Strings(oc)
+			c = append(c, oc)
+		}
+		sort.Slice(c, func(i, j int) bool { return len(c[i]) > len(c[j]) })
+		return c
+	}
+
+	var found []Shop
+	err = db.Preload("Orders.Items.Product").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 shops got %d", len(found))
+	}
+	for _, shop := range found {
+		if c := codes(shop); !reflect.DeepEqual(c, shops[shop.Name]) {
+			t.Errorf("shop %s: expected %v got %v", shop.Name, shops[shop.Name], c)
+		}
+	}
+
+	var shop Shop
+	err = db.Preload("Orders").Preload("Orders.Items.Product").Where("name = ?", "b").First(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := codes(shop); !reflect.DeepEqual(c, shops["b"]) {
+		t.Errorf("expected %v got %v", shops["b"], c)
+	}
+
+	// Only the items of the second product, sorted by descending id.
+	var items []OrderItem
+	err = db.Order("id").Find(&items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var orders []ShopOrder
+	err = db.Preload("Items", "product_id = ?", products[1].ID, func(db *DB) *DB {
+		return db.Order("id DESC")
+	}).Order("id").Find(&orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids [][]int64
+	for _, o := range orders {
+		var oi []int64
+		for _, i := range o.Items {
+			oi = append(oi, i.ID)
+		}
+		ids = append(ids, oi)
+	}
+	expect := [][]int64{{items[1].ID}, nil, {items[3].ID}}
+	if !reflect.DeepEqual(ids, expect) {
+		t.Errorf("expected %v got %v", expect, ids)
+	}
+	err = db.Preload("Items", func(db *DB) *DB {
+		return db.Order("id DESC")
+	}).Order("id").Find(&orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders[0].Items) != 2 || orders[0].Items[0].ID != items[1].ID {
+		t.Errorf("expected the items in descending order got %v", orders[0].Items)
+	}
+
+	// Paths may come back to a model.
+	found = nil
+	err = db.Preload("Orders.Shop.Orders").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, shop := range found {
+		for _, o := range shop.Orders {
+			if o.Shop == nil || o.Shop.ID != shop.ID || len(o.Shop.Orders) != len(shop.Orders) {
+				t.Errorf("expected the orders of the shop of the order got %+v", o.Shop)
+			}
+		}
+	}
+}
+
+func TestDB_JoinPreload(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBJoinPreload,
+			&Shop{}, &ShopOrder{},
+			&fixture.User{}, &fixture.CreditCard{},
+		)
+	}
+}
+
+func testDBJoinPreload(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Shop{}, &ShopOrder{}, &fixture.User{}, &fixture.CreditCard{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop := Shop{Name: "a"}
+	err = db.Create(&shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{shop.ID, 0} {
+		err = db.Create(&ShopOrder{ShopID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var orders []ShopOrder
+	err = db.JoinPreload("Shop").Order("id").Find(&orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("expected 2 orders got %d", len(orders))
+	}
+	if orders[0].Shop == nil || orders[0].Shop.Name != "a" {
+		t.Errorf("expected the shop to be loaded got %v", orders[0].Shop)
+	}
+	if orders[1].Shop != nil {
+		t.Errorf("expected no shop got %v", orders[1].Shop)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		u := fixture.User{Name: name}
+		if name == "a" {
+			u.CreditCard = fixture.CreditCard{Number: "123"}
+		}
+		err = db.Create(&u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var user fixture.User
+	err = db.JoinPreload("CreditCard").Where("users.name = ?", "a").First(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "a" || user.CreditCard.Number != "123" {
+		t.Errorf("expected the credit card of a got %v", user.CreditCard)
+	}
+	user = fixture.User{}
+	err = db.JoinPreload("CreditCard").Where("users.name = ?", "b").First(&user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "b" || user.CreditCard.ID != 0 {
+		t.Errorf("expected b without credit card got %v", user.CreditCard)
+	}
+
+	err = db.JoinPreload("Emails").Find(&[]fixture.User{})
+	if err == nil || !strings.Contains(err.Error(), "has_one and belongs_to") {
+		t.Errorf("expected an error for has_many got %v", err)
+	}
+}
+
+func checkUserHasPreloadData(db *DB, user fixture.User, t *testing.T) {
+	u, err := getPreparedUser(db, user.Name, "Preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.BillingAddress.Address1 != u.BillingAddress.Address1 {
+		t.Errorf("BillingAddress: expected %s got %s",
+			u.BillingAddress.Address1, user.BillingAddress.Address1)
+	}
+
+	if user.ShippingAddress.Address1 != u.ShippingAddress.Address1 {
+		t.Errorf("ShippingAddress: expected %s got %s",
+			u.ShippingAddress.Address1, user.ShippingAddress.Address1)
+	}
+
+	if user.CreditCard.Number != u.CreditCard.Number {
+		t.Errorf("CreditCard: expected %s got %s",
+			u.CreditCard.Number, user.CreditCard.Number)
+	}
+
+	if user.Company.Name != u.Company.Name {
+		t.Errorf(" Company: expected %s got %s", u.Company.Name, user.Company.Name)
+	}
+
+	if len(user.Languages) != len(u.Languages) {
+		t.Errorf("Languages: expected %d languages got %d", len(u.Languages), len(user.Languages))
+	} else {
+		names := make(map[string]bool)
+		for _, l := range user.Languages {
+			names[l.Name] = true
+		}
+		for _, l := range u.Languages {
+			if !names[l.Name] {
+				t.Errorf("Languages: expected %s in %v", l.Name, user.Languages)
+			}
+		}
+	}
+
+	if len(user.Emails) != len(u.Emails) {
+		t.Errorf("Emails: expected %d emails got %d", len(u.Emails), len(user.Emails))
+
+	} else {
+		var found int
+		for _, e1 := range u.Emails {
+			for _, e2 := range user.Emails {
+				if e1.Email == e2.Email {
+					found++
+					break
+				}
+			}
+		}
+		if found != len(u.Emails) {
+			t.Errorf("expected %d emails got %d", len(u.Emails), found)
+		}
+	}
+}
+
+func getPreparedUser(db *DB, name string, role string) (*fixture.User, error) {
+	var company fixture.Company
+	err := db.Begin().Where(fixture.Company{Name: role}).FirstOrCreate(&company)
+	if err != nil {
+		return nil, err
+	}
+	return &fixture.User{
+		Name:            name,
+		Age:             20,
+		Role:            fixture.Role{Name: role},
+		BillingAddress:  fixture.Address{Address1: fmt.Sprintf("Billing Address %v", name)},
+		ShippingAddress: fixture.Address{Address1: fmt.Sprintf("Shipping Address %v", name)},
+		CreditCard:      fixture.CreditCard{Number: fmt.Sprintf("123456%v", name)},
+		Emails: []fixture.Email{
+			{Email: fmt.Sprintf("user_%v@example1.com", name)}, {Email: fmt.Sprintf("user_%v@example2.com", name)},
+		},
+		Company: company,
+		Languages: []fixture.Language{
+			{Name: fmt.Sprintf("lang_1_%v", name)},
+			{Name: fmt.Sprintf("lang_2_%v", name)},
+		},
+	}, nil
+}
+
+func TestRelationship_Belongs_To(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, belongsTo,
+			&bUser{}, &bAddr{},
+		)
+	}
+}
+
+type bUser struct {
+	ID     int64
+	Addr   bAddr
+	AddrID int
+	Ship   bAddr
+	ShipID int64
+}
+
+type bAddr struct {
+	ID   int64
+	Name string
+}
+
+func belongsTo(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&bUser{}, &bAddr{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := "some name"
+	u := &bUser{
+		Addr: bAddr{Name: n},
+		Ship: bAddr{Name: n},
+	}
+	err = db.Begin().Create(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID == 0 {
+		t.Error("expected user to be created")
+	}
+	if u.AddrID == 0 {
+		t.Error("expected Addr to be created")
+	}
+	if u.ShipID == 0 {
+		t.Error("expected Ship to be created")
+	}
+}
+func TestDB_AddForeignKeySQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testAddForeignKeySQL,
+			&fixture.User{},
+		)
+	}
+}
+func testAddForeignKeySQL(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&fixture.User{},
+	)
+	sql, err := db.Model(&fixture.User{}).AddForeignKeySQL("city_id", "cities(id)", "RESTRICT", "RESTRICT")
+	if isQL(db) {
+		if err == nil {
+			t.Error("expected an error")
+		}
+	} else {
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := `ALTER TABLE "users" ADD CONSTRAINT "users_city_id_cities_id_foreign" FOREIGN KEY ("city_id") REFERENCES cities(id) ON DELETE RESTRICT ON UPDATE RESTRICT;`
+		e = strings.TrimSpace(e)
+		sql = strings.TrimSpace(sql)
+		if e != sql {
+			t.Errorf("expected %s \n got %s", e, sql)
+		}
+
+		sql, err = db.Model(&Badge{}).AddForeignKeySQL("holder_org_id, holder_user_id",
+			"org_users(org_id,user_id)", "CASCADE", "CASCADE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(sql, `FOREIGN KEY ("holder_org_id","holder_user_id") REFERENCES org_users(org_id,user_id)`) {
+			t.Errorf("expected a composite foreign key got %s", sql)
+		}
+	}
+
+}
+
+type Blog struct {
+	ID         int64  `gorm:"primary_key"`
+	Locale     string `gorm:"primary_key"`
+	Subject    string
+	Body       string
+	Tags       []Tag `gorm:"many2many:blog_tags;"`
+	SharedTags []Tag `gorm:"many2many:shared_blog_tags;ForeignKey:id;AssociationForeignKey:id"`
+	LocaleTags []Tag `gorm:"many2many:locale_blog_tags;ForeignKey:id,locale;AssociationForeignKey:id"`
+}
+
+type Tag struct {
+	ID     int64  `gorm:"primary_key"`
+	Locale string `gorm:"primary_key"`
+	Value  string
+	Blogs  []*Blog `gorm:"many2many:blogs_tags"`
+}
+
+func TestRelationship_Many_To_Many(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testRelManyToMany,
+			&Blog{},
+			&Tag{},
+		)
+	}
+}
+func testRelManyToMany(t *testing.T, db *DB) {
+	_, err := db.Begin().Automigrate(
+		&Blog{}, &Tag{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blog := Blog{
+		Locale:  "ZH",
+		Subject: "subject",
+		Body:    "body",
+		Tags: []Tag{
+			{Locale: "ZH", Value: "tag1"},
+			{Locale: "ZH", Value: "tag2"},
+		},
+	}
+	err = db.Begin().Save(&blog)
+	if err != nil {
+		t.Error(err)
+	}
+
+	a, err := db.Model(&blog).Association("Tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := a.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 2 {
+		t.Errorf("expected 2 got %d", c)
+	}
+}
+
+func TestDB_FindMaps(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFindMaps, &Foo{})
+	}
+}
+
+func testDBFindMaps(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b"} {
+		err := db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rows []map[string]interface{}
+	err = db.Model(&Foo{}).Order("id").Find(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows got %d", len(rows))
+	}
+	if rows[1]["stuff"] != "b" {
+		t.Errorf("expected b got %#v", rows[1]["stuff"])
+	}
+	if _, ok := rows[0]["id"].(int64); !ok {
+		t.Errorf("expected int64 got %T", rows[0]["id"])
+	}
+
+	row := map[string]interface{}{}
+	err = db.Table("foos").Where("stuff = ?", "a").Find(&row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row["stuff"] != "a" {
+		t.Errorf("expected a got %#v", row["stuff"])
+	}
+	err = db.Table("foos").Where("stuff = ?", "z").Find(&row)
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+	}
+}
+
+func TestDB_UnmappedColumns(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBUnmappedColumns, &Foo{})
+	}
+}
+
+func testDBUnmappedColumns(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Foo{Stuff: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var foos []Foo
+	err = db.Select("id, stuff AS stuf").Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.UnmappedColumns(model.UnmappedStrict)
+	err = db.Select("id, stuff").Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Select("id, stuff AS stuf").Find(&foos)
+	u, ok := err.(*errmsg.UnmappedColumnsError)
+	if !ok {
+		t.Fatalf("expected *errmsg.UnmappedColumnsError got %v", err)
+	}
+	if u.Table != "foos" || !reflect.DeepEqual(u.Columns, []string{"stuf"}) {
+		t.Errorf("unexpected error %v", u)
+	}
+
+	var buf bytes.Buffer
+	db.LogOutput(&buf)
+	defer db.LogOutput(nil)
+	db.UnmappedColumns(model.UnmappedLog)
+	err = db.Select("id, stuff AS stuf").Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "stuf") {
+		t.Errorf("expected the unmapped column to be logged got %q", buf.String())
+	}
+}
+
+func TestDB_FormatSQL(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFormatSQL, &Foo{})
+	}
+}
+
+func testDBFormatSQL(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.FormatSQL(true)
+	defer db.FormatSQL(false)
+	var foos []Foo
+	q, err := db.Where("stuff = ?", "a").Order("id").FindSQL(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(q.Q, "\nWHERE") || !strings.Contains(q.Q, "\nORDER BY") {
+		t.Errorf("expected a clause per line got %s", q.Q)
+	}
+
+	var buf bytes.Buffer
+	db.LogOutput(&buf)
+	defer db.LogOutput(nil)
+	db.Verbose(true)
+	defer db.Verbose(false)
+	err = db.Where("stuff = ?", "a").Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nWHERE") {
+		t.Errorf("expected the logged query to be formatted got %q", buf.String())
+	}
+}
+
+func TestDB_Rows(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBRows, &Foo{})
+	}
+}
+
+func testDBRows(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		err := db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := db.Model(&Foo{}).Where("stuff != ?", "b").Order("id").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var stuff []string
+	for rows.Next() {
+		var foo Foo
+		err = db.ScanRows(rows, &foo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stuff = append(stuff, foo.Stuff)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stuff, []string{"a", "c"}) {
+		t.Errorf("expected [a c] got %v", stuff)
+	}
+
+	rows, err = db.Model(&Foo{}).Where("stuff = ?", "b").Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatal("expected a row")
+	}
+	var m map[string]interface{}
+	err = db.ScanRows(rows, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["stuff"] != "b" {
+		t.Errorf("expected b got %#v", m["stuff"])
+	}
+	err = db.ScanRows(rows, Foo{})
+	if err != errmsg.ErrUnaddressable {
+		t.Errorf("expected %v got %v", errmsg.ErrUnaddressable, err)
+	}
+}
+
+func TestDB_ScanScalar(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBScanScalar, &Foo{})
+	}
+}
+
+func testDBScanScalar(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		err := db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var name string
+	err = db.Model(&Foo{}).Select("stuff").Where("id = ?", 2).Find(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "b" {
+		t.Errorf("expected b got %s", name)
+	}
+	var n int64
+	err = db.Model(&Foo{}).Select("count(*)").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 got %d", n)
+	}
+	var stuff *string
+	err = db.Table("foos").Select("stuff").Where("stuff = ?", "c").Scan(&stuff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stuff == nil || *stuff != "c" {
+		t.Errorf("expected c got %v", stuff)
+	}
+	err = db.Model(&Foo{}).Select("stuff").Where("id = ?", 10).Scan(&name)
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+	}
+	err = db.Model(&Foo{}).Scan(&name)
+	if err == nil || !strings.Contains(err.Error(), "select a single column") {
+		t.Errorf("expected a column count error got %v", err)
+	}
+
+	var foo Foo
+	err = db.Model(&Foo{}).Where("stuff = ?", "a").Scan(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID != 1 {
+		t.Errorf("expected 1 got %d", foo.ID)
+	}
+
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		err = db.Model(&Foo{}).Select("id").Order("id").Scan(&ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+			t.Errorf("expected [1 2 3] got %v", ids)
+		}
+	}
+	var names []*string
+	err = db.Model(&Foo{}).Select("stuff").Where("stuff = ?", "b").Find(&names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] == nil || *names[0] != "b" {
+		t.Errorf("expected [b] got %v", names)
+	}
+	var small int8
+	err = db.Model(&Foo{}).Select("id + 1000").Where("id = ?", 1).Scan(&small)
+	if err == nil {
+		t.Errorf("expected an overflow error got %d", small)
+	}
+	var small8 []int8
+	err = db.Model(&Foo{}).Select("id + 1000").Scan(&small8)
+	if err == nil {
+		t.Errorf("expected an overflow error got %v", small8)
+	}
+}
+
+func TestDB_Take(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBTake, &Foo{})
+	}
+}
+
+func testDBTake(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		err := db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var foo Foo
+	err = db.Take(&foo, "stuff = ?", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.ID != 2 {
+		t.Errorf("expected 2 got %d", foo.ID)
+	}
+	foo = Foo{}
+	err = db.First(&foo, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.Stuff != "c" {
+		t.Errorf("expected c got %s", foo.Stuff)
+	}
+	foo = Foo{}
+	err = db.Where("stuff != ?", "c").Last(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if foo.Stuff != "b" {
+		t.Errorf("expected b got %s", foo.Stuff)
+	}
+	for _, fn := range []func(interface{}, ...interface{}) error{db.First, db.Last, db.Take} {
+		err = fn(&Foo{}, 10)
+		if err != errmsg.ErrRecordNotFound {
+			t.Errorf("expected %v got %v", errmsg.ErrRecordNotFound, err)
+		}
+	}
+}
+
+// namedDialect reports a different name than the dialect it wraps, to test
+// the SQL generated for databases that aren't available.
+type namedDialect struct {
+	dialects.Dialect
+	name string
+}
+
+func (d namedDialect) GetName() string {
+	return d.name
+}
+
+func TestDB_From(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFrom)
+	}
+}
+
+func testDBFrom(t *testing.T, db *DB) {
+	_, err := db.Model(&Foo{}).From("bars").Where("foos.id = bars.foo_id").UpdateSQL("stuff", "x")
+	if err == nil && dialects.IsQL(db.Dialect()) {
+		t.Error("expected an error")
+	}
+	d := db.dialect
+	defer func() {
+		db.dialect = d
+	}()
+	sample := []struct {
+		name           string
+		update, delete string
+	}{
+		{"postgres",
+			"UPDATE foos SET stuff = $1 FROM bars WHERE (foos.id = bars.foo_id)",
+			"DELETE FROM foos USING bars WHERE (foos.id = bars.foo_id)"},
+		{"mysql",
+			"UPDATE foos, bars SET stuff = $1 WHERE (foos.id = bars.foo_id)",
+			"DELETE foos FROM foos, bars WHERE (foos.id = bars.foo_id)"},
+	}
+	for _, v := range sample {
+		db.dialect = namedDialect{Dialect: d, name: v.name}
+		sql, err := db.Model(&Foo{}).From("bars").Where("foos.id = bars.foo_id").UpdateSQL("stuff", "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql.Q != v.update {
+			t.Errorf("%s: expected %s got %s", v.name, v.update, sql.Q)
+		}
+		sql, err = db.From("bars").Where("foos.id = bars.foo_id").DeleteSQL(&Foo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql.Q != v.delete {
+			t.Errorf("%s: expected %s got %s", v.name, v.delete, sql.Q)
+		}
+	}
+}
+
+func TestDB_Alias(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAlias)
+	}
+}
+
+func testDBAlias(t *testing.T, db *DB) {
+	var users []FirstOrCreateUser
+	sql, err := db.Model(&FirstOrCreateUser{}).Alias("u1").
+		JoinAs(&FirstOrCreateUser{}, "u2", "u1.name = u2.name AND u1.id != u2.id").
+		Not(map[string]interface{}{"role": "admin"}).FindSQL(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "SELECT u1.* FROM first_or_create_users AS u1 JOIN first_or_create_users AS u2 ON u1.name = u2.name AND u1.id != u2.id WHERE (u1.role <> $1)"
+	if sql.Q != expect {
+		t.Errorf("expected %s got %s", expect, sql.Q)
+	}
+	sql, err = db.Table("first_or_create_users").Alias("u").Where("u.age > ?", 10).FindSQL(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "SELECT * FROM first_or_create_users AS u  WHERE (u.age > $1)"
+	if sql.Q != expect {
+		t.Errorf("expected %s got %s", expect, sql.Q)
+	}
+}
+
+func TestDB_MapColumns(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBMapColumns, &Foo{})
+	}
+}
+
+func testDBMapColumns(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "b"} {
+		err = db.Create(&Foo{Stuff: v})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	type label struct {
+		ID   int64
+		Name string
+	}
+	var labels []label
+	err = db.Table("foos").Select("id, stuff AS title").Order("id").
+		MapColumns(map[string]string{"title": "Name"}).Find(&labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []label{{1, "a"}, {2, "b"}}
+	if !reflect.DeepEqual(labels, expect) {
+		t.Errorf("expected %v got %v", expect, labels)
+	}
+}
+
+func TestDB_Result(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBResult, &Foo{})
+	}
+}
+
+func testDBResult(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r model.Result
+	foo := Foo{Stuff: "a"}
+	err = db.Result(&r).Create(&foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowsAffected != 1 || r.LastInsertID != int64(foo.ID) {
+		t.Errorf("expected 1 row and id %d got %+v", foo.ID, r)
+	}
+	foos := []Foo{{Stuff: "b"}, {Stuff: "c"}}
+	err = db.Result(&r).CreateInBatches(&foos, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowsAffected != 2 || r.LastInsertID != int64(foos[1].ID) {
+		t.Errorf("expected 2 rows and id %d got %+v", foos[1].ID, r)
+	}
+
+	err = db.Model(&Foo{}).Where("stuff = ?", "x").Result(&r).Update("stuff", "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowsAffected != 0 || r.LastInsertID != 0 {
+		t.Errorf("expected no affected rows got %+v", r)
+	}
+	err = db.Model(&Foo{}).Where("stuff = ?", "b").Result(&r).Update("stuff", "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowsAffected != 1 {
+		t.Errorf("expected 1 got %d", r.RowsAffected)
+	}
+	var found []Foo
+	err = db.Result(&r).Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowsAffected != 3 {
+		t.Errorf("expected 3 got %d", r.RowsAffected)
+	}
+}
+
+func TestDB_Timeout(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBTimeout, &Foo{})
+	}
+}
+
+func testDBTimeout(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Foo{Stuff: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var foos []Foo
+	err = db.Timeout(time.Minute).Find(&foos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foos) != 1 {
+		t.Errorf("expected 1 got %d", len(foos))
+	}
+	err = db.Timeout(time.Nanosecond).Find(&foos)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+	err = db.Model(&Foo{}).Where("stuff = ?", "a").Timeout(time.Nanosecond).Update("stuff", "b")
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+
+	// The rows can be read after Rows returns.
+	rows, err := db.Model(&Foo{}).Timeout(time.Minute).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 got %d", n)
+	}
+}
+
+type SoftItem struct {
+	ID        int64
+	Name      string
+	DeletedAt *time.Time
+}
+
+func TestDB_Unscoped(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBUnscoped, &SoftItem{})
+	}
+}
+
+func testDBUnscoped(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&SoftItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []SoftItem{{Name: "a"}, {Name: "b"}}
+	for i := range items {
+		err = db.Create(&items[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Delete(&items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := func(db *DB) int {
+		t.Helper()
+		var n int
+		if err := db.Model(&SoftItem{}).Count(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(db); n != 1 {
+		t.Errorf("expected 1 got %d", n)
+	}
+	var found []SoftItem
+	err = db.Unscoped().Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected 2 got %d", len(found))
+	}
+
+	// Purge the soft deleted row.
+	err = db.Unscoped().Delete(&items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = nil
+	err = db.Unscoped().Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "b" {
+		t.Errorf("expected only b got %v", found)
+	}
+}
+
+type FirstOrCreateUser struct {
+	ID   int64
+	Name string
+	Age  int
+	Role string
+}
+
+func TestDB_UpdatesSelectOmit(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBUpdatesSelectOmit, &FirstOrCreateUser{})
+	}
+}
+
+func testDBUpdatesSelectOmit(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&FirstOrCreateUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := FirstOrCreateUser{Name: "a", Age: 10, Role: "admin"}
+	err = db.Create(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(expect FirstOrCreateUser) {
+		t.Helper()
+		var got FirstOrCreateUser
+		err := db.Where("id = ?", u.ID).Find(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expect {
+			t.Errorf("expected %v got %v", expect, got)
+		}
+	}
+
+	// Blank fields of structs are skipped.
+	err = db.Model(&u).Updates(FirstOrCreateUser{Name: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(FirstOrCreateUser{ID: u.ID, Name: "b", Age: 10, Role: "admin"})
+
+	// Selected fields are updated even when blank.
+	err = db.Model(&u).Select("age").Updates(FirstOrCreateUser{Name: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(FirstOrCreateUser{ID: u.ID, Name: "b", Age: 0, Role: "admin"})
+
+	err = db.Model(&u).Omit("role").Updates(map[string]interface{}{"name": "d", "role": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(FirstOrCreateUser{ID: u.ID, Name: "d", Age: 0, Role: "admin"})
+
+	sql, err := db.Model(&u).Select("name, age").UpdatesSQL(map[string]interface{}{
+		"role": "y", "name": "e", "age": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sql.Q, "UPDATE first_or_create_users SET age = $1, name = $2 ") {
+		t.Errorf("unexpected statement %q", sql.Q)
+	}
+	if !reflect.DeepEqual(sql.Args[:2], []interface{}{1, "e"}) {
+		t.Errorf("unexpected arguments %v", sql.Args)
+	}
+}
+
+type CounterItem struct {
+	ID        int64
+	Hits      int
+	UpdatedAt time.Time
+}
+
+func TestDB_UpdateColumn(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBUpdateColumn, &CounterItem{})
+	}
+}
+
+func testDBUpdateColumn(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&CounterItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := CounterItem{}
+	err = db.Create(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before CounterItem
+	err = db.Where("id = ?", item.ID).Find(&before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = db.Model(&item).UpdateColumn("hits", Expr("hits + ?", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var after CounterItem
+	err = db.Where("id = ?", item.ID).Find(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Hits != 2 {
+		t.Errorf("expected 2 hits got %d", after.Hits)
+	}
+	if !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("expected updated_at to be left alone, %v became %v", before.UpdatedAt, after.UpdatedAt)
+	}
+	err = db.Model(&CounterItem{}).UpdateColumn("hits", 0)
+	if err == nil {
+		t.Error("expected an error without conditions")
+	}
+}
+
+func TestDB_FirstOrCreateAttrs(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFirstOrCreateAttrs, &FirstOrCreateUser{})
+	}
+}
+
+func testDBFirstOrCreateAttrs(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&FirstOrCreateUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u FirstOrCreateUser
+	err = db.Where(FirstOrCreateUser{Name: "a"}).
+		Attrs(FirstOrCreateUser{Age: 20}).
+		Assign(FirstOrCreateUser{Role: "admin"}).
+		FirstOrCreate(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := FirstOrCreateUser{ID: u.ID, Name: "a", Age: 20, Role: "admin"}
+	if u.ID == 0 || u != expect {
+		t.Errorf("expected %+v got %+v", expect, u)
+	}
+	err = db.FirstOrCreate(&FirstOrCreateUser{}, FirstOrCreateUser{Name: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u = FirstOrCreateUser{}
+	err = db.Where(FirstOrCreateUser{Name: "a"}).
+		Attrs(FirstOrCreateUser{Age: 30}).
+		Assign(FirstOrCreateUser{Role: "user"}).
+		FirstOrCreate(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect.Role = "user"
+	if u != expect {
+		t.Errorf("expected %+v got %+v", expect, u)
+	}
+	var stored FirstOrCreateUser
+	err = db.First(&stored, expect.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != expect {
+		t.Errorf("expected %+v got %+v", expect, stored)
+	}
+
+	// conditions given before FirstOrCreate are used to find the record.
+	u = FirstOrCreateUser{}
+	err = db.Where("name = ?", "b").FirstOrCreate(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "b" {
+		t.Errorf("expected b got %s", u.Name)
+	}
+	var n int64
+	err = db.Model(&FirstOrCreateUser{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 got %d", n)
+	}
+}
+
+func TestDB_FirstOrInitAttrs(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBFirstOrInitAttrs, &FirstOrCreateUser{})
+	}
+}
+
+func testDBFirstOrInitAttrs(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&FirstOrCreateUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u FirstOrCreateUser
+	err = db.Where(FirstOrCreateUser{Name: "a"}).
+		Attrs(FirstOrCreateUser{Age: 20}).
+		Assign(FirstOrCreateUser{Role: "admin"}).
+		FirstOrInit(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := FirstOrCreateUser{Name: "a", Age: 20, Role: "admin"}
+	if u != expect {
+		t.Errorf("expected %+v got %+v", expect, u)
+	}
+	var n int64
+	err = db.Model(&FirstOrCreateUser{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expected no record got %d", n)
+	}
+
+	stored := FirstOrCreateUser{Name: "b", Age: 40}
+	err = db.Create(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u = FirstOrCreateUser{}
+	err = db.Where("name = ?", "b").
+		Attrs(FirstOrCreateUser{Age: 20}).
+		Assign(FirstOrCreateUser{Role: "admin"}).
+		FirstOrInit(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = FirstOrCreateUser{ID: stored.ID, Name: "b", Age: 40, Role: "admin"}
+	if u != expect {
+		t.Errorf("expected %+v got %+v", expect, u)
+	}
+	u = FirstOrCreateUser{}
+	err = db.First(&u, stored.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != stored {
+		t.Errorf("expected %+v got %+v", stored, u)
+	}
+}
+
+type Thread struct {
+	ID      int64
+	Title   string
+	Replies []Reply `gorm:"ORDER:position desc;LIMIT:2"`
+}
+
+type Reply struct {
+	ID       int64
+	ThreadID int64
+	Position int
+}
+
+func TestDB_PreloadOrderLimit(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBPreloadOrderLimit, &Thread{}, &Reply{})
+	}
+}
+
+func testDBPreloadOrderLimit(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Thread{}, &Reply{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"a", "b"} {
+		thread := Thread{Title: title, Replies: []Reply{{Position: 1}, {Position: 3}, {Position: 2}}}
+		if err := db.Create(&thread); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var threads []Thread
+	err = db.Preload("Replies").Order("id").Find(&threads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 2 {
+		t.Fatalf("expected 2 threads got %d", len(threads))
+	}
+	for _, thread := range threads {
+		if len(thread.Replies) != 2 {
+			t.Fatalf("expected 2 replies for %s got %d", thread.Title, len(thread.Replies))
+		}
+		if thread.Replies[0].Position != 3 || thread.Replies[1].Position != 2 {
+			t.Errorf("expected the latest replies of %s got %+v", thread.Title, thread.Replies)
+		}
+	}
+
+	var thread Thread
+	err = db.Preload("Replies").First(&thread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(thread.Replies) != 2 || thread.Replies[0].Position != 3 {
+		t.Errorf("expected the 2 latest replies got %+v", thread.Replies)
+	}
+
+	// An order set with the conditions replaces the one of the tag.
+	threads = nil
+	err = db.Preload("Replies", func(e *engine.Engine) {
+		search.Order(e, "position")
+	}).Order("id").Find(&threads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := threads[0].Replies; len(r) != 2 || r[0].Position != 1 || r[1].Position != 2 {
+		t.Errorf("expected the first replies got %+v", r)
+	}
+}
+
+func TestDB_Callback(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBCallback, &fixture.User{})
+	}
+}
+
+func testDBCallback(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&fixture.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := db.Callback().Create().Names()
+	expect := []string{model.HookModelBeforeCreate, model.HookValidate, model.HookCreateSQL,
+		model.HookCreateExec, model.HookAfterCreate, model.HookReloadDefaults,
+		model.HookTrackChanges, model.HookModelAfterCreate}
+	if !reflect.DeepEqual(names, expect) {
+		t.Errorf("expected %v got %v", expect, names)
+	}
+	err = db.Callback().Create().Before(model.HookCreateSQL).Register("test:name",
+		func(e *engine.Engine) error {
+			if u, ok := e.Scope.Value.(*fixture.User); ok {
+				if u.Name == "" {
+					return errors.New("missing name")
+				}
+				u.Name = strings.ToUpper(u.Name)
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := fixture.User{Name: "gernest"}
+	err = db.Create(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored fixture.User
+	err = db.First(&stored, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "GERNEST" {
+		t.Errorf("expected the name set by the callback got %s", stored.Name)
+	}
+	err = db.Create(&fixture.User{})
+	if err == nil || err.Error() != "missing name" {
+		t.Errorf("expected the error of the callback got %v", err)
+	}
+
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&fixture.User{Name: "tx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromTx fixture.User
+	err = db.Where("name = ?", "TX").First(&fromTx)
+	if err != nil {
+		t.Errorf("expected the callback to run in transactions got %v", err)
+	}
+
+	var deleted int
+	err = db.Callback().Delete().After(model.HookDeleteExec).Register("test:count",
+		func(e *engine.Engine) error {
+			deleted += int(e.RowsAffected)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Delete(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted row got %d", deleted)
+	}
+	err = db.Callback().Delete().Remove("test:count")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type Account struct {
+	ID      int64
+	Name    string
+	Balance int64
+	calls   []string
+}
+
+func (a *Account) BeforeCreate(e *engine.Engine) error {
+	a.calls = append(a.calls, "BeforeCreate")
+	if a.Balance < 0 {
+		return errors.New("negative balance")
+	}
+	return nil
+}
+
+func (a *Account) AfterCreate(e *engine.Engine) error {
+	a.calls = append(a.calls, "AfterCreate")
+	if a.Name == "rollback" {
+		return errors.New("rolled back")
+	}
+	return nil
+}
+
+func (a *Account) BeforeUpdate(e *engine.Engine) error {
+	a.calls = append(a.calls, "BeforeUpdate")
+	return nil
+}
+
+func (a *Account) AfterUpdate(e *engine.Engine) error {
+	a.calls = append(a.calls, "AfterUpdate")
+	return nil
+}
+
+func (a *Account) BeforeDelete(e *engine.Engine) error {
+	a.calls = append(a.calls, "BeforeDelete")
+	if a.Balance > 0 {
+		return errors.New("account not empty")
+	}
+	return nil
+}
+
+func (a *Account) AfterDelete(e *engine.Engine) error {
+	a.calls = append(a.calls, "AfterDelete")
+	return nil
+}
+
+func (a *Account) AfterFind(e *engine.Engine) error {
+	a.calls = append(a.calls, "AfterFind")
+	return nil
+}
+
+func TestDB_LifecycleHooks(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBLifecycleHooks, &Account{})
+	}
+}
+
+func testDBLifecycleHooks(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Account{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Account{Name: "a", Balance: 10}
+	err = db.Create(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"BeforeCreate", "AfterCreate"}
+	if !reflect.DeepEqual(a.calls, expect) {
+		t.Errorf("expected %v got %v", expect, a.calls)
+	}
+	err = db.Create(&Account{Name: "b", Balance: -1})
+	if err == nil || err.Error() != "negative balance" {
+		t.Errorf("expected the error of BeforeCreate got %v", err)
+	}
+	err = db.Create(&Account{Name: "rollback"})
+	if err == nil || err.Error() != "rolled back" {
+		t.Errorf("expected the error of AfterCreate got %v", err)
+	}
+	var n int
+	err = db.Model(&Account{}).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected the accounts failing the hooks not to be created got %d accounts", n)
+	}
+
+	a.calls = nil
+	a.Balance = 0
+	err = db.Save(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"BeforeUpdate", "AfterUpdate"}
+	if !reflect.DeepEqual(a.calls, expect) {
+		t.Errorf("expected %v got %v", expect, a.calls)
+	}
+
+	var found []Account
+	err = db.Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || !reflect.DeepEqual(found[0].calls, []string{"AfterFind"}) {
+		t.Errorf("expected AfterFind to be called got %+v", found)
+	}
+
+	found[0].calls = nil
+	found[0].Balance = 5
+	err = db.Delete(&found[0])
+	if err == nil || err.Error() != "account not empty" {
+		t.Errorf("expected the error of BeforeDelete got %v", err)
+	}
+	a.calls = nil
+	err = db.Delete(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"BeforeDelete", "AfterDelete"}
+	if !reflect.DeepEqual(a.calls, expect) {
+		t.Errorf("expected %v got %v", expect, a.calls)
+	}
+}
+
+type countPlugin struct {
+	queries int
+}
+
+func (p *countPlugin) Name() string {
+	return "test:count"
+}
+
+func (p *countPlugin) Initialize(e *engine.Engine) error {
+	return e.Callbacks.Query().After(model.HookQueryExec).Register("test:count",
+		func(*engine.Engine) error {
+			p.queries++
+			return nil
+		})
+}
+
+func TestDB_Use(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBUse, &fixture.User{})
+	}
+}
+
+func testDBUse(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&fixture.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &countPlugin{}
+	err = db.Use(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Use(&countPlugin{})
+	if err == nil {
+		t.Error("expected an error using the plugin twice")
+	}
+	var users []fixture.User
+	err = db.Find(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Where("age > ?", 10).Find(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.queries != 2 {
+		t.Errorf("expected 2 queries got %d", p.queries)
+	}
+}
+
+type Ledger struct {
+	model.Tracked
+	ID        int64
+	Title     string
+	Amount    int
+	CreatedBy string
+	UpdatedBy string
+}
+
+func TestDB_Audit(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAudit, &Ledger{}, &hooks.AuditLog{})
+	}
+}
+
+func testDBAudit(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Ledger{}, &hooks.AuditLog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Use(&hooks.Audit{Log: "audit_logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	db.now = func() time.Time { return now }
+	alice := db.WithContext(hooks.WithActor(context.Background(), "alice"))
+	bob := db.WithContext(hooks.WithActor(context.Background(), "bob"))
+
+	l := Ledger{Title: "rent", Amount: 10}
+	err = alice.Create(&l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.CreatedBy != "alice" || l.UpdatedBy != "alice" {
+		t.Errorf("expected the audit columns to be set got %v", l)
+	}
+	err = bob.Model(&l).Updates(map[string]interface{}{"amount": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Title = "rent 2"
+	err = bob.Save(&l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Ledger
+	err = db.First(&stored, l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CreatedBy != "alice" || stored.UpdatedBy != "bob" || stored.Amount != 20 {
+		t.Errorf("expected the audit columns to be stored got %v", stored)
+	}
+	anonymous := Ledger{Title: "anonymous"}
+	err = db.Create(&anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = alice.Delete(&l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := []Ledger{{Title: "a"}, {Title: "b"}}
+	for k := range batch {
+		err = db.Create(&batch[k])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = alice.Where("id IN (?)", []int64{batch[0].ID, batch[1].ID}).Delete(&batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs []hooks.AuditLog
+	err = db.Find(&logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var changes, saved string
+	for _, log := range logs {
+		got = append(got, strings.Join([]string{log.Action, log.TableName, log.RecordID, log.Actor}, " "))
+		if log.Action == "update" && strings.Contains(log.Changes, "amount") {
+			changes = log.Changes
+		} else if log.Action == "update" {
+			saved = log.Changes
+		}
+		if !log.CreatedAt.Equal(now) {
+			t.Errorf("expected the logs to be created with the clock of the db got %v", log.CreatedAt)
+		}
+	}
+	sort.Strings(got)
+	id := fmt.Sprint(l.ID)
+	expect := []string{
+		"create ledgers " + fmt.Sprint(anonymous.ID) + " ",
+		"create ledgers " + fmt.Sprint(batch[0].ID) + " ",
+		"create ledgers " + fmt.Sprint(batch[1].ID) + " ",
+		"delete ledgers " + fmt.Sprint(batch[0].ID) + " alice",
+		"delete ledgers " + fmt.Sprint(batch[1].ID) + " alice",
+		"create ledgers " + id + " alice",
+		"delete ledgers " + id + " alice",
+		"update ledgers " + id + " bob",
+		"update ledgers " + id + " bob",
+	}
+	sort.Strings(expect)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	if !strings.Contains(changes, `"amount":20`) || !strings.Contains(changes, `"updated_by":"bob"`) {
+		t.Errorf("expected the changed columns got %s", changes)
+	}
+	if saved != `{"title":"rent 2"}` {
+		t.Errorf("expected only the changed columns of the saved ledger got %s", saved)
+	}
+}
+
+type Signup struct {
+	ID    int64
+	Email string
+	Age   int
+}
+
+func (s *Signup) Validate(e *engine.Engine) error {
+	v := &errmsg.ValidationError{}
+	if !strings.Contains(s.Email, "@") {
+		v.Add("Email", "is invalid")
+	}
+	if s.Age < 18 {
+		v.Add("Age", "must be at least 18")
+	}
+	return v.Err()
+}
+
+type Voucher struct {
+	ID   int64
+	Code string
+}
+
+func TestDB_Validate(t *testing.T) {
+	err := hooks.RegisterValidator(&Voucher{}, func(e *engine.Engine, value interface{}) error {
+		if value.(*Voucher).Code == "" {
+			return errors.New("missing code")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hooks.RegisterValidator(&Voucher{}, nil) }()
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBValidate, &Signup{}, &Voucher{})
+	}
+}
+
+func testDBValidate(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Signup{}, &Voucher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Signup{Email: "nope", Age: 10})
+	verr, ok := err.(*errmsg.ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error got %v", err)
+	}
+	if len(verr.Fields) != 2 || verr.Field("Age")[0] != "must be at least 18" {
+		t.Errorf("expected both fields to fail got %v", verr)
+	}
+	s := Signup{Email: "a@b.c", Age: 20}
+	err = db.Create(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&s).Updates(map[string]interface{}{"age": 5})
+	verr, ok = err.(*errmsg.ValidationError)
+	if !ok || !reflect.DeepEqual(verr.Field("Age"), []string{"must be at least 18"}) {
+		t.Errorf("expected the updated age to fail got %v", err)
+	}
+	var stored Signup
+	err = db.First(&stored, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Age != 20 {
+		t.Errorf("expected the invalid update to be aborted got %d", stored.Age)
+	}
+	err = db.Create(&[]Signup{{Email: "c@d.e", Age: 30}, {Email: "x", Age: 30}})
+	verr, ok = err.(*errmsg.ValidationError)
+	if !ok || !reflect.DeepEqual(verr.Field("[1].Email"), []string{"is invalid"}) {
+		t.Errorf("expected the second signup to fail got %v", err)
+	}
+
+	err = db.Create(&Voucher{})
+	if err == nil || err.Error() != "missing code" {
+		t.Errorf("expected the registered validator to fail got %v", err)
+	}
+	err = db.Create(&Voucher{Code: "x"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+type Ticket struct {
+	ID       int64
+	Title    string
+	Priority int   `gorm:"DEFAULT:3"`
+	Points   int64 `gorm:"DEFAULT:10"`
+}
+
+func TestDB_CreateDefaults(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBCreateDefaults, &Ticket{})
+	}
+}
+
+func testDBCreateDefaults(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Ticket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := Ticket{Title: "a", Points: 5}
+	err = db.Create(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Priority != 3 || a.Points != 5 {
+		t.Errorf("expected the default priority to be read back got %v", a)
+	}
+	b := Ticket{Title: "b"}
+	err = db.Select("ID", "Title", "Priority").Create(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Ticket
+	err = db.First(&stored, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Priority != 0 || stored.Points != 10 {
+		t.Errorf("expected the selected blank column to be inserted got %v", stored)
+	}
+}
+
+type traceKey struct{}
+
+type statementTrace struct {
+	before, after []string
+	errs          []error
+	traced        int
+}
+
+func (s *statementTrace) BeforeQuery(ctx context.Context, st *engine.Statement) context.Context {
+	s.before = append(s.before, st.Table)
+	return context.WithValue(ctx, traceKey{}, len(s.before))
+}
+
+func (s *statementTrace) AfterQuery(ctx context.Context, st *engine.Statement) {
+	if ctx.Value(traceKey{}) == len(s.before) {
+		s.traced++
+	}
+	s.after = append(s.after, strings.Fields(strings.TrimPrefix(st.SQL, "BEGIN TRANSACTION;"))[0])
+	s.errs = append(s.errs, st.Err)
+}
+
+func TestDB_StatementHook(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBStatementHook, &fixture.User{}, &Foo{})
+	}
+}
+
+func testDBStatementHook(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&fixture.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := &statementTrace{}
+	db.Callback().AddStatementHook(trace)
+	err = db.Create(&fixture.User{Name: "hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []fixture.User
+	err = db.Find(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Where("nope = ?", 1).Find(&users)
+	if err == nil {
+		t.Fatal("expected an error for an unknown column")
+	}
+	if len(trace.after) < 3 || len(trace.after) != len(trace.before) || trace.traced != len(trace.after) {
+		t.Fatalf("expected every statement to be traced got %v %v %d", trace.before, trace.after, trace.traced)
+	}
+	n := len(trace.after)
+	if trace.after[0] != "INSERT" || trace.after[n-1] != "SELECT" || trace.before[n-1] != "users" {
+		t.Errorf("expected the statements to be reported got %v %v", trace.before, trace.after)
+	}
+	if trace.errs[0] != nil || trace.errs[n-1] == nil {
+		t.Errorf("expected the error of the last statement got %v", trace.errs)
+	}
+
+	// Schema changes and scripts are traced too.
+	trace.after = nil
+	_, err = db.CreateTable(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Model(&Foo{}).AddIndex("idx_foo_stuff", "stuff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ExecTx("DELETE FROM foos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.ExecScript("DELETE FROM foos; DELETE FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"CREATE", "CREATE", "DELETE", "DELETE", "DELETE"}
+	if !reflect.DeepEqual(trace.after, expect) {
+		t.Errorf("expected %v got %v", expect, trace.after)
+	}
+}
+
+type Patient struct {
+	ID    int64
+	Name  string
+	Notes string  `gorm:"ENCRYPTED"`
+	SSN   string  `gorm:"ENCRYPTED:deterministic"`
+	Scan  []byte  `gorm:"ENCRYPTED"`
+	Alias *string `gorm:"ENCRYPTED"`
+}
+
+func TestDB_Encryption(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBEncryption, &Patient{})
+	}
+}
+
+func testDBEncryption(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Patient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Patient{Name: "a", Notes: "x"})
+	if err == nil {
+		t.Error("expected an error without the encryption plugin")
+	}
+	enc := &hooks.Encryption{Keys: hooks.StaticKey(bytes.Repeat([]byte("k"), 32))}
+	err = db.Use(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Patient{Name: "b", Notes: "private", SSN: "123-45", Scan: []byte{1, 2, 3}}
+	err = db.Create(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Notes != "private" {
+		t.Errorf("expected the model to keep its values got %s", p.Notes)
+	}
+	var notes []string
+	err = db.Model(&Patient{}).Pluck("notes", &notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0] == "" || strings.Contains(notes[0], "private") {
+		t.Errorf("expected the notes to be stored encrypted got %v", notes)
+	}
+	var got Patient
+	err = db.Where(&Patient{SSN: "123-45"}).First(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Notes != "private" || got.SSN != "123-45" || !bytes.Equal(got.Scan, []byte{1, 2, 3}) || got.Alias != nil {
+		t.Errorf("expected the values to be decrypted got %v", got)
+	}
+	err = db.Where("ssn = ?", enc.Deterministic("123-45")).First(&Patient{})
+	if err != nil {
+		t.Errorf("expected to find the patient by the deterministic ssn got %v", err)
+	}
+	alias := "bee"
+	err = db.Model(&got).Updates(map[string]interface{}{"notes": "changed", "alias": &alias})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updated Patient
+	err = db.First(&updated, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Notes != "changed" || updated.Alias == nil || *updated.Alias != "bee" {
+		t.Errorf("expected the updated values to be decrypted got %v", updated)
+	}
+
+	err = db.Where(&Patient{Notes: "changed"}).First(&Patient{})
+	if err == nil {
+		t.Error("expected an error searching a field which isn't deterministic")
+	}
+
+	type BadPatient struct {
+		ID  int64
+		Age int `gorm:"ENCRYPTED"`
+	}
+	err = db.Create(&BadPatient{Age: 1})
+	if err == nil {
+		t.Error("expected an error for an encrypted int")
+	}
+}
+
+type SecretRecord struct {
+	ID      int64
+	History map[string]string `gorm:"SERIALIZER:secret_json"`
+}
+
+func TestDB_EncryptedSerializer(t *testing.T) {
+	enc := &hooks.Encryption{Keys: hooks.StaticKey(bytes.Repeat([]byte("s"), 32))}
+	err := types.RegisterSerializer("secret_json", enc.Serializer(types.JSON{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBEncryptedSerializer, &SecretRecord{})
+	}
+}
+
+func testDBEncryptedSerializer(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&SecretRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := SecretRecord{History: map[string]string{"allergy": "penicillin"}}
+	err = db.Create(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored []string
+	err = db.Model(&SecretRecord{}).Pluck("history", &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0] == "" || strings.Contains(stored[0], "penicillin") {
+		t.Errorf("expected the history to be stored encrypted got %v", stored)
+	}
+	var got SecretRecord
+	err = db.First(&got, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.History["allergy"] != "penicillin" {
+		t.Errorf("expected the history to be decrypted got %v", got.History)
+	}
+}
+
+type rotatedKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (k *rotatedKeys) CurrentKey() (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *rotatedKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+func (k *rotatedKeys) KeyIDs() ([]string, error) {
+	var ids []string
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func TestDB_EncryptionKeyRotation(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBEncryptionKeyRotation, &Patient{})
+	}
+}
+
+func testDBEncryptionKeyRotation(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Patient{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &rotatedKeys{current: "k1", keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte("1"), 32),
+	}}
+	enc := &hooks.Encryption{Keys: keys}
+	err = db.Use(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&Patient{Name: "old", SSN: "123-45"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.keys["k2"] = bytes.Repeat([]byte("2"), 32)
+	keys.current = "k2"
+	err = db.Create(&Patient{Name: "new", SSN: "123-45"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []Patient
+	err = db.Where(&Patient{SSN: "123-45"}).Order("id").Find(&found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].Name != "old" || found[0].SSN != "123-45" {
+		t.Errorf("expected the patients encrypted with both keys got %v", found)
+	}
+	var n int
+	err = db.Model(&Patient{}).Where("ssn IN (?)", enc.DeterministicAll("123-45")).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 patients got %d", n)
+	}
+	err = db.Model(&Patient{}).Where("ssn = ?", enc.Deterministic("123-45")).Count(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected the patient encrypted with the current key got %d", n)
+	}
+}
+
+type TenantDoc struct {
+	ID       int64
+	TenantID int64
+	Title    string
+}
+
+func TestDB_Tenancy(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBTenancy, &TenantDoc{})
+	}
+}
+
+func testDBTenancy(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&TenantDoc{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Use(&hooks.Tenancy{Models: []interface{}{&TenantDoc{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := db.WithContext(hooks.WithTenant(context.Background(), int64(1)))
+	two := db.WithContext(hooks.WithTenant(context.Background(), int64(2)))
+	admin := db.WithContext(hooks.AllTenants(context.Background()))
+
+	a := TenantDoc{Title: "a"}
+	for _, v := range []struct {
+		db  *DB
+		doc *TenantDoc
+	}{{one, &a}, {one, &TenantDoc{Title: "b"}}, {two, &TenantDoc{Title: "c"}}} {
+		err = v.db.Create(v.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.TenantID != 1 {
+		t.Errorf("expected the tenant to be set got %d", a.TenantID)
+	}
+	err = two.Create(&TenantDoc{TenantID: 1, Title: "d"})
+	if err == nil {
+		t.Error("expected an error creating a model of another tenant")
+	}
+
+	var docs []TenantDoc
+	err = one.Find(&docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 {
+		t.Errorf("expected the docs of tenant 1 got %v", docs)
+	}
+	var count int64
+	err = two.Model(&TenantDoc{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 doc for tenant 2 got %d", count)
+	}
+	err = two.First(&TenantDoc{}, a.ID)
+	if err != errmsg.ErrRecordNotFound {
+		t.Errorf("expected the doc of another tenant to be hidden got %v", err)
+	}
+	err = two.Model(&a).Update("title", "stolen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = two.Delete(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored TenantDoc
+	err = one.First(&stored, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "a" {
+		t.Errorf("expected the doc to be left alone by another tenant got %v", stored)
+	}
+
+	err = db.Find(&docs)
+	if err != errmsg.ErrMissingTenant {
+		t.Errorf("expected %v got %v", errmsg.ErrMissingTenant, err)
+	}
+	err = admin.Find(&docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 {
+		t.Errorf("expected every doc for the admin got %v", docs)
+	}
+
+	// The SQL built without a tenant must not be reused for a tenant.
+	db.CachePlans(10)
+	admin = db.WithContext(hooks.AllTenants(context.Background()))
+	two = db.WithContext(hooks.WithTenant(context.Background(), int64(2)))
+	for _, v := range []struct {
+		db     *DB
+		expect int
+	}{{admin, 3}, {two, 1}} {
+		err = v.db.Where("title != ?", "z").Find(&docs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != v.expect {
+			t.Errorf("expected %d docs with cached plans got %v", v.expect, docs)
+		}
+	}
+
+	err = two.BulkUpdate([]TenantDoc{{ID: a.ID, Title: "stolen"}}, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = one.First(&stored, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "a" {
+		t.Errorf("expected the doc to be left alone by a bulk update of another tenant got %v", stored)
+	}
+	batch := []TenantDoc{{Title: "e"}, {Title: "f"}}
+	err = two.CreateInBatches(&batch, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].TenantID != 2 || batch[1].TenantID != 2 {
+		t.Errorf("expected the tenant to be set on the batch got %v", batch)
+	}
+	err = two.CreateInBatches(&[]TenantDoc{{TenantID: 1, Title: "g"}}, 10)
+	if err == nil {
+		t.Error("expected an error creating a batch with a model of another tenant")
+	}
+}
+
+type FlagNote struct {
+	ID      int64
+	Title   string
+	Removed bool `gorm:"SOFT_DELETE"`
+}
+
+type MilliNote struct {
+	ID    int64
+	Title string
+	Gone  int64 `gorm:"SOFT_DELETE"`
+}
+
+func TestDB_SoftDelete(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBSoftDelete, &FlagNote{}, &MilliNote{})
+	}
+}
+
+func testDBSoftDelete(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&FlagNote{}, &MilliNote{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*FlagNote{{Title: "kept"}, {Title: "removed"}} {
+		if err = db.Create(n); err != nil {
+			t.Fatal(err)
+		}
+		if n.Title == "removed" {
+			if err = db.Delete(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var flags []FlagNote
+	err = db.Find(&flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 1 || flags[0].Title != "kept" {
+		t.Errorf("expected the removed note to be hidden got %v", flags)
+	}
+	err = db.Unscoped().Where("removed = ?", true).Find(&flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 1 || flags[0].Title != "removed" {
+		t.Errorf("expected the removed note to be flagged got %v", flags)
+	}
+
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, n := range []*MilliNote{{Title: "kept"}, {Title: "gone"}} {
+		if err = db.Create(n); err != nil {
+			t.Fatal(err)
+		}
+		if n.Title == "gone" {
+			if err = db.Delete(n); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var millis []MilliNote
+	err = db.Find(&millis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(millis) != 1 || millis[0].Title != "kept" {
+		t.Errorf("expected the gone note to be hidden got %v", millis)
+	}
+	err = db.Unscoped().Where("gone > ?", 0).Find(&millis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(millis) != 1 || millis[0].Gone < before {
+		t.Errorf("expected the gone note to have its delete time got %v", millis)
+	}
+}
+
+type requestKey struct{}
+
+type RequestOrder struct {
+	ID      int64
+	Request string
+	Items   []RequestItem
+}
+
+type RequestItem struct {
+	ID             int64
+	RequestOrderID int64
+	Request        string
+	Found          string `gorm:"-"`
+}
+
+func (i *RequestItem) BeforeCreate(e *engine.Engine) error {
+	i.Request, _ = e.Context().Value(requestKey{}).(string)
+	return nil
+}
+
+func (i *RequestItem) AfterFind(e *engine.Engine) error {
+	i.Found, _ = e.Context().Value(requestKey{}).(string)
+	return nil
+}
+
+type requestCheck struct {
+	statements, missing int
+}
+
+func (r *requestCheck) BeforeQuery(ctx context.Context, s *engine.Statement) context.Context {
+	r.statements++
+	if ctx.Value(requestKey{}) == nil {
+		r.missing++
+	}
+	return ctx
+}
+
+func (r *requestCheck) AfterQuery(ctx context.Context, s *engine.Statement) {}
+
+func TestDB_ContextPropagation(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBContextPropagation, &RequestOrder{}, &RequestItem{})
+	}
+}
+
+func testDBContextPropagation(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&RequestOrder{}, &RequestItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := &requestCheck{}
+	db.Callback().AddStatementHook(check)
+	rdb := db.WithContext(context.WithValue(context.Background(), requestKey{}, "r1"))
+
+	order := RequestOrder{Items: []RequestItem{{}, {}}}
+	err = rdb.Create(&order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range order.Items {
+		if i.Request != "r1" {
+			t.Errorf("expected the hooks of the associations to get the context got %q", i.Request)
+		}
+	}
+	var orders []RequestOrder
+	err = rdb.Preload("Items").Find(&orders)
 	if err != nil {
 		t.Fatal(err)
 	}
-	checkUserHasPreloadData(db, user, t)
+	if len(orders) != 1 || len(orders[0].Items) != 2 || orders[0].Items[0].Found != "r1" {
+		t.Errorf("expected the preloaded models to get the context got %v", orders)
+	}
 
-	user2, err := getPreparedUser(db, "user2", "Preload")
+	tx, err := rdb.BeginTx()
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = db.Begin().Save(user2)
+	err = tx.Create(&RequestOrder{Items: []RequestItem{{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Commit()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if check.statements < 5 || check.missing != 0 {
+		t.Errorf("expected every statement to get the context got %d of %d without it",
+			check.missing, check.statements)
+	}
+}
 
-	user3, err := getPreparedUser(db, "user3", "Preload")
+type TrackedNote struct {
+	model.Tracked
+	ID    int64
+	Title string
+	Body  string
+	Data  []byte
+}
+
+type TrackedSettings struct {
+	model.Tracked
+	ID       int64
+	Settings map[string]string `gorm:"SERIALIZER:gob"`
+}
+
+func TestDB_TrackChanges(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBTrackChanges, &TrackedNote{}, &TrackedSettings{})
+	}
+}
+
+func testDBTrackChanges(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&TrackedNote{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = db.Begin().Save(user3)
+	e := db.NewEngine()
+	defer engine.Put(e)
+	note := TrackedNote{Title: "a", Body: "b", Data: []byte("c")}
+	if !scope.Changed(e, &note, "Title") {
+		t.Error("expected the fields of a new model to be changed")
+	}
+	err = db.Create(&note)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if scope.Changed(e, &note, "Title") {
+		t.Error("expected the fields of a created model to be unchanged")
+	}
 
-	var users []fixture.User
-	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	err = preloadDB.Find(&users)
+	var stored TrackedNote
+	err = db.First(&stored, note.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	for _, user := range users {
-		checkUserHasPreloadData(db, user, t)
+	stored.Title = "a2"
+	stored.Data[0] = 'd'
+	if !scope.Changed(e, &stored, "Title") || !scope.Changed(e, &stored, "data") ||
+		scope.Changed(e, &stored, "Body") {
+		t.Error("expected only the title and the data to be changed")
 	}
-
-	var users2 []*fixture.User
-	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	err = preloadDB.Find(&users2)
+	sql, err := db.SaveSQL(&stored)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	for _, user := range users2 {
-		checkUserHasPreloadData(db, *user, t)
+	if strings.Contains(sql.Q, "body") || !strings.Contains(sql.Q, "title") {
+		t.Errorf("expected only the changed columns to be updated got %s", sql.Q)
 	}
 
-	var users3 []*fixture.User
-	preloadDB = db.Begin().Where("role = ?", "Preload").Preload("BillingAddress").Preload("ShippingAddress").
-		Preload("CreditCard").Preload("Emails").Preload("Company")
-	err = preloadDB.Preload("Emails", "email = ?", user3.Emails[0].Email).Find(&users3)
+	// Another writer changes the body, which the save must leave alone.
+	err = db.Model(&TrackedNote{}).Where("id = ?", note.ID).UpdateColumn("body", "other")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	for _, user := range users3 {
-		if user.Name == user3.Name {
-			if len(user.Emails) != 1 {
-				t.Errorf("should only preload one emails for user3 when with condition")
-			}
-		} else if len(user.Emails) != 0 {
-			t.Errorf("should not preload any emails for other users when with condition")
-		} else if user.Emails == nil {
-			t.Errorf("should return an empty slice to indicate zero results")
-		}
+	err = db.Save(&stored)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func checkUserHasPreloadData(db *DB, user fixture.User, t *testing.T) {
-	u, err := getPreparedUser(db, user.Name, "Preload")
+	if scope.Changed(e, &stored, "Title") {
+		t.Error("expected the fields of a saved model to be unchanged")
+	}
+	var got TrackedNote
+	err = db.First(&got, note.ID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if user.BillingAddress.Address1 != u.BillingAddress.Address1 {
-		t.Errorf("BillingAddress: expected %s got %s",
-			u.BillingAddress.Address1, user.BillingAddress.Address1)
+	if got.Title != "a2" || got.Body != "other" || string(got.Data) != "d" {
+		t.Errorf("expected the changed columns to be saved got %v", got)
 	}
-
-	if user.ShippingAddress.Address1 != u.ShippingAddress.Address1 {
-		t.Errorf("ShippingAddress: expected %s got %s",
-			u.ShippingAddress.Address1, user.ShippingAddress.Address1)
+	err = db.Save(&got)
+	if err != nil {
+		t.Errorf("expected saving an unchanged model to do nothing got %v", err)
 	}
 
-	if user.CreditCard.Number != u.CreditCard.Number {
-		t.Errorf("CreditCard: expected %s got %s",
-			u.CreditCard.Number, user.CreditCard.Number)
+	_, err = db.Automigrate(&TrackedSettings{})
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	if user.Company.Name != u.Company.Name {
-		t.Errorf(" Company: expected %s got %s", u.Company.Name, user.Company.Name)
+	settings := TrackedSettings{Settings: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}}
+	err = db.Create(&settings)
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	if len(user.Emails) != len(u.Emails) {
-		t.Errorf("Emails: expected %d emails got %d", len(u.Emails), len(user.Emails))
-
-	} else {
-		var found int
-		for _, e1 := range u.Emails {
-			for _, e2 := range user.Emails {
-				if e1.Email == e2.Email {
-					found++
-					break
-				}
-			}
-		}
-		if found != len(u.Emails) {
-			t.Errorf("expected %d emails got %d", len(u.Emails), found)
+	var gotSettings TrackedSettings
+	err = db.First(&gotSettings, settings.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The gob encodings of equal maps can differ.
+	for i := 0; i < 10; i++ {
+		if scope.Changed(e, &gotSettings, "Settings") {
+			t.Fatal("expected an unchanged serialized map to be unchanged")
 		}
 	}
+	gotSettings.Settings["a"] = "2"
+	if !scope.Changed(e, &gotSettings, "Settings") {
+		t.Error("expected the changed serialized map to be changed")
+	}
 }
 
-func getPreparedUser(db *DB, name string, role string) (*fixture.User, error) {
-	var company fixture.Company
-	err := db.Begin().Where(fixture.Company{Name: role}).FirstOrCreate(&company)
-	if err != nil {
-		return nil, err
-	}
-	return &fixture.User{
-		Name:            name,
-		Age:             20,
-		Role:            fixture.Role{Name: role},
-		BillingAddress:  fixture.Address{Address1: fmt.Sprintf("Billing Address %v", name)},
-		ShippingAddress: fixture.Address{Address1: fmt.Sprintf("Shipping Address %v", name)},
-		CreditCard:      fixture.CreditCard{Number: fmt.Sprintf("123456%v", name)},
-		Emails: []fixture.Email{
-			{Email: fmt.Sprintf("user_%v@example1.com", name)}, {Email: fmt.Sprintf("user_%v@example2.com", name)},
-		},
-		Company: company,
-		Languages: []fixture.Language{
-			{Name: fmt.Sprintf("lang_1_%v", name)},
-			{Name: fmt.Sprintf("lang_2_%v", name)},
-		},
-	}, nil
+type EventNote struct {
+	model.Tracked
+	ID    int64
+	Title string
+	Data  []byte
 }
 
-func TestRelationship_Belongs_To(t *testing.T) {
+func TestDB_Events(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, belongsTo,
-			&bUser{}, &bAddr{},
-		)
+		runWrapDB(t, d, testDBEvents, &EventNote{})
 	}
 }
 
-type bUser struct {
-	ID     int64
-	Addr   bAddr
-	AddrID int
-	Ship   bAddr
-	ShipID int64
-}
-
-type bAddr struct {
-	ID   int64
-	Name string
-}
+func testDBEvents(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&EventNote{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &hooks.Events{}
+	ch := make(chan hooks.Event, 10)
+	events.Subscribe(ch)
+	var handled []hooks.Event
+	events.Handle(func(e *engine.Engine, event hooks.Event) error {
+		if n, ok := event.(hooks.ModelCreated); ok && n.New.(*EventNote).Title == "fail" {
+			return errors.New("refused")
+		}
+		handled = append(handled, event)
+		return nil
+	})
+	err = db.Use(events)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-func belongsTo(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&bUser{}, &bAddr{},
-	)
+	note := EventNote{Title: "a", Data: []byte("x")}
+	err = db.Create(&note)
 	if err != nil {
 		t.Fatal(err)
 	}
-	n := "some name"
-	u := &bUser{
-		Addr: bAddr{Name: n},
-		Ship: bAddr{Name: n},
+	note.Data[0] = 'y'
+	note.Title = "b"
+	err = db.Save(&note)
+	if err != nil {
+		t.Fatal(err)
 	}
-	err = db.Begin().Create(u)
+	err = db.Delete(&note)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if u.ID == 0 {
-		t.Error("expected user to be created")
+	err = db.Delete(&note)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if u.AddrID == 0 {
-		t.Error("expected Addr to be created")
+	if len(handled) != 3 || len(ch) != 3 {
+		t.Fatalf("expected 3 events got %v and %d sent", handled, len(ch))
 	}
-	if u.ShipID == 0 {
-		t.Error("expected Ship to be created")
+	created, ok := (<-ch).(hooks.ModelCreated)
+	if !ok || created.Table() != "event_notes" || created.New.(*EventNote).ID != note.ID ||
+		string(created.New.(*EventNote).Data) != "x" {
+		t.Errorf("expected the created note got %v", created)
 	}
-}
-func TestDB_AddForeignKeySQL(t *testing.T) {
-	for _, d := range allTestDB() {
-		runWrapDB(t, d, testAddForeignKeySQL,
-			&fixture.User{},
-		)
+	updated, ok := (<-ch).(hooks.ModelUpdated)
+	if !ok || updated.Old["title"] != "a" || updated.New.(*EventNote).Title != "b" {
+		t.Errorf("expected the old and new titles got %v", updated)
 	}
-}
-func testAddForeignKeySQL(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&fixture.User{},
-	)
-	sql, err := db.Model(&fixture.User{}).AddForeignKeySQL("city_id", "cities(id)", "RESTRICT", "RESTRICT")
-	if isQL(db) {
-		if err == nil {
-			t.Error("expected an error")
-		}
-	} else {
-		if err != nil {
-			t.Fatal(err)
-		}
-		e := `ALTER TABLE "users" ADD CONSTRAINT "users_city_id_cities_id_foreign" FOREIGN KEY ("city_id") REFERENCES cities(id) ON DELETE RESTRICT ON UPDATE RESTRICT;`
-		e = strings.TrimSpace(e)
-		sql = strings.TrimSpace(sql)
-		if e != sql {
-			t.Errorf("expected %s \n got %s", e, sql)
-		}
+	if _, ok := (<-ch).(hooks.ModelDeleted); !ok {
+		t.Error("expected the deleted note")
+	}
+
+	err = db.Create(&EventNote{Title: "fail"})
+	if err == nil || err.Error() != "refused" {
+		t.Errorf("expected the error of the handler got %v", err)
+	}
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&EventNote{Title: "tx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Error("expected the events to wait for the commit")
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 1 {
+		t.Errorf("expected the committed event got %d", len(ch))
 	}
+}
 
+type ReportView struct {
+	_     struct{} `gorm:"READONLY"`
+	ID    int64
+	Total int64
 }
 
-type Blog struct {
-	ID         int64  `gorm:"primary_key"`
-	Locale     string `gorm:"primary_key"`
-	Subject    string
-	Body       string
-	Tags       []Tag `gorm:"many2many:blog_tags;"`
-	SharedTags []Tag `gorm:"many2many:shared_blog_tags;ForeignKey:id;AssociationForeignKey:id"`
-	LocaleTags []Tag `gorm:"many2many:locale_blog_tags;ForeignKey:id,locale;AssociationForeignKey:id"`
+type Replica struct {
+	ID       int64
+	Name     string
+	MirrorID int64
 }
 
-type Tag struct {
-	ID     int64  `gorm:"primary_key"`
-	Locale string `gorm:"primary_key"`
-	Value  string
-	Blogs  []*Blog `gorm:"many2many:blogs_tags"`
+type Mirror struct {
+	ID       int64
+	Name     string
+	Replicas []Replica
 }
 
-func TestRelationship_Many_To_Many(t *testing.T) {
+func TestDB_ReadOnly(t *testing.T) {
 	for _, d := range allTestDB() {
-		runWrapDB(t, d, testRelManyToMany,
-			&Blog{},
-			&Tag{},
-		)
+		runWrapDB(t, d, testDBReadOnly, &ReportView{}, &Replica{}, &Mirror{})
 	}
 }
-func testRelManyToMany(t *testing.T, db *DB) {
-	_, err := db.Begin().Automigrate(
-		&Blog{}, &Tag{},
-	)
+
+func testDBReadOnly(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&ReportView{}, &Replica{}, &Mirror{})
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	blog := Blog{
-		Locale:  "ZH",
-		Subject: "subject",
-		Body:    "body",
-		Tags: []Tag{
-			{Locale: "ZH", Value: "tag1"},
-			{Locale: "ZH", Value: "tag2"},
-		},
+	_, err = db.ExecTx("INSERT INTO report_views (id, total) VALUES (1, 10)")
+	if err != nil {
+		t.Fatal(err)
 	}
-	err = db.Begin().Save(&blog)
+	var r ReportView
+	err = db.First(&r)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if r.Total != 10 {
+		t.Errorf("expected the read only model to be queried got %v", r)
+	}
+	for _, op := range []func() error{
+		func() error { return db.Create(&ReportView{Total: 1}) },
+		func() error { return db.Save(&r) },
+		func() error { return db.Model(&r).Update("total", 2) },
+		func() error { return db.Delete(&r) },
+		func() error { return db.CreateInBatches(&[]ReportView{{Total: 1}}, 10) },
+	} {
+		if err = op(); err != errmsg.ErrReadOnly {
+			t.Errorf("expected %v got %v", errmsg.ErrReadOnly, err)
+		}
 	}
 
-	a, err := db.Model(&blog).Association("Tags")
+	mirror := Mirror{Name: "m", Replicas: []Replica{{Name: "a"}}}
+	err = db.Create(&mirror)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	c, err := a.Count()
+	err = db.RegisterReadOnly(&Replica{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if c != 2 {
-		t.Errorf("expected 2 got %d", c)
+	err = db.Create(&Replica{Name: "b"})
+	if err != errmsg.ErrReadOnly {
+		t.Errorf("expected %v got %v", errmsg.ErrReadOnly, err)
+	}
+	var replicas []Replica
+	err = db.Find(&replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replicas) != 1 {
+		t.Errorf("expected the registered model to be queried got %v", replicas)
+	}
+	a, err := db.Model(&mirror).Association("Replicas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Clear()
+	if err != errmsg.ErrReadOnly {
+		t.Errorf("expected %v clearing the association got %v", errmsg.ErrReadOnly, err)
+	}
+	if len(mirror.Replicas) != 1 {
+		t.Errorf("expected the association to be kept got %v", mirror.Replicas)
 	}
 }
@@ -12,6 +12,10 @@ var (
 	// only match string like `name`, `users.name`
 	Column = regexp.MustCompile("^[a-zA-Z]+(\\.[a-zA-Z]+)*$")
 
+	//Identifier matches a possibly qualified SQL identifier like `name`,
+	//`users.created_at` or `_id2`.
+	Identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)*$`)
+
 	//IsNumber matches if the string is a number.
 	IsNumber = regexp.MustCompile("^\\s*\\d+\\s*$")
 
@@ -21,6 +25,10 @@ var (
 	//CountingQuery matches count query.
 	CountingQuery = regexp.MustCompile("(?i)^count(.+)$")
 
+	//DistinctColumns matches a select of distinct columns and captures the
+	//columns.
+	DistinctColumns = regexp.MustCompile(`(?is)^\s*distinct\s+(.+?)\s*$`)
+
 	//KeyName matches _ in a string
 	KeyName = regexp.MustCompile("(_*[^a-zA-Z]+_*|_+)")
 )
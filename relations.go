@@ -0,0 +1,97 @@
+package ngorm
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/scope"
+)
+
+//Relation describes a relationship declared by a field of a model. It is read
+//from the cached model definition, which tools like admin interfaces or data
+//exporters can use to follow the associations of the models.
+type Relation struct {
+	// Field is the name of the field declaring the relationship, and Kind one
+	// of has_one, has_many, belongs_to or many_to_many.
+	Field string
+	Kind  string
+
+	// Model and Table are the type and the table of the associated model.
+	Model reflect.Type
+	Table string
+
+	// ForeignKeys are the columns of the foreign key and AssociationForeignKeys
+	// the columns they reference. The foreign key is in the table of the
+	// model for belongs_to and in Table for has_one and has_many.
+	//
+	// For many_to_many they are the columns of JoinTable referencing the model
+	// and the associated model respectively.
+	ForeignKeys            []string
+	AssociationForeignKeys []string
+	JoinTable              string
+
+	// PolymorphicType is the column holding PolymorphicValue in the rows of
+	// polymorphic has_one and has_many relationships.
+	PolymorphicType  string
+	PolymorphicValue string
+
+	// OnDelete and OnUpdate are the actions set with the CONSTRAINT tag.
+	OnDelete string
+	OnUpdate string
+}
+
+func (r Relation) String() string {
+	return fmt.Sprintf("%s %s %s", r.Field, r.Kind, r.Model)
+}
+
+//Relationships returns the relationships declared by the fields of value, in
+//the order of the fields
+//
+//    rels, err := db.Relationships(&User{})
+//    if err != nil {
+//        return err
+//    }
+//    for _, r := range rels {
+//        fmt.Println(r.Field, r.Kind, r.Table, r.ForeignKeys)
+//    }
+func (db *DB) Relationships(value interface{}) ([]Relation, error) {
+	e := db.NewEngine()
+	defer engine.Put(e)
+	m, err := scope.GetModelStruct(e, value)
+	if err != nil {
+		return nil, err
+	}
+	var rels []Relation
+	for _, f := range m.StructFields {
+		rel := f.Relationship
+		if rel == nil || f.IsIgnored {
+			continue
+		}
+		t := f.Struct.Type
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		r := Relation{
+			Field:            f.Name,
+			Kind:             rel.Kind,
+			Model:            t,
+			Table:            scope.TableNameOf(e, reflect.New(t).Interface()),
+			PolymorphicType:  rel.PolymorphicDBName,
+			PolymorphicValue: rel.PolymorphicValue,
+			OnDelete:         rel.OnDelete,
+			OnUpdate:         rel.OnUpdate,
+		}
+		if rel.Kind == "many_to_many" && rel.JoinTableHandler != nil {
+			h := rel.JoinTableHandler
+			r.JoinTable = h.TableName
+			r.ForeignKeys = h.Source.DBNames()
+			r.AssociationForeignKeys = h.Destination.DBNames()
+		} else {
+			r.ForeignKeys = append([]string(nil), rel.ForeignDBNames...)
+			r.AssociationForeignKeys = append([]string(nil), rel.AssociationForeignDBNames...)
+		}
+		rels = append(rels, r)
+	}
+	return rels, nil
+}
@@ -0,0 +1,56 @@
+package ngorm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ngorm/ngorm/fixture"
+)
+
+func TestDB_Relationships(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBRelationships)
+	}
+}
+
+func testDBRelationships(t *testing.T, db *DB) {
+	rels, err := db.Relationships(&fixture.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byField := make(map[string]Relation)
+	for _, r := range rels {
+		byField[r.Field] = r
+	}
+	sample := []struct {
+		field, kind, table string
+		fks, refs          []string
+		join               string
+	}{
+		{"Emails", "has_many", "emails", []string{"user_id"}, []string{"id"}, ""},
+		{"BillingAddress", "belongs_to", "addresses", []string{"billing_address_id"}, []string{"id"}, ""},
+		{"CreditCard", "has_one", "credit_cards", []string{"user_id"}, []string{"id"}, ""},
+		{"Languages", "many_to_many", "languages", []string{"user_id"}, []string{"language_id"}, "user_languages"},
+	}
+	for _, s := range sample {
+		r, ok := byField[s.field]
+		if !ok {
+			t.Errorf("expected a relationship for %s", s.field)
+			continue
+		}
+		if r.Kind != s.kind || r.Table != s.table || r.JoinTable != s.join {
+			t.Errorf("expected %s %s %s %s got %s %s %s", s.field, s.kind, s.table, s.join, r.Kind, r.Table, r.JoinTable)
+		}
+		if !reflect.DeepEqual(r.ForeignKeys, s.fks) || !reflect.DeepEqual(r.AssociationForeignKeys, s.refs) {
+			t.Errorf("expected %s keys %v %v got %v %v", s.field, s.fks, s.refs, r.ForeignKeys, r.AssociationForeignKeys)
+		}
+	}
+	if _, ok := byField["IgnoredPointer"]; ok {
+		t.Error("expected ignored fields to be skipped")
+	}
+
+	_, err = db.Relationships(1)
+	if err == nil {
+		t.Error("expected an error for a value which isn't a struct")
+	}
+}
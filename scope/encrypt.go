@@ -0,0 +1,144 @@
+package scope
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+)
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// encryptable returns true for the types of fields which can have the
+// ENCRYPTED tag, strings and []byte or pointers to them.
+func encryptable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.String || t == bytesType
+}
+
+// encryptedValue returns the encrypted value of field, which has the ENCRYPTED
+// tag. NULL is left alone.
+func encryptedValue(e *engine.Engine, field *model.Field) interface{} {
+	enc := e.Encrypter()
+	if enc == nil {
+		return invalidValue{err: fmt.Errorf("ngorm: no encryption plugin for the encrypted field %s", field.Name)}
+	}
+	plain, ok := plainValue(field)
+	if !ok {
+		return nil
+	}
+	c, err := enc.Encrypt(field.StructField, plain)
+	if err != nil {
+		return invalidValue{err: fmt.Errorf("ngorm: can't encrypt %s: %v", field.Name, err)}
+	}
+	return c
+}
+
+//EncryptedSearch returns the values the column of field, which has the
+//ENCRYPTED tag, may have for the value of field. This is used by struct
+//conditions, the values are given by the engine.SearchEncrypter plugin of e
+//when it is one. A single nil value is returned for NULL.
+func EncryptedSearch(e *engine.Engine, field *model.Field) ([]interface{}, error) {
+	enc := e.Encrypter()
+	if enc == nil {
+		return nil, fmt.Errorf("ngorm: no encryption plugin for the encrypted field %s", field.Name)
+	}
+	plain, ok := plainValue(field)
+	if !ok {
+		return []interface{}{nil}, nil
+	}
+	s, ok := enc.(engine.SearchEncrypter)
+	if !ok {
+		c, err := enc.Encrypt(field.StructField, plain)
+		if err != nil {
+			return nil, fmt.Errorf("ngorm: can't encrypt %s: %v", field.Name, err)
+		}
+		return []interface{}{c}, nil
+	}
+	cs, err := s.EncryptSearch(field.StructField, plain)
+	if err != nil {
+		return nil, fmt.Errorf("ngorm: can't search %s: %v", field.Name, err)
+	}
+	values := make([]interface{}, len(cs))
+	for k, c := range cs {
+		values[k] = c
+	}
+	return values, nil
+}
+
+// plainValue returns the value of field, which has the ENCRYPTED tag, as
+// bytes. ok is false for NULL.
+func plainValue(field *model.Field) (plain []byte, ok bool) {
+	v := field.Field
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return []byte(v.String()), true
+	}
+	if v.IsNil() {
+		return nil, false
+	}
+	return v.Bytes(), true
+}
+
+//DecryptFields decrypts the fields with the ENCRYPTED tag which were scanned
+//from columns by Scan, using the engine.Encrypter plugin of e.
+func DecryptFields(e *engine.Engine, columns []string, fields []*model.Field) error {
+	used := make(map[*model.Field]bool)
+	for _, column := range columns {
+		for _, field := range fields {
+			if !field.IsNormal || field.DBName != column || used[field] ||
+				!field.Field.IsValid() || !field.Field.CanAddr() {
+				continue
+			}
+			used[field] = true
+			if _, ok := field.TagSettings["ENCRYPTED"]; ok {
+				if err := decryptField(e, field); err != nil {
+					return err
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func decryptField(e *engine.Engine, field *model.Field) error {
+	v := field.Field
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	var c string
+	if v.Kind() == reflect.String {
+		c = v.String()
+	} else {
+		c = string(v.Bytes())
+	}
+	if c == "" {
+		return nil
+	}
+	enc := e.Encrypter()
+	if enc == nil {
+		return fmt.Errorf("ngorm: no encryption plugin for the encrypted field %s", field.Name)
+	}
+	plain, err := enc.Decrypt(field.StructField, c)
+	if err != nil {
+		return fmt.Errorf("ngorm: can't decrypt %s: %v", field.Name, err)
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(string(plain))
+	} else {
+		v.SetBytes(plain)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package scope
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+)
+
+//ETag returns a strong HTTP entity tag for the struct value computed from the
+//given columns, or from all columns when none is given. The tag only depends
+//on the values of the columns, so it is the same for every read of an
+//unmodified row.
+func ETag(e *engine.Engine, value interface{}, columns ...string) (string, error) {
+	fields, err := ETagFields(e, value, columns...)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, f := range fields {
+		fmt.Fprintf(h, "%s\x00%s\x00", f.DBName, etagValue(f.Field.Interface()))
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+//ETagFields returns the fields of value used to compute its ETag, sorted by
+//column name.
+func ETagFields(e *engine.Engine, value interface{}, columns ...string) ([]*model.Field, error) {
+	var fields []*model.Field
+	if len(columns) == 0 {
+		fds, err := Fields(e, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fds {
+			if f.IsNormal {
+				fields = append(fields, f)
+			}
+		}
+	} else {
+		for _, c := range columns {
+			f, err := FieldByName(e, value, c)
+			if err != nil {
+				return nil, err
+			}
+			if !f.IsNormal {
+				return nil, fmt.Errorf("ngorm: %s is not a column", c)
+			}
+			fields = append(fields, f)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].DBName < fields[j].DBName
+	})
+	return fields, nil
+}
+
+// etagValue returns the canonical representation of v, time values are
+// converted to UTC since drivers don't agree on the location of the values
+// they return.
+func etagValue(v interface{}) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(v); !(rv.Kind() == reflect.Ptr && rv.IsNil()) {
+			if dv, err := valuer.Value(); err == nil {
+				v = dv
+			}
+		}
+	}
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "\x01"
+		}
+		rv = rv.Elem()
+		v = rv.Interface()
+	}
+	switch value := v.(type) {
+	case nil:
+		return "\x01"
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(value)
+	}
+	return fmt.Sprint(v)
+}
@@ -72,7 +72,21 @@ func GetSearchMap(e *engine.Engine, s *model.JoinTableHandler, sources ...interf
 func AddJoinRelation(table string, s *model.JoinTableHandler,
 	e *engine.Engine, source interface{},
 	destination interface{}) (*model.Expr, error) {
-	searchMap := GetSearchMap(e, s, source, destination)
+	// The keys are looked up by side, the source and the destination have the
+	// same type in self referencing relationships.
+	searchMap := map[string]interface{}{}
+	for _, side := range []struct {
+		value interface{}
+		keys  []model.JoinTableForeignKey
+	}{{source, s.Source.ForeignKeys}, {destination, s.Destination.ForeignKeys}} {
+		for _, foreignKey := range side.keys {
+			field, err := FieldByName(e, side.value, foreignKey.AssociationDBName)
+			if err != nil {
+				return nil, err
+			}
+			searchMap[foreignKey.DBName] = field.Field.Interface()
+		}
+	}
 
 	var assignColumns, binVars, conditions []string
 	var values []interface{}
@@ -97,6 +111,25 @@ func AddJoinRelation(table string, s *model.JoinTableHandler,
 	return &model.Expr{Q: sql, Args: values}, nil
 }
 
+//JoinRelationsSQL returns the query selecting the rows of the join table
+//linking the source records whose keys are sourceKeys, the values of the
+//fields referenced by h.Source.ForeignKeys. Each row has the source columns
+//followed by the destination columns.
+func JoinRelationsSQL(e *engine.Engine, h *model.JoinTableHandler, sourceKeys [][]interface{}) *model.Expr {
+	var cols []string
+	var args []interface{}
+	for _, col := range append(h.Source.DBNames(), h.Destination.DBNames()...) {
+		cols = append(cols, Quote(e, col))
+	}
+	cond := keysCondition(e, h.Source.DBNames(), sourceKeys, func(v interface{}) string {
+		args = append(args, v)
+		return e.Dialect.BindVar(len(args))
+	})
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+		strings.Join(cols, ", "), Quote(e, h.TableName), cond)
+	return &model.Expr{Q: q, Args: args}
+}
+
 // JoinWith query with `Join` conditions
 func JoinWith(handler *model.JoinTableHandler, ne *engine.Engine, source interface{}) error {
 	ne.Scope.ContextValue(source)
@@ -130,25 +163,21 @@ func JoinWith(handler *model.JoinTableHandler, ne *engine.Engine, source interfa
 
 		foreignFieldValues := util.ColumnAsArray(foreignFieldNames, ne.Scope.ValueOf())
 
-		var condString string
+		condString := "1 <> 1"
+		var condValues []interface{}
 		if len(foreignFieldValues) > 0 {
 			var quotedForeignDBNames []string
 			for _, dbName := range foreignDBNames {
 				quotedForeignDBNames = append(quotedForeignDBNames, tableName+"."+dbName)
 			}
-
-			condString = fmt.Sprintf("%v IN (%v)",
-				ToQueryCondition(ne, quotedForeignDBNames),
-				util.ToQueryMarks(foreignFieldValues))
-		} else {
-			condString = fmt.Sprintf("1 <> 1")
+			condString, condValues = KeysCondition(ne, quotedForeignDBNames, foreignFieldValues)
 		}
 
 		search.Join(ne,
 			fmt.Sprintf("INNER JOIN %v ON %v",
 				quotedTableName,
 				strings.Join(joinConditions, " AND ")))
-		search.Where(ne, condString, util.ToQueryValues(foreignFieldValues)...)
+		search.Where(ne, condString, condValues...)
 		return nil
 	}
 	return errors.New("wrong source type for join table handler")
@@ -168,6 +197,24 @@ func JoinWithQL(handler *model.JoinTableHandler, ne *engine.Engine, source inter
 		ne.Search.TableNames = append(ne.Search.TableNames, handler.TableName)
 		d := reflect.New(handler.Destination.ModelType).Interface()
 		destinationTableName := QuotedTableName(ne, d)
+
+		// ql names the columns of a query on several tables after their
+		// table, only those of the destination are selected with their own
+		// names.
+		dm, err := GetModelStruct(ne, d)
+		if err != nil {
+			return err
+		}
+		var selects []string
+		for _, f := range dm.StructFields {
+			if f.IsNormal {
+				selects = append(selects, fmt.Sprintf("%s.%s AS %s",
+					destinationTableName, Quote(ne, f.DBName), Quote(ne, f.DBName)))
+			}
+		}
+		if len(ne.Search.Selects) == 0 {
+			search.Select(ne, strings.Join(selects, ", "))
+		}
 		for _, foreignKey := range handler.Destination.ForeignKeys {
 			joinConditions = append(joinConditions, fmt.Sprintf("%v.%v = %v.%v",
 				quotedTableName,
@@ -0,0 +1,435 @@
+package scope
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ngorm/ngorm/fixture"
+	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ql"
+)
+
+// fakeResults are the results returned by the scan test driver, keyed by
+// query.
+var fakeResults = map[string]*fakeRows{}
+
+func init() {
+	sql.Register("ngorm-scan-test", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(q string) (driver.Stmt, error) { return fakeStmt{q: q}, nil }
+func (fakeConn) Close() error                          { return nil }
+func (fakeConn) Begin() (driver.Tx, error)             { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	q string
+}
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	r, ok := fakeResults[s.q]
+	if !ok {
+		return nil, errors.New("unknown query")
+	}
+	return &fakeRows{columns: r.columns, types: r.types, rows: r.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	types   []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.types) {
+		return r.types[i]
+	}
+	return ""
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+type scanned struct {
+	ID    int64
+	Name  string
+	Age   *int
+	Nick  sql.NullString
+	Born  time.Time
+	Seen  *time.Time
+	Score float64
+}
+
+// fakeQuery returns the rows of query positioned on the first row.
+func fakeQuery(t *testing.T, query string) *sql.Rows {
+	db, err := sql.Open("ngorm-scan-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatal("expected a row")
+	}
+	return rows
+}
+
+// scanRow returns the first row of query scanned into v together with the
+// extra fields.
+func scanRow(t *testing.T, query string, v *scanned, extra ...*model.Field) error {
+	rows := fakeQuery(t, query)
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := fixture.TestEngine()
+	fields, err := Fields(e, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Scan(e, rows, columns, append(fields, extra...))
+}
+
+func TestScan(t *testing.T) {
+	born := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	columns := []string{"id", "name", "age", "nick", "born", "seen", "score", "extra"}
+	fakeResults["values"] = &fakeRows{
+		columns: columns,
+		rows: [][]driver.Value{
+			{int64(1), []byte("gernest"), int64(30), "gernie", born, []byte("2017-03-02 10:00:00"), 1.5, "ignored"},
+		},
+	}
+	fakeResults["nulls"] = &fakeRows{
+		columns: columns,
+		rows: [][]driver.Value{
+			{int64(2), nil, nil, nil, nil, nil, nil, nil},
+		},
+	}
+	fakeResults["duplicate"] = &fakeRows{
+		columns: []string{"id", "name", "id"},
+		rows:    [][]driver.Value{{int64(3), "a", int64(4)}},
+	}
+	fakeResults["invalid"] = &fakeRows{
+		columns: []string{"id"},
+		rows:    [][]driver.Value{{"three"}},
+	}
+
+	var v scanned
+	err := scanRow(t, "values", &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := time.Date(2017, 3, 2, 10, 0, 0, 0, time.UTC)
+	age := 30
+	expect := scanned{
+		ID: 1, Name: "gernest", Age: &age,
+		Nick: sql.NullString{String: "gernie", Valid: true},
+		Born: born, Seen: &seen, Score: 1.5,
+	}
+	if !reflect.DeepEqual(v, expect) {
+		t.Errorf("expected %+v got %+v", expect, v)
+	}
+
+	// NULL resets the values left from the previous row.
+	err = scanRow(t, "nulls", &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = scanned{ID: 2}
+	if !reflect.DeepEqual(v, expect) {
+		t.Errorf("expected %+v got %+v", expect, v)
+	}
+
+	v = scanned{}
+	join := &model.Field{
+		StructField: &model.StructField{DBName: "id", IsNormal: true},
+		Field:       reflect.New(reflect.TypeOf(int64(0))).Elem(),
+	}
+	err = scanRow(t, "duplicate", &v, join)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 3 || join.Field.Int() != 4 {
+		t.Errorf("expected 3 and 4 got %d and %d", v.ID, join.Field.Int())
+	}
+
+	err = scanRow(t, "invalid", &v)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	fakeResults["text"] = &fakeRows{
+		columns: []string{"id", "score", "active", "born", "name", "hash", "other", "null"},
+		types:   []string{"BIGINT", "DECIMAL(10,2)", "BOOLEAN", "DATETIME", "VARCHAR", "BLOB", "JSON", "INT"},
+		rows: [][]driver.Value{{
+			[]byte("1"), []byte("1.5"), []byte("t"), []byte("2017-03-01 10:00:00"),
+			[]byte("gernest"), []byte{0xca, 0xfe}, []byte("{}"), nil,
+		}},
+	}
+	rows := fakeQuery(t, "text")
+	defer rows.Close()
+	e := fixture.TestEngine()
+	values, err := ScanValues(e, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{
+		int64(1), 1.5, true, time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC),
+		"gernest", []byte{0xca, 0xfe}, "{}", nil,
+	}
+	if !reflect.DeepEqual(values, expect) {
+		t.Errorf("expected %#v got %#v", expect, values)
+	}
+
+	fakeResults["interface"] = &fakeRows{
+		columns: []string{"id", "value"},
+		types:   []string{"INT", "FLOAT"},
+		rows:    [][]driver.Value{{int64(1), []byte("2.5")}},
+	}
+	rows = fakeQuery(t, "interface")
+	defer rows.Close()
+	var v struct {
+		ID    int64
+		Value interface{}
+	}
+	fields, err := Fields(e, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Scan(e, rows, []string{"id", "value"}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Value != 2.5 {
+		t.Errorf("expected 2.5 got %#v", v.Value)
+	}
+
+	rows = fakeQuery(t, "interface")
+	defer rows.Close()
+	e.Dialect = convertingDialect{&ql.QL{}}
+	err = Scan(e, rows, []string{"id", "value"}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Value != "FLOAT 2.5" {
+		t.Errorf("expected the value converted by the dialect got %#v", v.Value)
+	}
+}
+
+type convertingDialect struct {
+	*ql.QL
+}
+
+func (convertingDialect) ConvertValue(dbType string, v interface{}) (interface{}, error) {
+	return fmt.Sprintf("%s %s", dbType, v), nil
+}
+
+func TestScanPointers(t *testing.T) {
+	born := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	columns := []string{"s", "i", "f", "b", "t", "n", "v", "u"}
+	fakeResults["pointers"] = &fakeRows{
+		columns: columns,
+		rows: [][]driver.Value{
+			{[]byte("a"), int64(1), 1.5, int64(1), born, "b", []byte("c"), int64(2)},
+		},
+	}
+	fakeResults["nullpointers"] = &fakeRows{
+		columns: columns,
+		rows:    [][]driver.Value{{nil, nil, nil, nil, nil, nil, nil, nil}},
+	}
+	type pointers struct {
+		S *string
+		I *int64
+		F *float64
+		B *bool
+		T *time.Time
+		N *sql.NullString
+		V *[]byte
+		U *fixture.Num
+	}
+	scan := func(query string, v *pointers) {
+		t.Helper()
+		rows := fakeQuery(t, query)
+		defer rows.Close()
+		fields, err := Fields(fixture.TestEngine(), v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Scan(fixture.TestEngine(), rows, columns, fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var v pointers
+	scan("pointers", &v)
+	if v.S == nil || *v.S != "a" || v.I == nil || *v.I != 1 || v.F == nil || *v.F != 1.5 ||
+		v.B == nil || !*v.B || v.T == nil || !v.T.Equal(born) ||
+		v.N == nil || *v.N != (sql.NullString{String: "b", Valid: true}) ||
+		v.V == nil || string(*v.V) != "c" || v.U == nil || *v.U != 2 {
+		t.Errorf("expected all the pointers to be set got %+v", v)
+	}
+
+	// A new value is allocated, the previous one is left alone.
+	prev := v.S
+	scan("pointers", &v)
+	if v.S == prev || *prev != "a" {
+		t.Error("expected a newly allocated value")
+	}
+
+	scan("nullpointers", &v)
+	expect := pointers{}
+	if !reflect.DeepEqual(v, expect) {
+		t.Errorf("expected all the pointers to be nil got %+v", v)
+	}
+	if *prev != "a" {
+		t.Error("expected the previous value to be left alone")
+	}
+
+	fakeResults["scalar"] = &fakeRows{
+		columns: []string{"s"},
+		rows:    [][]driver.Value{{[]byte("a")}},
+	}
+	rows := fakeQuery(t, "scalar")
+	defer rows.Close()
+	var s *string
+	err := ScanScalar(fixture.TestEngine(), rows, reflect.ValueOf(&s).Elem())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s == nil || *s != "a" {
+		t.Errorf("expected a got %v", s)
+	}
+}
+
+type flag bool
+
+func TestScanBool(t *testing.T) {
+	fakeResults["bools"] = &fakeRows{
+		columns: []string{"a", "b", "c", "d"},
+		rows:    [][]driver.Value{{int64(1), []byte("f"), "yes", nil}},
+	}
+	rows := fakeQuery(t, "bools")
+	defer rows.Close()
+	e := fixture.TestEngine()
+	d := true
+	v := struct {
+		A bool
+		B flag
+		C *bool
+		D *bool
+	}{B: true, D: &d}
+	fields, err := Fields(e, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Scan(fixture.TestEngine(), rows, []string{"a", "b", "c", "d"}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.A || bool(v.B) || v.C == nil || !*v.C || v.D != nil {
+		t.Errorf("unexpected values %v %v %v %v", v.A, v.B, v.C, v.D)
+	}
+
+	fakeResults["badbool"] = &fakeRows{
+		columns: []string{"a"},
+		rows:    [][]driver.Value{{int64(2)}},
+	}
+	rows = fakeQuery(t, "badbool")
+	defer rows.Close()
+	err = Scan(fixture.TestEngine(), rows, []string{"a"}, fields)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestIsScalar(t *testing.T) {
+	sample := []struct {
+		v      interface{}
+		expect bool
+	}{
+		{int64(0), true},
+		{"", true},
+		{[]byte{}, true},
+		{time.Time{}, true},
+		{&time.Time{}, true},
+		{sql.NullString{}, true},
+		{fixture.Num(0), true},
+		{scanned{}, false},
+		{fixture.User{}, false},
+		{[]string{}, false},
+		{map[string]interface{}{}, false},
+	}
+	for _, v := range sample {
+		if got := IsScalar(reflect.TypeOf(v.v)); got != v.expect {
+			t.Errorf("%T: expected %v got %v", v.v, v.expect, got)
+		}
+	}
+}
+
+func TestScanColumns(t *testing.T) {
+	fakeResults["aliased"] = &fakeRows{
+		columns: []string{"id", "total_amount", "label", "extra"},
+		rows:    [][]driver.Value{{int64(1), int64(20), "a", "b"}},
+	}
+	rows := fakeQuery(t, "aliased")
+	defer rows.Close()
+	var v struct {
+		ID    int64
+		Total int64 `gorm:"SCAN:sum_total,total_amount"`
+		Name  string
+	}
+	fields, err := Fields(fixture.TestEngine(), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns, _ := rows.Columns()
+	columns, err = ScanColumns(columns, fields, map[string]string{"label": "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"id", "total", "name", "extra"}
+	if !reflect.DeepEqual(columns, expect) {
+		t.Errorf("expected %v got %v", expect, columns)
+	}
+	err = Scan(fixture.TestEngine(), rows, columns, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 1 || v.Total != 20 || v.Name != "a" {
+		t.Errorf("unexpected values %+v", v)
+	}
+
+	_, err = ScanColumns([]string{"label"}, fields, map[string]string{"label": "Title"})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
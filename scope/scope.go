@@ -7,18 +7,24 @@ package scope
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"go/ast"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jinzhu/inflection"
+	"github.com/ngorm/ngorm/dialects"
 	"github.com/ngorm/ngorm/engine"
 	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/regexes"
+	"github.com/ngorm/ngorm/types"
 	"github.com/ngorm/ngorm/util"
 )
 
@@ -32,15 +38,63 @@ import (
 // In case of a string without a dot example one it will be quoted using the
 // current dialect e.Dialect
 //
+// Results are cached per dialect since the same table and column names are
+// quoted every time a statement is built.
 func Quote(e *engine.Engine, str string) string {
+	key := newQuoteKey(e.Dialect, str)
+	cache := quoteCache.Load().(*sync.Map)
+	if q, ok := cache.Load(key); ok {
+		return q.(string)
+	}
+	var q string
 	if strings.Index(str, ".") != -1 {
 		p := strings.Split(str, ".")
 		for i := 0; i < len(p); i++ {
 			p[i] = e.Dialect.Quote(p[i])
 		}
-		return strings.Join(p, ".")
+		q = strings.Join(p, ".")
+	} else {
+		q = e.Dialect.Quote(str)
+	}
+	if _, loaded := cache.LoadOrStore(key, q); !loaded {
+		if atomic.AddInt64(&quoteCacheSize, 1) > maxQuoteCacheSize {
+			// The names of the dialects which are gone are dropped with
+			// the others.
+			quoteCache.Store(new(sync.Map))
+			atomic.StoreInt64(&quoteCacheSize, 0)
+		}
 	}
-	return e.Dialect.Quote(str)
+	return q
+}
+
+// maxQuoteCacheSize limits the number of cached quoted names, the cache is
+// cleared once it has more.
+const maxQuoteCacheSize = 10000
+
+var (
+	quoteCache     atomic.Value // *sync.Map
+	quoteCacheSize int64
+)
+
+func init() {
+	quoteCache.Store(new(sync.Map))
+}
+
+// quoteKey identifies a name quoted by a dialect. Dialects which are pointers
+// are told apart by their address, since two of them may quote differently.
+type quoteKey struct {
+	typ     reflect.Type
+	ptr     uintptr
+	dialect string
+	name    string
+}
+
+func newQuoteKey(d dialects.Dialect, name string) quoteKey {
+	key := quoteKey{typ: reflect.TypeOf(d), dialect: d.GetName(), name: name}
+	if v := reflect.ValueOf(d); v.Kind() == reflect.Ptr {
+		key.ptr = v.Pointer()
+	}
+	return key
 }
 
 //Fields extracts []*model.Fields from value, value is  a struct or
@@ -97,6 +151,10 @@ func Fields(e *engine.Engine, value interface{}) ([]*model.Field, error) {
 //
 // The value can implement engine.Tabler interface to help easily identify the
 // table name for the model.
+//
+// The fields of embedded structs, anonymous or tagged EMBEDDED, are fields of
+// the model. So are their relationships, with the foreign keys inferred from
+// the model like for its own fields.
 func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error) {
 	// Scope value can't be nil
 	if value == nil {
@@ -105,6 +163,9 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 	var refType reflect.Type
 
 	if v, ok := value.(reflect.Value); ok {
+		if !v.IsValid() {
+			return nil, errors.New("nil value")
+		}
 		refType = v.Type()
 	} else {
 		refType = reflect.ValueOf(value).Type()
@@ -142,6 +203,13 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 
 	// Get all fields
 	for i := 0; i < refType.NumField(); i++ {
+		if fStruct := refType.Field(i); fStruct.Name == "_" {
+			// The blank fields carry the tags of the model.
+			if _, ok := model.ParseTagSetting(fStruct.Tag)["READONLY"]; ok {
+				m.ReadOnly = true
+			}
+			continue
+		}
 		if fStruct := refType.Field(i); ast.IsExported(fStruct.Name) {
 			field := &model.StructField{
 				Struct:      fStruct,
@@ -174,7 +242,20 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 				}
 
 				fieldValue := reflect.New(inType).Interface()
-				if _, isScanner := fieldValue.(sql.Scanner); isScanner {
+				if _, ok := field.TagSettings["ENCRYPTED"]; ok {
+					// is encrypted into a text column
+					if !encryptable(fStruct.Type) {
+						return nil, fmt.Errorf("ngorm: encrypted field %s must be a string or []byte, "+
+							"use a serializer made with hooks.Encryption.Serializer for other types", fStruct.Name)
+					}
+					field.IsNormal = true
+				} else if name, ok := field.TagSettings["SERIALIZER"]; ok {
+					// is serialized into a single column
+					if types.SerializerFor(name) == nil {
+						return nil, fmt.Errorf("ngorm: no serializer named %s for field %s", name, fStruct.Name)
+					}
+					field.IsNormal = true
+				} else if _, isScanner := fieldValue.(sql.Scanner); isScanner {
 					// is scanner
 					field.IsScanner, field.IsNormal = true, true
 					if inType.Kind() == reflect.Struct {
@@ -203,6 +284,9 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 							m.PrimaryFields = append(m.PrimaryFields, subField)
 						}
 						m.StructFields = append(m.StructFields, subField)
+						if build := embeddedRelation(e, value, refType, &m, subField); build != nil {
+							defer build()
+						}
 					}
 					continue
 				} else {
@@ -211,11 +295,14 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 					case reflect.Slice:
 						defer func() {
 							_ = buildRelationSlice(e, value, refType, &m, field)
+							setConstraint(field)
+							setPreloadOrder(field)
 						}()
 
 					case reflect.Struct:
 						defer func() {
 							_ = buildRelationStruct(e, value, refType, &m, field)
+							setConstraint(field)
 						}()
 					default:
 						field.IsNormal = true
@@ -244,9 +331,44 @@ func GetModelStruct(e *engine.Engine, value interface{}) (*model.Struct, error)
 	return &m, nil
 }
 
+// embeddedRelation returns the function building again the relationship of
+// field, a field of an embedded struct, for the model m it is embedded in, or
+// nil when field isn't a relationship. The foreign keys are inferred from m
+// and not from the embedded struct, which usually has no primary key.
+func embeddedRelation(e *engine.Engine, value interface{}, refType reflect.Type, m *model.Struct, field *model.StructField) func() {
+	if field.IsNormal || field.IsIgnored {
+		return nil
+	}
+	field.Relationship = nil
+	typ := field.Struct.Type
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		return func() {
+			_ = buildRelationSlice(e, value, refType, m, field)
+			setConstraint(field)
+			setPreloadOrder(field)
+		}
+	case reflect.Struct:
+		return func() {
+			_ = buildRelationStruct(e, value, refType, m, field)
+			setConstraint(field)
+		}
+	}
+	return nil
+}
+
 //BuildRelationSlice builds relationship for a field of kind reflect.Slice. This
 //updates the ModelStruct m accordingly.
 //
+// The columns of many2many join tables are named after the models unless
+// named with the JOINTABLE_FOREIGNKEY and ASSOCIATION_JOINTABLE_FOREIGNKEY
+// tags, in the order of the keys
+//
+//    Students []Student `gorm:"many2many:enrollments;JOINTABLE_FOREIGNKEY:course_ref;ASSOCIATION_JOINTABLE_FOREIGNKEY:student_ref"`
+//
 //TODO: (gernest) Proper error handling.Make sure we return error, this is a lot
 //of logic and no any error should be absorbed.
 func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflect.Type, m *model.Struct, field *model.StructField) error {
@@ -259,12 +381,10 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 	)
 
 	if fk := field.TagSettings["FOREIGNKEY"]; fk != "" {
-		fks = strings.Split(field.TagSettings["FOREIGNKEY"], ",")
+		fks = splitTagList(field.TagSettings["FOREIGNKEY"])
 	}
 
-	if fk := field.TagSettings["ASSOCIATIONFOREIGNKEY"]; fk != "" {
-		associationForeignKeys = strings.Split(field.TagSettings["ASSOCIATIONFOREIGNKEY"], ",")
-	}
+	associationForeignKeys = referencedKeys(field)
 
 	for elemType.Kind() == reflect.Slice || elemType.Kind() == reflect.Ptr {
 		elemType = elemType.Elem()
@@ -274,6 +394,21 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 		if many2many := field.TagSettings["MANY2MANY"]; many2many != "" {
 			rel.Kind = "many_to_many"
 
+			// The columns of the join table are named after the models, the
+			// destination of a self referencing relationship is named after
+			// the field instead, like friend_id for Friends []User.
+			var joinTableFKs, associationJoinTableFKs []string
+			if fk := field.TagSettings["JOINTABLE_FOREIGNKEY"]; fk != "" {
+				joinTableFKs = splitTagList(fk)
+			}
+			if fk := field.TagSettings["ASSOCIATION_JOINTABLE_FOREIGNKEY"]; fk != "" {
+				associationJoinTableFKs = splitTagList(fk)
+			}
+			associationPrefix := util.ToDBName(elemType.Name())
+			if elemType == refType {
+				associationPrefix = util.ToDBName(inflection.Singular(field.Name))
+			}
+
 			// if no foreign keys defined with tag
 			if len(fks) == 0 {
 				for _, field := range m.PrimaryFields {
@@ -287,6 +422,9 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 					rel.ForeignFieldNames = append(rel.ForeignFieldNames, foreignField.DBName)
 					// join table foreign keys for source
 					joinTableDBName := util.ToDBName(refType.Name()) + "_" + foreignField.DBName
+					if i := len(rel.ForeignDBNames); i < len(joinTableFKs) {
+						joinTableDBName = joinTableFKs[i]
+					}
 					rel.ForeignDBNames = append(rel.ForeignDBNames, joinTableDBName)
 				}
 			}
@@ -310,7 +448,10 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 				// association foreign keys (db names)
 				rel.AssociationForeignFieldNames = append(rel.AssociationForeignFieldNames, field.DBName)
 				// join table foreign keys for association
-				joinTableDBName := util.ToDBName(elemType.Name()) + "_" + field.DBName
+				joinTableDBName := associationPrefix + "_" + field.DBName
+				if i := len(rel.AssociationForeignDBNames); i < len(associationJoinTableFKs) {
+					joinTableDBName = associationJoinTableFKs[i]
+				}
 				rel.AssociationForeignDBNames = append(rel.AssociationForeignDBNames, joinTableDBName)
 			}
 
@@ -410,6 +551,67 @@ func buildRelationSlice(e *engine.Engine, modelValue interface{}, refType reflec
 	return nil
 }
 
+// setConstraint sets the actions of the foreign key constraint of the
+// relationship of field from its CONSTRAINT tag, like
+// CONSTRAINT:OnDelete:CASCADE,OnUpdate:SET NULL.
+func setConstraint(field *model.StructField) {
+	rel := field.Relationship
+	if rel == nil {
+		return
+	}
+	for _, setting := range splitTagList(field.TagSettings["CONSTRAINT"]) {
+		kv := strings.SplitN(setting, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		action := strings.ToUpper(strings.Join(strings.Fields(kv[1]), " "))
+		switch strings.ToUpper(strings.TrimSpace(kv[0])) {
+		case "ONDELETE":
+			rel.OnDelete = action
+		case "ONUPDATE":
+			rel.OnUpdate = action
+		}
+	}
+}
+
+// setPreloadOrder sets the order and the maximum number of the records
+// preloaded for a has_many relationship from the ORDER and LIMIT tags of field,
+// like ORDER:created_at desc;LIMIT:10.
+func setPreloadOrder(field *model.StructField) {
+	rel := field.Relationship
+	if rel == nil || rel.Kind != "has_many" {
+		return
+	}
+	rel.Order = strings.TrimSpace(field.TagSettings["ORDER"])
+	if limit, err := strconv.Atoi(strings.TrimSpace(field.TagSettings["LIMIT"])); err == nil && limit > 0 {
+		rel.Limit = limit
+	}
+}
+
+// referencedKeys returns the keys of the ASSOCIATIONFOREIGNKEY tag of field, or
+// of its REFERENCES tag. They name the fields referenced by the foreign keys,
+// which can be unique fields other than the primary key like the Email of
+//
+//    User User `gorm:"FOREIGNKEY:UserEmail;REFERENCES:Email"`
+func referencedKeys(field *model.StructField) []string {
+	for _, tag := range []string{"ASSOCIATIONFOREIGNKEY", "REFERENCES"} {
+		if keys := field.TagSettings[tag]; keys != "" {
+			return splitTagList(keys)
+		}
+	}
+	return nil
+}
+
+// splitTagList splits the comma separated list of a tag setting, like the
+// keys of a composite foreign key FOREIGNKEY:OrgID,UserID.
+func splitTagList(setting string) []string {
+	list := strings.Split(setting, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	return list
+}
+
 //BuildRelationStruct builds relationship for a field of kind reflect.Struct . This
 //updates the ModelStruct m accordingly.
 //
@@ -433,12 +635,10 @@ func buildRelationStruct(e *engine.Engine, modelValue interface{}, refType refle
 	toFields := ms.StructFields
 
 	if fk := field.TagSettings["FOREIGNKEY"]; fk != "" {
-		tagForeignKeys = strings.Split(field.TagSettings["FOREIGNKEY"], ",")
+		tagForeignKeys = splitTagList(field.TagSettings["FOREIGNKEY"])
 	}
 
-	if fk := field.TagSettings["ASSOCIATIONFOREIGNKEY"]; fk != "" {
-		tagAssociationForeignKeys = strings.Split(field.TagSettings["ASSOCIATIONFOREIGNKEY"], ",")
-	}
+	tagAssociationForeignKeys = referencedKeys(field)
 
 	if polymorphic := field.TagSettings["POLYMORPHIC"]; polymorphic != "" {
 		// Cat has one toy, tag polymorphic is Owner, then associationType is Owner
@@ -591,6 +791,109 @@ func buildRelationStruct(e *engine.Engine, modelValue interface{}, refType refle
 	return nil
 }
 
+//RegisterProjection registers projection as a struct loading a subset of the
+//columns of the table of value. The projection is queried from that table and
+//only its columns are selected, which lets associations be preloaded without
+//loading the whole rows.
+//
+// Every column of the projection must be a column of value.
+func RegisterProjection(e *engine.Engine, projection, value interface{}) error {
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return err
+	}
+	p, err := GetModelStruct(e, projection)
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]bool)
+	for _, f := range m.StructFields {
+		if f.IsNormal && !f.IsIgnored {
+			columns[f.DBName] = true
+		}
+	}
+	for _, f := range p.StructFields {
+		if f.IsNormal && !f.IsIgnored && !columns[f.DBName] {
+			return fmt.Errorf("ngorm: %s has no column %s of the projection %s",
+				m.ModelType, f.DBName, p.ModelType)
+		}
+	}
+	table := TableNameOf(e, value)
+	return modifyModelStruct(e, projection, func(r *model.Struct) {
+		r.DefaultTableName = table
+		r.ProjectionOf = m.ModelType
+	})
+}
+
+//RegisterReadOnly makes value a read only model, creating, updating or
+//deleting it fails with errmsg.ErrReadOnly. This is the same as the READONLY
+//tag of a blank field
+//
+//    type Report struct {
+//    	_     struct{} `gorm:"READONLY"`
+//    	ID    int64
+//    	Total int64
+//    }
+func RegisterReadOnly(e *engine.Engine, value interface{}) error {
+	return modifyModelStruct(e, value, func(r *model.Struct) {
+		r.ReadOnly = true
+	})
+}
+
+// modifyModelStruct changes the stored model struct of value with fn. The
+// stored struct may be in use by other queries, so a changed copy replaces it.
+func modifyModelStruct(e *engine.Engine, value interface{}, fn func(*model.Struct)) error {
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return err
+	}
+	if !e.StructMap.Modify(m.ModelType, fn) {
+		r := *m
+		fn(&r)
+		e.StructMap.Replace(&r)
+	}
+	return nil
+}
+
+//Writable returns errmsg.ErrReadOnly when value is a read only model and
+//errmsg.ErrProjectionWrite when it is a projection, both of which can't be
+//written.
+func Writable(e *engine.Engine, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	m, err := GetModelStruct(e, value)
+	if err != nil {
+		return nil
+	}
+	if m.ReadOnly {
+		return errmsg.ErrReadOnly
+	}
+	if m.ProjectionOf != nil {
+		return errmsg.ErrProjectionWrite
+	}
+	return nil
+}
+
+//ProjectionColumns returns the columns of value to select when it is a
+//projection registered with RegisterProjection, or nil.
+func ProjectionColumns(e *engine.Engine, value interface{}) []string {
+	if value == nil {
+		return nil
+	}
+	m, err := GetModelStruct(e, value)
+	if err != nil || m.ProjectionOf == nil {
+		return nil
+	}
+	var columns []string
+	for _, f := range m.StructFields {
+		if f.IsNormal && !f.IsIgnored {
+			columns = append(columns, f.DBName)
+		}
+	}
+	return columns
+}
+
 //FieldByName returns the field in the model struct value with name name.
 //
 //TODO:(gernest) return an error when the field is not found.
@@ -668,6 +971,9 @@ func PrimaryField(e *engine.Engine, value interface{}) (*model.Field, error) {
 // what we use.
 func TableName(e *engine.Engine, value interface{}) string {
 	if e.Search != nil && len(e.Search.TableName) > 0 {
+		if name, _, ok := splitTableAlias(e.Search.TableName); ok {
+			return name
+		}
 		return e.Search.TableName
 	}
 	if e.Scope.TableName != "" {
@@ -694,6 +1000,17 @@ func TableName(e *engine.Engine, value interface{}) string {
 	return ms.DefaultTableName
 }
 
+//TableNameOf returns the table name of value like TableName, without using or
+//changing the name TableName caches in the scope of e. This allows getting
+//the tables of several models with the same engine.
+func TableNameOf(e *engine.Engine, value interface{}) string {
+	cached := e.Scope.TableName
+	e.Scope.TableName = ""
+	name := TableName(e, value)
+	e.Scope.TableName = cached
+	return name
+}
+
 //PrimaryKey returns the name of the primary key for the model value
 func PrimaryKey(e *engine.Engine, value interface{}) (string, error) {
 	pf, err := PrimaryField(e, value)
@@ -703,18 +1020,76 @@ func PrimaryKey(e *engine.Engine, value interface{}) (string, error) {
 	return pf.DBName, nil
 }
 
-//QuotedTableName  returns a quoted table name.
+//QuotedTableName  returns a quoted table name. When the table was given an
+//alias with search.Table, like "users AS u", or with search.Alias both the
+//name and the alias are quoted and the result is suitable for use in a FROM
+//clause.
 func QuotedTableName(e *engine.Engine, value interface{}) string {
 	if e.Search != nil && len(e.Search.TableName) > 0 {
+		name, alias, ok := splitTableAlias(e.Search.TableName)
+		if ok {
+			return Quote(e, name) + " AS " + Quote(e, alias)
+		}
 		if strings.Index(e.Search.TableName, " ") != -1 {
 			return e.Search.TableName
 		}
+		if e.Search.Alias != "" {
+			return Quote(e, e.Search.TableName) + " AS " + Quote(e, e.Search.Alias)
+		}
 		return Quote(e, e.Search.TableName)
 	}
-
+	if e.Search != nil && e.Search.Alias != "" {
+		return Quote(e, TableName(e, value)) + " AS " + Quote(e, e.Search.Alias)
+	}
 	return Quote(e, TableName(e, value))
 }
 
+//TableAlias returns the alias of the table set with search.Table, for instance
+//u for "users AS u" or "users u", or with search.Alias. An empty string is
+//returned when there is no alias.
+func TableAlias(e *engine.Engine) string {
+	if e.Search == nil {
+		return ""
+	}
+	if len(e.Search.TableName) > 0 {
+		if _, alias, ok := splitTableAlias(e.Search.TableName); ok {
+			return alias
+		}
+		if strings.Index(e.Search.TableName, " ") != -1 {
+			return ""
+		}
+	}
+	return e.Search.Alias
+}
+
+//QuotedTableAlias returns the quoted name that columns of the table of value
+//are qualified with. This is the alias when one is set, otherwise it is the
+//same as QuotedTableName.
+func QuotedTableAlias(e *engine.Engine, value interface{}) string {
+	if alias := TableAlias(e); alias != "" {
+		return Quote(e, alias)
+	}
+	return QuotedTableName(e, value)
+}
+
+// splitTableAlias splits table reference s of the form "name AS alias" or
+// "name alias". ok is false when s is not in one of those forms.
+func splitTableAlias(s string) (name, alias string, ok bool) {
+	p := strings.Fields(s)
+	switch {
+	case len(p) == 3 && strings.EqualFold(p[1], "AS"):
+		name, alias = p[0], p[2]
+	case len(p) == 2:
+		name, alias = p[0], p[1]
+	default:
+		return "", "", false
+	}
+	if strings.ContainsAny(name+alias, "()") {
+		return "", "", false
+	}
+	return name, alias, true
+}
+
 //AddToVars add value to e.Scope.SQLVars it returns  the positional binding of
 //the values.
 //
@@ -740,10 +1115,102 @@ func AddToVars(e *engine.Engine, value interface{}) string {
 		return expr.Q
 	}
 
-	e.Scope.SQLVars = append(e.Scope.SQLVars, value)
+	e.Scope.SQLVars = append(e.Scope.SQLVars, BindValue(e, value))
 	return e.Dialect.BindVar(len(e.Scope.SQLVars))
 }
 
+//BindValue returns the value bound in place of value by AddToVars, the values
+//of registered enums and booleans are converted for the dialect of e.
+func BindValue(e *engine.Engine, value interface{}) interface{} {
+	return boolValue(e, enumValue(value))
+}
+
+// boolValue returns the value bound in place of value, booleans are stored
+// differently depending on the dialect. Types implementing driver.Valuer are
+// left alone.
+func boolValue(e *engine.Engine, value interface{}) interface{} {
+	if _, ok := value.(driver.Valuer); ok {
+		return value
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Bool {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Bool {
+		return value
+	}
+	return dialects.BoolValue(e.Dialect, v.Bool())
+}
+
+// enumValue returns the database value of value when it is of a registered
+// enum type, or a pointer to one. Undeclared values are replaced by a
+// driver.Valuer failing with the error so the statement isn't executed.
+func enumValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return value
+	}
+	en := types.EnumFor(v.Type())
+	if en == nil && v.Kind() == reflect.Ptr {
+		en = types.EnumFor(v.Type().Elem())
+		if en == nil || v.IsNil() {
+			return value
+		}
+		v = v.Elem()
+	}
+	if en == nil {
+		return value
+	}
+	dv, err := en.Value(v.Interface())
+	if err != nil {
+		return invalidValue{err: err}
+	}
+	return dv
+}
+
+//FieldValue returns the value bound for field. Fields with the SERIALIZER tag
+//are encoded by their serializer, nil values are bound as NULL. Fields with
+//the ENCRYPTED tag are encrypted by the engine.Encrypter plugin of e.
+func FieldValue(e *engine.Engine, field *model.Field) interface{} {
+	if _, ok := field.TagSettings["ENCRYPTED"]; ok {
+		return encryptedValue(e, field)
+	}
+	name, ok := field.TagSettings["SERIALIZER"]
+	if !ok {
+		return field.Field.Interface()
+	}
+	s := types.SerializerFor(name)
+	if s == nil {
+		return invalidValue{err: fmt.Errorf("ngorm: no serializer named %s", name)}
+	}
+	if isNil(field.Field) {
+		return nil
+	}
+	dv, err := s.Serialize(field.Field.Interface())
+	if err != nil {
+		return invalidValue{err: fmt.Errorf("ngorm: can't serialize %s: %v", field.Name, err)}
+	}
+	return dv
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// invalidValue is bound in place of values which can't be sent to the
+// database.
+type invalidValue struct {
+	err error
+}
+
+func (v invalidValue) Value() (driver.Value, error) {
+	return nil, v.err
+}
+
 //HasColumn returns true if the modelValue has column of name column.
 func HasColumn(e *engine.Engine, modelValue interface{}, column string) bool {
 	ms, err := GetModelStruct(e, modelValue)
@@ -771,54 +1238,367 @@ func GetForeignField(column string, fields []*model.StructField) *model.StructFi
 	return nil
 }
 
-//Scan scans restult from the rows into fields.
-func Scan(rows *sql.Rows, columns []string, fields []*model.Field) {
-	var (
-		ignored            interface{}
-		values             = make([]interface{}, len(columns))
-		selectFields       []*model.Field
-		selectedColumnsMap = map[string]int{}
-		resetFields        = map[int]*model.Field{}
-		reflectValue       reflect.Value
-	)
+//ScanColumns returns columns with the names Scan matches against fields. A
+//column found in m is renamed to the DBName of the field named after the
+//value of m, either its Name or its DBName. A column matching no DBName is
+//renamed to the DBName of the field listing it in its SCAN tag
+//
+//    Total int64 `gorm:"SCAN:sum_total,total_amount"`
+func ScanColumns(columns []string, fields []*model.Field, m map[string]string) ([]string, error) {
+	names := make(map[string]bool)
+	for _, f := range fields {
+		if f.IsNormal {
+			names[f.DBName] = true
+		}
+	}
+	o := make([]string, len(columns))
+	for k, c := range columns {
+		o[k] = c
+		if name, ok := m[c]; ok {
+			f := fieldNamed(fields, name)
+			if f == nil {
+				return nil, fmt.Errorf("ngorm: column %s is mapped to unknown field %s", c, name)
+			}
+			o[k] = f.DBName
+			continue
+		}
+		if names[c] {
+			continue
+		}
+		for _, f := range fields {
+			if f.IsNormal && hasScanAlias(f, c) {
+				o[k] = f.DBName
+				break
+			}
+		}
+	}
+	return o, nil
+}
 
-	for index, column := range columns {
-		values[index] = &ignored
+// fieldNamed returns the normal field whose Name or DBName is name.
+func fieldNamed(fields []*model.Field, name string) *model.Field {
+	for _, f := range fields {
+		if f.IsNormal && (f.Name == name || f.DBName == name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// hasScanAlias returns true if column is listed in the SCAN tag of f.
+func hasScanAlias(f *model.Field, column string) bool {
+	aliases, ok := f.TagSettings["SCAN"]
+	if !ok {
+		return false
+	}
+	for _, alias := range strings.Split(aliases, ",") {
+		if strings.TrimSpace(alias) == column {
+			return true
+		}
+	}
+	return false
+}
 
-		selectFields = fields
-		if idx, ok := selectedColumnsMap[column]; ok {
-			selectFields = selectFields[idx+1:]
+//Unmapped returns the columns which Scan would ignore because no normal field
+//has the same DBName.
+func Unmapped(columns []string, fields []*model.Field) []string {
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.IsNormal {
+			names[f.DBName] = true
+		}
+	}
+	var o []string
+	for _, c := range columns {
+		if !names[c] {
+			o = append(o, c)
 		}
+	}
+	return o
+}
 
-		for fieldIndex, field := range selectFields {
-			if field.DBName == column {
-				if field.Field.Kind() == reflect.Ptr {
-					values[index] = field.Field.Addr().Interface()
-				} else {
-					reflectValue = reflect.New(reflect.PtrTo(field.Struct.Type))
-					reflectValue.Elem().Set(field.Field.Addr())
-					values[index] = reflectValue.Interface()
-					resetFields[index] = field
+//Scan scans the current row of rows into fields. columns are the columns of
+//rows, each is matched with the normal field having the same DBName. A column
+//selected more than once, for instance with joins, is scanned into the next
+//field with the same name. Columns without a matching field are ignored.
+//
+// NULL values set fields to their zero value, nil for pointers, unless the
+// field implements sql.Scanner in which case the field handles NULL itself.
+// Other values are scanned into a newly allocated value for pointer fields, the
+// value a pointer field pointed to before is never modified. time.Time fields
+// are parsed from strings for drivers which don't return time values, and
+// values scanned into interface{} fields are converted with
+// dialects.ConvertValue for the dialect of e.
+func Scan(e *engine.Engine, rows *sql.Rows, columns []string, fields []*model.Field) error {
+	values := make([]interface{}, len(columns))
+	set := make([]func() error, len(columns))
+	used := make(map[*model.Field]bool)
+	types, _ := rows.ColumnTypes()
+	for index, column := range columns {
+		values[index] = new(interface{})
+		for _, field := range fields {
+			if !field.IsNormal || field.DBName != column || used[field] ||
+				!field.Field.IsValid() || !field.Field.CanAddr() {
+				continue
+			}
+			used[field] = true
+			var dbType string
+			if index < len(types) {
+				dbType = types[index].DatabaseTypeName()
+			}
+			if name, ok := field.TagSettings["SERIALIZER"]; ok {
+				var v interface{}
+				f := field.Field
+				values[index], set[index] = &v, func() error {
+					return setSerialized(f, name, v)
 				}
+				break
+			}
+			values[index], set[index] = scanTarget(e, field.Field, dbType)
+			break
+		}
+	}
+	if err := rows.Scan(values...); err != nil {
+		return err
+	}
+	for _, fn := range set {
+		if fn == nil {
+			continue
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-				selectedColumnsMap[column] = fieldIndex
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
 
-				if field.IsNormal {
-					break
-				}
+//IsScalar returns true if values of typ are scanned from a single column, that
+//is basic types, []byte, time.Time, types implementing sql.Scanner and
+//pointers to them.
+func IsScalar(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return true
+	}
+	if reflect.PtrTo(typ).Implements(scannerType) {
+		if typ.Kind() != reflect.Struct {
+			return true
+		}
+		// Scan promoted from an embedded field doesn't make a model scalar.
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.Anonymous && reflect.PtrTo(f.Type).Implements(scannerType) {
+				return false
 			}
 		}
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array, reflect.Chan, reflect.Func,
+		reflect.UnsafePointer, reflect.Ptr:
+		return false
+	case reflect.Slice:
+		return typ.Elem().Kind() == reflect.Uint8
 	}
-	err := rows.Scan(values...)
+	return true
+}
+
+//ScanScalar scans the current row of rows into dest, which is a scalar as
+//reported by IsScalar. The row must have exactly one column.
+//
+// Values are converted to the type of dest, numbers which don't fit, like 300
+// into an int8 or -1 into an uint, fail instead of being truncated.
+func ScanScalar(e *engine.Engine, rows *sql.Rows, dest reflect.Value) error {
+	types, err := rows.ColumnTypes()
 	if err != nil {
-		fmt.Println(err)
+		return err
+	}
+	if len(types) != 1 {
+		names := make([]string, len(types))
+		for k, t := range types {
+			names[k] = t.Name()
+		}
+		return fmt.Errorf("ngorm: can't scan %d columns (%s) into %s, select a single column",
+			len(types), strings.Join(names, ", "), dest.Type())
 	}
+	target, set := scanTarget(e, dest, types[0].DatabaseTypeName())
+	if err := rows.Scan(target); err != nil {
+		return err
+	}
+	if set != nil {
+		return set()
+	}
+	return nil
+}
 
-	for index, field := range resetFields {
-		if v := reflect.ValueOf(values[index]).Elem().Elem(); v.IsValid() {
-			field.Field.Set(v)
+//ScanValues scans the current row of rows into a slice with a value per
+//column. Values are converted with dialects.ConvertValue for the dialect of
+//e, so that drivers returning []byte for every column give proper Go types.
+func ScanValues(e *engine.Engine, rows *sql.Rows) ([]interface{}, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(types))
+	dest := make([]interface{}, len(types))
+	for k := range values {
+		dest[k] = &values[k]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		c, err := dialects.ConvertValue(e.Dialect, types[k].DatabaseTypeName(), v)
+		if err != nil {
+			return nil, err
 		}
+		values[k] = c
 	}
+	return values, nil
+}
+
+// scanTarget returns the destination to pass to sql.Rows.Scan for field, and
+// a function to call after scanning to set the scanned value when field isn't
+// scanned directly. dbType is the database type of the column.
+func scanTarget(e *engine.Engine, field reflect.Value, dbType string) (interface{}, func() error) {
+	addr := field.Addr().Interface()
+	if _, ok := addr.(sql.Scanner); ok {
+		return addr, nil
+	}
+	typ := field.Type()
+	en := types.EnumFor(typ)
+	if en == nil && typ.Kind() == reflect.Ptr {
+		en = types.EnumFor(typ.Elem())
+	}
+	if en != nil {
+		var v interface{}
+		return &v, func() error {
+			return en.Set(field, v)
+		}
+	}
+	if typ.Kind() == reflect.Bool || (typ.Kind() == reflect.Ptr && typ.Elem().Kind() == reflect.Bool) {
+		var v interface{}
+		return &v, func() error {
+			return setBool(field, v)
+		}
+	}
+	if typ.Kind() == reflect.Interface {
+		var v interface{}
+		return &v, func() error {
+			c, err := dialects.ConvertValue(e.Dialect, dbType, v)
+			if err != nil {
+				return err
+			}
+			if c == nil {
+				field.Set(reflect.Zero(typ))
+			} else {
+				field.Set(reflect.ValueOf(c))
+			}
+			return nil
+		}
+	}
+	if typ == timeType || (typ.Kind() == reflect.Ptr && typ.Elem() == timeType) {
+		var v interface{}
+		return &v, func() error {
+			return setTime(field, v)
+		}
+	}
+	if typ.Kind() == reflect.Ptr {
+		// NULL sets the pointer to nil.
+		return addr, nil
+	}
+	ptr := reflect.New(reflect.PtrTo(typ))
+	return ptr.Interface(), func() error {
+		if ptr.Elem().IsNil() {
+			field.Set(reflect.Zero(typ))
+		} else {
+			field.Set(ptr.Elem().Elem())
+		}
+		return nil
+	}
+}
+
+// setBool sets field, which is a bool or a *bool, to the value v returned by
+// the driver.
+func setBool(field reflect.Value, v interface{}) error {
+	if v == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	b, err := dialects.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	if field.Kind() == reflect.Ptr {
+		p := reflect.New(field.Type().Elem())
+		p.Elem().SetBool(b)
+		field.Set(p)
+		return nil
+	}
+	field.SetBool(b)
+	return nil
+}
+
+// setSerialized decodes v, as returned by the driver, into field with the
+// serializer name. NULL sets the zero value.
+func setSerialized(field reflect.Value, name string, v interface{}) error {
+	s := types.SerializerFor(name)
+	if s == nil {
+		return fmt.Errorf("ngorm: no serializer named %s", name)
+	}
+	var src []byte
+	switch value := v.(type) {
+	case nil:
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case []byte:
+		src = value
+	case string:
+		src = []byte(value)
+	default:
+		return fmt.Errorf("ngorm: cannot deserialize %T", v)
+	}
+	dest := reflect.New(field.Type())
+	if err := s.Deserialize(src, dest.Interface()); err != nil {
+		return err
+	}
+	field.Set(dest.Elem())
+	return nil
+}
+
+// setTime sets field, which is a time.Time or a *time.Time, to the value v
+// returned by the driver.
+func setTime(field reflect.Value, v interface{}) error {
+	var t time.Time
+	switch value := v.(type) {
+	case nil:
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	case time.Time:
+		t = value
+	case []byte, string:
+		var err error
+		t, err = dialects.ParseTime(fmt.Sprintf("%s", value))
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("ngorm: cannot scan %T into %s", v, field.Type())
+	}
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(timeType))
+		field.Elem().Set(reflect.ValueOf(t))
+		return nil
+	}
+	field.Set(reflect.ValueOf(t))
+	return nil
 }
 
 //SetColumn sets the column value.
@@ -866,7 +1646,12 @@ func SelectAttrs(e *engine.Engine) []string {
 	if e.Scope.SelectAttrs == nil {
 		for _, value := range e.Search.Selects {
 			if str, ok := value.(string); ok {
-				e.Scope.SelectAttrs = append(e.Scope.SelectAttrs, str)
+				// Select("name, age") selects both columns.
+				for _, attr := range strings.Split(str, ",") {
+					if attr = strings.TrimSpace(attr); attr != "" {
+						e.Scope.SelectAttrs = append(e.Scope.SelectAttrs, attr)
+					}
+				}
 			} else if strs, ok := value.([]string); ok {
 				e.Scope.SelectAttrs = append(e.Scope.SelectAttrs, strs...)
 			} else if strs, ok := value.([]interface{}); ok {
@@ -881,18 +1666,28 @@ func SelectAttrs(e *engine.Engine) []string {
 
 //ChangeableField returns true if the field's value can be changed.
 func ChangeableField(e *engine.Engine, field *model.Field) bool {
+	return changeable(e, field.Name, field.DBName)
+}
+
+// changeable returns true if the column with the given names is selected, or
+// not omitted when nothing is selected.
+func changeable(e *engine.Engine, names ...string) bool {
 	if selectAttrs := SelectAttrs(e); len(selectAttrs) > 0 {
 		for _, attr := range selectAttrs {
-			if field.Name == attr || field.DBName == attr {
-				return true
+			for _, name := range names {
+				if name == attr {
+					return true
+				}
 			}
 		}
 		return false
 	}
 
 	for _, attr := range e.Search.Omits {
-		if field.Name == attr || field.DBName == attr {
-			return false
+		for _, name := range names {
+			if name == attr {
+				return false
+			}
 		}
 	}
 
@@ -911,7 +1706,7 @@ func CreateTable(e *engine.Engine, value interface{}) error {
 
 	for _, field := range m.StructFields {
 		if field.IsNormal {
-			sqlTag, err := e.Dialect.DataTypeOf(field)
+			sqlTag, err := dialects.DataTypeOf(e.Dialect, field)
 			if err != nil {
 
 				return err
@@ -923,8 +1718,12 @@ func CreateTable(e *engine.Engine, value interface{}) error {
 			if strings.Contains(strings.ToLower(sqlTag), "primary key") {
 				primaryKeyInColumnType = true
 			}
+			enc, err := dialects.ColumnEncoding(e.Dialect, field)
+			if err != nil {
+				return err
+			}
 
-			tags = append(tags, Quote(e, field.DBName)+" "+sqlTag)
+			tags = append(tags, Quote(e, field.DBName)+" "+sqlTag+util.AddExtraSpaceIfExist(enc))
 		}
 
 		if field.IsPrimaryKey {
@@ -1148,7 +1947,11 @@ func Automigrate(e *engine.Engine, value interface{}) error {
 	for _, field := range m.StructFields {
 		if !e.Dialect.HasColumn(tableName, field.DBName) {
 			if field.IsNormal {
-				sqlTag, err := e.Dialect.DataTypeOf(field)
+				sqlTag, err := dialects.DataTypeOf(e.Dialect, field)
+				if err != nil {
+					return err
+				}
+				enc, err := dialects.ColumnEncoding(e.Dialect, field)
 				if err != nil {
 					return err
 				}
@@ -1157,8 +1960,8 @@ func Automigrate(e *engine.Engine, value interface{}) error {
 				}
 				e.Scope.Exprs = append(e.Scope.Exprs,
 					&model.Expr{
-						Q: fmt.Sprintf("ALTER TABLE %v ADD %v %v;", quotedTableName,
-							Quote(e, field.DBName), sqlTag),
+						Q: fmt.Sprintf("ALTER TABLE %v ADD %v %v%v;", quotedTableName,
+							Quote(e, field.DBName), sqlTag, util.AddExtraSpaceIfExist(enc)),
 					},
 				)
 			}
@@ -1216,18 +2019,40 @@ func HasConditions(e *engine.Engine, modelValue interface{}) bool {
 //
 // That applies if the value is a struct. Any other type of values are handeled
 // by ConvertInterfaceToMap function.
+//
+// When value is a map all its keys are updated, when it is a struct only the
+// fields which aren't blank are. Columns chosen with Select are updated even
+// when blank, and the columns which aren't selected or are omitted are left
+// out.
 func UpdatedAttrsWithValues(e *engine.Engine, value interface{}) (results map[string]interface{}, hasUpdate bool) {
 	v := e.Scope.ValueOf()
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
 
+	attrs := ConvertInterfaceToMap(e, value, v.Kind() == reflect.Struct)
+	if len(SelectAttrs(e)) > 0 {
+		if fds, err := Fields(e, value); err == nil {
+			for _, field := range fds {
+				if field.IsBlank && field.IsNormal && !field.IsIgnored && ChangeableField(e, field) {
+					attrs[field.DBName] = field.Field.Interface()
+				}
+			}
+		}
+	}
+
 	if v.Kind() != reflect.Struct {
-		return ConvertInterfaceToMap(e, value, false), true
+		results = map[string]interface{}{}
+		for key, value := range attrs {
+			if changeable(e, key, util.ToDBName(key)) {
+				results[key] = value
+			}
+		}
+		return results, len(results) > 0
 	}
 
 	results = map[string]interface{}{}
-	for key, value := range ConvertInterfaceToMap(e, value, true) {
+	for key, value := range attrs {
 		field, err := FieldByName(e, e.Scope.ValueOf(), key)
 		if err != nil {
 			//TODO return error?
@@ -1245,7 +2070,7 @@ func UpdatedAttrsWithValues(e *engine.Engine, value interface{}) (results map[st
 						if err == errmsg.ErrUnaddressable {
 							results[field.DBName] = value
 						} else {
-							results[field.DBName] = field.Field.Interface()
+							results[field.DBName] = FieldValue(e, field)
 						}
 					}
 				}
@@ -1331,18 +2156,70 @@ func ConvertInterfaceToMap(e *engine.Engine, values interface{}, withIgnoredFiel
 // field provided that the field is not blank,is changeable and is not an
 // ignored field.
 //
-// Only works if the field has tag SAVE_ASSOCIATION
+// Fields for which AssociationSaving disables everything aren't saved.
 func SaveFieldAsAssociation(e *engine.Engine, field *model.Field) (bool, *model.Relationship) {
-	if ChangeableField(e, field) && !field.IsBlank && !field.IsIgnored {
-		if value, ok := field.TagSettings["SAVE_ASSOCIATIONS"]; !ok || (value != "false" && value != "skip") {
-			if relationship := field.Relationship; relationship != nil {
-				return true, relationship
-			}
+	if ChangeableField(e, field) && !field.IsBlank && !field.IsIgnored && field.Relationship != nil {
+		s := AssociationSaving(e, field)
+		if s.AutoCreate || s.AutoUpdate || s.SaveReference {
+			return true, field.Relationship
 		}
 	}
 	return false, nil
 }
 
+//AssociationSaving returns what saving the model of e does with the
+//association field. Everything is saved by default, or what is set with
+//e.AssociationSaving. The tags of the field override the default
+//
+//    Languages []Language `gorm:"many2many:user_languages;association_autoupdate:false"`
+//
+// SAVE_ASSOCIATIONS:false disables all of ASSOCIATION_AUTOCREATE,
+// ASSOCIATION_AUTOUPDATE and ASSOCIATION_SAVE_REFERENCE, which can still be
+// enabled one by one. The values set on the scope with the keys
+// model.SaveAssociations, model.AssociationAutoCreate,
+// model.AssociationAutoUpdate and model.AssociationSaveRefs take precedence
+// over the tags.
+func AssociationSaving(e *engine.Engine, field *model.Field) model.AssociationSaving {
+	s := model.AssociationSaving{AutoCreate: true, AutoUpdate: true, SaveReference: true}
+	if e.AssociationSaving != nil {
+		s = *e.AssociationSaving
+	}
+	setting := func(key, tag string) (bool, bool) {
+		if v, ok := e.Scope.Get(key); ok {
+			return truth(v), true
+		}
+		if v, ok := field.TagSettings[tag]; ok {
+			return truth(v), true
+		}
+		return false, false
+	}
+	if v, ok := setting(model.SaveAssociations, "SAVE_ASSOCIATIONS"); ok {
+		s = model.AssociationSaving{AutoCreate: v, AutoUpdate: v, SaveReference: v}
+	}
+	if v, ok := setting(model.AssociationAutoCreate, "ASSOCIATION_AUTOCREATE"); ok {
+		s.AutoCreate = v
+	}
+	if v, ok := setting(model.AssociationAutoUpdate, "ASSOCIATION_AUTOUPDATE"); ok {
+		s.AutoUpdate = v
+	}
+	if v, ok := setting(model.AssociationSaveRefs, "ASSOCIATION_SAVE_REFERENCE"); ok {
+		s.SaveReference = v
+	}
+	return s
+}
+
+// truth returns false for the false bool and the "false" and "skip" strings.
+func truth(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		b = strings.ToLower(strings.TrimSpace(b))
+		return b != "false" && b != "skip"
+	}
+	return true
+}
+
 //Initialize initializes value for e.Scope.Value There are three areas where we
 //look for values to initialize the model with.
 //
@@ -1358,6 +2235,49 @@ func Initialize(e *engine.Engine) {
 	UpdatedAttrsWithValues(e, e.Search.AssignAttrs)
 }
 
+//KeysCondition returns the condition matching the rows whose columns have the
+//values of one of keys, with ? marks for the values, and the values in order.
+//A single column is matched with IN, several columns with a condition per key
+//since not all the databases, like ql, compare tuples
+//
+//    (org_id = ? AND user_id = ?) OR (org_id = ? AND user_id = ?)
+func KeysCondition(e *engine.Engine, columns []string, keys [][]interface{}) (string, []interface{}) {
+	var values []interface{}
+	q := keysCondition(e, columns, keys, func(v interface{}) string {
+		values = append(values, v)
+		return "?"
+	})
+	return q, values
+}
+
+//KeysConditionVars is like KeysCondition with the values added to the
+//variables of e, for statements executed without a search, see AddToVars.
+func KeysConditionVars(e *engine.Engine, columns []string, keys [][]interface{}) string {
+	return keysCondition(e, columns, keys, func(v interface{}) string {
+		return AddToVars(e, v)
+	})
+}
+
+// keysCondition is KeysCondition with the marks returned by bind.
+func keysCondition(e *engine.Engine, columns []string, keys [][]interface{}, bind func(interface{}) string) string {
+	if len(columns) == 1 {
+		marks := make([]string, len(keys))
+		for i, key := range keys {
+			marks[i] = bind(key[0])
+		}
+		return fmt.Sprintf("%s IN (%s)", Quote(e, columns[0]), strings.Join(marks, ","))
+	}
+	conds := make([]string, len(keys))
+	for i, key := range keys {
+		eq := make([]string, len(columns))
+		for j, column := range columns {
+			eq[j] = fmt.Sprintf("%s = %s", Quote(e, column), bind(key[j]))
+		}
+		conds[i] = "(" + strings.Join(eq, " AND ") + ")"
+	}
+	return "(" + strings.Join(conds, " OR ") + ")"
+}
+
 func ToQueryCondition(e *engine.Engine, columns []string) string {
 	var newColumns []string
 	for _, column := range columns {
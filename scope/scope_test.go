@@ -1,11 +1,16 @@
 package scope
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/ngorm/ngorm/engine"
 	"github.com/ngorm/ngorm/fixture"
 	"github.com/ngorm/ngorm/model"
+	"github.com/ngorm/ngorm/types"
 	"github.com/ngorm/ql"
 )
 
@@ -36,6 +41,37 @@ func TestQuote(t *testing.T) {
 	}
 }
 
+// quoteDialect quotes names with its own quote.
+type quoteDialect struct {
+	*ql.QL
+	quote string
+}
+
+func (d *quoteDialect) Quote(key string) string {
+	return d.quote + key + d.quote
+}
+
+func TestQuoteDialects(t *testing.T) {
+	a := fixture.TestEngine()
+	a.Dialect = &quoteDialect{QL: ql.Memory(), quote: `"`}
+	b := fixture.TestEngine()
+	b.Dialect = &quoteDialect{QL: ql.Memory(), quote: "`"}
+	for i := 0; i < 2; i++ {
+		if q := Quote(a, "users.name"); q != `"users"."name"` {
+			t.Errorf("expected the quotes of the first dialect got %s", q)
+		}
+		if q := Quote(b, "users.name"); q != "`users`.`name`" {
+			t.Errorf("expected the quotes of the second dialect got %s", q)
+		}
+	}
+	for i := 0; i < maxQuoteCacheSize+10; i++ {
+		_ = Quote(a, fmt.Sprintf("c%d", i))
+	}
+	if n := atomic.LoadInt64(&quoteCacheSize); n > maxQuoteCacheSize {
+		t.Errorf("expected at most %d cached names got %d", maxQuoteCacheSize, n)
+	}
+}
+
 func TestQuotedTableName(t *testing.T) {
 	e := fixture.TestEngine()
 	e.Dialect = &ql.QL{}
@@ -47,6 +83,36 @@ func TestQuotedTableName(t *testing.T) {
 	}
 }
 
+func TestTableAlias(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	sample := []struct {
+		table, as, name, quoted, alias string
+	}{
+		{"users AS u", "", "users", "users AS u", "u"},
+		{"users as u", "", "users", "users AS u", "u"},
+		{"users u", "", "users", "users AS u", "u"},
+		{"users", "", "users", "users", "users"},
+		{"(SELECT * FROM users) AS u", "", "(SELECT * FROM users) AS u", "(SELECT * FROM users) AS u", "(SELECT * FROM users) AS u"},
+		{"", "u", "users", "users AS u", "u"},
+		{"people", "p", "people", "people AS p", "p"},
+		{"users AS u", "p", "users", "users AS u", "u"},
+	}
+	for _, v := range sample {
+		e.Search.TableName = v.table
+		e.Search.Alias = v.as
+		if name := TableName(e, &fixture.User{}); name != v.name {
+			t.Errorf("expected %s got %s", v.name, name)
+		}
+		if quoted := QuotedTableName(e, &fixture.User{}); quoted != v.quoted {
+			t.Errorf("expected %s got %s", v.quoted, quoted)
+		}
+		if alias := QuotedTableAlias(e, &fixture.User{}); alias != v.alias {
+			t.Errorf("expected %s got %s", v.alias, alias)
+		}
+	}
+}
+
 func TestPrimaryKey(t *testing.T) {
 	e := fixture.TestEngine()
 	e.Dialect = &ql.QL{}
@@ -104,3 +170,178 @@ func TestTableName(t *testing.T) {
 	}
 
 }
+
+func TestTableNameOf(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	e.Scope.TableName = "cached"
+	name := TableNameOf(e, &model.Model{})
+	expect := "models"
+	if name != expect {
+		t.Errorf("expected %s got %s", expect, name)
+	}
+	if e.Scope.TableName != "cached" {
+		t.Errorf("expected the cached table name to be kept got %s", e.Scope.TableName)
+	}
+	name = TableNameOf(e, &withTabler{})
+	if name != "with_tabler" {
+		t.Errorf("expected with_tabler got %s", name)
+	}
+}
+
+type pgDialect struct {
+	*ql.QL
+}
+
+func (pgDialect) GetName() string {
+	return "postgres"
+}
+
+type document struct {
+	ID   int64
+	Body string `gorm:"storage:external;compression:lz4"`
+}
+
+func TestCreateTable_encoding(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Scope = model.NewScope()
+	e.Dialect = pgDialect{ql.Memory()}
+	err := CreateTable(e, &document{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "body string STORAGE EXTERNAL COMPRESSION lz4"
+	if !strings.Contains(e.Scope.SQL, expect) {
+		t.Errorf("expected %s to contain %s", e.Scope.SQL, expect)
+	}
+
+	e = fixture.TestEngine()
+	e.Scope = model.NewScope()
+	e.Dialect = ql.Memory()
+	err = CreateTable(e, &document{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(e.Scope.SQL, "STORAGE") {
+		t.Errorf("expected no storage options got %s", e.Scope.SQL)
+	}
+}
+
+type item struct {
+	ID        int64
+	Embedding types.Vector `gorm:"dim:3"`
+}
+
+func TestCreateTable_vector(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Scope = model.NewScope()
+	e.Dialect = pgDialect{ql.Memory()}
+	err := CreateTable(e, &item{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "embedding vector(3)"
+	if !strings.Contains(e.Scope.SQL, expect) {
+		t.Errorf("expected %s to contain %s", e.Scope.SQL, expect)
+	}
+
+	e = fixture.TestEngine()
+	e.Scope = model.NewScope()
+	e.Dialect = ql.Memory()
+	err = CreateTable(e, &item{})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestKeysCondition(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	keys := [][]interface{}{{1, 2}, {3, 4}}
+	q, values := KeysCondition(e, []string{"org_id", "user_id"}, keys)
+	expect := "((org_id = ? AND user_id = ?) OR (org_id = ? AND user_id = ?))"
+	if q != expect {
+		t.Errorf("expected %s got %s", expect, q)
+	}
+	if !reflect.DeepEqual(values, []interface{}{1, 2, 3, 4}) {
+		t.Errorf("expected [1 2 3 4] got %v", values)
+	}
+	q, values = KeysCondition(e, []string{"id"}, [][]interface{}{{1}, {2}})
+	if q != "id IN (?,?)" {
+		t.Errorf("expected id IN (?,?) got %s", q)
+	}
+	if len(values) != 2 {
+		t.Errorf("expected 2 values got %v", values)
+	}
+}
+
+func TestJoinRelationsSQL(t *testing.T) {
+	e := fixture.TestEngine()
+	e.Dialect = &ql.QL{}
+	f, err := FieldByName(e, &fixture.User{}, "Languages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := f.Relationship.JoinTableHandler
+	if h == nil {
+		t.Fatal("expected a join table handler")
+	}
+	if h.TableName != "user_languages" {
+		t.Errorf("expected user_languages got %s", h.TableName)
+	}
+	expr := JoinRelationsSQL(e, h, [][]interface{}{{1}, {2}})
+	q := "SELECT user_id, language_id FROM user_languages WHERE user_id IN ($1,$2)"
+	if expr.Q != q {
+		t.Errorf("expected %s got %s", q, expr.Q)
+	}
+	if len(expr.Args) != 2 {
+		t.Errorf("expected 2 args got %v", expr.Args)
+	}
+}
+
+func BenchmarkQuote(b *testing.B) {
+	e := fixture.TestEngine()
+	e.Dialect = pgDialect{ql.Memory()}
+	columns := []string{"id", "name", "email", "users.created_at", "users.updated_at", "age"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, c := range columns {
+			_ = Quote(e, c)
+		}
+	}
+}
+
+func TestRegisterReadOnly_projection(t *testing.T) {
+	type row struct {
+		ID    int64
+		Name  string
+		Total int64
+	}
+	type summary struct {
+		ID   int64
+		Name string
+	}
+	for i := 0; i < 50; i++ {
+		e := fixture.TestEngine()
+		done := make(chan error)
+		go func() {
+			done <- RegisterProjection(e, &summary{}, &row{})
+		}()
+		go func() {
+			done <- RegisterReadOnly(e, &summary{})
+		}()
+		for k := 0; k < 2; k++ {
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		}
+		m, err := GetModelStruct(e, &summary{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.ReadOnly || m.ProjectionOf == nil {
+			t.Fatalf("expected both registrations to be kept got %v %v", m.ReadOnly, m.ProjectionOf)
+		}
+	}
+}
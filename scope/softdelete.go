@@ -0,0 +1,81 @@
+package scope
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+)
+
+var softDeleterType = reflect.TypeOf((*model.SoftDeleter)(nil)).Elem()
+
+//SoftDeleteOf returns the soft delete strategy of modelValue, see
+//model.SoftDelete. It is nil when the rows of modelValue are deleted for good.
+func SoftDeleteOf(e *engine.Engine, modelValue interface{}) model.SoftDelete {
+	if v, ok := modelValue.(reflect.Value); ok {
+		if !v.IsValid() {
+			return nil
+		}
+		modelValue = v.Interface()
+	}
+	if modelValue == nil {
+		return nil
+	}
+	t := reflect.TypeOf(modelValue)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if reflect.PtrTo(t).Implements(softDeleterType) {
+		return reflect.New(t).Interface().(model.SoftDeleter).SoftDelete()
+	}
+	ms, err := GetModelStruct(e, modelValue)
+	if err != nil {
+		return nil
+	}
+	var deletedAt bool
+	for _, field := range ms.StructFields {
+		if !field.IsNormal {
+			continue
+		}
+		if tag, ok := field.TagSettings["SOFT_DELETE"]; ok {
+			return softDeleteOfField(field, tag)
+		}
+		if field.DBName == "deleted_at" {
+			deletedAt = true
+		}
+	}
+	if deletedAt {
+		return model.DeletedAt("deleted_at")
+	}
+	return nil
+}
+
+// softDeleteOfField returns the strategy of field, which has the SOFT_DELETE
+// tag with value tag. Without a strategy named by the tag it depends on the
+// type of field.
+func softDeleteOfField(field *model.StructField, tag string) model.SoftDelete {
+	switch strings.ToLower(tag) {
+	case "flag":
+		return model.DeletedFlag(field.DBName)
+	case "unix_milli":
+		return model.DeletedAtMilli(field.DBName)
+	case "timestamp":
+		return model.DeletedAt(field.DBName)
+	}
+	t := field.Struct.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return model.DeletedFlag(field.DBName)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return model.DeletedAtMilli(field.DBName)
+	}
+	return model.DeletedAt(field.DBName)
+}
@@ -0,0 +1,97 @@
+package scope
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/model"
+)
+
+//Track records the values of the columns of value as its original values when
+//it implements model.Tracker, see model.Tracked.
+func Track(e *engine.Engine, value interface{}) error {
+	t, ok := value.(model.Tracker)
+	if !ok {
+		return nil
+	}
+	fds, err := Fields(e, value)
+	if err != nil {
+		return err
+	}
+	original := make(map[string]interface{}, len(fds))
+	for _, field := range fds {
+		if field.IsNormal && !field.IsIgnored {
+			original[field.DBName] = trackedValue(e, field)
+		}
+	}
+	t.SetOriginal(original)
+	return nil
+}
+
+//Changed returns true when the field or column name of value changed since
+//value was loaded, created or updated. It is always true when the changes of
+//value aren't tracked, see model.Tracked
+//
+//    func (u *User) BeforeUpdate(e *engine.Engine) error {
+//    	if scope.Changed(e, u, "Email") {
+//    		u.Verified = false
+//    	}
+//    	return nil
+//    }
+func Changed(e *engine.Engine, value interface{}, name string) bool {
+	t, ok := value.(model.Tracker)
+	if !ok || t.Original() == nil {
+		return true
+	}
+	field, err := FieldByName(e, value, name)
+	if err != nil {
+		return true
+	}
+	return FieldChanged(e, t.Original(), field)
+}
+
+//FieldChanged returns true when field doesn't have its value in original, the
+//values recorded by Track.
+func FieldChanged(e *engine.Engine, original map[string]interface{}, field *model.Field) bool {
+	v, ok := original[field.DBName]
+	if !ok {
+		return true
+	}
+	current := trackedValue(e, field)
+	if t, ok := v.(time.Time); ok {
+		c, ok := current.(time.Time)
+		return !ok || !c.Equal(t)
+	}
+	return !reflect.DeepEqual(v, current)
+}
+
+// trackedValue returns the value of field recorded by Track. Pointers are
+// dereferenced and byte slices copied, so that changing the values they point
+// to is a change. Serialized fields are recorded as a copy decoded from their
+// encoding for the same reason, the encodings themselves can differ for equal
+// values, like the ones of maps with gob or of encrypted values.
+func trackedValue(e *engine.Engine, field *model.Field) interface{} {
+	if name, ok := field.TagSettings["SERIALIZER"]; ok {
+		dv := FieldValue(e, field)
+		if _, invalid := dv.(invalidValue); invalid || dv == nil {
+			return dv
+		}
+		c := reflect.New(field.Field.Type()).Elem()
+		if err := setSerialized(c, name, dv); err != nil {
+			return dv
+		}
+		return c.Interface()
+	}
+	v := field.Field
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return append([]byte(nil), v.Bytes()...)
+	}
+	return v.Interface()
+}
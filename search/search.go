@@ -3,8 +3,11 @@ package search
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/ngorm/ngorm/clause"
 	"github.com/ngorm/ngorm/engine"
+	"github.com/ngorm/ngorm/errmsg"
 	"github.com/ngorm/ngorm/model"
 	"github.com/ngorm/ngorm/regexes"
 	"github.com/ngorm/ngorm/util"
@@ -15,6 +18,17 @@ func Where(e *engine.Engine, query interface{}, values ...interface{}) {
 	e.Search.WhereConditions = append(e.Search.WhereConditions, map[string]interface{}{"query": query, "args": values})
 }
 
+//WhereStruct adds WHERE condition from the fields of struct value. Like Where,
+//fields with zero values are ignored unless they are listed in include, either
+//by field name or by database name, which allows conditions like
+//
+//  search.WhereStruct(e, &User{Age: 0}, "Age")
+func WhereStruct(e *engine.Engine, value interface{}, include ...string) {
+	e.Search.WhereConditions = append(e.Search.WhereConditions, map[string]interface{}{
+		"query": value, "args": []interface{}{}, "include": include,
+	})
+}
+
 //Not adds NOT search condition
 func Not(e *engine.Engine, query interface{}, values ...interface{}) {
 	e.Search.NotConditions = append(e.Search.NotConditions, map[string]interface{}{"query": query, "args": values})
@@ -69,14 +83,30 @@ func Offset(e *engine.Engine, offset interface{}) {
 	e.Search.Offset = offset
 }
 
-//Group  add GROUP BY search condition.
+//Group  add GROUP BY search condition. Calling Group multiple times groups by
+//all the given columns in order.
+//
+// query is either a string of comma separated column names, a column position
+// or a *model.Expr for grouping by expressions. Column names are validated and
+// quoted when the statement is built, use *model.Expr for anything else. The
+// expressions come after the columns in the GROUP BY clause.
 func Group(e *engine.Engine, query interface{}) error {
-	s, err := util.GetInterfaceAsSQL(query)
-	if err != nil {
-		return err
-
+	var group string
+	switch value := query.(type) {
+	case *model.Expr:
+		e.Search.GroupExprs = append(e.Search.GroupExprs, value)
+		return nil
+	case string:
+		group = value
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		group = fmt.Sprint(value)
+	default:
+		return errmsg.ErrInvalidSQL
 	}
-	e.Search.Group = s
+	if e.Search.Group != "" {
+		group = e.Search.Group + "," + group
+	}
+	e.Search.Group = group
 	return nil
 }
 
@@ -90,6 +120,34 @@ func Join(e *engine.Engine, query interface{}, values ...interface{}) {
 	e.Search.JoinConditions = append(e.Search.JoinConditions, map[string]interface{}{"query": query, "args": values})
 }
 
+//Alias sets the alias of the table of the search, columns are then qualified
+//with the alias. An alias given with Table, like "users AS u", takes
+//precedence.
+func Alias(e *engine.Engine, alias string) {
+	e.Search.Alias = alias
+}
+
+//Timeout bounds the statements executed for the search to d, they are
+//canceled and fail with context.DeadlineExceeded when it is over. The
+//deadline starts with the first statement and covers all the statements of
+//the operation.
+func Timeout(e *engine.Engine, d time.Duration) {
+	e.Search.Timeout = d
+}
+
+//MapColumns maps the columns of the query results to fields, keys are column
+//names and values are field names or DBNames. This is for queries aliasing
+//columns differently from the DBNames of the destination, mappings are added
+//to the ones given before.
+func MapColumns(e *engine.Engine, m map[string]string) {
+	if e.Search.ColumnMap == nil {
+		e.Search.ColumnMap = make(map[string]string)
+	}
+	for column, field := range m {
+		e.Search.ColumnMap[column] = field
+	}
+}
+
 //Preload add preloading condition
 func Preload(e *engine.Engine, schema string, values ...interface{}) {
 	var preloads []model.SearchPreload
@@ -102,12 +160,24 @@ func Preload(e *engine.Engine, schema string, values ...interface{}) {
 	e.Search.Preload = preloads
 }
 
+//JoinPreload adds the has_one or belongs_to association column to the
+//associations loaded with a LEFT JOIN in the query.
+func JoinPreload(e *engine.Engine, column string) {
+	for _, c := range e.Search.JoinPreload {
+		if c == column {
+			return
+		}
+	}
+	e.Search.JoinPreload = append(e.Search.JoinPreload, column)
+}
+
 //Raw set the seacrh query to RAw
 func Raw(e *engine.Engine, b bool) {
 	e.Search.Raw = b
 }
 
-//Unscoped set the search scope status
+//Unscoped set the search scope status. An unscoped search doesn't filter out
+//soft deleted rows and deletes rows for good instead of soft deleting them.
 func Unscoped(e *engine.Engine, b bool) {
 	e.Search.Unscoped = b
 }
@@ -117,9 +187,89 @@ func Table(e *engine.Engine, name string) {
 	e.Search.TableName = name
 }
 
+//From adds tables which the conditions can reference besides the table of the
+//model. Queries select from all of them, UPDATE and DELETE statements are
+//translated by the dialect, see dialects.UpdateFrom and dialects.DeleteUsing.
+func From(e *engine.Engine, tables ...string) {
+	e.Search.TableNames = append(e.Search.TableNames, tables...)
+}
+
 //Inline add Where clause if any.
 func Inline(e *engine.Engine, values ...interface{}) {
 	if len(values) > 0 {
 		Where(e, values[0], values[1:]...)
 	}
 }
+
+//In adds WHERE column IN (values) condition.
+func In(e *engine.Engine, column string, values interface{}) {
+	Where(e, clause.In(column, values))
+}
+
+//NotIn adds WHERE column NOT IN (values) condition.
+func NotIn(e *engine.Engine, column string, values interface{}) {
+	Where(e, clause.NotIn(column, values))
+}
+
+//Between adds WHERE column BETWEEN lower AND upper condition.
+func Between(e *engine.Engine, column string, lower, upper interface{}) {
+	Where(e, clause.Between(column, lower, upper))
+}
+
+//IsNull adds WHERE column IS NULL condition.
+func IsNull(e *engine.Engine, column string) {
+	Where(e, clause.IsNull(column))
+}
+
+//IsNotNull adds WHERE column IS NOT NULL condition.
+func IsNotNull(e *engine.Engine, column string) {
+	Where(e, clause.IsNotNull(column))
+}
+
+//Gt adds WHERE column > value condition.
+func Gt(e *engine.Engine, column string, value interface{}) {
+	Where(e, clause.Gt(column, value))
+}
+
+//Gte adds WHERE column >= value condition.
+func Gte(e *engine.Engine, column string, value interface{}) {
+	Where(e, clause.Gte(column, value))
+}
+
+//Lt adds WHERE column < value condition.
+func Lt(e *engine.Engine, column string, value interface{}) {
+	Where(e, clause.Lt(column, value))
+}
+
+//Lte adds WHERE column <= value condition.
+func Lte(e *engine.Engine, column string, value interface{}) {
+	Where(e, clause.Lte(column, value))
+}
+
+//TupleIn adds WHERE (columns...) IN ((values...),...) condition.
+func TupleIn(e *engine.Engine, columns []string, values interface{}) {
+	Where(e, clause.TupleIn(columns, values))
+}
+
+//Exists adds WHERE EXISTS (subquery) condition, where the subquery is the
+//search built on sub for value.
+func Exists(e, sub *engine.Engine, value interface{}) {
+	Where(e, clause.Exists(&model.SubQuery{Search: sub.Search, Value: value}))
+}
+
+//NotExists adds WHERE NOT EXISTS (subquery) condition.
+func NotExists(e, sub *engine.Engine, value interface{}) {
+	Where(e, clause.NotExists(&model.SubQuery{Search: sub.Search, Value: value}))
+}
+
+//WhereNamed adds WHERE condition with :name placeholders bound to the fields
+//of params. See clause.Named for details.
+func WhereNamed(e *engine.Engine, query string, params interface{}) {
+	Where(e, clause.Named(query, params))
+}
+
+//Clause adds the custom clause registered with builder.RegisterClause under
+//name. value is passed to the clause builder.
+func Clause(e *engine.Engine, name string, value interface{}) {
+	e.Search.Clauses = append(e.Search.Clauses, model.SearchClause{Name: name, Value: value})
+}
@@ -0,0 +1,110 @@
+package ngorm
+
+import (
+	"context"
+
+	"github.com/ngorm/ngorm/errmsg"
+	"github.com/ngorm/ngorm/model"
+)
+
+//BeginTx starts a database transaction. All operations performed through the
+//returned *DB are executed inside the transaction, which must be finished by
+//calling Commit or Rollback.
+//
+// Nested transactions are not supported, calling BeginTx on a *DB that is
+// already in a transaction returns errmsg.ErrInvalidTransaction.
+func (db *DB) BeginTx() (*DB, error) {
+	if db.tx != nil {
+		return nil, errmsg.ErrInvalidTransaction
+	}
+	// The transaction is bound to the context, it is rolled back when the
+	// context is canceled.
+	ctx := db.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The transaction keeps all the settings of db.
+	ndb := db.clone()
+	ndb.db = db.db.Wrap(&model.Tx{Tx: tx})
+	ndb.tx = ndb.db.SQLCommon.(*model.Tx)
+	ndb.e = ndb.NewEngine()
+	return ndb, nil
+}
+
+//Commit commits the transaction. Listeners registered with OnCommit are
+//notified with the tables that were modified by the transaction, then the
+//functions registered with AfterCommit are called.
+//
+// If the commit fails the functions registered with AfterRollback are called
+// instead.
+func (db *DB) Commit() error {
+	if db.tx == nil {
+		return errmsg.ErrInvalidTransaction
+	}
+	if err := db.tx.Commit(); err != nil {
+		db.tx.RolledBack()
+		return err
+	}
+	if db.listeners != nil {
+		db.listeners.Notify(db.tx.Tables())
+	}
+	db.tx.Committed()
+	return nil
+}
+
+//Rollback aborts the transaction and calls the functions registered with
+//AfterRollback.
+func (db *DB) Rollback() error {
+	if db.tx == nil {
+		return errmsg.ErrInvalidTransaction
+	}
+	if err := db.tx.Rollback(); err != nil {
+		return err
+	}
+	db.tx.RolledBack()
+	return nil
+}
+
+//AfterCommit registers fn to be called after the transaction is successfully
+//committed. Use this for side effects like sending emails or publishing
+//events which must not happen when the transaction is rolled back.
+//
+// This returns errmsg.ErrInvalidTransaction if db is not in a transaction.
+func (db *DB) AfterCommit(fn func()) error {
+	if db.tx == nil {
+		return errmsg.ErrInvalidTransaction
+	}
+	db.tx.AfterCommit(fn)
+	return nil
+}
+
+//AfterRollback registers fn to be called after the transaction is rolled
+//back.
+//
+// This returns errmsg.ErrInvalidTransaction if db is not in a transaction.
+func (db *DB) AfterRollback(fn func()) error {
+	if db.tx == nil {
+		return errmsg.ErrInvalidTransaction
+	}
+	db.tx.AfterRollback(fn)
+	return nil
+}
+
+//OnCommit registers fn to be called with the names of the tables modified by
+//insert, update and delete statements once they are committed.
+//
+// Statements executed outside of a transaction are reported as soon as they
+// are executed, while statements executed in a transaction are reported
+// together only after the transaction is committed. Nothing is reported for
+// transactions that are rolled back, which makes this suitable for
+// invalidating external caches.
+func (db *DB) OnCommit(fn func(tables []string)) {
+	if db.listeners == nil {
+		db.listeners = &model.Listeners{}
+	}
+	db.listeners.Add(fn)
+}
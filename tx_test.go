@@ -0,0 +1,127 @@
+package ngorm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ngorm/ngorm/errmsg"
+)
+
+func TestDB_Transaction(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBTransaction, &Foo{})
+	}
+}
+
+func testDBTransaction(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var touched [][]string
+	db.OnCommit(func(tables []string) {
+		touched = append(touched, tables)
+	})
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&Foo{Stuff: "transaction"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(touched) != 0 {
+		t.Fatalf("expected no notifications before commit got %v", touched)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := [][]string{{"foos"}}
+	if !reflect.DeepEqual(touched, expect) {
+		t.Errorf("expected %v got %v", expect, touched)
+	}
+
+	touched = nil
+	tx, err = db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Create(&Foo{Stuff: "rolled back"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(touched) != 0 {
+		t.Errorf("expected no notifications after rollback got %v", touched)
+	}
+	var count int
+	err = db.Model(&Foo{}).Count(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 got %d", count)
+	}
+
+	err = db.Create(&Foo{Stuff: "no transaction"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(touched, expect) {
+		t.Errorf("expected %v got %v", expect, touched)
+	}
+}
+
+func TestDB_AfterCommit(t *testing.T) {
+	for _, d := range allTestDB() {
+		runWrapDB(t, d, testDBAfterCommit, &Foo{})
+	}
+}
+
+func testDBAfterCommit(t *testing.T, db *DB) {
+	_, err := db.Automigrate(&Foo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AfterCommit(func() {})
+	if err != errmsg.ErrInvalidTransaction {
+		t.Errorf("expected %v got %v", errmsg.ErrInvalidTransaction, err)
+	}
+	var events []string
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.AfterCommit(func() { events = append(events, "commit") })
+	_ = tx.AfterRollback(func() { events = append(events, "rollback") })
+	err = tx.Create(&Foo{Stuff: "after commit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events before commit got %v", events)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = db.BeginTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.AfterCommit(func() { events = append(events, "commit") })
+	_ = tx.AfterRollback(func() { events = append(events, "rollback") })
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"commit", "rollback"}
+	if !reflect.DeepEqual(events, expect) {
+		t.Errorf("expected %v got %v", expect, events)
+	}
+}
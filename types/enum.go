@@ -0,0 +1,181 @@
+package types
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+//Enum maps the declared values of a Go enum type to the values stored in the
+//database. It is used by ngorm when binding and scanning values of the type,
+//so the type doesn't need to implement driver.Valuer and sql.Scanner.
+type Enum struct {
+	typ     reflect.Type
+	dbType  reflect.Type
+	values  map[interface{}]interface{}
+	byValue map[interface{}]reflect.Value
+}
+
+var enums = struct {
+	mu sync.RWMutex
+	m  map[reflect.Type]*Enum
+}{m: make(map[reflect.Type]*Enum)}
+
+var (
+	stringType = reflect.TypeOf("")
+	int64Type  = reflect.TypeOf(int64(0))
+)
+
+//RegisterEnum registers an enum type, values maps each declared value of the
+//type to the value stored in the database. The keys must all be of the same
+//type based on an integer or a string, the values must be all strings or all
+//integers.
+//
+//    type Status int
+//
+//    const (
+//    	Active Status = iota
+//    	Banned
+//    )
+//
+//    types.RegisterEnum(map[interface{}]interface{}{
+//    	Active: "active",
+//    	Banned: "banned",
+//    })
+//
+// Registering a type again replaces its declared values. Binding or scanning a
+// value which isn't declared fails.
+func RegisterEnum(values map[interface{}]interface{}) error {
+	if len(values) == 0 {
+		return errors.New("ngorm: enum without values")
+	}
+	en := &Enum{
+		values:  make(map[interface{}]interface{}),
+		byValue: make(map[interface{}]reflect.Value),
+	}
+	for k, v := range values {
+		typ := reflect.TypeOf(k)
+		if en.typ == nil {
+			if !isEnumKind(typ.Kind()) {
+				return fmt.Errorf("ngorm: enum type %s must be based on an integer or a string", typ)
+			}
+			en.typ = typ
+		} else if typ != en.typ {
+			return fmt.Errorf("ngorm: enum values of different types %s and %s", en.typ, typ)
+		}
+		dv, dbType, err := normalize(v)
+		if err != nil {
+			return err
+		}
+		if en.dbType == nil {
+			en.dbType = dbType
+		} else if dbType != en.dbType {
+			return fmt.Errorf("ngorm: enum %s is stored both as %s and %s", en.typ, en.dbType, dbType)
+		}
+		if _, ok := en.byValue[dv]; ok {
+			return fmt.Errorf("ngorm: enum %s stores %v more than once", en.typ, v)
+		}
+		en.values[k] = dv
+		en.byValue[dv] = reflect.ValueOf(k)
+	}
+	enums.mu.Lock()
+	enums.m[en.typ] = en
+	enums.mu.Unlock()
+	return nil
+}
+
+//EnumFor returns the enum registered for typ, or nil when typ isn't a
+//registered enum type.
+func EnumFor(typ reflect.Type) *Enum {
+	enums.mu.RLock()
+	defer enums.mu.RUnlock()
+	return enums.m[typ]
+}
+
+func isEnumKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.String:
+		return true
+	}
+	return false
+}
+
+// normalize returns the database value v as a string or an int64.
+func normalize(v interface{}) (interface{}, reflect.Type, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), stringType, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), int64Type, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), int64Type, nil
+	}
+	return nil, nil, fmt.Errorf("ngorm: enum values must be stored as strings or integers, got %T", v)
+}
+
+//Type returns the Go type of the enum.
+func (en *Enum) Type() reflect.Type {
+	return en.typ
+}
+
+//DBType returns the type of the values stored in the database, string or
+//int64.
+func (en *Enum) DBType() reflect.Type {
+	return en.dbType
+}
+
+//Value returns the database value of v, which is of the enum type.
+func (en *Enum) Value(v interface{}) (driver.Value, error) {
+	dv, ok := en.values[v]
+	if !ok {
+		return nil, fmt.Errorf("ngorm: %v is not a declared value of enum %s", v, en.typ)
+	}
+	return dv, nil
+}
+
+//Set sets field, of the enum type or a pointer to it, to the value matching
+//src as returned by the driver. NULL sets the zero value.
+func (en *Enum) Set(field reflect.Value, src interface{}) error {
+	if src == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	var key interface{}
+	switch value := src.(type) {
+	case []byte:
+		key = string(value)
+	case string:
+		key = value
+	case int64:
+		key = value
+	default:
+		return fmt.Errorf("ngorm: cannot scan %T into enum %s", src, en.typ)
+	}
+	if s, ok := key.(string); ok && en.dbType == int64Type {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ngorm: cannot scan %q into enum %s", s, en.typ)
+		}
+		key = n
+	} else if n, ok := key.(int64); ok && en.dbType == stringType {
+		key = strconv.FormatInt(n, 10)
+	}
+	v, ok := en.byValue[key]
+	if !ok {
+		return fmt.Errorf("ngorm: %v is not a declared value of enum %s", key, en.typ)
+	}
+	if field.Kind() == reflect.Ptr {
+		p := reflect.New(en.typ)
+		p.Elem().Set(v)
+		field.Set(p)
+		return nil
+	}
+	field.Set(v)
+	return nil
+}
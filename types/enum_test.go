@@ -0,0 +1,91 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+type color int
+
+type size string
+
+func TestEnum(t *testing.T) {
+	err := RegisterEnum(map[interface{}]interface{}{
+		color(0): "red",
+		color(1): "green",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RegisterEnum(map[interface{}]interface{}{
+		size("small"): 1,
+		size("large"): 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	en := EnumFor(reflect.TypeOf(color(0)))
+	if en == nil || en.DBType() != stringType {
+		t.Fatalf("expected a string enum got %v", en)
+	}
+	v, err := en.Value(color(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "green" {
+		t.Errorf("expected green got %v", v)
+	}
+	if _, err = en.Value(color(2)); err == nil {
+		t.Error("expected an error")
+	}
+	var c color
+	err = en.Set(reflect.ValueOf(&c).Elem(), []byte("green"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != 1 {
+		t.Errorf("expected 1 got %d", c)
+	}
+	var p *color
+	err = en.Set(reflect.ValueOf(&p).Elem(), "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil || *p != 0 {
+		t.Errorf("expected red got %v", p)
+	}
+	if err = en.Set(reflect.ValueOf(&c).Elem(), "blue"); err == nil {
+		t.Error("expected an error")
+	}
+
+	en = EnumFor(reflect.TypeOf(size("")))
+	if en == nil || en.DBType() != int64Type {
+		t.Fatalf("expected an integer enum got %v", en)
+	}
+	var s size
+	for _, src := range []interface{}{int64(2), []byte("2")} {
+		err = en.Set(reflect.ValueOf(&s).Elem(), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != "large" {
+			t.Errorf("expected large got %s", s)
+		}
+	}
+
+	for _, values := range []map[interface{}]interface{}{
+		nil,
+		{1.5: "a"},
+		{color(0): "a", size("b"): "b"},
+		{color(0): "a", color(1): 1},
+		{color(0): "a", color(1): "a"},
+		{color(0): 1.5},
+	} {
+		if err := RegisterEnum(values); err == nil {
+			t.Errorf("expected an error for %v", values)
+		}
+	}
+	if EnumFor(reflect.TypeOf(0)) != nil {
+		t.Error("expected int not to be an enum")
+	}
+}
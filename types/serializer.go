@@ -0,0 +1,114 @@
+package types
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+//Serializer encodes values of any Go type into a single column. Fields using
+//a serializer are chosen with the SERIALIZER tag, they are encoded when they
+//are bound and decoded when they are scanned
+//
+//    type Profile struct {
+//    	ID       int64
+//    	Settings map[string]string `gorm:"SERIALIZER:json"`
+//    }
+//
+// The json and gob serializers are registered by default.
+type Serializer interface {
+	//DBType returns the type of the encoded values, string for text columns
+	//or []byte for blob columns.
+	DBType() reflect.Type
+
+	//Serialize encodes v, which is never nil.
+	Serialize(v interface{}) (driver.Value, error)
+
+	//Deserialize decodes src into dest, a pointer to the field.
+	Deserialize(src []byte, dest interface{}) error
+}
+
+var serializers = struct {
+	mu sync.RWMutex
+	m  map[string]Serializer
+}{m: map[string]Serializer{
+	"json": JSON{},
+	"gob":  Gob{},
+}}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+//RegisterSerializer registers s under name, which is the value of the
+//SERIALIZER tag of the fields using it. Names are case insensitive,
+//registering a name again replaces its serializer.
+func RegisterSerializer(name string, s Serializer) error {
+	if name == "" || s == nil {
+		return errors.New("ngorm: serializer without a name")
+	}
+	switch s.DBType() {
+	case stringType, bytesType:
+	default:
+		return errors.New("ngorm: serializer " + name + " must store strings or []byte")
+	}
+	serializers.mu.Lock()
+	serializers.m[strings.ToLower(name)] = s
+	serializers.mu.Unlock()
+	return nil
+}
+
+//SerializerFor returns the serializer registered under name, or nil when
+//there is none.
+func SerializerFor(name string) Serializer {
+	serializers.mu.RLock()
+	defer serializers.mu.RUnlock()
+	return serializers.m[strings.ToLower(strings.TrimSpace(name))]
+}
+
+//JSON stores values as JSON text.
+type JSON struct{}
+
+//DBType implements Serializer.
+func (JSON) DBType() reflect.Type {
+	return stringType
+}
+
+//Serialize implements Serializer.
+func (JSON) Serialize(v interface{}) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+//Deserialize implements Serializer.
+func (JSON) Deserialize(src []byte, dest interface{}) error {
+	return json.Unmarshal(src, dest)
+}
+
+//Gob stores values encoded with encoding/gob in blob columns.
+type Gob struct{}
+
+//DBType implements Serializer.
+func (Gob) DBType() reflect.Type {
+	return bytesType
+}
+
+//Serialize implements Serializer.
+func (Gob) Serialize(v interface{}) (driver.Value, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//Deserialize implements Serializer.
+func (Gob) Deserialize(src []byte, dest interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(src)).Decode(dest)
+}
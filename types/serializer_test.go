@@ -0,0 +1,45 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSerializer(t *testing.T) {
+	for _, name := range []string{"json", "JSON", "gob"} {
+		s := SerializerFor(name)
+		if s == nil {
+			t.Fatalf("expected a serializer for %s", name)
+		}
+		v, err := s.Serialize(map[string]int{"a": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var src []byte
+		switch value := v.(type) {
+		case string:
+			src = []byte(value)
+		case []byte:
+			src = value
+		}
+		var got map[string]int
+		if err = s.Deserialize(src, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, map[string]int{"a": 1}) {
+			t.Errorf("%s: expected map[a:1] got %v", name, got)
+		}
+	}
+	if SerializerFor("yaml") != nil {
+		t.Error("expected no serializer for yaml")
+	}
+	if err := RegisterSerializer("text", textSerializer{}); err == nil {
+		t.Error("expected an error for a serializer storing ints")
+	}
+}
+
+type textSerializer struct{ JSON }
+
+func (textSerializer) DBType() reflect.Type {
+	return int64Type
+}
@@ -0,0 +1,110 @@
+// Package types provides column types which are not covered by the standard
+// library.
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ngorm/ngorm/clause"
+)
+
+//Vector is an embedding stored in a pgvector vector column. The dimension of
+//the column is set with the DIM tag
+//
+//  type Item struct {
+//  	ID        int64
+//  	Embedding types.Vector `gorm:"dim:3"`
+//  }
+type Vector []float32
+
+//Value implements driver.Valuer, the vector is sent in its text form, for
+//instance [1,2,3].
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return v.String(), nil
+}
+
+//Scan implements sql.Scanner.
+func (v *Vector) Scan(src interface{}) error {
+	var s string
+	switch value := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		s = value
+	case []byte:
+		s = string(value)
+	default:
+		return fmt.Errorf("ngorm: cannot scan %T into Vector", src)
+	}
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return fmt.Errorf("ngorm: invalid vector %q", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	o := Vector{}
+	if s != "" {
+		for _, p := range strings.Split(s, ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+			if err != nil {
+				return fmt.Errorf("ngorm: invalid vector element %q", p)
+			}
+			o = append(o, float32(f))
+		}
+	}
+	*v = o
+	return nil
+}
+
+func (v Vector) String() string {
+	parts := make([]string, len(v))
+	for k, f := range v {
+		parts[k] = strconv.FormatFloat(float64(f), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+//Metric is the distance function used to compare vectors. The value is the
+//pgvector operator.
+type Metric string
+
+//Supported distance metrics.
+const (
+	L2           Metric = "<->"
+	InnerProduct Metric = "<#>"
+	Cosine       Metric = "<=>"
+	L1           Metric = "<+>"
+)
+
+//OrderByDistance returns an expression which can be passed to Order to sort
+//rows by their distance to v, closest first.
+//
+//  db.Order(types.OrderByDistance("embedding", v, types.Cosine)).Limit(5).Find(&items)
+//
+// The column, optionally qualified like items.embedding, is quoted for the
+// dialect. Building the statement fails when metric isn't one of the metrics
+// defined here.
+func OrderByDistance(column string, v Vector, metric Metric) clause.Expression {
+	return distance{column: column, v: v, metric: metric}
+}
+
+type distance struct {
+	column string
+	v      Vector
+	metric Metric
+}
+
+func (d distance) Build(b clause.Builder) (string, error) {
+	switch d.metric {
+	case L2, InnerProduct, Cosine, L1:
+	default:
+		return "", fmt.Errorf("ngorm: unknown vector metric %q", string(d.metric))
+	}
+	return fmt.Sprintf("%s %s %s", b.Quote(d.column), d.metric, b.AddToVars(d.v)), nil
+}
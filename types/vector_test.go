@@ -0,0 +1,88 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ngorm/ngorm/model"
+)
+
+func TestVector(t *testing.T) {
+	v := Vector{1, 0.5, -2}
+	dv, err := v.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "[1,0.5,-2]"
+	if dv != expect {
+		t.Errorf("expected %s got %v", expect, dv)
+	}
+	var o Vector
+	err = o.Scan([]byte(" [1, 0.5,-2] "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o, v) {
+		t.Errorf("expected %v got %v", v, o)
+	}
+	for _, src := range []interface{}{"1,2", "[1,a]", 10} {
+		if err := o.Scan(src); err == nil {
+			t.Errorf("expected an error for %v", src)
+		}
+	}
+	err = o.Scan(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != nil {
+		t.Errorf("expected nil got %v", o)
+	}
+
+	b := &testBuilder{}
+	q, err := OrderByDistance("embedding", v, Cosine).Build(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != `"embedding" <=> $1` || !reflect.DeepEqual(b.vars, []interface{}{v}) {
+		t.Errorf("unexpected expression %s %v", q, b.vars)
+	}
+	q, err = OrderByDistance(`items.em"b`, v, L2).Build(&testBuilder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != `"items"."em""b" <-> $1` {
+		t.Errorf("unexpected expression %s", q)
+	}
+	_, err = OrderByDistance("embedding", v, Metric("; DROP TABLE items; --")).Build(&testBuilder{})
+	if err == nil {
+		t.Error("expected an error for an unknown metric")
+	}
+}
+
+// testBuilder is a clause.Builder quoting like postgres.
+type testBuilder struct {
+	vars []interface{}
+}
+
+func (b *testBuilder) Quote(column string) string {
+	parts := strings.Split(column, ".")
+	for k, p := range parts {
+		parts[k] = `"` + strings.Replace(p, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+func (b *testBuilder) AddToVars(value interface{}) string {
+	b.vars = append(b.vars, value)
+	return fmt.Sprintf("$%d", len(b.vars))
+}
+
+func (b *testBuilder) RowValues() bool {
+	return true
+}
+
+func (b *testBuilder) SubQuery(q *model.SubQuery) (string, error) {
+	return "", nil
+}